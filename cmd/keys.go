@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+)
+
+// parseTime parses either an RFC 3339 timestamp or a duration from now.
+func parseTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(d), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// policyFlags adds flags for all auth.PolicySettings to the given FlagSet,
+// setting them in the given Policy.
+func policyFlags(flags *flag.FlagSet, policy *auth.Policy) {
+	usage := map[string]string{
+		"devices":       "comma separated list of devices the key may send to, and wears for wearer keys",
+		"channels":      "comma separated list of channels the key may send on",
+		"operations":    "comma separated list of operations the key may send",
+		"max-intensity": "maximum intensity per operation, e.g. shock=10,vibrate=50",
+		"max-duration":  "longest duration the key may hold any operation",
+		"valid-from":    "time (RFC 3339) the key may be used from",
+		"valid-until":   "time (RFC 3339) the key may be used until",
+	}
+
+	for _, setting := range auth.PolicySettings {
+		setting := setting
+		flags.Func(setting, usage[setting], func(value string) error {
+			return policy.Set(setting, value)
+		})
+	}
+}
+
+// keysCommand implements the "keys" subcommand managing the key store.
+func keysCommand(store *auth.Store, args []string) error {
+	usage := errors.New("usage: keys create -label <label> [-admin] [-wearer] [-approver] [-expires <time or duration>] [policy flags] | keys list | keys policy <id> [policy flags] | keys revoke <id> | keys expire <id> <time or duration>")
+
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		label := flags.String("label", "", "label of the key, for auditing")
+		admin := flags.Bool("admin", false, "allow the key to manage other keys")
+		wearer := flags.Bool("wearer", false, "give the key to the wearer, allowing it to set and lift the safeword")
+		approver := flags.Bool("approver", false, "allow the key to approve shocks held for approval")
+		expiresString := flags.String("expires", "", "time (RFC 3339) or duration from now the key expires at")
+
+		policy := auth.Policy{}
+		policyFlags(flags, &policy)
+
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		if *label == "" {
+			return errors.New("keys create: -label is required")
+		}
+
+		var expires *time.Time
+		if *expiresString != "" {
+			t, err := parseTime(*expiresString)
+			if err != nil {
+				return fmt.Errorf("keys create: invalid expiry: %w", err)
+			}
+
+			expires = &t
+		}
+
+		apiKey, key, err := store.Create(auth.Key{
+			Label:    *label,
+			Admin:    *admin,
+			Wearer:   *wearer,
+			Approver: *approver,
+			Policy:   policy,
+			Expires:  expires,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("created key %s (%s), this is the only time it is shown:\n%s\n", key.ID, key.Label, apiKey)
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tLABEL\tADMIN\tWEARER\tAPPROVER\tCREATED\tSTATUS\tPOLICY")
+
+		for _, key := range store.List() {
+			status := "active"
+			if err := key.Active(time.Now()); err != nil {
+				status = err.Error()
+			} else if key.Expires != nil {
+				status = fmt.Sprintf("active until %v", key.Expires.Format(time.RFC3339))
+			}
+
+			policy := make([]string, 0)
+			for _, setting := range auth.PolicySettings {
+				if value := key.Policy.Get(setting); value != "" {
+					policy = append(policy, fmt.Sprintf("%s=%s", setting, value))
+				}
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%v\t%s\t%s\t%s\n", key.ID, key.Label, key.Admin, key.Wearer, key.Approver, key.Created.Format(time.RFC3339), status, strings.Join(policy, " "))
+		}
+
+		return w.Flush()
+	case "policy":
+		if len(args) < 2 {
+			return usage
+		}
+
+		key, err := store.Get(args[1])
+		if err != nil {
+			return err
+		}
+
+		flags := flag.NewFlagSet("keys policy", flag.ContinueOnError)
+		policyFlags(flags, &key.Policy)
+
+		if err := flags.Parse(args[2:]); err != nil {
+			return err
+		}
+
+		if _, err := store.SetPolicy(key.ID, key.Policy); err != nil {
+			return err
+		}
+
+		fmt.Printf("updated policy of key %s\n", key.ID)
+	case "revoke":
+		if len(args) != 2 {
+			return usage
+		}
+
+		if _, err := store.Revoke(args[1]); err != nil {
+			return err
+		}
+
+		fmt.Printf("revoked key %s\n", args[1])
+	case "expire":
+		if len(args) != 3 {
+			return usage
+		}
+
+		at, err := parseTime(args[2])
+		if err != nil {
+			return fmt.Errorf("keys expire: invalid expiry: %w", err)
+		}
+
+		if _, err := store.Expire(args[1], at); err != nil {
+			return err
+		}
+
+		fmt.Printf("key %s expires at %v\n", args[1], at.Format(time.RFC3339))
+	default:
+		return usage
+	}
+
+	return nil
+}
@@ -1,38 +1,257 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
-	"os"
+	"time"
 
-	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/approval"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/audit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/calibration"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument/prometheus"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/job"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/live"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/pattern"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/quiethours"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/safeword"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/schedule"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api"
 	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api/v1alpha1"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api/v1beta1"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/web"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/session"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
 
 	_ "praios.lf-net.org/littlefox/gotoshock/pkg/driver/raspi/gpio"
 	_ "praios.lf-net.org/littlefox/gotoshock/pkg/driver/softpwm"
+
+	// time zones of quiet hours, even on systems without them
+	_ "time/tzdata"
 )
 
 func main() {
-	pwmDriver, err := driver.Setup(os.Args[1])
+	listen := flag.String("listen", ":8080", "address to listen on for HTTP requests")
+	queueSize := flag.Int("queue-size", transmit.DefaultQueueCapacity, "number of jobs queued for each transmitter before rejecting new ones")
+	transmittersFile := flag.String("transmitters", "transmitters.json", "file to load further named transmitters from")
+	patternsDir := flag.String("patterns", "patterns", "directory to load pattern programs from")
+	schedulesFile := flag.String("schedules", "schedules.json", "file to persist scheduled actions in")
+	devicesFile := flag.String("devices", "devices.json", "file to load the named devices from")
+	quietHoursFile := flag.String("quiet-hours", "quiet-hours.json", "file to load the time windows commands are denied or sent as vibrations in from")
+	calibrationsFile := flag.String("calibrations", "calibrations.json", "file to persist device calibrations set through the API in")
+	keysFile := flag.String("keys", "keys.json", "file to store API keys in")
+	safewordFile := flag.String("safewords", "safewords.json", "file to persist safewords set by the wearer in")
+	sessionsFile := flag.String("sessions", "sessions.json", "file to persist sessions opened by the wearer in")
+	requireSession := flag.Bool("require-session", false, "only accept commands from keys in an active session")
+	approvalThreshold := flag.Uint("approval-threshold", 100, "shocks with an intensity above this have to be approved by a second key")
+	approvalTimeout := flag.Duration("approval-timeout", time.Minute, "how long shocks wait for approval")
+	idempotencyWindow := flag.Duration("idempotency-window", api.DefaultIdempotencyWindow, "how long responses are kept to answer requests retried with the same Idempotency-Key")
+	loginLifetime := flag.Duration("login-lifetime", web.DefaultLoginLifetime, "how long a login to the web control panel lasts")
+	liveHeartbeat := flag.Duration("live-heartbeat", live.DefaultHeartbeat, "how long live control waits for the next message of a client before releasing its hold")
+	auditFile := flag.String("audit-log", "audit.jsonl", "file to append the audit log of all commands to")
+	auditMaxSize := flag.Int64("audit-max-size", audit.DefaultMaxSize, "size in bytes the audit log is rotated at")
+	auditMaxFiles := flag.Int("audit-max-files", audit.DefaultMaxFiles, "number of rotated audit log files kept")
+
+	maxDurations := transmit.MaxDurations{}
+	for op, d := range transmit.DefaultMaxDurations {
+		maxDurations[op] = d
+	}
+	flag.Var(maxDurations, "max-duration", "longest duration an operation may be held for, as comma separated operation=duration list")
+
+	dutyCycle := transmit.DutyCycle{}
+	flag.Var(&dutyCycle, "duty-cycle", "share of time each transmitter may be on air as budget/window[,delay=duration], delay being the longest commands are held back until the budget is free again, e.g. 1%/1h,delay=5s")
+
+	rateLimits := ratelimit.Rules{}
+	flag.Var(&rateLimits, "rate-limit", "rate limits as comma separated scope:operation=burst/interval list, scope being key, channel or global and operation * for all, e.g. channel:shock=1/10s")
+
+	flag.Parse()
+
+	keys, err := auth.OpenStore(*keysFile, clock.Real)
 	if err != nil {
-		log.Fatalf("error initializing driver: %v", err)
+		log.Fatalf("error opening key store: %v", err)
+	}
+
+	if flag.Arg(0) == "keys" {
+		if err := keysCommand(keys, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+
+		return
 	}
 
-	routes, err := v1alpha1.Routes(pwmDriver)
+	transmitterConfigs, err := loadTransmitters(*transmittersFile)
 	if err != nil {
-		log.Fatalf("error initializing router: %v", err)
+		log.Fatalf("error loading transmitters: %v", err)
+	}
+
+	if flag.NArg() == 1 {
+		transmitterConfigs = append([]transmitterConfig{{Name: defaultTransmitter, Driver: flag.Arg(0)}}, transmitterConfigs...)
+	}
+
+	if flag.NArg() > 1 || len(transmitterConfigs) == 0 {
+		log.Fatalf("usage: %s [flags] <driver string> | %s [flags] keys ...", flag.CommandLine.Name(), flag.CommandLine.Name())
+	}
+
+	if len(keys.List()) == 0 {
+		log.Printf("no API keys in %s yet, create one with %s keys create -label <label>", *keysFile, flag.CommandLine.Name())
+	}
+
+	devices, err := device.Load(*devicesFile)
+	if err != nil {
+		log.Fatalf("error loading devices: %v", err)
 	}
-	http.ListenAndServe(":8080", routes)
 
-	/*
-		msg := types.NewMessage().
-			SetIntensity(20).
-			SetOperation(types.OperationVibrate).
-			Build()
+	if err := devices.OpenCalibrations(*calibrationsFile); err != nil {
+		log.Fatalf("error loading calibrations: %v", err)
+	}
 
-		for i := 0; i < 4; i++ {
-			if err := pwmDriver.Output(msg); err != nil {
-				log.Fatalf("error sending message: %v", err)
+	events := event.NewBus(event.DefaultHistory, clock.Real)
+	metrics := prometheus.New(clock.Real)
+
+	transmitters, err := setupTransmitters(transmitterConfigs, transmit.Config{
+		QueueCapacity:   *queueSize,
+		MaxDurations:    maxDurations,
+		DutyCycle:       dutyCycle,
+		Instrumentation: metrics,
+	}, events, devices)
+	if err != nil {
+		log.Fatalf("error setting up transmitters: %v", err)
+	}
+	defer transmitters.Close()
+	metrics.Transmitters(transmitters.Stats)
+
+	for _, d := range devices.Devices() {
+		for _, name := range d.Transmitters {
+			if _, err := transmitters.Scheduler(name); err != nil {
+				log.Fatalf("error routing device %q: %v", d.Name, err)
 			}
-		}*/
+		}
+	}
+
+	safewords, err := safeword.Open(*safewordFile, clock.Real)
+	if err != nil {
+		log.Fatalf("error loading safewords: %v", err)
+	}
+
+	for ch, state := range safewords.States() {
+		metrics.Safeword(ch, string(state.Mode))
+	}
+
+	sessions, err := session.NewManager(*sessionsFile, keys, clock.Real, *requireSession)
+	if err != nil {
+		log.Fatalf("error loading sessions: %v", err)
+	}
+
+	if *approvalThreshold > 100 {
+		log.Fatalf("approval threshold out of range: %d", *approvalThreshold)
+	}
+
+	approvals := approval.NewManager(types.Intensity(*approvalThreshold), *approvalTimeout, clock.Real)
+
+	auditLog, err := audit.Open(*auditFile, *auditMaxSize, *auditMaxFiles, clock.Real)
+	if err != nil {
+		log.Fatalf("error opening audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	windows, err := quiethours.Load(*quietHoursFile)
+	if err != nil {
+		log.Fatalf("error loading quiet hours: %v", err)
+	}
+
+	quietHours, err := quiethours.NewPolicy(windows, clock.Real)
+	if err != nil {
+		log.Fatalf("error loading quiet hours: %v", err)
+	}
+
+	limiter := ratelimit.NewLimiter(rateLimits, clock.Real)
+	dispatcher := command.NewDispatcher(transmitters, command.Config{
+		Keys:       keys,
+		Limiter:    limiter,
+		Safewords:  safewords,
+		Sessions:   sessions,
+		Approvals:  approvals,
+		Audit:      auditLog,
+		Events:     events,
+		Devices:    devices,
+		QuietHours: quietHours,
+
+		Instrumentation: metrics,
+	})
+
+	patterns := pattern.NewManager(*patternsDir, dispatcher, clock.Real)
+	defer patterns.StopAll()
+
+	schedules, err := schedule.NewManager(*schedulesFile, dispatcher, clock.Real)
+	if err != nil {
+		log.Fatalf("error loading schedules: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go schedules.Run(ctx)
+
+	idempotency := api.NewIdempotency(*idempotencyWindow, clock.Real)
+
+	v1alpha1Routes, err := v1alpha1.Routes(v1alpha1.Backend{
+		Keys:         keys,
+		Limiter:      limiter,
+		Safewords:    safewords,
+		Sessions:     sessions,
+		Approvals:    approvals,
+		Audit:        auditLog,
+		Transmitters: transmitters,
+		Dispatcher:   dispatcher,
+		Patterns:     patterns,
+		Schedules:    schedules,
+		Events:       events,
+		Devices:      devices,
+
+		Idempotency:     idempotency,
+		Instrumentation: metrics,
+	})
+	if err != nil {
+		log.Fatalf("error initializing router: %v", err)
+	}
+
+	v1beta1Routes, err := v1beta1.Routes(v1beta1.Backend{
+		Keys:         keys,
+		Dispatcher:   dispatcher,
+		Jobs:         job.NewManager(dispatcher, clock.Real),
+		Transmitters: transmitters,
+		Heartbeat:    *liveHeartbeat,
+		Events:       events,
+		Devices:      devices,
+		Calibrations: calibration.NewManager(dispatcher, devices, clock.Real),
+		QuietHours:   quietHours,
+
+		Idempotency: idempotency,
+	})
+	if err != nil {
+		log.Fatalf("error initializing router: %v", err)
+	}
+
+	panel := web.NewPanel(keys, *loginLifetime, clock.Real)
+	panelRoutes, err := panel.Routes()
+	if err != nil {
+		log.Fatalf("error initializing router: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1alpha1/", v1alpha1Routes)
+	mux.Handle("/v1beta1/", v1beta1Routes)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", panelRoutes)
+
+	if err := http.ListenAndServe(*listen, panel.Handler(mux)); err != nil {
+		log.Fatalf("error serving HTTP: %v", err)
+	}
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+)
+
+// defaultTransmitter is the name of the transmitter given on the command
+// line.
+const defaultTransmitter = "default"
+
+// transmitterConfig configures a named transmitter: the driver string of its
+// driver chain, the capacity of its queue, -queue-size if not given, and its
+// duty cycle, -duty-cycle if not given.
+type transmitterConfig struct {
+	Name      string              `json:"name"`
+	Driver    string              `json:"driver"`
+	QueueSize int                 `json:"queueSize,omitempty"`
+	DutyCycle *transmit.DutyCycle `json:"dutyCycle,omitempty"`
+}
+
+// loadTransmitters loads the transmitters configured in the given JSON file,
+// holding a list of transmitterConfigs. A file not existing configures none.
+func loadTransmitters(path string) ([]transmitterConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading transmitters: %w", err)
+	}
+
+	var ret []transmitterConfig
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, fmt.Errorf("error parsing transmitters: %w", err)
+	}
+
+	return ret, nil
+}
+
+// setupTransmitters sets up the driver chain of every given transmitter and
+// returns a Router for them, the first one being the default. Errors of the
+// drivers are published on the given Bus, naming the device of the given
+// Registry they were sending to if only one listens there, and reported to
+// the Instrumentation of config.
+func setupTransmitters(configs []transmitterConfig, config transmit.Config, events *event.Bus, devices *device.Registry) (*transmit.Router, error) {
+	instrumentation := instrument.Or(config.Instrumentation)
+
+	schedulers := make([]*transmit.Scheduler, 0, len(configs))
+	for _, c := range configs {
+		d, err := driver.Setup(c.Driver)
+		if err != nil {
+			for _, s := range schedulers {
+				s.Close()
+			}
+
+			return nil, fmt.Errorf("error initializing driver of transmitter %q: %w", c.Name, err)
+		}
+
+		name, drivers, config := c.Name, driverNames(c.Driver), config
+		if c.QueueSize > 0 {
+			config.QueueCapacity = c.QueueSize
+		}
+
+		if c.DutyCycle != nil {
+			config.DutyCycle = *c.DutyCycle
+		}
+
+		if _, ok := d.(driver.AirtimeDriver); !ok && config.DutyCycle.Budget > 0 {
+			log.Printf("driver of transmitter %q does not tell its time on air, its duty cycle is not limited", c.Name)
+		}
+
+		config.DriverError = func(job transmit.Job, err error) {
+			channel, _, _ := job.Message.GetChannel()
+
+			var dev string
+			if listening := devices.Listening(job.Message.GetRemoteID(), channel); len(listening) == 1 {
+				dev = listening[0].Name
+			}
+
+			events.Publish(event.Event{
+				Type:    event.TypeDriverError,
+				Channel: &channel,
+				Device:  dev,
+				Error:   err.Error(),
+				Data:    map[string]string{"transmitter": name},
+			})
+			instrumentation.DriverError(name, drivers)
+		}
+
+		schedulers = append(schedulers, transmit.NewScheduler(name, d, config))
+	}
+
+	ret, err := transmit.NewRouter(schedulers...)
+	if err != nil {
+		for _, s := range schedulers {
+			s.Close()
+		}
+
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// driverNames returns the names of the drivers in the given driver string,
+// without their arguments.
+func driverNames(conn string) string {
+	names := make([]string, 0, 2)
+	for _, word := range strings.Fields(conn) {
+		if first := []rune(word)[0]; unicode.IsLetter(first) || first == '_' {
+			names = append(names, word)
+		}
+	}
+
+	return strings.Join(names, " ")
+}
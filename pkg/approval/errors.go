@@ -0,0 +1,27 @@
+package approval
+
+import (
+	"errors"
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+)
+
+var (
+	// ErrDenied is returned for Requests denied by an approver.
+	ErrDenied = fmt.Errorf("%w: approval denied", auth.ErrForbidden)
+
+	// ErrExpired is returned for Requests not decided on in time.
+	ErrExpired = fmt.Errorf("%w: approval expired", auth.ErrForbidden)
+
+	// ErrSelfApproval is returned when a key tries to decide on its own
+	// Request.
+	ErrSelfApproval = fmt.Errorf("%w: cannot decide on own request", auth.ErrForbidden)
+
+	// ErrUnknownRequest is returned when a Request is not known.
+	ErrUnknownRequest = errors.New("unknown approval request")
+
+	// ErrNotPending is returned when deciding on a Request already decided
+	// on.
+	ErrNotPending = errors.New("approval request not pending")
+)
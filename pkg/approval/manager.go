@@ -0,0 +1,292 @@
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// decidedKept is the number of decided Requests kept for listing.
+const decidedKept = 64
+
+// subscriberBuffer is the number of Events buffered per subscriber, Events
+// are dropped for subscribers not keeping up.
+const subscriberBuffer = 16
+
+// State is the state of a Request.
+type State string
+
+const (
+	// StatePending is the State of Requests waiting for a decision.
+	StatePending State = "pending"
+
+	// StateApproved is the State of Requests approved.
+	StateApproved State = "approved"
+
+	// StateDenied is the State of Requests denied.
+	StateDenied State = "denied"
+
+	// StateExpired is the State of Requests not decided on in time.
+	StateExpired State = "expired"
+
+	// StateCancelled is the State of Requests given up by their sender.
+	StateCancelled State = "cancelled"
+)
+
+// Request is a shock held until it is approved.
+type Request struct {
+	ID        string          `json:"id"`
+	KeyID     string          `json:"keyId"`
+	Device    string          `json:"device,omitempty"`
+	Channel   types.Channel   `json:"channel"`
+	Operation types.Operation `json:"operation"`
+	Intensity types.Intensity `json:"intensity"`
+	Duration  time.Duration   `json:"duration,omitempty"`
+
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+
+	State     State      `json:"state"`
+	DecidedBy string     `json:"decidedBy,omitempty"`
+	Decided   *time.Time `json:"decided,omitempty"`
+}
+
+// Event tells subscribers a Request was created or decided on, the Type
+// being the new State of the Request.
+type Event struct {
+	Type    State   `json:"type"`
+	Request Request `json:"request"`
+}
+
+type request struct {
+	Request
+	decided chan struct{}
+}
+
+// Manager holds shocks above a threshold until a second key approves them.
+type Manager struct {
+	threshold types.Intensity
+	timeout   time.Duration
+	clock     clock.Clock
+
+	mu          sync.Mutex
+	requests    map[string]*request
+	subscribers map[chan Event]struct{}
+}
+
+// NewManager creates a Manager holding shocks with an Intensity above the
+// given threshold for approval, for at most the given timeout.
+func NewManager(threshold types.Intensity, timeout time.Duration, c clock.Clock) *Manager {
+	return &Manager{
+		threshold:   threshold,
+		timeout:     timeout,
+		clock:       c,
+		requests:    make(map[string]*request),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Required returns if sending the given Operation with the given Intensity
+// has to be approved.
+func (m *Manager) Required(op types.Operation, intensity types.Intensity) bool {
+	return op == types.OperationShock && intensity > m.threshold
+}
+
+// Request creates a Request for sending the given Operation with the given
+// Intensity, held for the given duration, to the device with the given name
+// (empty if none is named) on the given Channel on behalf of the key with the
+// given ID and waits until it is decided on, returning the decided Request.
+// The error is nil if it was approved, ErrDenied or ErrExpired otherwise, or
+// the cause of ctx when it is done before.
+func (m *Manager) Request(ctx context.Context, keyID, dev string, ch types.Channel, op types.Operation, intensity types.Intensity, duration time.Duration) (Request, error) {
+	id, err := newID()
+	if err != nil {
+		return Request{}, err
+	}
+
+	now := m.clock.Now()
+	req := &request{
+		Request: Request{
+			ID:        id,
+			KeyID:     keyID,
+			Device:    dev,
+			Channel:   ch,
+			Operation: op,
+			Intensity: intensity,
+			Duration:  duration,
+			Created:   now,
+			Expires:   now.Add(m.timeout),
+			State:     StatePending,
+		},
+		decided: make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.requests[id] = req
+	m.pruneLocked()
+	m.publishLocked(req.Request)
+	m.mu.Unlock()
+
+	timer := m.clock.NewTimer(m.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-req.decided:
+	case <-timer.C():
+		m.decide(id, "", StateExpired)
+	case <-ctx.Done():
+		m.decide(id, "", StateCancelled)
+	}
+
+	m.mu.Lock()
+	decided := req.Request
+	m.mu.Unlock()
+
+	switch decided.State {
+	case StateApproved:
+		return decided, nil
+	case StateDenied:
+		return decided, fmt.Errorf("%w: request %s", ErrDenied, id)
+	case StateExpired:
+		return decided, fmt.Errorf("%w: request %s not approved within %v", ErrExpired, id, m.timeout)
+	default:
+		return decided, context.Cause(ctx)
+	}
+}
+
+// Approve approves the Request with the given ID on behalf of the key with
+// the given ID, which must not be the one the Request is from.
+func (m *Manager) Approve(id, keyID string) (Request, error) {
+	return m.decide(id, keyID, StateApproved)
+}
+
+// Deny denies the Request with the given ID on behalf of the key with the
+// given ID, which must not be the one the Request is from.
+func (m *Manager) Deny(id, keyID string) (Request, error) {
+	return m.decide(id, keyID, StateDenied)
+}
+
+func (m *Manager) decide(id, keyID string, state State) (Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	req, ok := m.requests[id]
+	if !ok {
+		return Request{}, fmt.Errorf("%w: %q", ErrUnknownRequest, id)
+	}
+
+	if keyID != "" && keyID == req.KeyID {
+		return Request{}, ErrSelfApproval
+	}
+
+	if req.State != StatePending {
+		return Request{}, fmt.Errorf("%w: %s is %s", ErrNotPending, id, req.State)
+	}
+
+	now := m.clock.Now()
+	req.State = state
+	req.DecidedBy = keyID
+	req.Decided = &now
+	close(req.decided)
+
+	m.publishLocked(req.Request)
+	return req.Request, nil
+}
+
+// Requests returns all pending Requests and the most recently decided ones,
+// ordered by their creation time.
+func (m *Manager) Requests() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]Request, 0, len(m.requests))
+	for _, req := range m.requests {
+		ret = append(ret, req.Request)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Created.Before(ret[j].Created)
+	})
+
+	return ret
+}
+
+// Subscribe returns a channel receiving an Event for every Request created
+// and decided on, and a function to call when done with it.
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	m.mu.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		delete(m.subscribers, ch)
+	}
+}
+
+// publishLocked logs the given Request and sends an Event for it to all
+// subscribers, m.mu has to be locked.
+func (m *Manager) publishLocked(req Request) {
+	by := ""
+	if req.DecidedBy != "" {
+		by = " by key " + req.DecidedBy
+	}
+
+	target := fmt.Sprintf("channel %v", req.Channel)
+	if req.Device != "" {
+		target = fmt.Sprintf("device %s on channel %v", req.Device, req.Channel)
+	}
+
+	log.Printf("approval: request %s from key %s (%v with intensity %v to %s) %s%s", req.ID, req.KeyID, req.Operation, req.Intensity, target, req.State, by)
+
+	for ch := range m.subscribers {
+		select {
+		case ch <- Event{Type: req.State, Request: req}:
+		default:
+		}
+	}
+}
+
+// pruneLocked forgets the oldest decided Requests exceeding decidedKept. m.mu
+// has to be locked.
+func (m *Manager) pruneLocked() {
+	decided := make([]*request, 0)
+	for _, req := range m.requests {
+		if req.State != StatePending {
+			decided = append(decided, req)
+		}
+	}
+
+	if len(decided) <= decidedKept {
+		return
+	}
+
+	sort.Slice(decided, func(i, j int) bool {
+		return decided[i].Decided.Before(*decided[j].Decided)
+	})
+
+	for _, req := range decided[:len(decided)-decidedKept] {
+		delete(m.requests, req.ID)
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,110 @@
+package approval_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/approval"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Manager", func() {
+	var (
+		fake    *clock.Fake
+		manager *approval.Manager
+		events  <-chan approval.Event
+		result  chan error
+	)
+
+	// request sends a Request in the background, returning its ID once it
+	// is pending.
+	request := func(ctx context.Context, keyID string) string {
+		go func() {
+			_, err := manager.Request(ctx, keyID, "alex-collar", types.Channel1, types.OperationShock, 80, time.Second)
+			result <- err
+		}()
+
+		var event approval.Event
+		Eventually(events).Should(Receive(&event))
+		Expect(event.Type).To(Equal(approval.StatePending))
+		Expect(event.Request.KeyID).To(Equal(keyID))
+		Expect(event.Request.Device).To(Equal("alex-collar"))
+
+		return event.Request.ID
+	}
+
+	BeforeEach(func() {
+		var unsubscribe func()
+
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+		manager = approval.NewManager(50, time.Minute, fake)
+		events, unsubscribe = manager.Subscribe()
+		result = make(chan error, 1)
+
+		DeferCleanup(unsubscribe)
+	})
+
+	It("requires approval for shocks above the threshold", func() {
+		Expect(manager.Required(types.OperationShock, 50)).To(BeFalse())
+		Expect(manager.Required(types.OperationShock, 51)).To(BeTrue())
+		Expect(manager.Required(types.OperationVibrate, 100)).To(BeFalse())
+	})
+
+	It("returns when approved by a second key", func() {
+		id := request(context.Background(), "alice")
+
+		_, err := manager.Approve(id, "alice")
+		Expect(err).To(MatchError(approval.ErrSelfApproval))
+
+		r, err := manager.Approve(id, "bob")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.State).To(Equal(approval.StateApproved))
+		Expect(r.DecidedBy).To(Equal("bob"))
+
+		Eventually(result).Should(Receive(BeNil()))
+		Eventually(events).Should(Receive(HaveField("Type", approval.StateApproved)))
+
+		_, err = manager.Deny(id, "bob")
+		Expect(err).To(MatchError(approval.ErrNotPending))
+	})
+
+	It("fails when denied", func() {
+		id := request(context.Background(), "alice")
+
+		_, err := manager.Deny(id, "wearer")
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(result).Should(Receive(MatchError(approval.ErrDenied)))
+	})
+
+	It("fails when not approved in time", func() {
+		request(context.Background(), "alice")
+
+		Eventually(fake.Timers).Should(Equal(1))
+		fake.Advance(time.Minute)
+
+		var err error
+		Eventually(result).Should(Receive(&err))
+		Expect(err).To(MatchError(approval.ErrExpired))
+		Expect(err).To(MatchError(auth.ErrForbidden))
+		Expect(manager.Requests()).To(ConsistOf(HaveField("State", approval.StateExpired)))
+	})
+
+	It("is cancelled with its context", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		request(ctx, "alice")
+
+		cancel()
+		Eventually(result).Should(Receive(MatchError(context.Canceled)))
+		Expect(manager.Requests()).To(ConsistOf(HaveField("State", approval.StateCancelled)))
+	})
+
+	It("does not know other requests", func() {
+		_, err := manager.Approve("unknown", "bob")
+		Expect(err).To(MatchError(approval.ErrUnknownRequest))
+	})
+})
@@ -0,0 +1,226 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// DefaultMaxSize is the size in bytes a Log file is rotated at by default.
+const DefaultMaxSize = 10 << 20
+
+// DefaultMaxFiles is the number of rotated Log files kept by default.
+const DefaultMaxFiles = 5
+
+// Log is an append-only audit log, storing Records as JSON lines in a file.
+// When the file grows over its maximum size, it is renamed with the suffix
+// ".1", older files moving to ".2" and so on, up to the maximum number of
+// files kept.
+type Log struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	clock    clock.Clock
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the Log at the given path for appending, creating it if it does
+// not exist. Records are stamped with the time of the given Clock. At least
+// one rotated file has to be kept.
+func Open(path string, maxSize int64, maxFiles int, c clock.Clock) (*Log, error) {
+	if maxFiles < 1 {
+		return nil, fmt.Errorf("error opening audit log: %d rotated files kept, at least 1 needed", maxFiles)
+	}
+
+	l := &Log{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		clock:    c,
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends the given Record to the Log, setting its Time to now if
+// not set. Channels and Operations not known are recorded with their raw
+// values. Errors are logged, as there is nobody to report them to.
+func (l *Log) Record(r Record) {
+	if r.Time.IsZero() {
+		r.Time = l.clock.Now()
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("audit: error encoding record: %v", err)
+		return
+	}
+
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotateLocked(); err != nil {
+			log.Printf("audit: %v", err)
+		}
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		log.Printf("audit: error writing record: %v", err)
+	}
+}
+
+// rotateLocked moves the current file to the first rotated one, replacing
+// the oldest one, and opens a new one, l.mu has to be locked. The file is
+// opened again even if rotating fails, to keep appending to it.
+func (l *Log) rotateLocked() error {
+	err := l.file.Close()
+	if err != nil {
+		err = fmt.Errorf("error closing audit log: %w", err)
+	}
+
+	for i := l.maxFiles; i > 0 && err == nil; i-- {
+		from := l.rotated(i - 1)
+		if renameErr := os.Rename(from, l.rotated(i)); renameErr != nil && !errors.Is(renameErr, fs.ErrNotExist) {
+			err = fmt.Errorf("error rotating audit log: %w", renameErr)
+		}
+	}
+
+	if openErr := l.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+
+	return err
+}
+
+// rotated returns the path of the i-th rotated file, the current file for 0.
+func (l *Log) rotated(i int) string {
+	if i == 0 {
+		return l.path
+	}
+
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+// snapshot opens all files of the Log, oldest first, with the size of the
+// current one, so they can be read while Records are appended and the files
+// are rotated.
+func (l *Log) snapshot() ([]*os.File, int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ret := make([]*os.File, 0, l.maxFiles+1)
+	for i := l.maxFiles; i >= 0; i-- {
+		file, err := os.Open(l.rotated(i))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			for _, file := range ret {
+				file.Close()
+			}
+
+			return nil, 0, fmt.Errorf("error reading audit log: %w", err)
+		}
+
+		ret = append(ret, file)
+	}
+
+	return ret, l.size, nil
+}
+
+// Query returns all Records matching the given Filter, oldest first. The
+// files are read without blocking Record, Records appended meanwhile are not
+// returned.
+func (l *Log) Query(f Filter) ([]Record, error) {
+	if f.Limit < 0 {
+		return nil, fmt.Errorf("%w: negative limit", types.ErrUnparsable)
+	}
+
+	files, size, err := l.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	ret := make([]Record, 0)
+	for i, file := range files {
+		var reader io.Reader = file
+		if i == len(files)-1 {
+			// the current file, only read what was there already
+			reader = io.LimitReader(file, size)
+		}
+
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64<<10), 1<<20)
+
+		for scanner.Scan() {
+			var r Record
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				return nil, fmt.Errorf("error parsing audit log %s: %w", file.Name(), err)
+			}
+
+			if f.Match(r) {
+				ret = append(ret, r)
+				if f.Limit > 0 && len(ret) > f.Limit {
+					ret = ret[1:]
+				}
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading audit log: %w", err)
+		}
+	}
+
+	return ret, nil
+}
+
+// Close closes the Log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
@@ -0,0 +1,198 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/audit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Log", func() {
+	var (
+		path string
+		fake *clock.Fake
+		log  *audit.Log
+	)
+
+	record := func(keyID string, op types.Operation, outcome audit.Outcome) audit.Record {
+		return audit.Record{
+			Type:      audit.TypeCommand,
+			KeyID:     keyID,
+			KeyLabel:  "label of " + keyID,
+			Channel:   types.Channel1,
+			Operation: op,
+			Intensity: 20,
+			Outcome:   string(outcome),
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		path = filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		log, err = audit.Open(path, audit.DefaultMaxSize, audit.DefaultMaxFiles, fake)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(log.Close)
+	})
+
+	It("stores records stamped with the time", func() {
+		log.Record(record("alice", types.OperationShock, audit.OutcomeAccepted))
+
+		records, err := log.Query(audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveExactElements(And(
+			HaveField("Time", BeTemporally("==", fake.Now())),
+			HaveField("KeyID", "alice"),
+			HaveField("Operation", types.OperationShock),
+		)))
+	})
+
+	It("filters records", func() {
+		log.Record(record("alice", types.OperationShock, audit.OutcomeAccepted))
+		fake.Advance(time.Minute)
+		log.Record(record("bob", types.OperationShock, audit.OutcomeRejected))
+		fake.Advance(time.Minute)
+		log.Record(record("alice", types.OperationBeep, audit.OutcomeFailed))
+
+		records, err := log.Query(audit.Filter{KeyID: "alice"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveLen(2))
+
+		shock := types.OperationShock
+		records, err = log.Query(audit.Filter{Operation: &shock, Outcome: string(audit.OutcomeRejected)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveExactElements(HaveField("KeyID", "bob")))
+
+		records, err = log.Query(audit.Filter{From: fake.Now().Add(-time.Minute), Until: fake.Now()})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveExactElements(HaveField("KeyID", "bob")))
+
+		records, err = log.Query(audit.Filter{Limit: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveExactElements(HaveField("KeyID", "bob"), HaveField("KeyID", "alice")))
+	})
+
+	It("appends over restarts", func() {
+		log.Record(record("alice", types.OperationShock, audit.OutcomeAccepted))
+
+		reopened, err := audit.Open(path, audit.DefaultMaxSize, audit.DefaultMaxFiles, fake)
+		Expect(err).NotTo(HaveOccurred())
+		defer reopened.Close()
+
+		reopened.Record(record("bob", types.OperationShock, audit.OutcomeAccepted))
+
+		records, err := reopened.Query(audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveExactElements(HaveField("KeyID", "alice"), HaveField("KeyID", "bob")))
+	})
+
+	It("rotates files", func() {
+		rotatingPath := filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+		rotating, err := audit.Open(rotatingPath, 300, 2, fake)
+		Expect(err).NotTo(HaveOccurred())
+		defer rotating.Close()
+
+		for i := 0; i < 10; i++ {
+			rotating.Record(record(string(rune('a'+i)), types.OperationBeep, audit.OutcomeAccepted))
+			fake.Advance(time.Second)
+		}
+
+		records, err := rotating.Query(audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(records)).To(BeNumerically("<", 10))
+		Expect(records[len(records)-1].KeyID).To(Equal("j"))
+
+		for i := 1; i < len(records); i++ {
+			Expect(records[i].Time).To(BeTemporally(">", records[i-1].Time))
+		}
+
+		Expect(rotatingPath + ".2").To(BeAnExistingFile())
+		Expect(rotatingPath + ".3").NotTo(BeAnExistingFile())
+	})
+
+	It("keeps appending when rotating fails", func() {
+		rotatingPath := filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+		rotating, err := audit.Open(rotatingPath, 1, 1, fake)
+		Expect(err).NotTo(HaveOccurred())
+		defer rotating.Close()
+
+		// a directory not empty cannot be replaced by the rotated file
+		Expect(os.MkdirAll(filepath.Join(rotatingPath+".1", "blocker"), 0o700)).To(Succeed())
+
+		rotating.Record(record("alice", types.OperationBeep, audit.OutcomeAccepted))
+		rotating.Record(record("bob", types.OperationBeep, audit.OutcomeAccepted))
+		rotating.Record(record("carol", types.OperationBeep, audit.OutcomeAccepted))
+
+		data, err := os.ReadFile(rotatingPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Count(data, []byte("\n"))).To(Equal(3))
+	})
+
+	It("keeps records of unknown channels and operations", func() {
+		r := record("alice", types.Operation(3), audit.OutcomeRejected)
+		r.Channel = types.Channel(7)
+		log.Record(r)
+		log.Record(record("bob", types.OperationBeep, audit.OutcomeAccepted))
+
+		records, err := log.Query(audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(records).To(HaveExactElements(
+			And(
+				HaveField("KeyID", "alice"),
+				HaveField("Channel", types.Channel(7)),
+				HaveField("Operation", types.Operation(3)),
+			),
+			And(
+				HaveField("KeyID", "bob"),
+				HaveField("Channel", types.Channel1),
+				HaveField("Operation", types.OperationBeep),
+			),
+		))
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"channel":7,"operation":3`))
+		Expect(string(data)).To(ContainSubstring(`"channel":"1","operation":"beep"`))
+	})
+
+	It("needs to keep rotated files", func() {
+		_, err := audit.Open(filepath.Join(GinkgoT().TempDir(), "audit.jsonl"), 1, 0, fake)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects negative limits", func() {
+		_, err := log.Query(audit.Filter{Limit: -1})
+		Expect(err).To(MatchError(types.ErrUnparsable))
+	})
+
+	It("exports CSV and JSON lines", func() {
+		log.Record(record("alice", types.OperationShock, audit.OutcomeAccepted))
+		records, err := log.Query(audit.Filter{})
+		Expect(err).NotTo(HaveOccurred())
+
+		buf := &bytes.Buffer{}
+		Expect(audit.WriteCSV(buf, records)).To(Succeed())
+
+		rows, err := csv.NewReader(buf).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows).To(HaveLen(2))
+		Expect(rows[0][3]).To(Equal("keyId"))
+		Expect(rows[1][3]).To(Equal("alice"))
+
+		buf.Reset()
+		Expect(audit.WriteJSONLines(buf, records)).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(Equal(string(data)))
+	})
+})
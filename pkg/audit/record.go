@@ -0,0 +1,220 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Type is what a Record is about.
+type Type string
+
+const (
+	// TypeCommand is the Type of Records of Commands dispatched.
+	TypeCommand Type = "command"
+
+	// TypeApproval is the Type of Records of approval requests decided on.
+	TypeApproval Type = "approval"
+)
+
+// Outcome is how a Command ended.
+type Outcome string
+
+const (
+	// OutcomeAccepted is the Outcome of Commands transmitted.
+	OutcomeAccepted Outcome = "accepted"
+
+	// OutcomeRejected is the Outcome of Commands rejected before they were
+	// transmitted, e.g. because of the limits of their key.
+	OutcomeRejected Outcome = "rejected"
+
+	// OutcomeFailed is the Outcome of Commands failed to transmit, e.g.
+	// because of driver errors or being stopped.
+	OutcomeFailed Outcome = "failed"
+)
+
+// Record is a single entry in the audit Log.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Type      Type      `json:"type"`
+	CommandID string    `json:"commandId,omitempty"`
+
+	KeyID      string `json:"keyId"`
+	KeyLabel   string `json:"keyLabel"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	Source     string `json:"source,omitempty"`
+
+	// IdempotencyKey is the key the client gave to detect retries.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+
+	// Device is the name of the device the Command was sent to, if any.
+	Device string `json:"device,omitempty"`
+
+	Channel   types.Channel   `json:"channel"`
+	Operation types.Operation `json:"operation"`
+	Intensity types.Intensity `json:"intensity"`
+	Duration  time.Duration   `json:"duration,omitempty"`
+
+	// Outcome is how the Command ended for TypeCommand Records and the
+	// State of the approval request for TypeApproval Records.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+
+	// Approval is the ID of the approval request, DecidedBy the ID of the
+	// key deciding on it, for TypeApproval Records.
+	Approval  string `json:"approval,omitempty"`
+	DecidedBy string `json:"decidedBy,omitempty"`
+}
+
+// MarshalJSON encodes the Record as JSON, writing Channels and Operations
+// not known as their raw numeric values, so Records of anything sent are
+// kept.
+func (r Record) MarshalJSON() ([]byte, error) {
+	type plain Record
+	ret := struct {
+		plain
+		Channel   any `json:"channel"`
+		Operation any `json:"operation"`
+	}{plain(r), r.Channel, r.Operation}
+
+	if _, err := r.Channel.MarshalText(); err != nil {
+		ret.Channel = uint8(r.Channel)
+	}
+
+	if _, err := r.Operation.MarshalText(); err != nil {
+		ret.Operation = uint8(r.Operation)
+	}
+
+	return json.Marshal(ret)
+}
+
+// UnmarshalJSON decodes a Record encoded with MarshalJSON.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	type plain Record
+	var raw struct {
+		plain
+		Channel   json.RawMessage `json:"channel"`
+		Operation json.RawMessage `json:"operation"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*r = Record(raw.plain)
+	if err := unmarshalRaw(raw.Channel, &r.Channel); err != nil {
+		return fmt.Errorf("channel: %w", err)
+	}
+
+	if err := unmarshalRaw(raw.Operation, &r.Operation); err != nil {
+		return fmt.Errorf("operation: %w", err)
+	}
+
+	return nil
+}
+
+// unmarshalRaw decodes the given JSON value, either a string or a raw
+// numeric value, into v, keeping it if there is none.
+func unmarshalRaw[T ~uint8](data json.RawMessage, v *T) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if data[0] == '"' {
+		return json.Unmarshal(data, v)
+	}
+
+	var n uint8
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+
+	*v = T(n)
+	return nil
+}
+
+// csvHeader are the column names of CSV exports, in the order of the fields
+// written by csvRow.
+var csvHeader = []string{
+	"time", "type", "commandId", "keyId", "keyLabel", "remoteAddr", "source", "idempotencyKey",
+	"device", "channel", "operation", "intensity", "duration",
+	"outcome", "error", "approval", "decidedBy",
+}
+
+func (r Record) csvRow() []string {
+	duration := ""
+	if r.Duration > 0 {
+		duration = r.Duration.String()
+	}
+
+	return []string{
+		r.Time.Format(time.RFC3339Nano), string(r.Type), r.CommandID, r.KeyID, r.KeyLabel, r.RemoteAddr, r.Source, r.IdempotencyKey,
+		r.Device, r.Channel.String(), r.Operation.String(), strconv.Itoa(int(r.Intensity)), duration,
+		r.Outcome, r.Error, r.Approval, r.DecidedBy,
+	}
+}
+
+// WriteCSV writes the given Records as CSV with a header row.
+func WriteCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("error writing CSV: %w", err)
+	}
+
+	for _, r := range records {
+		if err := cw.Write(r.csvRow()); err != nil {
+			return fmt.Errorf("error writing CSV: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSONLines writes the given Records as JSON, one per line, in the same
+// format as stored in the Log.
+func WriteJSONLines(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("error writing JSON lines: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Filter selects Records in a Query. Zero values match everything.
+type Filter struct {
+	From  time.Time
+	Until time.Time
+
+	Type      Type
+	KeyID     string
+	Device    string
+	Channel   *types.Channel
+	Operation *types.Operation
+	Outcome   string
+
+	// Limit is the maximum number of Records returned, the most recent
+	// ones are kept.
+	Limit int
+}
+
+// Match returns if the given Record is selected by the Filter, ignoring
+// Limit.
+func (f Filter) Match(r Record) bool {
+	return (f.From.IsZero() || !r.Time.Before(f.From)) &&
+		(f.Until.IsZero() || r.Time.Before(f.Until)) &&
+		(f.Type == "" || r.Type == f.Type) &&
+		(f.KeyID == "" || r.KeyID == f.KeyID) &&
+		(f.Device == "" || r.Device == f.Device) &&
+		(f.Channel == nil || r.Channel == *f.Channel) &&
+		(f.Operation == nil || r.Operation == *f.Operation) &&
+		(f.Outcome == "" || r.Outcome == f.Outcome)
+}
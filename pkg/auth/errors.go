@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnauthorized is returned when a request does not carry a usable
+	// API key.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is returned when the API key of a request is valid but
+	// not allowed to do what was requested.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrUnknownKey is returned for API keys not in the Store or with a
+	// wrong secret.
+	ErrUnknownKey = fmt.Errorf("%w: unknown key", ErrUnauthorized)
+
+	// ErrKeyRevoked is returned for API keys revoked.
+	ErrKeyRevoked = fmt.Errorf("%w: key revoked", ErrUnauthorized)
+
+	// ErrKeyExpired is returned for API keys past their expiry time.
+	ErrKeyExpired = fmt.Errorf("%w: key expired", ErrUnauthorized)
+)
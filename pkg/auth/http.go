@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// FromRequest returns the API key given in the Authorization header of the
+// request as "Bearer <key>", if any.
+func FromRequest(req *http.Request) (string, bool) {
+	scheme, key, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	key = strings.TrimSpace(key)
+	return key, key != ""
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// PolicySettings are the names of the settings of a Policy, as accepted by
+// Policy.Set. They are also the names of the rules in a PolicyError.
+var PolicySettings = []string{"devices", "channels", "operations", "max-intensity", "max-duration", "valid-from", "valid-until"}
+
+// Policy limits what a Key may send. Zero values mean "not limited".
+type Policy struct {
+	// Devices are the names of the devices the Key may send to, not
+	// allowing it to send on Channels without naming a device. For wearer
+	// keys, these are the devices they wear, only their safewords and
+	// calibrations may be changed with the key.
+	Devices []string `json:"devices,omitempty"`
+
+	// Channels are the Channels the Key may send on.
+	Channels []types.Channel `json:"channels,omitempty"`
+
+	// Operations are the Operations the Key may send.
+	Operations []types.Operation `json:"operations,omitempty"`
+
+	// MaxIntensity is the highest Intensity the Key may send, per
+	// Operation. Operations not in the map are not limited.
+	MaxIntensity map[types.Operation]types.Intensity `json:"maxIntensity,omitempty"`
+
+	// MaxDuration is the longest the Key may hold any Operation.
+	MaxDuration time.Duration `json:"maxDuration,omitempty"`
+
+	// ValidFrom and ValidUntil limit the time the Key may send anything.
+	ValidFrom  *time.Time `json:"validFrom,omitempty"`
+	ValidUntil *time.Time `json:"validUntil,omitempty"`
+}
+
+// PolicyError is returned when a Policy does not allow what was requested,
+// naming the rule that was broken. It matches ErrForbidden.
+type PolicyError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%v: policy rule %s: %s", ErrForbidden, e.Rule, e.Reason)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrForbidden
+}
+
+// Check returns a PolicyError if the Policy does not allow sending the given
+// Operation with the given Intensity, held for the given duration, to the
+// device with the given name (empty if none is named) on the given Channel
+// at the given time.
+func (p Policy) Check(now time.Time, dev string, ch types.Channel, op types.Operation, intensity types.Intensity, duration time.Duration) error {
+	if p.ValidFrom != nil && now.Before(*p.ValidFrom) {
+		return &PolicyError{"valid-from", fmt.Sprintf("key may only be used from %v", p.ValidFrom.Format(time.RFC3339))}
+	}
+
+	if p.ValidUntil != nil && !now.Before(*p.ValidUntil) {
+		return &PolicyError{"valid-until", fmt.Sprintf("key may only be used until %v", p.ValidUntil.Format(time.RFC3339))}
+	}
+
+	if len(p.Devices) > 0 && dev == "" {
+		return &PolicyError{"devices", fmt.Sprintf("channel %v not allowed without naming a device", ch)}
+	} else if len(p.Devices) > 0 && !contains(p.Devices, dev) {
+		return &PolicyError{"devices", fmt.Sprintf("device %s not allowed", dev)}
+	}
+
+	if len(p.Channels) > 0 && !contains(p.Channels, ch) {
+		return &PolicyError{"channels", fmt.Sprintf("channel %v not allowed", ch)}
+	}
+
+	if len(p.Operations) > 0 && !contains(p.Operations, op) {
+		return &PolicyError{"operations", fmt.Sprintf("%v not allowed", op)}
+	}
+
+	if max, ok := p.MaxIntensity[op]; ok && intensity > max {
+		return &PolicyError{"max-intensity", fmt.Sprintf("%v with intensity %v requested, maximum is %v", op, intensity, max)}
+	}
+
+	if p.MaxDuration > 0 && duration > p.MaxDuration {
+		return &PolicyError{"max-duration", fmt.Sprintf("%v requested, maximum is %v", duration, p.MaxDuration)}
+	}
+
+	return nil
+}
+
+// Get returns the setting with the given name in the format Set parses, or
+// an empty string if it is not limited.
+func (p Policy) Get(name string) string {
+	switch name {
+	case "devices":
+		return strings.Join(p.Devices, ",")
+	case "channels":
+		return join(p.Channels)
+	case "operations":
+		return join(p.Operations)
+	case "max-intensity":
+		parts := make([]string, 0, len(p.MaxIntensity))
+		for op, max := range p.MaxIntensity {
+			parts = append(parts, fmt.Sprintf("%v=%v", op, max))
+		}
+
+		sort.Strings(parts)
+		return strings.Join(parts, ",")
+	case "max-duration":
+		if p.MaxDuration > 0 {
+			return p.MaxDuration.String()
+		}
+	case "valid-from":
+		if p.ValidFrom != nil {
+			return p.ValidFrom.Format(time.RFC3339)
+		}
+	case "valid-until":
+		if p.ValidUntil != nil {
+			return p.ValidUntil.Format(time.RFC3339)
+		}
+	}
+
+	return ""
+}
+
+// Set parses the given value into the setting with the given name, one of
+// PolicySettings. Devices, channels and operations are comma separated lists,
+// max-intensity a comma separated list of "operation=intensity" pairs,
+// max-duration a duration and valid-from and valid-until RFC 3339 times. An
+// empty value removes the limit.
+func (p *Policy) Set(name, value string) error {
+	var err error
+
+	switch name {
+	case "devices":
+		p.Devices = nil
+		if value != "" {
+			p.Devices = strings.Split(value, ",")
+		}
+	case "channels":
+		p.Channels, err = split[types.Channel](value)
+	case "operations":
+		p.Operations, err = split[types.Operation](value)
+	case "max-intensity":
+		p.MaxIntensity, err = parseMaxIntensity(value)
+	case "max-duration":
+		p.MaxDuration = 0
+		if value != "" {
+			p.MaxDuration, err = time.ParseDuration(value)
+		}
+	case "valid-from":
+		p.ValidFrom, err = parseTime(value)
+	case "valid-until":
+		p.ValidUntil, err = parseTime(value)
+	default:
+		return fmt.Errorf("%w: unknown policy setting %q", types.ErrUnparsable, name)
+	}
+
+	if errors.Is(err, types.ErrUnparsable) {
+		return fmt.Errorf("error parsing %s: %w", name, err)
+	} else if err != nil {
+		return fmt.Errorf("%w: %s: %v", types.ErrUnparsable, name, err)
+	}
+
+	return nil
+}
+
+func contains[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func join[T fmt.Stringer](values []T) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = v.String()
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// split parses a comma separated list of values.
+func split[T any, PT interface {
+	*T
+	Set(string) error
+}](s string) ([]T, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, ",")
+
+	ret := make([]T, len(parts))
+	for i, part := range parts {
+		if err := PT(&ret[i]).Set(part); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func parseMaxIntensity(s string) (map[types.Operation]types.Intensity, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	ret := make(map[types.Operation]types.Intensity)
+	for _, part := range strings.Split(s, ",") {
+		opString, intensityString, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not in operation=intensity format", part)
+		}
+
+		var op types.Operation
+		if err := op.Set(opString); err != nil {
+			return nil, err
+		}
+
+		var intensity types.Intensity
+		if err := intensity.Set(intensityString); err != nil {
+			return nil, fmt.Errorf("error parsing intensity for %v: %w", op, err)
+		}
+
+		ret[op] = intensity
+	}
+
+	return ret, nil
+}
+
+func parseTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
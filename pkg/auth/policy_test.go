@@ -0,0 +1,100 @@
+package auth_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Policy", func() {
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	policy := auth.Policy{}
+	for setting, value := range map[string]string{
+		"devices":       "alex-collar,sam-collar",
+		"channels":      "1",
+		"operations":    "beep,vibrate,shock",
+		"max-intensity": "shock=10,vibrate=50",
+		"max-duration":  "5s",
+		"valid-from":    "2023-07-01T10:00:00Z",
+		"valid-until":   "2023-07-01T14:00:00Z",
+	} {
+		if err := policy.Set(setting, value); err != nil {
+			panic(err)
+		}
+	}
+
+	It("allows what is not limited", func() {
+		Expect(auth.Policy{}.Check(now, "", types.Channel2, types.OperationShock, 100, time.Hour)).To(Succeed())
+	})
+
+	It("allows what is within its limits", func() {
+		Expect(policy.Check(now, "alex-collar", types.Channel1, types.OperationShock, 10, 5*time.Second)).To(Succeed())
+		Expect(policy.Check(now, "alex-collar", types.Channel1, types.OperationBeep, 100, 0)).To(Succeed())
+	})
+
+	DescribeTable("names the rule broken",
+		func(at time.Time, ch types.Channel, op types.Operation, intensity int, duration time.Duration, rule string) {
+			err := policy.Check(at, "sam-collar", ch, op, types.Intensity(intensity), duration)
+			Expect(err).To(MatchError(auth.ErrForbidden))
+
+			var policyErr *auth.PolicyError
+			Expect(errors.As(err, &policyErr)).To(BeTrue())
+			Expect(policyErr.Rule).To(Equal(rule))
+		},
+		Entry("channel", now, types.Channel2, types.OperationBeep, 0, time.Duration(0), "channels"),
+		Entry("intensity", now, types.Channel1, types.OperationVibrate, 51, time.Duration(0), "max-intensity"),
+		Entry("duration", now, types.Channel1, types.OperationVibrate, 10, 6*time.Second, "max-duration"),
+		Entry("too early", now.Add(-3*time.Hour), types.Channel1, types.OperationBeep, 0, time.Duration(0), "valid-from"),
+		Entry("too late", now.Add(2*time.Hour), types.Channel1, types.OperationBeep, 0, time.Duration(0), "valid-until"),
+	)
+
+	It("limits devices", func() {
+		err := policy.Check(now, "kim-collar", types.Channel1, types.OperationBeep, 0, 0)
+		Expect(err).To(MatchError(ContainSubstring("policy rule devices: device kim-collar not allowed")))
+
+		err = policy.Check(now, "", types.Channel1, types.OperationBeep, 0, 0)
+		Expect(err).To(MatchError(ContainSubstring("policy rule devices: channel 1 not allowed without naming a device")))
+	})
+
+	It("limits operations", func() {
+		limited := auth.Policy{}
+		Expect(limited.Set("operations", "beep,vibrate")).To(Succeed())
+
+		err := limited.Check(now, "", types.Channel1, types.OperationShock, 1, 0)
+		Expect(err).To(MatchError(ContainSubstring("policy rule operations")))
+	})
+
+	It("formats settings as it parses them", func() {
+		for _, setting := range auth.PolicySettings {
+			parsed := auth.Policy{}
+			Expect(parsed.Set(setting, policy.Get(setting))).To(Succeed())
+			Expect(parsed.Get(setting)).To(Equal(policy.Get(setting)))
+		}
+
+		Expect(policy.Get("max-intensity")).To(Equal("shock=10,vibrate=50"))
+	})
+
+	It("removes limits with empty values", func() {
+		removed := policy
+		Expect(removed.Set("channels", "")).To(Succeed())
+		Expect(removed.Channels).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid settings",
+		func(setting, value string) {
+			Expect((&auth.Policy{}).Set(setting, value)).To(MatchError(types.ErrUnparsable))
+		},
+		Entry("unknown setting", "max-fun", "1"),
+		Entry("unknown channel", "channels", "3"),
+		Entry("unknown operation", "operations", "tickle"),
+		Entry("intensity out of range", "max-intensity", "shock=101"),
+		Entry("intensity format", "max-intensity", "shock"),
+		Entry("duration", "max-duration", "forever"),
+		Entry("time", "valid-until", "tomorrow"),
+	)
+})
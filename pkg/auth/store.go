@@ -0,0 +1,385 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Key is an API key as stored in the Store. The secret part of the key is
+// only known to its holder, the Store only keeps a bcrypt hash of it.
+type Key struct {
+	ID       string     `json:"id"`
+	Label    string     `json:"label"`
+	Admin    bool       `json:"admin,omitempty"`
+	Wearer   bool       `json:"wearer,omitempty"`
+	Approver bool       `json:"approver,omitempty"`
+	Hash     string     `json:"hash"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Revoked  *time.Time `json:"revoked,omitempty"`
+	Policy   Policy     `json:"policy"`
+}
+
+// Active returns nil if the Key can be used at the given time, otherwise
+// ErrKeyRevoked or ErrKeyExpired.
+func (k Key) Active(now time.Time) error {
+	if k.Revoked != nil {
+		return fmt.Errorf("%w: %s", ErrKeyRevoked, k.ID)
+	}
+
+	if k.Expires != nil && !now.Before(*k.Expires) {
+		return fmt.Errorf("%w: %s", ErrKeyExpired, k.ID)
+	}
+
+	return nil
+}
+
+// WearerOf returns if the Key is a wearer key for the device with the given
+// name, or for Channels not naming a device if name is empty: wearer keys
+// limited to some devices by their Policy wear only those, others all of
+// them.
+func (k Key) WearerOf(name string) bool {
+	if !k.Wearer || len(k.Policy.Devices) == 0 {
+		return k.Wearer
+	}
+
+	return name != "" && contains(k.Policy.Devices, name)
+}
+
+// Store is a file-based store of API keys. API keys look like
+// "<id>.<secret>", the ID identifying the Key in the Store and for auditing,
+// the secret being checked against the stored hash. The file is read again
+// whenever it changed, so changes made by other processes, like the keys
+// subcommand while a server is running, take effect right away and are not
+// overwritten.
+type Store struct {
+	path  string
+	clock clock.Clock
+
+	mu   sync.Mutex
+	keys map[string]*Key
+
+	// file is the state of the file when it was last read or written,
+	// nil if it did not exist.
+	file fs.FileInfo
+
+	// verified maps SHA-256 hashes of API keys already checked against
+	// their bcrypt hash to the Key ID, to not run bcrypt on every request.
+	verified map[string]string
+}
+
+// OpenStore opens the Store persisted in the given file, creating it when
+// the first key is created.
+func OpenStore(path string, c clock.Clock) (*Store, error) {
+	s := &Store{
+		path:     path,
+		clock:    c,
+		keys:     make(map[string]*Key),
+		verified: make(map[string]string),
+	}
+
+	if err := s.reloadLocked(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// reloadLocked reads the store file again if it changed since it was last
+// read or written, s.mu has to be locked. The keys are kept as they are if it
+// does not exist (anymore) or cannot be read.
+func (s *Store) reloadLocked() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading key store: %w", err)
+	}
+
+	if s.file != nil && os.SameFile(s.file, info) && s.file.ModTime().Equal(info.ModTime()) && s.file.Size() == info.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("error reading key store: %w", err)
+	}
+
+	keys := make([]*Key, 0)
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("error parsing key store: %w", err)
+	}
+
+	s.keys = make(map[string]*Key, len(keys))
+	for _, key := range keys {
+		s.keys[key.ID] = key
+	}
+
+	// hashes may have changed for the same IDs
+	s.verified = make(map[string]string)
+	s.file = info
+	return nil
+}
+
+// refreshLocked is reloadLocked for reading keys, logging errors and going on
+// with the keys read before.
+func (s *Store) refreshLocked() {
+	if err := s.reloadLocked(); err != nil {
+		log.Printf("auth: keeping the keys read before: %v", err)
+	}
+}
+
+// Create generates a new API key with the label, roles, Policy and expiry
+// time of the given Key, returning the API key to hand out (it cannot be
+// recovered later) and the stored Key.
+func (s *Store) Create(template Key) (string, Key, error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 24)
+
+	if _, err := rand.Read(id); err != nil {
+		return "", Key{}, fmt.Errorf("error generating key: %w", err)
+	}
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", Key{}, fmt.Errorf("error generating key: %w", err)
+	}
+
+	secretString := base64.RawURLEncoding.EncodeToString(secret)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secretString), bcrypt.DefaultCost)
+	if err != nil {
+		return "", Key{}, fmt.Errorf("error hashing key: %w", err)
+	}
+
+	key := &Key{
+		ID:       hex.EncodeToString(id),
+		Label:    template.Label,
+		Admin:    template.Admin,
+		Wearer:   template.Wearer,
+		Approver: template.Approver,
+		Hash:     string(hash),
+		Created:  s.clock.Now(),
+		Expires:  template.Expires,
+		Policy:   template.Policy,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reloadLocked(); err != nil {
+		return "", Key{}, err
+	}
+
+	s.keys[key.ID] = key
+	if err := s.saveLocked(); err != nil {
+		delete(s.keys, key.ID)
+		return "", Key{}, err
+	}
+
+	return key.ID + "." + secretString, *key, nil
+}
+
+// Authenticate checks the given API key, returning the Key if it is known
+// and active.
+func (s *Store) Authenticate(apiKey string) (Key, error) {
+	id, secret, ok := strings.Cut(apiKey, ".")
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+
+	sum := sha256.Sum256([]byte(apiKey))
+	fingerprint := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	s.refreshLocked()
+	key, ok := s.keys[id]
+	if !ok {
+		s.mu.Unlock()
+		return Key{}, ErrUnknownKey
+	}
+
+	stored := *key
+	verified := s.verified[fingerprint] == id
+	s.mu.Unlock()
+
+	if !verified {
+		if err := bcrypt.CompareHashAndPassword([]byte(stored.Hash), []byte(secret)); err != nil {
+			return Key{}, ErrUnknownKey
+		}
+
+		s.mu.Lock()
+		s.verified[fingerprint] = id
+		s.mu.Unlock()
+	}
+
+	if err := stored.Active(s.clock.Now()); err != nil {
+		return Key{}, err
+	}
+
+	return stored, nil
+}
+
+// Lookup returns the Key with the given ID if it is active, used to check
+// actions done on behalf of a key later, like scheduled ones.
+func (s *Store) Lookup(id string) (Key, error) {
+	key, err := s.Get(id)
+	if err != nil {
+		return Key{}, err
+	}
+
+	if err := key.Active(s.clock.Now()); err != nil {
+		return Key{}, err
+	}
+
+	return key, nil
+}
+
+// Authorize checks that the Key with the given ID is active and its Policy
+// allows sending the given Operation with the given Intensity, held for the
+// given duration, to the given device (empty if none) on the given Channel.
+func (s *Store) Authorize(id, dev string, ch types.Channel, op types.Operation, intensity types.Intensity, duration time.Duration) error {
+	key, err := s.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	return key.Policy.Check(s.clock.Now(), dev, ch, op, intensity, duration)
+}
+
+// Get returns the Key with the given ID, active or not.
+func (s *Store) Get(id string) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshLocked()
+	key, ok := s.keys[id]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	return *key, nil
+}
+
+// List returns all Keys, ordered by their creation time.
+func (s *Store) List() []Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshLocked()
+	ret := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		ret = append(ret, *key)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Created.Before(ret[j].Created)
+	})
+
+	return ret
+}
+
+// Revoke makes the Key with the given ID unusable from now on. It is kept in
+// the Store for auditing.
+func (s *Store) Revoke(id string) (Key, error) {
+	return s.update(id, func(key *Key) {
+		now := s.clock.Now()
+		key.Revoked = &now
+	})
+}
+
+// Expire sets the time the Key with the given ID expires at.
+func (s *Store) Expire(id string, at time.Time) (Key, error) {
+	return s.update(id, func(key *Key) {
+		key.Expires = &at
+	})
+}
+
+// SetPolicy replaces the Policy of the Key with the given ID.
+func (s *Store) SetPolicy(id string, policy Policy) (Key, error) {
+	return s.update(id, func(key *Key) {
+		key.Policy = policy
+	})
+}
+
+func (s *Store) update(id string, f func(*Key)) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reloadLocked(); err != nil {
+		return Key{}, err
+	}
+
+	key, ok := s.keys[id]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	previous := *key
+	f(key)
+
+	if err := s.saveLocked(); err != nil {
+		*key = previous
+		return Key{}, err
+	}
+
+	return *key, nil
+}
+
+// saveLocked writes all keys to the store file, s.mu has to be locked.
+func (s *Store) saveLocked() error {
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Created.Before(keys[j].Created)
+	})
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding key store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing key store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing key store: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing key store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error writing key store: %w", err)
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		s.file = info
+	}
+
+	return nil
+}
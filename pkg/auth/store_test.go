@@ -0,0 +1,168 @@
+package auth_test
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		path  string
+		fake  *clock.Fake
+		store *auth.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		path = filepath.Join(GinkgoT().TempDir(), "keys.json")
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		store, err = auth.OpenStore(path, fake)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("authenticates created keys", func() {
+		apiKey, key, err := store.Create(auth.Key{Label: "alice"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apiKey).To(HavePrefix(key.ID + "."))
+		Expect(key.Hash).NotTo(ContainSubstring(strings.TrimPrefix(apiKey, key.ID+".")))
+
+		authenticated, err := store.Authenticate(apiKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(authenticated.Label).To(Equal("alice"))
+
+		// second time from the cache of verified keys
+		_, err = store.Authenticate(apiKey)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("rejects unknown keys and wrong secrets", func() {
+		apiKey, key, err := store.Create(auth.Key{Label: "alice"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.Authenticate(key.ID + ".wrong")
+		Expect(err).To(MatchError(auth.ErrUnauthorized))
+
+		_, err = store.Authenticate("hellorld!")
+		Expect(err).To(MatchError(auth.ErrUnauthorized))
+
+		_, err = store.Authenticate("000000000000" + strings.TrimPrefix(apiKey, key.ID))
+		Expect(err).To(MatchError(auth.ErrUnknownKey))
+	})
+
+	It("rejects revoked keys", func() {
+		apiKey, key, err := store.Create(auth.Key{Label: "alice"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.Authenticate(apiKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.Revoke(key.ID)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.Authenticate(apiKey)
+		Expect(err).To(MatchError(auth.ErrKeyRevoked))
+
+		_, err = store.Lookup(key.ID)
+		Expect(err).To(MatchError(auth.ErrUnauthorized))
+	})
+
+	It("rejects expired keys", func() {
+		expires := fake.Now().Add(time.Hour)
+		apiKey, key, err := store.Create(auth.Key{Label: "alice", Expires: &expires})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.Authenticate(apiKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		fake.Advance(time.Hour)
+
+		_, err = store.Authenticate(apiKey)
+		Expect(err).To(MatchError(auth.ErrKeyExpired))
+
+		_, err = store.Expire(key.ID, fake.Now().Add(time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.Authenticate(apiKey)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("authorizes with the policy of the key", func() {
+		policy := auth.Policy{}
+		Expect(policy.Set("max-intensity", "shock=10")).To(Succeed())
+
+		_, key, err := store.Create(auth.Key{Label: "alice", Policy: policy})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(store.Authorize(key.ID, "", types.Channel1, types.OperationShock, 10, 0)).To(Succeed())
+		Expect(store.Authorize(key.ID, "", types.Channel1, types.OperationShock, 11, 0)).To(MatchError(ContainSubstring("policy rule max-intensity")))
+
+		_, err = store.SetPolicy(key.ID, auth.Policy{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Authorize(key.ID, "", types.Channel1, types.OperationShock, 11, 0)).To(Succeed())
+
+		_, err = store.Revoke(key.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Authorize(key.ID, "", types.Channel1, types.OperationBeep, 0, 0)).To(MatchError(auth.ErrKeyRevoked))
+	})
+
+	It("limits wearer keys to the devices of their policy", func() {
+		_, key, err := store.Create(auth.Key{Label: "wearer", Wearer: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.WearerOf("alex-collar")).To(BeTrue())
+		Expect(key.WearerOf("")).To(BeTrue())
+
+		key, err = store.SetPolicy(key.ID, auth.Policy{Devices: []string{"alex-collar"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.WearerOf("alex-collar")).To(BeTrue())
+		Expect(key.WearerOf("sam-collar")).To(BeFalse())
+		Expect(key.WearerOf("")).To(BeFalse())
+
+		Expect(auth.Key{Policy: key.Policy}.WearerOf("alex-collar")).To(BeFalse())
+	})
+
+	It("persists keys", func() {
+		apiKey, key, err := store.Create(auth.Key{Label: "alice", Admin: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		reopened, err := auth.OpenStore(path, fake)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.List()).To(HaveLen(1))
+
+		authenticated, err := reopened.Authenticate(apiKey)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(authenticated.ID).To(Equal(key.ID))
+		Expect(authenticated.Admin).To(BeTrue())
+	})
+
+	It("picks up changes made by another process", func() {
+		apiKey, key, err := store.Create(auth.Key{Label: "alice"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// like the keys subcommand while the server is running
+		other, err := auth.OpenStore(path, fake)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = other.Revoke(key.ID)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.Authenticate(apiKey)
+		Expect(err).To(MatchError(auth.ErrKeyRevoked))
+
+		_, bob, err := store.Create(auth.Key{Label: "bob"})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(other.List()).To(HaveLen(2))
+		alice, err := other.Get(key.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alice.Revoked).NotTo(BeNil())
+		Expect(other.Get(bob.ID)).To(HaveField("Label", "bob"))
+	})
+})
@@ -0,0 +1,36 @@
+package calibration
+
+import (
+	"errors"
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var (
+	// ErrUnknownFlow is returned when there is no Flow for a device.
+	ErrUnknownFlow = errors.New("no calibration running")
+
+	// ErrRunning is returned when starting a Flow for a device already
+	// being calibrated.
+	ErrRunning = errors.New("calibration already running")
+
+	// ErrFinished is returned when stepping through a Flow already
+	// finished.
+	ErrFinished = errors.New("calibration finished")
+
+	// ErrNotFinished is returned when applying a Flow still running.
+	ErrNotFinished = errors.New("calibration not finished yet")
+
+	// ErrOutOfOrder is returned when giving feedback before the step was
+	// sent, or sending a step while the previous one is still sent.
+	ErrOutOfOrder = errors.New("calibration step out of order")
+
+	// ErrNoSuggestion is returned when applying a Flow in which nothing
+	// was felt.
+	ErrNoSuggestion = errors.New("no calibration to apply, nothing was felt")
+
+	// ErrInvalidFlow is returned for Flows and Feedback that make no
+	// sense.
+	ErrInvalidFlow = fmt.Errorf("%w: invalid calibration", types.ErrUnparsable)
+)
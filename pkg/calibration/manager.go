@@ -0,0 +1,430 @@
+// Package calibration implements the guided calibration of devices: raw
+// Intensities are sent to a device step by step, the wearer telling how each
+// of them felt, and a device.Calibration is suggested from that feedback.
+package calibration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Feeling is the feedback of the wearer on a step.
+type Feeling string
+
+const (
+	// FeelingNothing tells the step was not felt at all.
+	FeelingNothing Feeling = "nothing"
+
+	// FeelingNoticeable tells the step was barely felt.
+	FeelingNoticeable Feeling = "noticeable"
+
+	// FeelingComfortable tells the step was clearly felt, but comfortable.
+	FeelingComfortable Feeling = "comfortable"
+
+	// FeelingIntense tells the step was intense, but still fine.
+	FeelingIntense Feeling = "intense"
+
+	// FeelingTooMuch tells the step was too much, ending the Flow.
+	FeelingTooMuch Feeling = "too-much"
+)
+
+// Set parses the given string into the Feeling this method is called on,
+// returning ErrInvalidFlow for unknown ones.
+func (f *Feeling) Set(s string) error {
+	switch Feeling(s) {
+	case FeelingNothing, FeelingNoticeable, FeelingComfortable, FeelingIntense, FeelingTooMuch:
+		*f = Feeling(s)
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown feeling %q", ErrInvalidFlow, s)
+	}
+}
+
+// felt returns if the step was felt and was not too much.
+func (f Feeling) felt() bool {
+	return f == FeelingNoticeable || f == FeelingComfortable || f == FeelingIntense
+}
+
+// State is the state of a Flow.
+type State string
+
+const (
+	// StateRunning is the State of Flows still stepping through their
+	// Intensities.
+	StateRunning State = "running"
+
+	// StateDone is the State of Flows through all their steps or ended by
+	// FeelingTooMuch.
+	StateDone State = "done"
+
+	// StateCancelled is the State of Flows cancelled before they were
+	// done.
+	StateCancelled State = "cancelled"
+)
+
+// Step is a single raw Intensity sent to the device, with the Feeling of the
+// wearer once given.
+type Step struct {
+	Intensity types.Intensity `json:"intensity"`
+	Sent      *time.Time      `json:"sent,omitempty"`
+	Feeling   Feeling         `json:"feeling,omitempty"`
+}
+
+// Flow is the guided calibration of a single device for an Operation. Steps
+// are sent one at a time, each one is sent until the wearer gave their
+// Feeling about it.
+type Flow struct {
+	ID        string          `json:"id"`
+	Device    string          `json:"device"`
+	Operation types.Operation `json:"operation"`
+	KeyID     string          `json:"keyId"`
+	State     State           `json:"state"`
+	Started   time.Time       `json:"started"`
+
+	// Steps are the raw Intensities sent, Current the index of the one
+	// sent or to be sent next.
+	Steps   []Step `json:"steps"`
+	Current int    `json:"current"`
+
+	// Suggested is the Calibration suggested by the feedback once the Flow
+	// is done, Applied tells if it was applied to the device.
+	Suggested *device.Calibration `json:"suggested,omitempty"`
+	Applied   bool                `json:"applied,omitempty"`
+}
+
+type flow struct {
+	Flow
+	sending bool
+	cancel  context.CancelCauseFunc
+}
+
+// Dispatcher is where Flows send their steps, usually a command.Dispatcher.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, keyID string, cmd command.Command) error
+}
+
+// Manager runs the Flows, at most one per device.
+type Manager struct {
+	dispatcher Dispatcher
+	devices    *device.Registry
+	clock      clock.Clock
+
+	mu    sync.Mutex
+	flows map[string]*flow
+}
+
+// NewManager creates a Manager sending steps to the Devices of the given
+// Registry through the given Dispatcher, applying the Calibrations to it.
+func NewManager(d Dispatcher, devices *device.Registry, c clock.Clock) *Manager {
+	return &Manager{
+		dispatcher: d,
+		devices:    devices,
+		clock:      c,
+		flows:      make(map[string]*flow),
+	}
+}
+
+// Steps returns the Intensities from from up to to, step apart.
+func Steps(from, to, step types.Intensity) ([]types.Intensity, error) {
+	if step == 0 || from > to || to > 100 {
+		return nil, fmt.Errorf("%w: steps must be 0 <= from <= to <= 100 and step above 0", ErrInvalidFlow)
+	}
+
+	ret := make([]types.Intensity, 0)
+	for i := int(from); i <= int(to); i += int(step) {
+		ret = append(ret, types.Intensity(i))
+	}
+
+	return ret, nil
+}
+
+// Start starts a Flow for the Device with the given name or alias, stepping
+// through the given raw Intensities of the given Operation on behalf of the
+// key with the given ID. It replaces the finished Flow of the Device, if
+// any, and returns ErrRunning if one is still running.
+func (m *Manager) Start(keyID, name string, op types.Operation, intensities []types.Intensity) (Flow, error) {
+	d, err := m.devices.Lookup(name)
+	if err != nil {
+		return Flow{}, err
+	}
+
+	if op != types.OperationShock && op != types.OperationVibrate {
+		return Flow{}, fmt.Errorf("%w: only shock and vibrate can be calibrated", ErrInvalidFlow)
+	}
+
+	if len(intensities) == 0 {
+		return Flow{}, fmt.Errorf("%w: no steps", ErrInvalidFlow)
+	}
+
+	steps := make([]Step, 0, len(intensities))
+	for i, intensity := range intensities {
+		if intensity > 100 || (i > 0 && intensity <= intensities[i-1]) {
+			return Flow{}, fmt.Errorf("%w: steps must rise up to 100 at most", ErrInvalidFlow)
+		}
+
+		steps = append(steps, Step{Intensity: intensity})
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Flow{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if f, ok := m.flows[d.Name]; ok && f.State == StateRunning {
+		return Flow{}, fmt.Errorf("%w: %s", ErrRunning, d.Name)
+	}
+
+	f := &flow{Flow: Flow{
+		ID:        id,
+		Device:    d.Name,
+		Operation: op,
+		KeyID:     keyID,
+		State:     StateRunning,
+		Started:   m.clock.Now(),
+		Steps:     steps,
+	}}
+	m.flows[d.Name] = f
+
+	return f.copy(), nil
+}
+
+// lookupLocked returns the Flow of the Device with the given name or alias,
+// m.mu has to be locked.
+func (m *Manager) lookupLocked(name string) (*flow, error) {
+	d, err := m.devices.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := m.flows[d.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFlow, d.Name)
+	}
+
+	return f, nil
+}
+
+// Get returns the Flow of the Device with the given name or alias.
+func (m *Manager) Get(name string) (Flow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.lookupLocked(name)
+	if err != nil {
+		return Flow{}, err
+	}
+
+	return f.copy(), nil
+}
+
+// Next sends the current step of the Flow of the Device with the given name
+// or alias on behalf of the key with the given ID, like any other Command of
+// that key, and waits until it was transmitted. Steps are sent again until
+// Feedback is given for them.
+func (m *Manager) Next(ctx context.Context, keyID, name string) (Flow, error) {
+	m.mu.Lock()
+	f, err := m.lookupLocked(name)
+	if err == nil && f.State != StateRunning {
+		err = fmt.Errorf("%w: %s is %s", ErrFinished, f.Device, f.State)
+	} else if err == nil && f.sending {
+		err = fmt.Errorf("%w: step %d is still sent", ErrOutOfOrder, f.Current)
+	}
+
+	if err != nil {
+		m.mu.Unlock()
+		return Flow{}, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		m.mu.Unlock()
+		return Flow{}, err
+	}
+
+	current := f.Current
+	cmd := command.Command{
+		ID:           id,
+		Device:       f.Device,
+		Operation:    f.Operation,
+		Intensity:    f.Steps[current].Intensity,
+		Uncalibrated: true,
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	f.sending, f.cancel = true, cancel
+	m.mu.Unlock()
+
+	err = m.dispatcher.Dispatch(ctx, keyID, cmd)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f.sending, f.cancel = false, nil
+	if err == nil && f.State == StateRunning {
+		now := m.clock.Now()
+		f.Steps[current].Sent = &now
+	}
+
+	return f.copy(), err
+}
+
+// Feedback records how the step sent last felt to the wearer and moves on
+// to the next one. The Flow is done after the last step or with
+// FeelingTooMuch, with a Calibration suggested.
+func (m *Manager) Feedback(name string, feeling Feeling) (Flow, error) {
+	if err := feeling.Set(string(feeling)); err != nil {
+		return Flow{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.lookupLocked(name)
+	if err != nil {
+		return Flow{}, err
+	}
+
+	switch {
+	case f.State != StateRunning:
+		return Flow{}, fmt.Errorf("%w: %s is %s", ErrFinished, f.Device, f.State)
+	case f.sending || f.Steps[f.Current].Sent == nil:
+		return Flow{}, fmt.Errorf("%w: step %d was not sent yet", ErrOutOfOrder, f.Current)
+	}
+
+	f.Steps[f.Current].Feeling = feeling
+	if feeling == FeelingTooMuch || f.Current == len(f.Steps)-1 {
+		f.State = StateDone
+		f.Suggested = suggest(f.Steps)
+	} else {
+		f.Current++
+	}
+
+	return f.copy(), nil
+}
+
+// Cancel cancels the Flow of the Device with the given name or alias,
+// stopping the step currently sent.
+func (m *Manager) Cancel(name string) (Flow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.lookupLocked(name)
+	if err != nil {
+		return Flow{}, err
+	}
+
+	if f.State != StateRunning {
+		return Flow{}, fmt.Errorf("%w: %s is %s", ErrFinished, f.Device, f.State)
+	}
+
+	f.State = StateCancelled
+	if f.cancel != nil {
+		f.cancel(fmt.Errorf("%w: cancelled", ErrFinished))
+	}
+
+	return f.copy(), nil
+}
+
+// Apply applies the Calibration suggested by the finished Flow of the
+// Device with the given name or alias to the Device.
+func (m *Manager) Apply(name string) (Flow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := m.lookupLocked(name)
+	if err != nil {
+		return Flow{}, err
+	}
+
+	switch {
+	case f.State != StateDone:
+		return Flow{}, fmt.Errorf("%w: %s is %s", ErrNotFinished, f.Device, f.State)
+	case f.Suggested == nil:
+		return Flow{}, ErrNoSuggestion
+	}
+
+	c := *f.Suggested
+	if err := m.devices.SetCalibration(f.Device, &c); err != nil {
+		return Flow{}, err
+	}
+
+	f.Applied = true
+	return f.copy(), nil
+}
+
+// suggest returns the Calibration suggested by the Feelings of the given
+// Steps, nil if nothing was felt: a table mapping the lowest Intensity
+// requested to the weakest step felt, 50 to the strongest one comfortable
+// and the highest Intensity to the strongest step felt that was not too
+// much.
+func suggest(steps []Step) *device.Calibration {
+	var lowest, comfortable, highest *types.Intensity
+	for i := range steps {
+		step := &steps[i]
+		if !step.Feeling.felt() {
+			continue
+		}
+
+		if lowest == nil {
+			lowest = &step.Intensity
+		}
+
+		if step.Feeling != FeelingIntense {
+			comfortable = &step.Intensity
+		}
+
+		highest = &step.Intensity
+	}
+
+	if lowest == nil {
+		return nil
+	}
+
+	points := []device.Point{{In: 0, Out: *lowest}}
+	if comfortable != nil && *comfortable > *lowest && *comfortable < *highest {
+		points = append(points, device.Point{In: 50, Out: *comfortable})
+	}
+	points = append(points, device.Point{In: 100, Out: *highest})
+
+	return &device.Calibration{
+		Curve:  device.CurveTable,
+		Max:    100,
+		Points: points,
+	}
+}
+
+// copy returns a copy of the Flow not sharing any memory with it.
+func (f *flow) copy() Flow {
+	ret := f.Flow
+	ret.Steps = append([]Step{}, f.Steps...)
+	if f.Suggested != nil {
+		suggested := *f.Suggested
+		suggested.Points = append([]device.Point{}, suggested.Points...)
+		ret.Suggested = &suggested
+	}
+
+	return ret
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
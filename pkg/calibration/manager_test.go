@@ -0,0 +1,193 @@
+package calibration_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/calibration"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// recordingDispatcher records the Commands dispatched, failing with err if
+// set.
+type recordingDispatcher struct {
+	mu   sync.Mutex
+	cmds []command.Command
+	err  error
+}
+
+func (d *recordingDispatcher) Dispatch(ctx context.Context, keyID string, cmd command.Command) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil {
+		return d.err
+	}
+
+	d.cmds = append(d.cmds, cmd)
+	return nil
+}
+
+var _ = Describe("Manager", func() {
+	var (
+		dispatcher *recordingDispatcher
+		devices    *device.Registry
+		manager    *calibration.Manager
+	)
+
+	BeforeEach(func() {
+		var err error
+		devices, err = device.NewRegistry([]device.Device{{
+			Name:        "alex-collar",
+			Aliases:     []string{"alex"},
+			Protocol:    device.ProtocolPetrainer,
+			Channel:     types.Channel1,
+			Calibration: &device.Calibration{Min: 10, Max: 60},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+
+		dispatcher = &recordingDispatcher{}
+		manager = calibration.NewManager(dispatcher, devices, clock.NewFake(time.Unix(0, 0)))
+	})
+
+	step := func(feeling calibration.Feeling) calibration.Flow {
+		_, err := manager.Next(context.Background(), "key", "alex")
+		Expect(err).NotTo(HaveOccurred())
+
+		flow, err := manager.Feedback("alex", feeling)
+		Expect(err).NotTo(HaveOccurred())
+		return flow
+	}
+
+	It("steps through raw intensities and suggests a Calibration", func() {
+		steps, err := calibration.Steps(10, 50, 10)
+		Expect(err).NotTo(HaveOccurred())
+
+		flow, err := manager.Start("key", "alex", types.OperationShock, steps)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(flow.Device).To(Equal("alex-collar"))
+		Expect(flow.Steps).To(HaveLen(5))
+
+		step(calibration.FeelingNothing)
+		step(calibration.FeelingNoticeable)
+		step(calibration.FeelingComfortable)
+		flow = step(calibration.FeelingTooMuch)
+
+		Expect(dispatcher.cmds).To(HaveLen(4))
+		Expect(dispatcher.cmds[3]).To(And(
+			HaveField("Device", "alex-collar"),
+			HaveField("Operation", types.OperationShock),
+			HaveField("Intensity", BeEquivalentTo(40)),
+			HaveField("Uncalibrated", true),
+		))
+
+		Expect(flow.State).To(Equal(calibration.StateDone))
+		Expect(flow.Suggested).To(Equal(&device.Calibration{
+			Curve:  device.CurveTable,
+			Max:    100,
+			Points: []device.Point{{In: 0, Out: 20}, {In: 100, Out: 30}},
+		}))
+
+		flow, err = manager.Apply("alex")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(flow.Applied).To(BeTrue())
+
+		alex, err := devices.Lookup("alex")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alex.Calibration.Apply(50)).To(BeEquivalentTo(25))
+	})
+
+	It("suggests the strongest comfortable intensity for the middle", func() {
+		_, err := manager.Start("key", "alex", types.OperationVibrate, []types.Intensity{20, 40, 60, 80})
+		Expect(err).NotTo(HaveOccurred())
+
+		step(calibration.FeelingNoticeable)
+		step(calibration.FeelingComfortable)
+		step(calibration.FeelingIntense)
+		flow := step(calibration.FeelingIntense)
+
+		Expect(flow.State).To(Equal(calibration.StateDone))
+		Expect(flow.Suggested.Points).To(Equal([]device.Point{{In: 0, Out: 20}, {In: 50, Out: 40}, {In: 100, Out: 80}}))
+	})
+
+	It("sends steps again until feedback is given", func() {
+		_, err := manager.Start("key", "alex", types.OperationShock, []types.Intensity{10, 20})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = manager.Feedback("alex", calibration.FeelingNothing)
+		Expect(err).To(MatchError(calibration.ErrOutOfOrder))
+
+		dispatcher.err = errors.New("broken")
+		_, err = manager.Next(context.Background(), "key", "alex")
+		Expect(err).To(MatchError("broken"))
+
+		dispatcher.err = nil
+		step(calibration.FeelingNothing)
+		flow, err := manager.Next(context.Background(), "key", "alex")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(flow.Current).To(Equal(1))
+
+		_, err = manager.Next(context.Background(), "key", "alex")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dispatcher.cmds).To(HaveExactElements(
+			HaveField("Intensity", BeEquivalentTo(10)),
+			HaveField("Intensity", BeEquivalentTo(20)),
+			HaveField("Intensity", BeEquivalentTo(20)),
+		))
+	})
+
+	It("suggests nothing if nothing was felt", func() {
+		_, err := manager.Start("key", "alex", types.OperationShock, []types.Intensity{10})
+		Expect(err).NotTo(HaveOccurred())
+
+		flow := step(calibration.FeelingNothing)
+		Expect(flow.Suggested).To(BeNil())
+
+		_, err = manager.Apply("alex")
+		Expect(err).To(MatchError(calibration.ErrNoSuggestion))
+	})
+
+	It("runs one Flow per device at a time", func() {
+		_, err := manager.Start("key", "alex", types.OperationShock, []types.Intensity{10})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = manager.Start("key", "alex-collar", types.OperationShock, []types.Intensity{10})
+		Expect(err).To(MatchError(calibration.ErrRunning))
+
+		_, err = manager.Apply("alex")
+		Expect(err).To(MatchError(calibration.ErrNotFinished))
+
+		flow, err := manager.Cancel("alex")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(flow.State).To(Equal(calibration.StateCancelled))
+
+		_, err = manager.Next(context.Background(), "key", "alex")
+		Expect(err).To(MatchError(calibration.ErrFinished))
+
+		_, err = manager.Start("key", "alex", types.OperationShock, []types.Intensity{10})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("rejects invalid Flows",
+		func(name string, op types.Operation, steps []types.Intensity, expected error) {
+			_, err := manager.Start("key", name, op, steps)
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("unknown device", "sam", types.OperationShock, []types.Intensity{10}, device.ErrUnknownDevice),
+		Entry("beep", "alex", types.OperationBeep, []types.Intensity{10}, calibration.ErrInvalidFlow),
+		Entry("no steps", "alex", types.OperationShock, nil, calibration.ErrInvalidFlow),
+		Entry("falling steps", "alex", types.OperationShock, []types.Intensity{20, 10}, calibration.ErrInvalidFlow),
+	)
+
+	It("returns ErrUnknownFlow without a Flow", func() {
+		_, err := manager.Get("alex")
+		Expect(err).To(MatchError(calibration.ErrUnknownFlow))
+	})
+})
@@ -0,0 +1,45 @@
+package clock
+
+import "time"
+
+// Clock is the source of time for everything depending on the time of day,
+// to be replaced with a Fake in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a Timer sending the current time on its channel
+	// after at least the given duration.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event, like time.Timer.
+type Timer interface {
+	// C returns the channel the time is sent on when the Timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing, returning false if it already
+	// fired or was stopped.
+	Stop() bool
+}
+
+// Real is the Clock using the system time.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
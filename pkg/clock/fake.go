@@ -0,0 +1,107 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock only moving forward when told to, for deterministic tests
+// of code depending on the time of day.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake creates a Fake Clock starting at the given time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the current time of the Fake Clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// NewTimer creates a Timer firing when the Fake Clock is advanced by at
+// least the given duration, right away if the duration is <= 0.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{
+		fake:     f,
+		deadline: f.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+
+	if d <= 0 {
+		t.c <- f.now
+		return t
+	}
+
+	f.timers = append(f.timers, t)
+	return t
+}
+
+// Advance moves the Fake Clock forward by the given duration, firing all
+// Timers due until then.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the Fake Clock to the given time, firing all Timers due until
+// then.
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = now
+
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		if t.deadline.After(now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- now
+		}
+	}
+
+	f.timers = pending
+}
+
+// Timers returns the number of Timers waiting to fire, to synchronize tests
+// with code creating Timers in the background.
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.timers)
+}
+
+type fakeTimer struct {
+	fake     *Fake
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.fake.mu.Lock()
+	defer t.fake.mu.Unlock()
+
+	for i, other := range t.fake.timers {
+		if other == t {
+			t.fake.timers = append(t.fake.timers[:i], t.fake.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Command is a request to send an Operation on a Channel, independent of
+// where it came from (HTTP API, timers, patterns, ...).
+type Command struct {
+	// ID identifies the Command in API responses and the audit log, it is
+	// optional.
+	ID string `json:"id,omitempty"`
+
+	// Device is the name of the device the Command is sent to, if any. The
+	// Channel is the one of the device then, its limits and calibration
+	// apply and it is sent from its remote.
+	Device string `json:"device,omitempty"`
+
+	Channel    types.Channel     `json:"channel"`
+	Operation  types.Operation   `json:"operation"`
+	Intensity  types.Intensity   `json:"intensity"`
+	Repetition driver.Repetition `json:"repetition"`
+
+	// Uncalibrated sends the Intensity to the device as it is, without
+	// its limits and calibration, for calibrating it.
+	Uncalibrated bool `json:"uncalibrated,omitempty"`
+}
+
+// Message builds the Message sending this Command.
+func (c Command) Message() *types.Message {
+	return types.NewMessage().
+		SetChannel(c.Channel).
+		SetOperation(c.Operation).
+		SetIntensity(c.Intensity).
+		Build()
+}
+
+// Target returns the device.Target the Command is sent to.
+func (c Command) Target() device.Target {
+	return device.Target{Device: c.Device, Channel: c.Channel}
+}
+
+// Job returns the transmit.Job sending this Command, on the default remote.
+// Commands sent to a device are turned into Jobs by the Dispatcher.
+func (c Command) Job() transmit.Job {
+	return transmit.Job{
+		Message:    c.Message(),
+		Priority:   transmit.PriorityFor(c.Operation),
+		Repetition: c.Repetition,
+	}
+}
@@ -0,0 +1,543 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/approval"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/audit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/quiethours"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/safeword"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/session"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Config holds everything a Dispatcher checks Commands against. Keys is
+// required, everything else is optional.
+type Config struct {
+	Keys       *auth.Store
+	Limiter    *ratelimit.Limiter
+	Safewords  *safeword.Lock
+	Sessions   *session.Manager
+	Approvals  *approval.Manager
+	Audit      *audit.Log
+	Events     *event.Bus
+	Devices    *device.Registry
+	QuietHours *quiethours.Policy
+
+	// Instrumentation is told about every Command finished, instrument.Nop
+	// if nil.
+	Instrumentation instrument.Instrumentation
+}
+
+// Dispatcher is the single path all Commands take to the transmitter,
+// checking them against the limits of the key they are sent with first.
+// Keys are referred to by their ID, as Commands may be sent on behalf of a
+// key long after the request creating them, like scheduled ones.
+type Dispatcher struct {
+	transmitters *transmit.Router
+	config       Config
+}
+
+// NewDispatcher creates a Dispatcher sending Commands on the transmitters
+// of the given Router, checking them against everything in the given
+// Config.
+func NewDispatcher(transmitters *transmit.Router, config Config) *Dispatcher {
+	config.Instrumentation = instrument.Or(config.Instrumentation)
+
+	return &Dispatcher{
+		transmitters: transmitters,
+		config:       config,
+	}
+}
+
+// Check returns the error Dispatch would return before transmitting, without
+// transmitting anything. Used to validate Commands to be sent later. The
+// Policy of the key is checked against the Operation and Intensity
+// requested, before quiet hours and the calibration and limits of the device
+// change them.
+func (d *Dispatcher) Check(keyID string, cmd Command) error {
+	cmd, dev, err := d.resolve(cmd)
+	if err != nil {
+		return err
+	}
+
+	cmd, job, err := d.build(keyID, cmd, dev)
+	if err != nil {
+		return err
+	}
+
+	return d.check(keyID, cmd, job)
+}
+
+// authorize checks the given Command, transmitted as the given Job, against
+// the Policy of the key with the given ID.
+func (d *Dispatcher) authorize(keyID string, cmd Command, job transmit.Job) error {
+	return d.config.Keys.Authorize(keyID, cmd.Device, cmd.Channel, cmd.Operation, cmd.Intensity, d.transmitters.Length(job))
+}
+
+// check does the work of Check left after building a Command, checking it
+// against the Session of the key and the transmitters.
+func (d *Dispatcher) check(keyID string, cmd Command, job transmit.Job) error {
+	if d.config.Sessions != nil {
+		if err := d.config.Sessions.Check(keyID, cmd.Device, cmd.Operation, cmd.Intensity, d.held(job)); err != nil {
+			return err
+		}
+	}
+
+	return d.transmitters.Check(job)
+}
+
+// held returns for how long the given Job is held on air as counted by
+// Sessions: how long it takes to transmit, if held for a Duration or sending
+// frames for longer than an unheld shock counts, 0 for unheld otherwise.
+func (d *Dispatcher) held(job transmit.Job) time.Duration {
+	length := d.transmitters.Length(job)
+	if job.Repetition.Duration <= 0 && length <= session.UnheldShockTime {
+		return 0
+	}
+
+	return length
+}
+
+// resolve returns the Command with the Channel and name of the device it is
+// sent to, if any, and that device. Commands naming a Channel a device paired
+// with the default remote listens on are sent to that device, as they would
+// reach it anyway, and rejected if several devices listen there.
+func (d *Dispatcher) resolve(cmd Command) (Command, *device.Device, error) {
+	if cmd.Device == "" {
+		// Commands naming a Channel are sent from the default remote,
+		// reaching the Devices paired with it
+		switch devices := d.config.Devices.Listening(types.DefaultRemoteID, cmd.Channel); len(devices) {
+		case 0:
+		case 1:
+			cmd.Device = devices[0].Name
+		default:
+			names := make([]string, 0, len(devices))
+			for _, dev := range devices {
+				names = append(names, dev.Name)
+			}
+
+			return cmd, nil, fmt.Errorf("%w: channel %v used by %s, name one of them", device.ErrAmbiguousChannel, cmd.Channel, strings.Join(names, ", "))
+		}
+	}
+
+	var dev *device.Device
+	if cmd.Device != "" {
+		found, err := d.config.Devices.Lookup(cmd.Device)
+		if err != nil {
+			return cmd, nil, err
+		}
+
+		dev = &found
+		cmd.Device, cmd.Channel = dev.Name, dev.Channel
+	}
+
+	return cmd, dev, nil
+}
+
+// build returns the Command resolved to the given device, nil if none, as it
+// is sent and the transmit.Job sending it on the transmitters of the device.
+// The Command is checked against the Policy of the key as requested first.
+// The quiet hours open now are applied to it afterwards, possibly denying it
+// or sending it as vibration, and Commands exceeding the limits of their
+// device are rejected, unless they are Uncalibrated.
+func (d *Dispatcher) build(keyID string, cmd Command, dev *device.Device) (Command, transmit.Job, error) {
+	// the frames of a Command take as long whatever they carry, so the
+	// length of the Job is known before building its Message
+	requested := cmd.Job()
+	if dev != nil {
+		requested.Transmitters = dev.Transmitters
+	}
+
+	if err := d.authorize(keyID, cmd, requested); err != nil {
+		return cmd, transmit.Job{}, err
+	}
+
+	quiet, err := d.config.QuietHours.Apply(quiethours.Request{
+		KeyID:     keyID,
+		Device:    cmd.Device,
+		Channel:   cmd.Channel,
+		Operation: cmd.Operation,
+		Intensity: cmd.Intensity,
+	})
+	if err != nil {
+		return cmd, transmit.Job{}, err
+	}
+	cmd.Operation, cmd.Intensity = quiet.Operation, quiet.Intensity
+
+	if dev == nil {
+		return cmd, cmd.Job(), nil
+	}
+
+	msg := dev.RawMessage(cmd.Operation, cmd.Intensity)
+	if !cmd.Uncalibrated {
+		if msg, err = dev.Message(cmd.Operation, cmd.Intensity); err != nil {
+			return cmd, transmit.Job{}, err
+		}
+	}
+
+	return cmd, transmit.Job{
+		Message:    msg,
+		Priority:   transmit.PriorityFor(cmd.Operation),
+		Repetition: cmd.Repetition,
+
+		Transmitters: dev.Transmitters,
+	}, nil
+}
+
+// Dispatch checks the given Command against the safeword of its device,
+// the limits of the key with the given ID, the rate limits and the Session of
+// the key and sends it, waiting until it is transmitted. Commands requiring
+// approval are held until they are approved, checking them again afterwards,
+// and the safeword is checked once more when the transmitter starts sending
+// the Command after it waited in the queue. Only Commands actually sent count
+// against the rate limits and the budget of the Session, not those checked
+// with Check. Commands sent to a device are checked against its limits as
+// well. Quiet hours open deny Commands or send them as vibrations. Every
+// Command is recorded in the audit log with its outcome and the Operation
+// actually sent, together with the Origin carried by ctx, and published as
+// events.
+func (d *Dispatcher) Dispatch(ctx context.Context, keyID string, cmd Command) error {
+	cmd, job, err := d.admit(ctx, keyID, cmd)
+	if err != nil {
+		d.finish(ctx, keyID, cmd, false, err)
+		return err
+	}
+
+	// the safeword may be set while the Job is queued, after admit checked it
+	ctx = transmit.WithCheck(ctx, func() error { return d.checkSafeword(keyID, cmd) })
+
+	err = d.transmitters.Submit(ctx, job)
+	d.finish(ctx, keyID, cmd, true, err)
+	return err
+}
+
+// Broadcast dispatches the given Commands together, like to all devices of
+// a group, returning the error of each of them. Every Command is checked on
+// its own as by Dispatch, those allowed are sent at once: all Commands sent on
+// the same transmitter with the same Repetition are combined into a single
+// Job, their frames interleaved, so they are on air at nearly the same time.
+// As with Dispatch, Commands sent on several transmitters succeed if any of
+// them transmitted them. A combined Job is not transmitted at all if the
+// safeword of any of its Commands was set while it was queued.
+func (d *Dispatcher) Broadcast(ctx context.Context, keyID string, cmds []Command) []error {
+	cmds = append([]Command{}, cmds...)
+	jobs := make([]transmit.Job, len(cmds))
+	errs := make([]error, len(cmds))
+
+	var wg sync.WaitGroup
+	for i := range cmds {
+		i := i
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cmds[i], jobs[i], errs[i] = d.admit(ctx, keyID, cmds[i])
+			if errs[i] != nil {
+				d.finish(ctx, keyID, cmds[i], false, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	// combine the Jobs per transmitter, remembering the combined Jobs each
+	// Command is part of
+	var batches []transmit.Job
+	batchOf := make(map[string]int)
+	memberOf := make([][]int, len(cmds))
+	for i, job := range jobs {
+		if errs[i] != nil {
+			continue
+		}
+
+		transmitters := job.Transmitters
+		if len(transmitters) == 0 {
+			transmitters = []string{d.transmitters.Default().Name()}
+		}
+
+		for _, name := range transmitters {
+			key := fmt.Sprint(name, job.Repetition)
+
+			b, ok := batchOf[key]
+			if !ok {
+				b = len(batches)
+				batchOf[key] = b
+
+				batch := job
+				batch.Transmitters = []string{name}
+				batches = append(batches, batch)
+			} else {
+				batches[b].Interleaved = append(batches[b].Interleaved, job.Message)
+				if job.Priority < batches[b].Priority {
+					batches[b].Priority = job.Priority
+				}
+			}
+
+			memberOf[i] = append(memberOf[i], b)
+		}
+	}
+
+	membersOf := make([][]int, len(batches))
+	for i, members := range memberOf {
+		for _, b := range members {
+			membersOf[b] = append(membersOf[b], i)
+		}
+	}
+
+	batchErrs := make([]error, len(batches))
+	for b := range batches {
+		b := b
+
+		check := func() error {
+			for _, i := range membersOf[b] {
+				if err := d.checkSafeword(keyID, cmds[i]); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batchErrs[b] = d.transmitters.Submit(transmit.WithCheck(ctx, check), batches[b])
+		}()
+	}
+	wg.Wait()
+
+	for i, members := range memberOf {
+		if len(members) == 0 {
+			continue
+		}
+
+		errs[i] = batchErrs[members[0]]
+		for _, b := range members {
+			if batchErrs[b] == nil {
+				errs[i] = nil
+			}
+		}
+
+		d.finish(ctx, keyID, cmds[i], true, errs[i])
+	}
+
+	return errs
+}
+
+// finish records the outcome of the given Command in the audit log and
+// publishes it, with the error of submitting it if it was submitted to the
+// transmitters or the one it was rejected with otherwise.
+func (d *Dispatcher) finish(ctx context.Context, keyID string, cmd Command, submitted bool, err error) {
+	outcome, eventType := audit.OutcomeAccepted, event.TypeCommandTransmitted
+	if err != nil && (!submitted || errors.Is(err, transmit.ErrQueueFull) || errors.Is(err, transmit.ErrDutyCycleExceeded) || errors.Is(err, transmit.ErrRejected)) {
+		outcome, eventType = audit.OutcomeRejected, event.TypeCommandRejected
+	} else if err != nil {
+		outcome, eventType = audit.OutcomeFailed, event.TypeCommandFailed
+	}
+
+	record := d.record(ctx, keyID, cmd)
+	record.Type = audit.TypeCommand
+	record.Outcome = string(outcome)
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	d.audit(record)
+	d.publish(eventType, record, cmd)
+
+	d.config.Instrumentation.CommandFinished(cmd.Operation, cmd.Channel, string(outcome))
+	if outcome == audit.OutcomeRejected {
+		d.config.Instrumentation.CommandRejected(rejectReason(err))
+	}
+}
+
+// rejectReasons maps errors Commands are rejected with to the
+// instrument.Reason reported for them, the first matching one wins. More
+// specific errors come before those they wrap.
+var rejectReasons = []struct {
+	err    error
+	reason instrument.Reason
+}{
+	{quiethours.ErrQuietHours, instrument.ReasonQuietHours},
+	{safeword.ErrSafeword, instrument.ReasonSafeword},
+	{device.ErrIntensityLimit, instrument.ReasonDeviceLimit},
+	{ratelimit.ErrRateLimited, instrument.ReasonRateLimited},
+	{transmit.ErrQueueFull, instrument.ReasonQueueFull},
+	{transmit.ErrDutyCycleExceeded, instrument.ReasonDutyCycle},
+	{transmit.ErrDurationExceeded, instrument.ReasonDuration},
+	{approval.ErrDenied, instrument.ReasonApproval},
+	{approval.ErrExpired, instrument.ReasonApproval},
+	{session.ErrNoSession, instrument.ReasonSession},
+	{session.ErrSessionLimit, instrument.ReasonSession},
+	{auth.ErrForbidden, instrument.ReasonForbidden},
+	{auth.ErrUnauthorized, instrument.ReasonUnauthorized},
+	{types.ErrUnparsable, instrument.ReasonInvalid},
+	{transmit.ErrInvalidJob, instrument.ReasonInvalid},
+}
+
+// rejectReason returns the instrument.Reason a Command rejected with the
+// given error is reported with.
+func rejectReason(err error) instrument.Reason {
+	for _, r := range rejectReasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+
+	return instrument.ReasonOther
+}
+
+// admit resolves and checks a Command as described for Dispatch, up to
+// submitting it to the transmitters, returning it as it is sent and the
+// transmit.Job sending it.
+func (d *Dispatcher) admit(ctx context.Context, keyID string, cmd Command) (Command, transmit.Job, error) {
+	cmd, dev, err := d.resolve(cmd)
+	if err != nil {
+		return cmd, transmit.Job{}, err
+	}
+
+	if err := d.checkSafeword(keyID, cmd); err != nil {
+		return cmd, transmit.Job{}, err
+	}
+
+	cmd, job, err := d.build(keyID, cmd, dev)
+	if err != nil {
+		return cmd, job, err
+	}
+
+	if err := d.check(keyID, cmd, job); err != nil {
+		return cmd, job, err
+	}
+
+	if d.config.Approvals != nil && d.config.Approvals.Required(cmd.Operation, cmd.Intensity) {
+		request, err := d.config.Approvals.Request(ctx, keyID, cmd.Device, cmd.Channel, cmd.Operation, cmd.Intensity, d.transmitters.Length(job))
+
+		record := d.record(ctx, keyID, cmd)
+		record.Type = audit.TypeApproval
+		record.Outcome = string(request.State)
+		record.Approval = request.ID
+		record.DecidedBy = request.DecidedBy
+		d.audit(record)
+
+		if err != nil {
+			return cmd, job, err
+		}
+
+		// the key, its Policy, its Session and the safeword may have
+		// changed while waiting for approval. Only shocks are held for
+		// approval, which quiet hours did not change then.
+		if err := d.checkSafeword(keyID, cmd); err != nil {
+			return cmd, job, err
+		}
+
+		if err := d.authorize(keyID, cmd, job); err != nil {
+			return cmd, job, err
+		}
+
+		if err := d.check(keyID, cmd, job); err != nil {
+			return cmd, job, err
+		}
+	}
+
+	if d.config.Limiter != nil {
+		if err := d.config.Limiter.Allow(keyID, cmd.Target(), cmd.Operation); err != nil {
+			return cmd, job, err
+		}
+	}
+
+	if d.config.Sessions != nil {
+		if err := d.config.Sessions.Use(keyID, cmd.Device, cmd.Operation, cmd.Intensity, d.held(job)); err != nil {
+			return cmd, job, err
+		}
+	}
+
+	d.publish(event.TypeCommandAccepted, d.record(ctx, keyID, cmd), cmd)
+	return cmd, job, nil
+}
+
+// publish publishes an Event of the given Type for the Command described by
+// the given audit.Record.
+func (d *Dispatcher) publish(t event.Type, record audit.Record, cmd Command) {
+	d.config.Events.Publish(event.Event{
+		Type:     t,
+		Channel:  &cmd.Channel,
+		Device:   cmd.Device,
+		KeyID:    record.KeyID,
+		KeyLabel: record.KeyLabel,
+		Error:    record.Error,
+		Data:     cmd,
+	})
+}
+
+// record returns an audit.Record filled with everything known about the
+// Command and where it came from.
+func (d *Dispatcher) record(ctx context.Context, keyID string, cmd Command) audit.Record {
+	origin := OriginFrom(ctx)
+
+	ret := audit.Record{
+		CommandID:      cmd.ID,
+		Device:         cmd.Device,
+		KeyID:          keyID,
+		RemoteAddr:     origin.RemoteAddr,
+		Source:         origin.Source,
+		IdempotencyKey: origin.IdempotencyKey,
+		Channel:        cmd.Channel,
+		Operation:      cmd.Operation,
+		Intensity:      cmd.Intensity,
+		Duration:       cmd.Repetition.Duration,
+	}
+
+	if key, err := d.config.Keys.Get(keyID); err == nil {
+		ret.KeyLabel = key.Label
+	}
+
+	return ret
+}
+
+// audit appends the given Record to the audit log, if there is one.
+func (d *Dispatcher) audit(record audit.Record) {
+	if d.config.Audit == nil {
+		return
+	}
+
+	d.config.Audit.Record(record)
+}
+
+// checkSafeword checks the Command against the safeword of its device, or
+// its Channel if it names none, logging it when rejected. Devices paired with
+// the default remote are reached by Commands naming their Channel as well, so
+// the safeword of their Channel applies to them too.
+func (d *Dispatcher) checkSafeword(keyID string, cmd Command) error {
+	if d.config.Safewords == nil {
+		return nil
+	}
+
+	targets := []device.Target{cmd.Target()}
+	if cmd.Device != "" {
+		if dev, err := d.config.Devices.Lookup(cmd.Device); err != nil || dev.RemoteID == types.DefaultRemoteID {
+			targets = append(targets, device.Target{Channel: cmd.Channel})
+		}
+	}
+
+	for _, target := range targets {
+		if err := d.config.Safewords.Check(target, cmd.Operation, cmd.Intensity); err != nil {
+			log.Printf("dispatch: rejected %v with intensity %v on %v for key %s: %v", cmd.Operation, cmd.Intensity, cmd.Target(), keyID, err)
+			return err
+		}
+	}
+
+	return nil
+}
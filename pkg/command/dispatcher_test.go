@@ -0,0 +1,403 @@
+package command_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/approval"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/quiethours"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/safeword"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/session"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// recordingDriver records all Messages it was asked to send. If gate is set,
+// every Output call blocks until something is received on it.
+type recordingDriver struct {
+	gate chan struct{}
+
+	mu   sync.Mutex
+	sent []*types.Message
+}
+
+func (d *recordingDriver) Output(m *types.Message) error {
+	if d.gate != nil {
+		<-d.gate
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sent = append(d.sent, m)
+	return nil
+}
+
+func (d *recordingDriver) Sent() []*types.Message {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]*types.Message(nil), d.sent...)
+}
+
+// rejections records the Reasons Commands were rejected with.
+type rejections struct {
+	instrument.Nop
+
+	mu      sync.Mutex
+	reasons []instrument.Reason
+}
+
+func (r *rejections) CommandRejected(reason instrument.Reason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reasons = append(r.reasons, reason)
+}
+
+func (r *rejections) Reasons() []instrument.Reason {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]instrument.Reason(nil), r.reasons...)
+}
+
+var _ = Describe("Dispatcher", func() {
+	var (
+		dir       string
+		fake      *clock.Fake
+		drv       *recordingDriver
+		scheduler *transmit.Scheduler
+		router    *transmit.Router
+		keys      *auth.Store
+		safewords *safeword.Lock
+		events    *event.Bus
+		config    command.Config
+		alice     auth.Key
+		other     types.RemoteID
+	)
+
+	beep := func(target device.Target) command.Command {
+		return command.Command{
+			Device:     target.Device,
+			Channel:    target.Channel,
+			Operation:  types.OperationBeep,
+			Repetition: driver.Repetition{Count: 1},
+		}
+	}
+
+	shock := func(target device.Target, intensity types.Intensity) command.Command {
+		cmd := beep(target)
+		cmd.Operation, cmd.Intensity = types.OperationShock, intensity
+		return cmd
+	}
+
+	alex := device.Target{Device: "alex-collar"}
+	sam := device.Target{Device: "sam-collar"}
+
+	BeforeEach(func() {
+		var err error
+
+		dir = GinkgoT().TempDir()
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+		Expect(other.Set("10111010010101110")).To(Succeed())
+
+		keys, err = auth.OpenStore(filepath.Join(dir, "keys.json"), fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, alice, err = keys.Create(auth.Key{
+			Label: "alice",
+			Policy: auth.Policy{
+				MaxIntensity: map[types.Operation]types.Intensity{types.OperationShock: 50},
+				MaxDuration:  time.Second,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		safewords, err = safeword.Open(filepath.Join(dir, "safewords.json"), fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		devices, err := device.NewRegistry([]device.Device{
+			{Name: "alex-collar", Protocol: device.ProtocolPetrainer, RemoteID: types.DefaultRemoteID, Channel: types.Channel1},
+			{Name: "sam-collar", Protocol: device.ProtocolPetrainer, RemoteID: other, Channel: types.Channel1},
+			{Name: "left", Protocol: device.ProtocolPetrainer, RemoteID: types.DefaultRemoteID, Channel: types.Channel2},
+			{Name: "right", Protocol: device.ProtocolPetrainer, RemoteID: types.DefaultRemoteID, Channel: types.Channel2},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		drv = &recordingDriver{}
+		scheduler = transmit.NewScheduler("test", driver.Repeating(drv, driver.DefaultRepetition), transmit.Config{})
+		router, err = transmit.NewRouter(scheduler)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(router.Close)
+
+		events = event.NewBus(16, fake)
+		config = command.Config{
+			Keys:      keys,
+			Safewords: safewords,
+			Events:    events,
+			Devices:   devices,
+		}
+	})
+
+	dispatch := func(cmd command.Command) error {
+		return command.NewDispatcher(router, config).Dispatch(context.Background(), alice.ID, cmd)
+	}
+
+	// dispatchLater dispatches the given Command in the background, sending
+	// its error on the channel returned.
+	dispatchLater := func(cmd command.Command) <-chan error {
+		ret := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			ret <- dispatch(cmd)
+		}()
+
+		return ret
+	}
+
+	// pending returns the approval Requests still pending.
+	pending := func() []approval.Request {
+		ret := make([]approval.Request, 0)
+		for _, r := range config.Approvals.Requests() {
+			if r.State == approval.StatePending {
+				ret = append(ret, r)
+			}
+		}
+
+		return ret
+	}
+
+	Describe("resolving devices", func() {
+		It("sends commands naming a channel to the device listening there", func() {
+			_, published, unsubscribe := events.Subscribe(0)
+			defer unsubscribe()
+
+			Expect(dispatch(beep(device.Target{Channel: types.Channel1}))).To(Succeed())
+			Expect(drv.Sent()).To(HaveLen(1))
+			Expect(drv.Sent()[0].GetRemoteID()).To(Equal(types.DefaultRemoteID))
+
+			Eventually(published).Should(Receive(And(
+				HaveField("Type", event.TypeCommandTransmitted),
+				HaveField("Device", "alex-collar"),
+			)))
+		})
+
+		It("sends commands to devices from their remote", func() {
+			Expect(dispatch(beep(sam))).To(Succeed())
+			Expect(drv.Sent()).To(HaveLen(1))
+			Expect(drv.Sent()[0].GetRemoteID()).To(Equal(other))
+		})
+
+		It("rejects commands naming a channel several devices listen on", func() {
+			err := dispatch(beep(device.Target{Channel: types.Channel2}))
+			Expect(err).To(MatchError(device.ErrAmbiguousChannel))
+			Expect(drv.Sent()).To(BeEmpty())
+		})
+
+		It("checks the length of repeated commands against the policy", func() {
+			cmd := beep(alex)
+			cmd.Repetition.Count = 10
+			Expect(dispatch(cmd)).To(Succeed())
+
+			cmd.Repetition.Count = 40
+			Expect(dispatch(cmd)).To(MatchError(auth.ErrForbidden))
+			Expect(drv.Sent()).To(HaveLen(10))
+		})
+	})
+
+	Describe("safewords", func() {
+		It("keeps safewords per device", func() {
+			_, err := safewords.Set("wearer", sam, safeword.ModePause, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(dispatch(beep(sam))).To(MatchError(safeword.ErrSafeword))
+			Expect(dispatch(beep(alex))).To(Succeed())
+		})
+
+		It("applies safewords of channels to devices on the default remote", func() {
+			_, err := safewords.Set("wearer", device.Target{Channel: types.Channel1}, safeword.ModePause, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(dispatch(beep(alex))).To(MatchError(safeword.ErrSafeword))
+			Expect(dispatch(beep(sam))).To(Succeed())
+		})
+
+		It("checks the safeword again when the command starts transmitting", func() {
+			drv.gate = make(chan struct{})
+			defer close(drv.gate)
+
+			first := dispatchLater(beep(alex))
+			Eventually(func() bool { return scheduler.Stats().Transmitting }).Should(BeTrue())
+
+			second := dispatchLater(beep(alex))
+			Eventually(func() int { return scheduler.Stats().QueueDepth }).Should(Equal(1))
+
+			_, err := safewords.Set("wearer", alex, safeword.ModePause, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			drv.gate <- struct{}{}
+			Eventually(first).Should(Receive(BeNil()))
+			Eventually(second).Should(Receive(And(
+				MatchError(safeword.ErrSafeword),
+				MatchError(transmit.ErrRejected),
+			)))
+			Expect(drv.Sent()).To(HaveLen(1))
+		})
+	})
+
+	Describe("checking commands", func() {
+		It("checks the safeword before the policy", func() {
+			_, err := safewords.Set("wearer", alex, safeword.ModePause, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(dispatch(shock(alex, 80))).To(MatchError(safeword.ErrSafeword))
+		})
+
+		It("checks the policy before asking for approval", func() {
+			config.Approvals = approval.NewManager(30, time.Minute, fake)
+
+			Expect(dispatch(shock(alex, 80))).To(MatchError(auth.ErrForbidden))
+			Expect(config.Approvals.Requests()).To(BeEmpty())
+		})
+
+		It("asks for approval before applying the rate limits", func() {
+			rule, err := ratelimit.ParseRule("key:*=1/1h")
+			Expect(err).NotTo(HaveOccurred())
+
+			config.Limiter = ratelimit.NewLimiter(ratelimit.Rules{rule}, fake)
+			config.Approvals = approval.NewManager(30, time.Minute, fake)
+			Expect(dispatch(beep(alex))).To(Succeed())
+
+			done := dispatchLater(shock(alex, 40))
+			Eventually(pending).Should(HaveLen(1))
+			Expect(pending()[0].Device).To(Equal("alex-collar"))
+
+			_, err = config.Approvals.Deny(pending()[0].ID, "approver")
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(done).Should(Receive(MatchError(approval.ErrDenied)))
+		})
+
+		It("checks the safeword again after approval", func() {
+			config.Approvals = approval.NewManager(30, time.Minute, fake)
+
+			done := dispatchLater(shock(alex, 40))
+			Eventually(pending).Should(HaveLen(1))
+
+			_, err := safewords.Set("wearer", alex, safeword.ModePause, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = config.Approvals.Approve(pending()[0].ID, "approver")
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(done).Should(Receive(MatchError(safeword.ErrSafeword)))
+			Expect(drv.Sent()).To(BeEmpty())
+		})
+
+		It("checks the key again after approval", func() {
+			config.Approvals = approval.NewManager(30, time.Minute, fake)
+
+			done := dispatchLater(shock(alex, 40))
+			Eventually(pending).Should(HaveLen(1))
+
+			_, err := keys.Revoke(alice.ID)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = config.Approvals.Approve(pending()[0].ID, "approver")
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(done).Should(Receive(MatchError(auth.ErrKeyRevoked)))
+			Expect(drv.Sent()).To(BeEmpty())
+		})
+
+		It("applies the rate limits before using the budget of the session", func() {
+			rule, err := ratelimit.ParseRule("key:shock=1/1h")
+			Expect(err).NotTo(HaveOccurred())
+			config.Limiter = ratelimit.NewLimiter(ratelimit.Rules{rule}, fake)
+
+			config.Sessions, err = session.NewManager(filepath.Join(dir, "sessions.json"), keys, fake, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			s, _, err := config.Sessions.Open(auth.Key{ID: "wearer", Wearer: true}, fake.Now(), fake.Now().Add(time.Hour), []string{alice.ID}, 0, session.Limits{MaxShocks: 2})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(dispatch(shock(alex, 20))).To(Succeed())
+			Expect(dispatch(shock(alex, 20))).To(MatchError(ratelimit.ErrRateLimited))
+
+			s, err = config.Sessions.Get(s.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.Used.Shocks).To(Equal(1))
+		})
+	})
+
+	Describe("quiet hours", func() {
+		var (
+			reasons *rejections
+			shocker auth.Key
+		)
+
+		// quiet opens a Window with the given Action around the time of
+		// the fake clock.
+		quiet := func(action quiethours.Action) {
+			window := quiethours.Window{Name: "night", Action: action, Location: "UTC"}
+			Expect(window.Start.Set("11:00")).To(Succeed())
+			Expect(window.End.Set("13:00")).To(Succeed())
+
+			var err error
+			config.QuietHours, err = quiethours.NewPolicy([]quiethours.Window{window}, fake)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			reasons = &rejections{}
+			config.Instrumentation = reasons
+
+			var err error
+			_, shocker, err = keys.Create(auth.Key{
+				Label:  "shocker",
+				Policy: auth.Policy{Operations: []types.Operation{types.OperationShock}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("checks the policy against the operation requested, not the one sent", func() {
+			quiet(quiethours.ActionVibrate)
+
+			err := command.NewDispatcher(router, config).Dispatch(context.Background(), shocker.ID, shock(alex, 40))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(drv.Sent()).To(HaveLen(1))
+
+			op, _, err := drv.Sent()[0].GetOperation()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(op).To(Equal(types.OperationVibrate))
+		})
+
+		It("checks the policy before the quiet hours", func() {
+			quiet(quiethours.ActionDeny)
+
+			err := command.NewDispatcher(router, config).Dispatch(context.Background(), shocker.ID, beep(alex))
+			Expect(err).To(MatchError(auth.ErrForbidden))
+			Expect(err).NotTo(MatchError(quiethours.ErrQuietHours))
+			Expect(reasons.Reasons()).To(Equal([]instrument.Reason{instrument.ReasonForbidden}))
+		})
+
+		It("reports commands denied by quiet hours with their window", func() {
+			quiet(quiethours.ActionDeny)
+
+			err := command.NewDispatcher(router, config).Dispatch(context.Background(), shocker.ID, shock(alex, 40))
+			Expect(err).To(MatchError(ContainSubstring("night")))
+			Expect(reasons.Reasons()).To(Equal([]instrument.Reason{instrument.ReasonQuietHours}))
+			Expect(drv.Sent()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,31 @@
+package command
+
+import "context"
+
+// Origin tells where a Command came from, for the audit log.
+type Origin struct {
+	// RemoteAddr is the address of the client sending the Command, if sent
+	// over the network.
+	RemoteAddr string
+
+	// Source names what sent the Command, like "api", "pattern:<name>" or
+	// "schedule:<id>".
+	Source string
+
+	// IdempotencyKey is the key the client gave to detect retries of the
+	// request sending the Command, if any.
+	IdempotencyKey string
+}
+
+type originKey struct{}
+
+// WithOrigin returns a copy of ctx carrying the given Origin.
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the Origin carried by ctx, the zero Origin if none.
+func OriginFrom(ctx context.Context) Origin {
+	origin, _ := ctx.Value(originKey{}).(Origin)
+	return origin
+}
@@ -0,0 +1,155 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Curve is how a Calibration maps requested Intensities to those sent.
+type Curve string
+
+const (
+	// CurveLinear maps the requested Intensities, from 0 to 100, linearly
+	// onto the range from Min to Max. It is the default.
+	CurveLinear Curve = "linear"
+
+	// CurveGamma maps the requested Intensities onto the range from Min to
+	// Max along a power curve with the exponent Gamma: above 1, low
+	// Intensities rise slower and high ones faster.
+	CurveGamma Curve = "gamma"
+
+	// CurveTable interpolates linearly between the Points of the table,
+	// Intensities below the first or above the last Point are sent as
+	// their Out.
+	CurveTable Curve = "table"
+
+	// CurveClamp sends the requested Intensities as they are, but not
+	// below Min and not above Max.
+	CurveClamp Curve = "clamp"
+)
+
+// Point is a point of a CurveTable: the Intensity In requested is sent as
+// Out.
+type Point struct {
+	In  types.Intensity `json:"in"`
+	Out types.Intensity `json:"out"`
+}
+
+// Calibration maps the Intensities requested to the ones sent to a Device,
+// making different Devices and wearers feel alike.
+type Calibration struct {
+	// Curve is the Curve applied, CurveLinear if not given.
+	Curve Curve `json:"curve,omitempty"`
+
+	// Min and Max are the range sent, 0 and 100 if not given. Not used by
+	// CurveTable.
+	Min types.Intensity `json:"min"`
+	Max types.Intensity `json:"max"`
+
+	// Gamma is the exponent of CurveGamma.
+	Gamma float64 `json:"gamma,omitempty"`
+
+	// Points is the table of CurveTable, sorted by In.
+	Points []Point `json:"points,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, filling in the defaults of
+// fields not given.
+func (c *Calibration) UnmarshalJSON(data []byte) error {
+	type plain Calibration
+	ret := plain{
+		Curve: CurveLinear,
+		Max:   100,
+	}
+
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return err
+	}
+
+	*c = Calibration(ret)
+	return nil
+}
+
+// validate returns an error if the Calibration makes no sense.
+func (c Calibration) validate() error {
+	if c.Min > c.Max || c.Max > 100 {
+		return errors.New("calibration must be 0 <= min <= max <= 100")
+	}
+
+	switch c.Curve {
+	case "", CurveLinear, CurveClamp:
+	case CurveGamma:
+		if !(c.Gamma > 0) || math.IsInf(c.Gamma, 0) {
+			return fmt.Errorf("gamma must be above 0, not %v", c.Gamma)
+		}
+	case CurveTable:
+		if len(c.Points) < 2 {
+			return errors.New("calibration table needs at least 2 points")
+		}
+
+		for i, p := range c.Points {
+			if p.In > 100 || p.Out > 100 {
+				return fmt.Errorf("calibration point %v -> %v out of range", p.In, p.Out)
+			}
+
+			if i > 0 && p.In <= c.Points[i-1].In {
+				return errors.New("calibration points must be sorted by in")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown calibration curve %q", c.Curve)
+	}
+
+	return nil
+}
+
+// Apply returns the Intensity sent for the given requested one.
+func (c Calibration) Apply(intensity types.Intensity) types.Intensity {
+	x := float64(intensity) / 100
+
+	switch c.Curve {
+	case CurveGamma:
+		return c.scale(math.Pow(x, c.Gamma))
+	case CurveTable:
+		return c.interpolate(intensity)
+	case CurveClamp:
+		if intensity < c.Min {
+			return c.Min
+		} else if intensity > c.Max {
+			return c.Max
+		}
+
+		return intensity
+	default:
+		return c.scale(x)
+	}
+}
+
+// scale maps the given fraction linearly onto the range from Min to Max.
+func (c Calibration) scale(x float64) types.Intensity {
+	scaled := float64(c.Min) + (float64(c.Max)-float64(c.Min))*x
+	return types.Intensity(math.Round(scaled))
+}
+
+// interpolate interpolates the given Intensity between the Points.
+func (c Calibration) interpolate(intensity types.Intensity) types.Intensity {
+	if intensity <= c.Points[0].In {
+		return c.Points[0].Out
+	}
+
+	for i := 1; i < len(c.Points); i++ {
+		from, to := c.Points[i-1], c.Points[i]
+		if intensity > to.In {
+			continue
+		}
+
+		x := float64(intensity-from.In) / float64(to.In-from.In)
+		return types.Intensity(math.Round(float64(from.Out) + (float64(to.Out)-float64(from.Out))*x))
+	}
+
+	return c.Points[len(c.Points)-1].Out
+}
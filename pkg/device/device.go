@@ -0,0 +1,203 @@
+// Package device implements the registry of named devices, mapping names
+// users think in, like "alex-collar", to the remote ID and Channel they
+// listen on, together with their limits and calibration.
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// ProtocolPetrainer is the Protocol of the Petrainer shockers, the only one
+// supported.
+const ProtocolPetrainer = "petrainer"
+
+// namePattern is what names and aliases of Devices have to look like.
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Device is a shocker paired with a remote, listening on a Channel.
+type Device struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Groups are the names of the groups the Device is in, to send
+	// commands to all of them together.
+	Groups []string `json:"groups,omitempty"`
+
+	// Protocol is the protocol the Device speaks, ProtocolPetrainer if
+	// not given.
+	Protocol string `json:"protocol"`
+
+	// RemoteID is the remote the Device is paired with,
+	// types.DefaultRemoteID if not given.
+	RemoteID types.RemoteID `json:"remoteId"`
+	Channel  types.Channel  `json:"channel"`
+
+	// Transmitters are the names of the transmitters sending to the
+	// Device, the default one if empty. Commands are sent on all of them,
+	// for redundancy.
+	Transmitters []string `json:"transmitters,omitempty"`
+
+	// MaxIntensity is the highest Intensity that may be requested for the
+	// Device, per Operation, before Calibration is applied. Operations not
+	// in the map are not limited.
+	MaxIntensity map[types.Operation]types.Intensity `json:"maxIntensity,omitempty"`
+
+	// Calibration, if set, maps requested Intensities to those sent.
+	Calibration *Calibration `json:"calibration,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, filling in the defaults of
+// fields not given.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	type plain Device
+	ret := plain{
+		Protocol: ProtocolPetrainer,
+		RemoteID: types.DefaultRemoteID,
+	}
+
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return err
+	}
+
+	*d = Device(ret)
+	return nil
+}
+
+// validate returns ErrInvalidDevice if the Device makes no sense.
+func (d Device) validate() error {
+	for _, name := range append(append([]string{d.Name}, d.Aliases...), d.Groups...) {
+		if !validName(name) {
+			return fmt.Errorf("%w: invalid name %q", ErrInvalidDevice, name)
+		}
+	}
+
+	if d.Protocol != ProtocolPetrainer {
+		return fmt.Errorf("%w: %s: unsupported protocol %q", ErrInvalidDevice, d.Name, d.Protocol)
+	}
+
+	if _, err := d.Channel.MarshalText(); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidDevice, d.Name, err)
+	}
+
+	transmitters := make(map[string]bool, len(d.Transmitters))
+	for _, name := range d.Transmitters {
+		if name == "" || transmitters[name] {
+			return fmt.Errorf("%w: %s: invalid or duplicate transmitter %q", ErrInvalidDevice, d.Name, name)
+		}
+
+		transmitters[name] = true
+	}
+
+	for op, intensity := range d.MaxIntensity {
+		if intensity > 100 {
+			return fmt.Errorf("%w: %s: max intensity for %v out of range: %d", ErrInvalidDevice, d.Name, op, intensity)
+		}
+	}
+
+	if d.Calibration != nil {
+		if err := d.Calibration.validate(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidDevice, d.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Check returns ErrIntensityLimit if the given Intensity may not be
+// requested for the given Operation on the Device.
+func (d Device) Check(op types.Operation, intensity types.Intensity) error {
+	if limit, ok := d.MaxIntensity[op]; ok && intensity > limit {
+		return fmt.Errorf("%w: %s: intensity %v requested for %v, maximum is %v", ErrIntensityLimit, d.Name, intensity, op, limit)
+	}
+
+	return nil
+}
+
+// Message checks the given Operation and Intensity against the limits of
+// the Device and builds the Message sending it, with the Intensity
+// calibrated.
+func (d Device) Message(op types.Operation, intensity types.Intensity) (*types.Message, error) {
+	if err := d.Check(op, intensity); err != nil {
+		return nil, err
+	}
+
+	if d.Calibration != nil && op != types.OperationBeep {
+		intensity = d.Calibration.Apply(intensity)
+	}
+
+	return d.RawMessage(op, intensity), nil
+}
+
+// RawMessage builds the Message sending the given Operation with the given
+// Intensity as it is, without checking the limits of the Device or applying
+// its Calibration, like for calibrating it.
+func (d Device) RawMessage(op types.Operation, intensity types.Intensity) *types.Message {
+	return types.NewMessage().
+		SetChannel(d.Channel).
+		SetOperation(op).
+		SetIntensity(intensity).
+		Build().
+		SetRemoteID(d.RemoteID)
+}
+
+// validName returns if the given string may be used as name of a Device,
+// names of Channels are taken.
+func validName(name string) bool {
+	var ch types.Channel
+	return namePattern.MatchString(name) && ch.Set(name) != nil
+}
+
+// Target is what Commands are sent to: a Device by name or alias, or a
+// Channel of the default remote. Targets are accepted wherever Channels
+// are.
+type Target struct {
+	Device  string
+	Channel types.Channel
+}
+
+// String returns the name of the Device or the Channel.
+func (t Target) String() string {
+	if t.Device != "" {
+		return t.Device
+	}
+
+	return t.Channel.String()
+}
+
+// Set parses the given Channel or Device name into the Target this method
+// is called on. Names are only checked to be valid, not to name a known
+// Device.
+func (t *Target) Set(s string) error {
+	var ch types.Channel
+	if err := ch.Set(s); err == nil {
+		*t = Target{Channel: ch}
+		return nil
+	}
+
+	if !namePattern.MatchString(s) {
+		return fmt.Errorf("%w: %q", ErrUnknownDevice, s)
+	}
+
+	*t = Target{Device: s}
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, using the same
+// representation as String.
+func (t Target) MarshalText() ([]byte, error) {
+	if t.Device != "" {
+		return []byte(t.Device), nil
+	}
+
+	return t.Channel.MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting the same
+// values as Set.
+func (t *Target) UnmarshalText(text []byte) error {
+	return t.Set(string(text))
+}
@@ -0,0 +1,32 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var (
+	// ErrUnknownDevice is returned for names not naming a Device or
+	// Channel.
+	ErrUnknownDevice = fmt.Errorf("%w: unknown device", types.ErrUnparsable)
+
+	// ErrUnknownGroup is returned for names not naming a group of
+	// Devices.
+	ErrUnknownGroup = fmt.Errorf("%w: unknown group", types.ErrUnparsable)
+
+	// ErrAmbiguousChannel is returned for Commands sent to a Channel on the
+	// default remote several Devices listen on, which have to be named
+	// instead.
+	ErrAmbiguousChannel = fmt.Errorf("%w: channel used by several devices", types.ErrUnparsable)
+
+	// ErrInvalidDevice is returned when loading Devices that make no sense,
+	// like two with the same name.
+	ErrInvalidDevice = errors.New("invalid device")
+
+	// ErrIntensityLimit is returned for Operations sent to a Device with an
+	// Intensity above its limit.
+	ErrIntensityLimit = fmt.Errorf("%w: device intensity limit", auth.ErrForbidden)
+)
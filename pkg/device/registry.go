@@ -0,0 +1,317 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Group is a named group of Devices, made of all Devices naming it in their
+// Groups.
+type Group struct {
+	Name    string   `json:"name"`
+	Devices []string `json:"devices"`
+}
+
+// Registry holds the configured Devices. A nil Registry holds no Devices.
+// Calibrations found with the guided calibration replace the configured
+// ones, they are persisted to a file of their own.
+type Registry struct {
+	devices []Device
+	byName  map[string]int
+	groups  map[string][]int
+
+	mu           sync.RWMutex
+	path         string
+	calibrations map[string]*Calibration
+}
+
+// NewRegistry creates a Registry holding the given Devices, returning
+// ErrInvalidDevice if any of them makes no sense or a name or alias is used
+// more than once. Groups may not be named like Devices.
+func NewRegistry(devices []Device) (*Registry, error) {
+	r := &Registry{
+		devices: devices,
+		byName:  make(map[string]int),
+		groups:  make(map[string][]int),
+
+		calibrations: make(map[string]*Calibration),
+	}
+
+	for i, d := range devices {
+		if err := d.validate(); err != nil {
+			return nil, err
+		}
+
+		for _, name := range append([]string{d.Name}, d.Aliases...) {
+			if _, ok := r.byName[name]; ok {
+				return nil, fmt.Errorf("%w: name %q used twice", ErrInvalidDevice, name)
+			}
+
+			r.byName[name] = i
+		}
+
+		for _, group := range d.Groups {
+			if members := r.groups[group]; len(members) == 0 || members[len(members)-1] != i {
+				r.groups[group] = append(members, i)
+			}
+		}
+	}
+
+	for group := range r.groups {
+		if _, ok := r.byName[group]; ok {
+			return nil, fmt.Errorf("%w: group %q named like a device", ErrInvalidDevice, group)
+		}
+	}
+
+	return r, nil
+}
+
+// Load loads the Devices configured in the given JSON file, holding a list
+// of Devices. A file not existing configures no Devices.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewRegistry(nil)
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading devices: %w", err)
+	}
+
+	devices := make([]Device, 0)
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("error parsing devices: %w", err)
+	}
+
+	return NewRegistry(devices)
+}
+
+// Lookup returns the Device with the given name or alias.
+func (r *Registry) Lookup(name string) (Device, error) {
+	if r == nil {
+		return Device{}, fmt.Errorf("%w: %q", ErrUnknownDevice, name)
+	}
+
+	i, ok := r.byName[name]
+	if !ok {
+		return Device{}, fmt.Errorf("%w: %q", ErrUnknownDevice, name)
+	}
+
+	return r.device(i), nil
+}
+
+// device returns the Device with the given index, with the Calibration
+// replacing the configured one, if any.
+func (r *Registry) device(i int) Device {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ret := r.devices[i]
+	if c, ok := r.calibrations[ret.Name]; ok {
+		ret.Calibration = c
+	}
+
+	return ret
+}
+
+// Devices returns all Devices, in the order they are configured.
+func (r *Registry) Devices() []Device {
+	if r == nil {
+		return []Device{}
+	}
+
+	ret := make([]Device, 0, len(r.devices))
+	for i := range r.devices {
+		ret = append(ret, r.device(i))
+	}
+
+	return ret
+}
+
+// Group returns the Devices in the group with the given name, in the order
+// they are configured.
+func (r *Registry) Group(name string) ([]Device, error) {
+	var members []int
+	if r != nil {
+		members = r.groups[name]
+	}
+
+	if len(members) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownGroup, name)
+	}
+
+	ret := make([]Device, 0, len(members))
+	for _, i := range members {
+		ret = append(ret, r.device(i))
+	}
+
+	return ret, nil
+}
+
+// Groups returns all groups, sorted by name.
+func (r *Registry) Groups() []Group {
+	ret := make([]Group, 0)
+	if r == nil {
+		return ret
+	}
+
+	for name, members := range r.groups {
+		group := Group{Name: name, Devices: make([]string, 0, len(members))}
+		for _, i := range members {
+			group.Devices = append(group.Devices, r.devices[i].Name)
+		}
+
+		ret = append(ret, group)
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Resolve returns the given Target with the Channel of its Device and the
+// name of the Device instead of an alias, Targets naming a Channel are
+// returned as they are.
+func (r *Registry) Resolve(t Target) (Target, error) {
+	if t.Device == "" {
+		return t, nil
+	}
+
+	d, err := r.Lookup(t.Device)
+	if err != nil {
+		return Target{}, err
+	}
+
+	return Target{Device: d.Name, Channel: d.Channel}, nil
+}
+
+// Listening returns the Devices paired with the given remote listening on
+// the given Channel, in the order they are configured.
+func (r *Registry) Listening(remote types.RemoteID, ch types.Channel) []Device {
+	ret := make([]Device, 0)
+	if r == nil {
+		return ret
+	}
+
+	for i, d := range r.devices {
+		if d.RemoteID == remote && d.Channel == ch {
+			ret = append(ret, r.device(i))
+		}
+	}
+
+	return ret
+}
+
+// Channel returns the Channel of the given Target.
+func (r *Registry) Channel(t Target) (types.Channel, error) {
+	t, err := r.Resolve(t)
+	return t.Channel, err
+}
+
+// OpenCalibrations loads the Calibrations replacing the configured ones from
+// the given JSON file, mapping names of Devices to their Calibration, and
+// persists those set with SetCalibration to it. A file not existing holds
+// none, Calibrations of Devices not configured anymore are ignored.
+func (r *Registry) OpenCalibrations(path string) error {
+	calibrations := make(map[string]*Calibration)
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading calibrations: %w", err)
+	} else if err == nil {
+		if err := json.Unmarshal(data, &calibrations); err != nil {
+			return fmt.Errorf("error parsing calibrations: %w", err)
+		}
+	}
+
+	for name, c := range calibrations {
+		if c == nil {
+			delete(calibrations, name)
+		} else if err := c.validate(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidDevice, name, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.path = path
+	r.calibrations = calibrations
+	return nil
+}
+
+// SetCalibration replaces the Calibration of the Device with the given name
+// or alias, nil going back to the configured one, and persists it.
+func (r *Registry) SetCalibration(name string, c *Calibration) error {
+	d, err := r.Lookup(name)
+	if err != nil {
+		return err
+	}
+
+	if c != nil {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidDevice, d.Name, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous, had := r.calibrations[d.Name]
+	if c != nil {
+		r.calibrations[d.Name] = c
+	} else {
+		delete(r.calibrations, d.Name)
+	}
+
+	if err := r.saveLocked(); err != nil {
+		if had {
+			r.calibrations[d.Name] = previous
+		} else {
+			delete(r.calibrations, d.Name)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// saveLocked writes all Calibrations to the file, if there is one, r.mu has
+// to be locked.
+func (r *Registry) saveLocked() error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.calibrations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding calibrations: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing calibrations: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing calibrations: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing calibrations: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("error writing calibrations: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package device_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Registry", func() {
+	load := func(config string) (*device.Registry, error) {
+		path := filepath.Join(GinkgoT().TempDir(), "devices.json")
+		Expect(os.WriteFile(path, []byte(config), 0o600)).To(Succeed())
+
+		return device.Load(path)
+	}
+
+	It("loads Devices with defaults", func() {
+		registry, err := load(`[
+			{"name": "alex-collar", "aliases": ["alex"], "remoteId": "10111010010101110", "channel": "2", "maxIntensity": {"shock": 30}},
+			{"name": "sam", "channel": "1"}
+		]`)
+		Expect(err).NotTo(HaveOccurred())
+
+		alex, err := registry.Lookup("alex")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alex.Name).To(Equal("alex-collar"))
+		Expect(alex.Protocol).To(Equal(device.ProtocolPetrainer))
+		Expect(alex.RemoteID.String()).To(Equal("10111010010101110"))
+		Expect(alex.Channel).To(Equal(types.Channel2))
+
+		sam, err := registry.Lookup("sam")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sam.RemoteID).To(Equal(types.DefaultRemoteID))
+
+		Expect(registry.Devices()).To(HaveLen(2))
+
+		_, err = registry.Lookup("nobody")
+		Expect(err).To(MatchError(device.ErrUnknownDevice))
+	})
+
+	It("loads no Devices without a file", func() {
+		registry, err := device.Load(filepath.Join(GinkgoT().TempDir(), "devices.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.Devices()).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid Devices",
+		func(config string) {
+			_, err := load(config)
+			Expect(err).To(MatchError(device.ErrInvalidDevice))
+		},
+		Entry("duplicate name", `[{"name": "alex", "channel": "1"}, {"name": "sam", "aliases": ["alex"], "channel": "2"}]`),
+		Entry("channel name", `[{"name": "1", "channel": "1"}]`),
+		Entry("invalid name", `[{"name": "alex collar", "channel": "1"}]`),
+		Entry("unknown protocol", `[{"name": "alex", "protocol": "x10", "channel": "1"}]`),
+		Entry("calibration out of range", `[{"name": "alex", "channel": "1", "calibration": {"min": 50, "max": 20}}]`),
+		Entry("unknown curve", `[{"name": "alex", "channel": "1", "calibration": {"curve": "cubic"}}]`),
+		Entry("gamma curve without gamma", `[{"name": "alex", "channel": "1", "calibration": {"curve": "gamma"}}]`),
+		Entry("unsorted table", `[{"name": "alex", "channel": "1", "calibration": {"curve": "table", "points": [{"in": 50, "out": 20}, {"in": 10, "out": 30}]}}]`),
+		Entry("duplicate transmitter", `[{"name": "alex", "channel": "1", "transmitters": ["bedroom", "bedroom"]}]`),
+		Entry("group named like a device", `[{"name": "alex", "channel": "1"}, {"name": "sam", "groups": ["alex"], "channel": "2"}]`),
+	)
+
+	It("groups Devices", func() {
+		registry, err := load(`[
+			{"name": "alex", "groups": ["everyone", "collars"], "channel": "1"},
+			{"name": "sam", "groups": ["everyone"], "channel": "2"},
+			{"name": "kim", "groups": ["collars", "collars"], "channel": "2"}
+		]`)
+		Expect(err).NotTo(HaveOccurred())
+
+		everyone, err := registry.Group("everyone")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(everyone).To(HaveExactElements(HaveField("Name", "alex"), HaveField("Name", "sam")))
+
+		Expect(registry.Groups()).To(Equal([]device.Group{
+			{Name: "collars", Devices: []string{"alex", "kim"}},
+			{Name: "everyone", Devices: []string{"alex", "sam"}},
+		}))
+
+		_, err = registry.Group("nobody")
+		Expect(err).To(MatchError(device.ErrUnknownGroup))
+	})
+
+	It("replaces and persists Calibrations", func() {
+		registry, err := load(`[{"name": "alex-collar", "aliases": ["alex"], "channel": "1", "calibration": {"min": 10}}]`)
+		Expect(err).NotTo(HaveOccurred())
+
+		path := filepath.Join(GinkgoT().TempDir(), "calibrations.json")
+		Expect(registry.OpenCalibrations(path)).To(Succeed())
+
+		Expect(registry.SetCalibration("alex", &device.Calibration{Curve: device.CurveClamp, Min: 5, Max: 40})).To(Succeed())
+		alex, err := registry.Lookup("alex")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alex.Calibration.Curve).To(Equal(device.CurveClamp))
+
+		reopened, err := load(`[{"name": "alex-collar", "channel": "1"}]`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.OpenCalibrations(path)).To(Succeed())
+		alex, err = reopened.Lookup("alex-collar")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alex.Calibration).To(Equal(&device.Calibration{Curve: device.CurveClamp, Min: 5, Max: 40}))
+
+		Expect(registry.SetCalibration("alex", nil)).To(Succeed())
+		alex, err = registry.Lookup("alex")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(alex.Calibration.Min).To(BeEquivalentTo(10))
+
+		Expect(registry.SetCalibration("alex", &device.Calibration{Min: 50, Max: 20})).To(MatchError(device.ErrInvalidDevice))
+		Expect(registry.SetCalibration("sam", nil)).To(MatchError(device.ErrUnknownDevice))
+	})
+
+	It("resolves Targets", func() {
+		registry, err := device.NewRegistry([]device.Device{{Name: "alex-collar", Aliases: []string{"alex"}, Protocol: device.ProtocolPetrainer, Channel: types.Channel2}})
+		Expect(err).NotTo(HaveOccurred())
+
+		var target device.Target
+		Expect(target.Set("alex")).To(Succeed())
+		Expect(registry.Resolve(target)).To(Equal(device.Target{Device: "alex-collar", Channel: types.Channel2}))
+
+		Expect(target.Set("1")).To(Succeed())
+		Expect(registry.Resolve(target)).To(Equal(device.Target{Channel: types.Channel1}))
+
+		Expect(target.Set("sam")).To(Succeed())
+		_, err = registry.Resolve(target)
+		Expect(err).To(MatchError(device.ErrUnknownDevice))
+
+		Expect(target.Set("no such/device")).To(MatchError(device.ErrUnknownDevice))
+	})
+
+	It("finds the Devices listening on a remote and Channel", func() {
+		registry, err := load(`[
+			{"name": "alex-collar", "channel": "2"},
+			{"name": "sam-collar", "channel": "2", "remoteId": "11111111111111111"},
+			{"name": "kim-collar", "channel": "1"}
+		]`)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(registry.Listening(types.DefaultRemoteID, types.Channel2)).To(ConsistOf(HaveField("Name", "alex-collar")))
+		Expect(registry.Listening(types.DefaultRemoteID, types.Channel1)).To(ConsistOf(HaveField("Name", "kim-collar")))
+
+		var nilRegistry *device.Registry
+		Expect(nilRegistry.Listening(types.DefaultRemoteID, types.Channel1)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Device", func() {
+	var remoteID types.RemoteID
+
+	BeforeEach(func() {
+		Expect(remoteID.Set("10111010010101110")).To(Succeed())
+	})
+
+	It("builds Messages for its remote and Channel", func() {
+		d := device.Device{Name: "alex", RemoteID: remoteID, Channel: types.Channel2}
+
+		msg, err := d.Message(types.OperationVibrate, 40)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.GetRemoteID()).To(Equal(remoteID))
+		ch, _, err := msg.GetChannel()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ch).To(Equal(types.Channel2))
+		Expect(msg.GetIntensity()).To(BeEquivalentTo(40))
+	})
+
+	It("checks its limits", func() {
+		d := device.Device{Name: "alex", MaxIntensity: map[types.Operation]types.Intensity{types.OperationShock: 30}}
+
+		_, err := d.Message(types.OperationShock, 31)
+		Expect(err).To(MatchError(device.ErrIntensityLimit))
+		Expect(err).To(MatchError(auth.ErrForbidden))
+
+		Expect(d.Message(types.OperationShock, 30)).NotTo(BeNil())
+		Expect(d.Message(types.OperationVibrate, 100)).NotTo(BeNil())
+	})
+
+	It("calibrates intensities", func() {
+		d := device.Device{Name: "alex", Calibration: &device.Calibration{Min: 10, Max: 60}}
+
+		msg, err := d.Message(types.OperationShock, 50)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(msg.GetIntensity()).To(BeEquivalentTo(34))
+
+		Expect(d.Calibration.Apply(0)).To(BeEquivalentTo(10))
+		Expect(d.Calibration.Apply(100)).To(BeEquivalentTo(60))
+	})
+
+	It("sends raw intensities without limits and calibration", func() {
+		d := device.Device{
+			Name:         "alex",
+			MaxIntensity: map[types.Operation]types.Intensity{types.OperationShock: 30},
+			Calibration:  &device.Calibration{Min: 10, Max: 60},
+		}
+
+		Expect(d.RawMessage(types.OperationShock, 70).GetIntensity()).To(BeEquivalentTo(70))
+	})
+})
+
+var _ = Describe("Calibration", func() {
+	DescribeTable("maps intensities along its curve",
+		func(config string, in, out int) {
+			var c device.Calibration
+			Expect(json.Unmarshal([]byte(config), &c)).To(Succeed())
+			Expect(c.Apply(types.Intensity(in))).To(BeEquivalentTo(out))
+		},
+		Entry("linear by default", `{}`, 42, 42),
+		Entry("linear", `{"min": 20, "max": 80}`, 50, 50),
+		Entry("linear at the bottom", `{"min": 20, "max": 80}`, 0, 20),
+		Entry("gamma", `{"curve": "gamma", "gamma": 2}`, 50, 25),
+		Entry("gamma in range", `{"curve": "gamma", "gamma": 0.5, "min": 10, "max": 90}`, 25, 50),
+		Entry("table below", `{"curve": "table", "points": [{"in": 10, "out": 20}, {"in": 50, "out": 40}, {"in": 100, "out": 90}]}`, 5, 20),
+		Entry("table between", `{"curve": "table", "points": [{"in": 10, "out": 20}, {"in": 50, "out": 40}, {"in": 100, "out": 90}]}`, 30, 30),
+		Entry("table at point", `{"curve": "table", "points": [{"in": 10, "out": 20}, {"in": 50, "out": 40}, {"in": 100, "out": 90}]}`, 50, 40),
+		Entry("table above", `{"curve": "table", "points": [{"in": 10, "out": 20}, {"in": 50, "out": 40}]}`, 90, 40),
+		Entry("clamp below", `{"curve": "clamp", "min": 15, "max": 60}`, 5, 15),
+		Entry("clamp between", `{"curve": "clamp", "min": 15, "max": 60}`, 35, 35),
+		Entry("clamp above", `{"curve": "clamp", "min": 15, "max": 60}`, 75, 60),
+	)
+})
@@ -3,6 +3,7 @@ package driver
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"text/scanner"
 )
@@ -27,7 +28,11 @@ func RegisterBitstream(name string, fac BitstreamDriverFactory) {
 	bitstreamDriverRegistry[name] = fac
 }
 
-func Setup(conn string) (MessageDriver, error) {
+// Setup parses the given driver string and initializes the drivers in it, a
+// MessageDriver optionally followed by a BitstreamDriver to bind it to, each
+// with their arguments as strings. MessageDrivers not implementing
+// RepeatingMessageDriver themselves are sent with DefaultRepetition.
+func Setup(conn string) (RepeatingMessageDriver, error) {
 	type driverWithArgs struct {
 		driver string
 		args   []string
@@ -52,7 +57,17 @@ func Setup(conn string) (MessageDriver, error) {
 				return nil, errors.New("syntax error in driver string")
 			}
 
-			drivers[len(drivers)-1].args = append(drivers[len(drivers)-1].args, s.TokenText())
+			arg := s.TokenText()
+			if token == scanner.String || token == scanner.RawString {
+				unquoted, err := strconv.Unquote(arg)
+				if err != nil {
+					return nil, fmt.Errorf("syntax error in driver string: %w", err)
+				}
+
+				arg = unquoted
+			}
+
+			drivers[len(drivers)-1].args = append(drivers[len(drivers)-1].args, arg)
 		default:
 			return nil, errors.New("syntax error in driver string")
 		}
@@ -73,7 +88,7 @@ func Setup(conn string) (MessageDriver, error) {
 	}
 
 	if len(drivers) == 1 {
-		return messageDriver, nil
+		return Repeating(messageDriver, DefaultRepetition), nil
 	}
 
 	bindableMessageDriver, ok := messageDriver.(BindableMessageDriver)
@@ -91,6 +106,9 @@ func Setup(conn string) (MessageDriver, error) {
 		return nil, fmt.Errorf("error initializing I/O driver: %w", err)
 	}
 
-	bindableMessageDriver.Bind(ioDriver)
-	return bindableMessageDriver, nil
+	if err := bindableMessageDriver.Bind(ioDriver); err != nil {
+		return nil, fmt.Errorf("error binding PWM driver to I/O driver: %w", err)
+	}
+
+	return Repeating(bindableMessageDriver, DefaultRepetition), nil
 }
@@ -1,7 +1,20 @@
 package driver
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
 
 var (
 	ErrIODriverNotBound = errors.New("IODriver not bound")
+
+	// ErrUnknownSetting is returned when parsing a driver setting not known
+	// to the driver.
+	ErrUnknownSetting = errors.New("unknown setting")
+
+	// ErrInvalidRepetition is returned for Repetitions with negative values
+	// or sending more frames or waiting longer between them than allowed.
+	ErrInvalidRepetition = fmt.Errorf("%w: invalid repetition", types.ErrUnparsable)
 )
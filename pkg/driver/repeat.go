@@ -0,0 +1,282 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// DefaultRepetition is used for MessageDrivers not bringing their own
+// defaults. The shockers reliably act on four frames in a row.
+var DefaultRepetition = Repetition{Count: 4}
+
+// MaxCount is the most frames a Repetition may send and MaxGap the longest
+// it may wait between two of them, so a single request cannot hold a
+// transmitter and everything queued behind it for long.
+const (
+	MaxCount = 100
+	MaxGap   = time.Second
+)
+
+// AssumedFrameTime is how long a frame is assumed to be on air for
+// MessageDrivers not telling it, a little longer than the frames of the
+// shockers.
+const AssumedFrameTime = 50 * time.Millisecond
+
+// Repetition defines how a Message is put on air: how many frames are sent,
+// how long to wait between them and, optionally, for how long to keep
+// sending frames. Zero values mean "use the default" (see Or).
+type Repetition struct {
+	// Count is the number of frames to send, ignored when Duration is set.
+	Count int `json:"count,omitempty"`
+
+	// Gap is the time to wait between two frames.
+	Gap time.Duration `json:"gap,omitempty"`
+
+	// Duration, when set, makes the driver send frames until the given
+	// time elapsed instead of sending Count frames.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// Or returns the Repetition with all zero values replaced by the values in
+// def, to fill a per-request Repetition with per-protocol defaults.
+func (r Repetition) Or(def Repetition) Repetition {
+	if r.Count <= 0 {
+		r.Count = def.Count
+	}
+
+	if r.Gap <= 0 {
+		r.Gap = def.Gap
+	}
+
+	if r.Duration <= 0 {
+		r.Duration = def.Duration
+	}
+
+	return r
+}
+
+// Validate returns ErrInvalidRepetition if any value of the Repetition is
+// negative or Count or Gap are over MaxCount or MaxGap.
+func (r Repetition) Validate() error {
+	switch {
+	case r.Count < 0 || r.Gap < 0 || r.Duration < 0:
+		return fmt.Errorf("%w: %v: negative values", ErrInvalidRepetition, r)
+	case r.Count > MaxCount:
+		return fmt.Errorf("%w: repeat=%d, maximum is %d", ErrInvalidRepetition, r.Count, MaxCount)
+	case r.Gap > MaxGap:
+		return fmt.Errorf("%w: gap=%v, maximum is %v", ErrInvalidRepetition, r.Gap, MaxGap)
+	}
+
+	return nil
+}
+
+// String returns a string representation of the Repetition, in the same
+// format Set parses.
+func (r Repetition) String() string {
+	parts := []string{fmt.Sprintf("repeat=%d", r.Count)}
+
+	if r.Gap > 0 {
+		parts = append(parts, fmt.Sprintf("gap=%v", r.Gap))
+	}
+
+	if r.Duration > 0 {
+		parts = append(parts, fmt.Sprintf("duration=%v", r.Duration))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Set parses a single "key=value" setting into the Repetition, with the keys
+// "repeat", "gap" and "duration". Returns ErrUnknownSetting for any other key
+// and an error if the value cannot be parsed.
+func (r *Repetition) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%w: %q is not in key=value format", ErrUnknownSetting, s)
+	}
+
+	var err error
+
+	switch key {
+	case "repeat":
+		r.Count, err = strconv.Atoi(value)
+	case "gap":
+		r.Gap, err = time.ParseDuration(value)
+	case "duration":
+		r.Duration, err = time.ParseDuration(value)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownSetting, key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// RepeatingMessageDriver is a MessageDriver knowing how its protocol is
+// reliably put on air, sending a Message as often as needed.
+type RepeatingMessageDriver interface {
+	MessageDriver
+
+	// OutputRepeated sends the given Message as described by the given
+	// Repetition, filled with the defaults of the driver. It stops between
+	// two frames when ctx is done, returning its cause.
+	OutputRepeated(ctx context.Context, message *types.Message, repetition Repetition) error
+
+	// OutputInterleaved is like OutputRepeated, but sends a frame of every
+	// one of the given Messages in turn, so all of them are on air at
+	// nearly the same time.
+	OutputInterleaved(ctx context.Context, messages []*types.Message, repetition Repetition) error
+
+	// Length returns how long sending the given Messages with
+	// OutputInterleaved as described by the given Repetition, filled with
+	// the defaults of the driver, takes.
+	Length(messages []*types.Message, repetition Repetition) time.Duration
+}
+
+// AirtimeDriver is a RepeatingMessageDriver knowing how long its
+// transmissions are on air, to keep within the duty cycle of the band.
+type AirtimeDriver interface {
+	RepeatingMessageDriver
+
+	// Airtime returns how long the given Messages are on air when sent
+	// with OutputInterleaved as described by the given Repetition, filled
+	// with the defaults of the driver: the length of the bitstreams of
+	// all frames times their period. Transmissions held for a Duration
+	// are estimated with the most frames fitting in.
+	Airtime(messages []*types.Message, repetition Repetition) time.Duration
+}
+
+// Airtime returns how long the given Messages are on air when sent with
+// OutputInterleaved as described by the given Repetition, each frame being
+// on air for the time returned by frame. It is meant to implement
+// AirtimeDriver.Airtime, the Repetition has to be filled with defaults
+// already.
+func Airtime(frame func(*types.Message) time.Duration, ms []*types.Message, r Repetition) time.Duration {
+	var round time.Duration
+	for _, m := range ms {
+		round += frame(m)
+	}
+
+	rounds := r.Count
+	if r.Duration > 0 {
+		// OutputInterleaved stops once the next round would start after
+		// Duration, every round taking at least its airtime and the Gap
+		rounds = 1
+		if perRound := round + r.Gap; perRound > 0 {
+			rounds = int((r.Duration + perRound - 1) / perRound)
+		}
+	}
+
+	if rounds < 1 {
+		rounds = 1
+	}
+
+	return time.Duration(rounds) * round
+}
+
+// Length returns how long sending the given Messages with OutputInterleaved
+// as described by the given Repetition takes, each frame being on air for the
+// time returned by frame: Duration if set, Count rounds of frames and Gaps
+// otherwise. It is meant to implement RepeatingMessageDriver.Length, the
+// Repetition has to be filled with defaults already.
+func Length(frame func(*types.Message) time.Duration, ms []*types.Message, r Repetition) time.Duration {
+	if r.Duration > 0 {
+		return r.Duration
+	}
+
+	var round time.Duration
+	for _, m := range ms {
+		round += frame(m)
+	}
+
+	rounds := r.Count
+	if rounds < 1 {
+		rounds = 1
+	}
+
+	return time.Duration(rounds) * (round + r.Gap)
+}
+
+// OutputRepeated sends the given Message with the given MessageDriver as
+// described by the given Repetition. It is meant to implement
+// RepeatingMessageDriver.OutputRepeated, the Repetition has to be filled with
+// defaults already.
+func OutputRepeated(ctx context.Context, d MessageDriver, m *types.Message, r Repetition) error {
+	return OutputInterleaved(ctx, d, []*types.Message{m}, r)
+}
+
+// OutputInterleaved sends the given Messages with the given MessageDriver as
+// described by the given Repetition, a frame of each of them in turn. Every
+// round of frames counts as a single frame of the Repetition, the Gap is
+// waited for between rounds. It is meant to implement
+// RepeatingMessageDriver.OutputInterleaved, the Repetition has to be filled
+// with defaults already.
+func OutputInterleaved(ctx context.Context, d MessageDriver, ms []*types.Message, r Repetition) error {
+	start := time.Now()
+
+	for i := 0; ; i++ {
+		for _, m := range ms {
+			if err := ctx.Err(); err != nil {
+				return context.Cause(ctx)
+			}
+
+			if err := d.Output(m); err != nil {
+				return err
+			}
+		}
+
+		if r.Duration > 0 {
+			if time.Since(start)+r.Gap >= r.Duration {
+				return nil
+			}
+		} else if i+1 >= r.Count {
+			return nil
+		}
+
+		if r.Gap > 0 {
+			timer := time.NewTimer(r.Gap)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return context.Cause(ctx)
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// repeating makes any MessageDriver a RepeatingMessageDriver.
+type repeating struct {
+	MessageDriver
+	defaults Repetition
+}
+
+func (r repeating) OutputRepeated(ctx context.Context, m *types.Message, rep Repetition) error {
+	return OutputRepeated(ctx, r.MessageDriver, m, rep.Or(r.defaults))
+}
+
+func (r repeating) OutputInterleaved(ctx context.Context, ms []*types.Message, rep Repetition) error {
+	return OutputInterleaved(ctx, r.MessageDriver, ms, rep.Or(r.defaults))
+}
+
+func (r repeating) Length(ms []*types.Message, rep Repetition) time.Duration {
+	return Length(func(*types.Message) time.Duration { return AssumedFrameTime }, ms, rep.Or(r.defaults))
+}
+
+// Repeating returns the given MessageDriver as RepeatingMessageDriver,
+// wrapping it to use the given defaults if it is not one already.
+func Repeating(d MessageDriver, defaults Repetition) RepeatingMessageDriver {
+	if r, ok := d.(RepeatingMessageDriver); ok {
+		return r
+	}
+
+	return repeating{MessageDriver: d, defaults: defaults}
+}
@@ -0,0 +1,154 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// countingDriver counts the frames it was asked to send.
+type countingDriver struct {
+	frames int
+}
+
+func (d *countingDriver) Output(m *types.Message) error {
+	d.frames++
+	return nil
+}
+
+// recordingDriver records the Messages it was asked to send.
+type recordingDriver struct {
+	sent []*types.Message
+}
+
+func (d *recordingDriver) Output(m *types.Message) error {
+	d.sent = append(d.sent, m)
+	return nil
+}
+
+var _ = Describe("Repetition", func() {
+	DescribeTable("Set",
+		func(setting string, expected driver.Repetition) {
+			r := driver.Repetition{}
+			Expect(r.Set(setting)).To(Succeed())
+			Expect(r).To(Equal(expected))
+		},
+		Entry("repeat", "repeat=3", driver.Repetition{Count: 3}),
+		Entry("gap", "gap=10ms", driver.Repetition{Gap: 10 * time.Millisecond}),
+		Entry("duration", "duration=1.5s", driver.Repetition{Duration: 1500 * time.Millisecond}),
+	)
+
+	It("rejects unknown settings", func() {
+		r := driver.Repetition{}
+		Expect(r.Set("frequency=433MHz")).To(MatchError(driver.ErrUnknownSetting))
+	})
+
+	DescribeTable("Validate",
+		func(r driver.Repetition, valid bool) {
+			if valid {
+				Expect(r.Validate()).To(Succeed())
+			} else {
+				Expect(r.Validate()).To(MatchError(driver.ErrInvalidRepetition))
+			}
+		},
+		Entry("defaults", driver.Repetition{}, true),
+		Entry("at the maximums", driver.Repetition{Count: driver.MaxCount, Gap: driver.MaxGap}, true),
+		Entry("too many frames", driver.Repetition{Count: driver.MaxCount + 1}, false),
+		Entry("too long a gap", driver.Repetition{Gap: time.Hour}, false),
+		Entry("negative", driver.Repetition{Count: -1}, false),
+	)
+
+	It("fills zero values with defaults", func() {
+		r := driver.Repetition{Gap: time.Millisecond}.Or(driver.Repetition{Count: 4, Gap: time.Second})
+		Expect(r).To(Equal(driver.Repetition{Count: 4, Gap: time.Millisecond}))
+	})
+})
+
+var _ = Describe("OutputRepeated", func() {
+	var drv *countingDriver
+
+	BeforeEach(func() {
+		drv = &countingDriver{}
+	})
+
+	It("sends Count frames", func() {
+		err := driver.OutputRepeated(context.Background(), drv, types.NewMessage().Build(), driver.Repetition{Count: 3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drv.frames).To(Equal(3))
+	})
+
+	It("sends frames until Duration elapsed", func() {
+		start := time.Now()
+		err := driver.OutputRepeated(context.Background(), drv, types.NewMessage().Build(), driver.Repetition{
+			Count:    1,
+			Gap:      10 * time.Millisecond,
+			Duration: 55 * time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 40*time.Millisecond))
+		Expect(drv.frames).To(BeNumerically(">=", 4))
+	})
+
+	It("stops when the context is cancelled", func() {
+		stopped := errors.New("stopped")
+		ctx, cancel := context.WithCancelCause(context.Background())
+		time.AfterFunc(25*time.Millisecond, func() { cancel(stopped) })
+
+		err := driver.OutputRepeated(ctx, drv, types.NewMessage().Build(), driver.Repetition{
+			Gap:      10 * time.Millisecond,
+			Duration: time.Minute,
+		})
+		Expect(err).To(MatchError(stopped))
+		Expect(drv.frames).To(BeNumerically("<", 10))
+	})
+})
+
+var _ = Describe("OutputInterleaved", func() {
+	It("sends a frame of every Message in turn", func() {
+		drv := &recordingDriver{}
+		first := types.NewMessage().SetChannel(types.Channel1).Build()
+		second := types.NewMessage().SetChannel(types.Channel2).Build()
+
+		err := driver.OutputInterleaved(context.Background(), drv, []*types.Message{first, second}, driver.Repetition{Count: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drv.sent).To(Equal([]*types.Message{first, second, first, second}))
+	})
+})
+
+var _ = Describe("Airtime", func() {
+	frame := func(*types.Message) time.Duration { return 50 * time.Millisecond }
+	messages := []*types.Message{types.NewMessage().Build(), types.NewMessage().Build()}
+
+	It("counts every frame of every Message", func() {
+		Expect(driver.Airtime(frame, messages, driver.Repetition{Count: 3})).To(Equal(300 * time.Millisecond))
+	})
+
+	It("estimates the frames held for a Duration", func() {
+		Expect(driver.Airtime(frame, messages[:1], driver.Repetition{Gap: 50 * time.Millisecond, Duration: time.Second})).To(Equal(500 * time.Millisecond))
+		Expect(driver.Airtime(frame, messages[:1], driver.Repetition{Duration: 10 * time.Millisecond})).To(Equal(50 * time.Millisecond))
+	})
+})
+
+var _ = Describe("Length", func() {
+	frame := func(*types.Message) time.Duration { return 50 * time.Millisecond }
+	messages := []*types.Message{types.NewMessage().Build(), types.NewMessage().Build()}
+
+	It("counts every round of frames with its gap", func() {
+		Expect(driver.Length(frame, messages, driver.Repetition{Count: 3, Gap: 10 * time.Millisecond})).To(Equal(330 * time.Millisecond))
+		Expect(driver.Length(frame, messages[:1], driver.Repetition{Count: 1000})).To(Equal(50 * time.Second))
+	})
+
+	It("is the Duration when held for one", func() {
+		Expect(driver.Length(frame, messages, driver.Repetition{Count: 1000, Duration: time.Second})).To(Equal(time.Second))
+	})
+
+	It("assumes a frame time for drivers not telling it", func() {
+		d := driver.Repeating(&countingDriver{}, driver.Repetition{Count: 4})
+		Expect(d.Length(messages[:1], driver.Repetition{})).To(Equal(4 * driver.AssumedFrameTime))
+	})
+})
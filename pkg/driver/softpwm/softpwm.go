@@ -1,14 +1,20 @@
 package softpwm
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
 	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
 )
 
+// period is the time every bit of the bitstream is on air.
+const period = 250 * time.Microsecond
+
 type softpwm struct {
-	io driver.BitstreamDriver
+	io         driver.BitstreamDriver
+	repetition driver.Repetition
 }
 
 func (s softpwm) Output(m *types.Message) error {
@@ -16,6 +22,11 @@ func (s softpwm) Output(m *types.Message) error {
 		return driver.ErrIODriverNotBound
 	}
 
+	return s.io.Output(bitstream(m), period)
+}
+
+// bitstream returns the bits of the frame sending the given Message.
+func bitstream(m *types.Message) []bool {
 	preamble := "00000000000000011111"
 	trailer := ""
 
@@ -37,7 +48,28 @@ func (s softpwm) Output(m *types.Message) error {
 		bitstring = append(bitstring, v == '1')
 	}
 
-	return s.io.Output(bitstring, 250*time.Microsecond)
+	return bitstring
+}
+
+func (s softpwm) OutputRepeated(ctx context.Context, m *types.Message, r driver.Repetition) error {
+	return driver.OutputRepeated(ctx, s, m, r.Or(s.repetition))
+}
+
+func (s softpwm) OutputInterleaved(ctx context.Context, ms []*types.Message, r driver.Repetition) error {
+	return driver.OutputInterleaved(ctx, s, ms, r.Or(s.repetition))
+}
+
+func (s softpwm) Airtime(ms []*types.Message, r driver.Repetition) time.Duration {
+	return driver.Airtime(frame, ms, r.Or(s.repetition))
+}
+
+func (s softpwm) Length(ms []*types.Message, r driver.Repetition) time.Duration {
+	return driver.Length(frame, ms, r.Or(s.repetition))
+}
+
+// frame returns how long the frame sending the given Message is on air.
+func frame(m *types.Message) time.Duration {
+	return time.Duration(len(bitstream(m))) * period
 }
 
 func (s *softpwm) Bind(io driver.BitstreamDriver) error {
@@ -47,6 +79,14 @@ func (s *softpwm) Bind(io driver.BitstreamDriver) error {
 
 func init() {
 	driver.RegisterMessage("softpwm", func(args []string) (driver.MessageDriver, error) {
-		return &softpwm{}, nil
+		ret := &softpwm{repetition: driver.DefaultRepetition}
+
+		for _, arg := range args {
+			if err := ret.repetition.Set(arg); err != nil {
+				return nil, fmt.Errorf("invalid arguments, only repeat=N, gap=D and duration=D are supported: %w", err)
+			}
+		}
+
+		return ret, nil
 	})
 }
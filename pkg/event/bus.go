@@ -0,0 +1,154 @@
+// Package event distributes what is happening, like commands sent and
+// safewords set, to live subscribers.
+package event
+
+import (
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// DefaultHistory is the number of Events kept for resuming subscribers by
+// default.
+const DefaultHistory = 256
+
+// subscriberBuffer is the number of Events buffered per subscriber, Events
+// are dropped for subscribers not keeping up.
+const subscriberBuffer = 64
+
+// Type is what an Event is about.
+type Type string
+
+const (
+	// TypeCommandAccepted is the Type of Events of Commands passing all
+	// checks, handed to the transmitter.
+	TypeCommandAccepted Type = "command.accepted"
+
+	// TypeCommandRejected is the Type of Events of Commands rejected before
+	// they were handed to the transmitter.
+	TypeCommandRejected Type = "command.rejected"
+
+	// TypeCommandTransmitted is the Type of Events of Commands transmitted.
+	TypeCommandTransmitted Type = "command.transmitted"
+
+	// TypeCommandFailed is the Type of Events of Commands failed to transmit
+	// or interrupted.
+	TypeCommandFailed Type = "command.failed"
+
+	// TypeDriverError is the Type of Events of errors of the driver.
+	TypeDriverError Type = "driver.error"
+
+	// TypeSafewordSet is the Type of Events of safewords set by the wearer.
+	TypeSafewordSet Type = "safeword.set"
+
+	// TypeSafewordLifted is the Type of Events of safewords lifted.
+	TypeSafewordLifted Type = "safeword.lifted"
+
+	// TypeStop is the Type of Events of emergency stops, of a single
+	// Channel or of all if Channel is nil.
+	TypeStop Type = "stop"
+)
+
+// Event is something happening. Channel is nil for Events not about a
+// single Channel, Device is the name of the device it is about, if any,
+// KeyID is the key causing it, if any.
+type Event struct {
+	ID      uint64         `json:"id"`
+	Type    Type           `json:"type"`
+	Time    time.Time      `json:"time"`
+	Channel *types.Channel `json:"channel,omitempty"`
+	Device  string         `json:"device,omitempty"`
+
+	KeyID    string `json:"keyId,omitempty"`
+	KeyLabel string `json:"keyLabel,omitempty"`
+
+	Error string `json:"error,omitempty"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// Bus sends Events to all subscribers, keeping the most recent ones for
+// subscribers resuming after a reconnect. A nil Bus drops all Events.
+type Bus struct {
+	clock clock.Clock
+
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	size        int
+	subscribers map[chan Event]struct{}
+}
+
+// NewBus creates a Bus keeping the given number of Events.
+func NewBus(history int, c clock.Clock) *Bus {
+	return &Bus{
+		clock:       c,
+		size:        history,
+		history:     make([]Event, 0, history),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends the given Event to all subscribers, setting its ID and Time.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	e.Time = b.clock.Now()
+
+	if len(b.history) == b.size && b.size > 0 {
+		b.history = append(b.history[:0], b.history[1:]...)
+	}
+	if b.size > 0 {
+		b.history = append(b.history, e)
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the Events kept with an ID after the given one, a
+// channel receiving all Events published from now on and a function to call
+// when done with it. Subscribers not resuming pass 0 and get no Events kept,
+// those resuming with an ID not known get all of them, as it is from before
+// a restart.
+func (b *Bus) Subscribe(after uint64) ([]Event, <-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[ch] = struct{}{}
+
+	resume := after > 0
+	if after > b.lastID {
+		after = 0
+	}
+
+	missed := make([]Event, 0)
+	if resume {
+		for _, e := range b.history {
+			if e.ID > after {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	return missed, ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers, ch)
+	}
+}
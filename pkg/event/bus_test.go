@@ -0,0 +1,88 @@
+package event_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+)
+
+var _ = Describe("Bus", func() {
+	var (
+		fake *clock.Fake
+		bus  *event.Bus
+	)
+
+	ids := func(events []event.Event) []uint64 {
+		ret := make([]uint64, 0, len(events))
+		for _, e := range events {
+			ret = append(ret, e.ID)
+		}
+
+		return ret
+	}
+
+	BeforeEach(func() {
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+		bus = event.NewBus(3, fake)
+	})
+
+	It("sends Events to all subscribers", func() {
+		missed, first, unsubscribeFirst := bus.Subscribe(0)
+		DeferCleanup(unsubscribeFirst)
+		Expect(missed).To(BeEmpty())
+
+		_, second, unsubscribeSecond := bus.Subscribe(0)
+
+		bus.Publish(event.Event{Type: event.TypeStop, KeyID: "alice"})
+
+		for _, ch := range []<-chan event.Event{first, second} {
+			var e event.Event
+			Expect(ch).To(Receive(&e))
+			Expect(e.ID).To(BeEquivalentTo(1))
+			Expect(e.Type).To(Equal(event.TypeStop))
+			Expect(e.Time).To(Equal(fake.Now()))
+			Expect(e.KeyID).To(Equal("alice"))
+		}
+
+		unsubscribeSecond()
+		bus.Publish(event.Event{Type: event.TypeStop})
+		Expect(first).To(Receive(HaveField("ID", BeEquivalentTo(2))))
+		Expect(second).NotTo(Receive())
+	})
+
+	It("resumes after the last Event received", func() {
+		for i := 0; i < 5; i++ {
+			bus.Publish(event.Event{Type: event.TypeStop})
+		}
+
+		missed, _, unsubscribe := bus.Subscribe(3)
+		unsubscribe()
+		Expect(ids(missed)).To(Equal([]uint64{4, 5}))
+
+		// only the last three are kept
+		missed, _, unsubscribe = bus.Subscribe(1)
+		unsubscribe()
+		Expect(ids(missed)).To(Equal([]uint64{3, 4, 5}))
+
+		missed, _, unsubscribe = bus.Subscribe(5)
+		unsubscribe()
+		Expect(missed).To(BeEmpty())
+	})
+
+	It("sends all Events kept for IDs from before a restart", func() {
+		bus.Publish(event.Event{Type: event.TypeStop})
+		bus.Publish(event.Event{Type: event.TypeStop})
+
+		missed, _, unsubscribe := bus.Subscribe(42)
+		unsubscribe()
+		Expect(ids(missed)).To(Equal([]uint64{1, 2}))
+	})
+
+	It("drops Events published on a nil Bus", func() {
+		var bus *event.Bus
+		Expect(func() { bus.Publish(event.Event{Type: event.TypeStop}) }).NotTo(Panic())
+	})
+})
@@ -0,0 +1,120 @@
+// Package instrument defines what the core packages report for monitoring,
+// independent of the monitoring system collecting it.
+package instrument
+
+import (
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Instrumentation is told about everything worth monitoring. Implementations
+// have to be safe for concurrent use.
+type Instrumentation interface {
+	// CommandFinished is called with every Command dispatched, with the
+	// outcome recorded in the audit log.
+	CommandFinished(op types.Operation, ch types.Channel, outcome string)
+
+	// CommandRejected is called with every Command rejected before it was
+	// transmitted, with one of the Reasons.
+	CommandRejected(reason Reason)
+
+	// QueueWait is called with how long a Job waited in the queue of the
+	// named transmitter until its worker picked it up.
+	QueueWait(transmitter string, wait time.Duration)
+
+	// TransmitLatency is called with how long a Job took on the named
+	// transmitter from being submitted until it was transmitted.
+	TransmitLatency(transmitter string, latency time.Duration)
+
+	// OnAir is called with the time on air of every Job transmitted by the
+	// named transmitter, for drivers telling it.
+	OnAir(transmitter string, airtime time.Duration)
+
+	// DriverError is called with every error of the named driver of the
+	// named transmitter.
+	DriverError(transmitter, driver string)
+
+	// Safeword is called whenever the safeword of a device or Channel is
+	// set, with its mode, or lifted, with an empty mode.
+	Safeword(target device.Target, mode string)
+
+	// EmergencyStop is called with every emergency stop, of a single
+	// Channel or of all if ch is nil.
+	EmergencyStop(ch *types.Channel)
+}
+
+// Reason is why a Command was rejected.
+type Reason string
+
+const (
+	// ReasonQuietHours is the Reason of Commands denied by quiet hours.
+	ReasonQuietHours Reason = "quiet_hours"
+
+	// ReasonSafeword is the Reason of Commands rejected because of a
+	// safeword of the wearer.
+	ReasonSafeword Reason = "safeword"
+
+	// ReasonDeviceLimit is the Reason of Commands exceeding the limits of
+	// their device.
+	ReasonDeviceLimit Reason = "device_limit"
+
+	// ReasonRateLimited is the Reason of Commands exceeding a rate limit.
+	ReasonRateLimited Reason = "rate_limited"
+
+	// ReasonQueueFull is the Reason of Commands not fitting in the queue of
+	// a transmitter.
+	ReasonQueueFull Reason = "queue_full"
+
+	// ReasonDutyCycle is the Reason of Commands exceeding the duty cycle of
+	// a transmitter.
+	ReasonDutyCycle Reason = "duty_cycle"
+
+	// ReasonDuration is the Reason of Commands held longer than their
+	// Operation may be.
+	ReasonDuration Reason = "duration"
+
+	// ReasonApproval is the Reason of Commands denied approval or not
+	// approved in time.
+	ReasonApproval Reason = "approval"
+
+	// ReasonSession is the Reason of Commands sent without Session or
+	// exceeding its limits.
+	ReasonSession Reason = "session"
+
+	// ReasonForbidden is the Reason of Commands not allowed by the Policy
+	// of their key.
+	ReasonForbidden Reason = "forbidden"
+
+	// ReasonUnauthorized is the Reason of Commands sent with a key not
+	// valid, like a revoked or expired one.
+	ReasonUnauthorized Reason = "unauthorized"
+
+	// ReasonInvalid is the Reason of Commands making no sense.
+	ReasonInvalid Reason = "invalid"
+
+	// ReasonOther is the Reason of Commands rejected for any other reason.
+	ReasonOther Reason = "other"
+)
+
+// Nop is an Instrumentation ignoring everything, used where none is given.
+type Nop struct{}
+
+func (Nop) CommandFinished(types.Operation, types.Channel, string) {}
+func (Nop) CommandRejected(Reason)                                 {}
+func (Nop) QueueWait(string, time.Duration)                        {}
+func (Nop) TransmitLatency(string, time.Duration)                  {}
+func (Nop) OnAir(string, time.Duration)                            {}
+func (Nop) DriverError(string, string)                             {}
+func (Nop) Safeword(device.Target, string)                         {}
+func (Nop) EmergencyStop(*types.Channel)                           {}
+
+// Or returns i, or Nop if i is nil.
+func Or(i Instrumentation) Instrumentation {
+	if i == nil {
+		return Nop{}
+	}
+
+	return i
+}
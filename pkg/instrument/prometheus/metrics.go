@@ -0,0 +1,227 @@
+// Package prometheus implements instrument.Instrumentation with Prometheus
+// metrics, the only package depending on the Prometheus client.
+package prometheus
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// namespace prefixes the names of all metrics.
+const namespace = "gotoshock"
+
+// allChannels is the channel label of emergency stops of all Channels.
+const allChannels = "all"
+
+// durationBuckets are the buckets of the histograms of durations, from 5ms to
+// about 40s.
+var durationBuckets = prom.ExponentialBuckets(0.005, 2, 14)
+
+// Metrics is an instrument.Instrumentation keeping Prometheus metrics in a
+// registry of its own, served by Handler together with those of the Go
+// runtime and the process.
+type Metrics struct {
+	clock    clock.Clock
+	registry *prom.Registry
+
+	commands        *prom.CounterVec
+	rejections      *prom.CounterVec
+	queueWait       *prom.HistogramVec
+	transmitLatency *prom.HistogramVec
+	airtime         *prom.CounterVec
+	driverErrors    *prom.CounterVec
+	stops           *prom.CounterVec
+	lastStop        *prom.GaugeVec
+
+	// safewordMu keeps replacing the series of a target atomic.
+	safewordMu sync.Mutex
+	safeword   *prom.GaugeVec
+}
+
+var _ instrument.Instrumentation = (*Metrics)(nil)
+
+// New creates Metrics, the given Clock giving the time of emergency stops.
+func New(c clock.Clock) *Metrics {
+	m := &Metrics{
+		clock:    c,
+		registry: prom.NewRegistry(),
+
+		commands: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_total",
+			Help:      "Commands dispatched, by operation actually sent, channel and outcome.",
+		}, []string{"operation", "channel", "outcome"}),
+		rejections: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "command_rejections_total",
+			Help:      "Commands rejected before they were transmitted, by reason.",
+		}, []string{"reason"}),
+		queueWait: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Name:      "transmit_queue_wait_seconds",
+			Help:      "Time jobs waited in the queue of a transmitter until they were picked up.",
+			Buckets:   durationBuckets,
+		}, []string{"transmitter"}),
+		transmitLatency: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Name:      "transmit_latency_seconds",
+			Help:      "Time jobs took from being submitted to a transmitter until they were transmitted.",
+			Buckets:   durationBuckets,
+		}, []string{"transmitter"}),
+		airtime: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "transmitter_airtime_seconds_total",
+			Help:      "Time a transmitter was on air, for drivers telling it.",
+		}, []string{"transmitter"}),
+		driverErrors: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "driver_errors_total",
+			Help:      "Errors of the driver of a transmitter.",
+		}, []string{"transmitter", "driver"}),
+		safeword: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "safeword",
+			Help:      "1 for each device or channel with a safeword set, with its mode.",
+		}, []string{"target", "mode"}),
+		stops: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Name:      "emergency_stops_total",
+			Help:      "Emergency stops, by channel stopped or all.",
+		}, []string{"channel"}),
+		lastStop: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Name:      "emergency_stop_last_timestamp_seconds",
+			Help:      "Unix time of the last emergency stop, by channel stopped or all.",
+		}, []string{"channel"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.commands,
+		m.rejections,
+		m.queueWait,
+		m.transmitLatency,
+		m.airtime,
+		m.driverErrors,
+		m.safeword,
+		m.stops,
+		m.lastStop,
+	)
+
+	return m
+}
+
+// Transmitters adds gauges of the duty cycle of every transmitter, read from
+// the given function on every scrape, like transmit.Router.Stats: the time
+// on air in the current window, the share of the window that is and the
+// time allowed, for transmitters limited by a DutyCycle.
+func (m *Metrics) Transmitters(stats func() []transmit.Stats) {
+	m.registry.MustRegister(&transmitterCollector{
+		stats: stats,
+
+		airtime: prom.NewDesc(
+			prom.BuildFQName(namespace, "", "transmitter_airtime_seconds"),
+			"Time a transmitter was on air in the current duty cycle window, for drivers telling it.",
+			[]string{"transmitter"}, nil,
+		),
+		dutyCycle: prom.NewDesc(
+			prom.BuildFQName(namespace, "", "transmitter_duty_cycle_ratio"),
+			"Share of the current duty cycle window a transmitter was on air, for drivers telling it.",
+			[]string{"transmitter"}, nil,
+		),
+		budget: prom.NewDesc(
+			prom.BuildFQName(namespace, "", "transmitter_airtime_budget_seconds"),
+			"Time a transmitter may be on air per duty cycle window, for transmitters limited.",
+			[]string{"transmitter"}, nil,
+		),
+	})
+}
+
+// transmitterCollector collects the duty cycle gauges of transmitters from
+// their Stats.
+type transmitterCollector struct {
+	stats func() []transmit.Stats
+
+	airtime   *prom.Desc
+	dutyCycle *prom.Desc
+	budget    *prom.Desc
+}
+
+func (c *transmitterCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.airtime
+	ch <- c.dutyCycle
+	ch <- c.budget
+}
+
+func (c *transmitterCollector) Collect(ch chan<- prom.Metric) {
+	for _, stats := range c.stats() {
+		ch <- prom.MustNewConstMetric(c.airtime, prom.GaugeValue, stats.Airtime.Seconds(), stats.Name)
+		ch <- prom.MustNewConstMetric(c.dutyCycle, prom.GaugeValue, stats.DutyCycle, stats.Name)
+		if stats.AirtimeBudget > 0 {
+			ch <- prom.MustNewConstMetric(c.budget, prom.GaugeValue, stats.AirtimeBudget.Seconds(), stats.Name)
+		}
+	}
+}
+
+// Handler returns the http.Handler serving the metrics to Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) CommandFinished(op types.Operation, ch types.Channel, outcome string) {
+	m.commands.WithLabelValues(op.String(), ch.String(), outcome).Inc()
+}
+
+func (m *Metrics) CommandRejected(reason instrument.Reason) {
+	m.rejections.WithLabelValues(string(reason)).Inc()
+}
+
+func (m *Metrics) QueueWait(transmitter string, wait time.Duration) {
+	m.queueWait.WithLabelValues(transmitter).Observe(wait.Seconds())
+}
+
+func (m *Metrics) TransmitLatency(transmitter string, latency time.Duration) {
+	m.transmitLatency.WithLabelValues(transmitter).Observe(latency.Seconds())
+}
+
+func (m *Metrics) OnAir(transmitter string, airtime time.Duration) {
+	m.airtime.WithLabelValues(transmitter).Add(airtime.Seconds())
+}
+
+func (m *Metrics) DriverError(transmitter, driver string) {
+	m.driverErrors.WithLabelValues(transmitter, driver).Inc()
+}
+
+// Safeword replaces the series of the device or Channel, leaving none when
+// the safeword is lifted.
+func (m *Metrics) Safeword(target device.Target, mode string) {
+	m.safewordMu.Lock()
+	defer m.safewordMu.Unlock()
+
+	m.safeword.DeletePartialMatch(prom.Labels{"target": target.String()})
+	if mode != "" {
+		m.safeword.WithLabelValues(target.String(), mode).Set(1)
+	}
+}
+
+func (m *Metrics) EmergencyStop(ch *types.Channel) {
+	channel := allChannels
+	if ch != nil {
+		channel = ch.String()
+	}
+
+	m.stops.WithLabelValues(channel).Inc()
+	m.lastStop.WithLabelValues(channel).Set(float64(m.clock.Now().UnixNano()) / 1e9)
+}
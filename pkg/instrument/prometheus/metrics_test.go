@@ -0,0 +1,109 @@
+package prometheus_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument/prometheus"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Metrics", func() {
+	var metrics *prometheus.Metrics
+
+	BeforeEach(func() {
+		metrics = prometheus.New(clock.NewFake(time.Unix(1700000000, 0)))
+	})
+
+	scrape := func() string {
+		res := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(res.Code).To(Equal(http.StatusOK))
+
+		return res.Body.String()
+	}
+
+	It("counts commands and rejections", func() {
+		metrics.CommandFinished(types.OperationShock, types.Channel1, "accepted")
+		metrics.CommandFinished(types.OperationShock, types.Channel1, "accepted")
+		metrics.CommandFinished(types.OperationBeep, types.Channel2, "rejected")
+		metrics.CommandRejected(instrument.ReasonQuietHours)
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`gotoshock_commands_total{channel="1",operation="shock",outcome="accepted"} 2`))
+		Expect(body).To(ContainSubstring(`gotoshock_commands_total{channel="2",operation="beep",outcome="rejected"} 1`))
+		Expect(body).To(ContainSubstring(`gotoshock_command_rejections_total{reason="quiet_hours"} 1`))
+	})
+
+	It("keeps histograms of queue wait and transmit latency", func() {
+		metrics.QueueWait("attic", 3*time.Millisecond)
+		metrics.TransmitLatency("attic", 150*time.Millisecond)
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`gotoshock_transmit_queue_wait_seconds_bucket{transmitter="attic",le="0.005"} 1`))
+		Expect(body).To(ContainSubstring(`gotoshock_transmit_latency_seconds_bucket{transmitter="attic",le="0.08"} 0`))
+		Expect(body).To(ContainSubstring(`gotoshock_transmit_latency_seconds_bucket{transmitter="attic",le="0.16"} 1`))
+		Expect(body).To(ContainSubstring(`gotoshock_transmit_latency_seconds_count{transmitter="attic"} 1`))
+	})
+
+	It("sums the time on air and counts driver errors", func() {
+		metrics.OnAir("attic", 500*time.Millisecond)
+		metrics.OnAir("attic", time.Second)
+		metrics.DriverError("attic", "softpwm gpio")
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`gotoshock_transmitter_airtime_seconds_total{transmitter="attic"} 1.5`))
+		Expect(body).To(ContainSubstring(`gotoshock_driver_errors_total{driver="softpwm gpio",transmitter="attic"} 1`))
+	})
+
+	It("shows the duty cycle of the transmitters", func() {
+		metrics.Transmitters(func() []transmit.Stats {
+			return []transmit.Stats{
+				{Name: "attic", Airtime: 9 * time.Second, AirtimeBudget: 36 * time.Second, DutyCycle: 0.0025},
+				{Name: "cellar"},
+			}
+		})
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`gotoshock_transmitter_airtime_seconds{transmitter="attic"} 9`))
+		Expect(body).To(ContainSubstring(`gotoshock_transmitter_duty_cycle_ratio{transmitter="attic"} 0.0025`))
+		Expect(body).To(ContainSubstring(`gotoshock_transmitter_airtime_budget_seconds{transmitter="attic"} 36`))
+		Expect(body).To(ContainSubstring(`gotoshock_transmitter_airtime_seconds{transmitter="cellar"} 0`))
+		Expect(body).NotTo(ContainSubstring(`gotoshock_transmitter_airtime_budget_seconds{transmitter="cellar"}`))
+	})
+
+	It("shows the safeword of each device and channel until it is lifted", func() {
+		metrics.Safeword(device.Target{Channel: types.Channel1}, "pause")
+		metrics.Safeword(device.Target{Channel: types.Channel1}, "limit")
+		metrics.Safeword(device.Target{Device: "alex-collar"}, "no-shock")
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`gotoshock_safeword{mode="limit",target="1"} 1`))
+		Expect(body).NotTo(ContainSubstring(`mode="pause"`))
+		Expect(body).To(ContainSubstring(`gotoshock_safeword{mode="no-shock",target="alex-collar"} 1`))
+
+		metrics.Safeword(device.Target{Channel: types.Channel1}, "")
+		body = scrape()
+		Expect(body).NotTo(ContainSubstring(`target="1"`))
+		Expect(body).To(ContainSubstring(`gotoshock_safeword{mode="no-shock",target="alex-collar"} 1`))
+	})
+
+	It("counts emergency stops with their time", func() {
+		ch := types.Channel2
+		metrics.EmergencyStop(&ch)
+		metrics.EmergencyStop(nil)
+		metrics.EmergencyStop(nil)
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`gotoshock_emergency_stops_total{channel="2"} 1`))
+		Expect(body).To(ContainSubstring(`gotoshock_emergency_stops_total{channel="all"} 2`))
+		Expect(body).To(ContainSubstring(`gotoshock_emergency_stop_last_timestamp_seconds{channel="all"} 1.7e+09`))
+	})
+})
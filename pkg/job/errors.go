@@ -0,0 +1,14 @@
+package job
+
+import "errors"
+
+var (
+	// ErrUnknownJob is returned when there is no Job with a given ID.
+	ErrUnknownJob = errors.New("unknown job")
+
+	// ErrFinished is returned when cancelling a Job already finished.
+	ErrFinished = errors.New("job already finished")
+
+	// ErrCancelled is the error of Jobs cancelled before they finished.
+	ErrCancelled = errors.New("job cancelled")
+)
@@ -0,0 +1,276 @@
+// Package job runs Commands in the background, for clients not waiting for
+// their transmission.
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+)
+
+// finishedKept is the number of finished Jobs kept for querying.
+const finishedKept = 256
+
+// State is the state of a Job.
+type State string
+
+const (
+	// StateQueued is the State of Jobs waiting to be transmitted, including
+	// those waiting for approval.
+	StateQueued State = "queued"
+
+	// StateTransmitting is the State of Jobs being transmitted right now.
+	StateTransmitting State = "transmitting"
+
+	// StateDone is the State of Jobs transmitted.
+	StateDone State = "done"
+
+	// StateFailed is the State of Jobs rejected or failed to transmit.
+	StateFailed State = "failed"
+
+	// StateCancelled is the State of Jobs cancelled before they finished.
+	StateCancelled State = "cancelled"
+)
+
+// Finished returns if Jobs in this State are finished.
+func (s State) Finished() bool {
+	return s == StateDone || s == StateFailed || s == StateCancelled
+}
+
+// Dispatcher is where Jobs send their Commands, usually a
+// command.Dispatcher.
+type Dispatcher interface {
+	Check(keyID string, cmd command.Command) error
+	Dispatch(ctx context.Context, keyID string, cmd command.Command) error
+}
+
+// Job is a Command sent in the background on behalf of a key.
+type Job struct {
+	ID      string          `json:"id"`
+	KeyID   string          `json:"keyId"`
+	Command command.Command `json:"command"`
+	State   State           `json:"state"`
+	Error   string          `json:"error,omitempty"`
+
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+type job struct {
+	Job
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+// Manager runs Jobs and keeps track of their State.
+type Manager struct {
+	dispatcher Dispatcher
+	clock      clock.Clock
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// NewManager creates a Manager sending the Commands of Jobs to the given
+// Dispatcher.
+func NewManager(d Dispatcher, c clock.Clock) *Manager {
+	return &Manager{
+		dispatcher: d,
+		clock:      c,
+		jobs:       make(map[string]*job),
+	}
+}
+
+// Submit checks the given Command against the limits of the key with the
+// given ID and starts a Job sending it, returning right away. The Command
+// gets the ID of the Job. Only the command.Origin is taken from ctx, the Job
+// is not cancelled with it.
+func (m *Manager) Submit(ctx context.Context, keyID string, cmd command.Command) (Job, error) {
+	if err := m.dispatcher.Check(keyID, cmd); err != nil {
+		return Job{}, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	cmd.ID = id
+
+	jobCtx, cancel := context.WithCancelCause(command.WithOrigin(context.Background(), command.OriginFrom(ctx)))
+
+	j := &job{
+		Job: Job{
+			ID:      id,
+			KeyID:   keyID,
+			Command: cmd,
+			State:   StateQueued,
+			Created: m.clock.Now(),
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = j
+	ret := j.Job
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel(nil)
+
+		ctx := transmit.WithStarted(jobCtx, func() { m.started(j) })
+		m.finish(j, m.dispatcher.Dispatch(ctx, keyID, cmd))
+	}()
+
+	return ret, nil
+}
+
+func (m *Manager) started(j *job) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	j.State = StateTransmitting
+	j.Started = &now
+}
+
+func (m *Manager) finish(j *job, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+	j.Finished = &now
+
+	switch {
+	case err == nil:
+		j.State = StateDone
+	case errors.Is(err, ErrCancelled):
+		j.State = StateCancelled
+		j.Error = err.Error()
+	default:
+		j.State = StateFailed
+		j.Error = err.Error()
+	}
+
+	close(j.done)
+	m.pruneLocked()
+}
+
+// Get returns the Job with the given ID.
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %q", ErrUnknownJob, id)
+	}
+
+	return j.Job, nil
+}
+
+// Wait waits until the Job with the given ID is finished or ctx is done,
+// returning the Job as it is then.
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %q", ErrUnknownJob, id)
+	}
+
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return j.Job, nil
+}
+
+// Cancel cancels the Job with the given ID, removing it from the queue or
+// interrupting its transmission between frames, and waits until it is
+// finished.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if ok && j.State.Finished() {
+		m.mu.Unlock()
+		return Job{}, fmt.Errorf("%w: %s is %s", ErrFinished, id, j.State)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %q", ErrUnknownJob, id)
+	}
+
+	j.cancel(ErrCancelled)
+	return m.Wait(context.Background(), id)
+}
+
+// Jobs returns all unfinished Jobs and the most recently finished ones of
+// the key with the given ID, or of all keys if empty, ordered by their
+// creation time.
+func (m *Manager) Jobs(keyID string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		if keyID == "" || j.KeyID == keyID {
+			ret = append(ret, j.Job)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Created.Before(ret[j].Created)
+	})
+
+	return ret
+}
+
+// pruneLocked forgets the oldest finished Jobs exceeding finishedKept. m.mu
+// has to be locked.
+func (m *Manager) pruneLocked() {
+	finished := make([]*job, 0)
+	for _, j := range m.jobs {
+		if j.State.Finished() {
+			finished = append(finished, j)
+		}
+	}
+
+	if len(finished) <= finishedKept {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Finished.Before(*finished[j].Finished)
+	})
+
+	for _, j := range finished[:len(finished)-finishedKept] {
+		delete(m.jobs, j.ID)
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,155 @@
+package job_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/job"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// blockingDriver blocks on every Output call until something is received on
+// release.
+type blockingDriver struct {
+	release chan struct{}
+	err     error
+}
+
+func (d *blockingDriver) Output(m *types.Message) error {
+	<-d.release
+	return d.err
+}
+
+// schedulerDispatcher sends Commands on a Scheduler without checking
+// anything but the key, allowing every key but "forbidden".
+type schedulerDispatcher struct {
+	scheduler *transmit.Scheduler
+}
+
+func (d schedulerDispatcher) Check(keyID string, cmd command.Command) error {
+	if keyID == "forbidden" {
+		return auth.ErrForbidden
+	}
+
+	return nil
+}
+
+func (d schedulerDispatcher) Dispatch(ctx context.Context, keyID string, cmd command.Command) error {
+	return d.scheduler.Submit(ctx, cmd.Job())
+}
+
+var _ = Describe("Manager", func() {
+	var (
+		drv       *blockingDriver
+		scheduler *transmit.Scheduler
+		manager   *job.Manager
+	)
+
+	beep := command.Command{
+		Channel:    types.Channel1,
+		Operation:  types.OperationBeep,
+		Repetition: driver.Repetition{Count: 1},
+	}
+
+	BeforeEach(func() {
+		drv = &blockingDriver{release: make(chan struct{})}
+		scheduler = transmit.NewScheduler("test", driver.Repeating(drv, driver.DefaultRepetition), transmit.Config{})
+		manager = job.NewManager(schedulerDispatcher{scheduler}, clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)))
+	})
+
+	AfterEach(func() {
+		close(drv.release)
+		scheduler.Close()
+	})
+
+	state := func(id string) func() job.State {
+		return func() job.State {
+			j, err := manager.Get(id)
+			Expect(err).NotTo(HaveOccurred())
+			return j.State
+		}
+	}
+
+	It("runs jobs in the background", func() {
+		j, err := manager.Submit(context.Background(), "alice", beep)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.State).To(Equal(job.StateQueued))
+		Expect(j.Command.ID).To(Equal(j.ID))
+
+		Eventually(state(j.ID)).Should(Equal(job.StateTransmitting))
+
+		drv.release <- struct{}{}
+		j, err = manager.Wait(context.Background(), j.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.State).To(Equal(job.StateDone))
+		Expect(j.Started).NotTo(BeNil())
+		Expect(j.Finished).NotTo(BeNil())
+
+		Expect(manager.Jobs("alice")).To(HaveLen(1))
+		Expect(manager.Jobs("bob")).To(BeEmpty())
+	})
+
+	It("rejects commands not allowed right away", func() {
+		_, err := manager.Submit(context.Background(), "forbidden", beep)
+		Expect(err).To(MatchError(auth.ErrForbidden))
+		Expect(manager.Jobs("")).To(BeEmpty())
+	})
+
+	It("reports failed jobs", func() {
+		drv.err = errors.New("broken")
+
+		j, err := manager.Submit(context.Background(), "alice", beep)
+		Expect(err).NotTo(HaveOccurred())
+
+		drv.release <- struct{}{}
+		j, err = manager.Wait(context.Background(), j.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.State).To(Equal(job.StateFailed))
+		Expect(j.Error).To(Equal("broken"))
+	})
+
+	It("cancels queued jobs", func() {
+		first, err := manager.Submit(context.Background(), "alice", beep)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(state(first.ID)).Should(Equal(job.StateTransmitting))
+
+		second, err := manager.Submit(context.Background(), "alice", beep)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+
+		second, err = manager.Cancel(second.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.State).To(Equal(job.StateCancelled))
+		Expect(second.Started).To(BeNil())
+
+		_, err = manager.Cancel(second.ID)
+		Expect(err).To(MatchError(job.ErrFinished))
+	})
+
+	It("stops waiting when the context is done", func() {
+		j, err := manager.Submit(context.Background(), "alice", beep)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		j, err = manager.Wait(ctx, j.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(j.State.Finished()).To(BeFalse())
+	})
+
+	It("does not know unknown jobs", func() {
+		_, err := manager.Get("nope")
+		Expect(err).To(MatchError(job.ErrUnknownJob))
+		_, err = manager.Cancel("nope")
+		Expect(err).To(MatchError(job.ErrUnknownJob))
+	})
+})
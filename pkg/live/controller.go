@@ -0,0 +1,285 @@
+// Package live implements live control of a channel: a client holds an
+// operation, like keeping the button on the remote pressed, and updates it
+// while it is held. Holds stop right away when released or when the client
+// goes away.
+package live
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// DefaultHeartbeat is how long the server waits for the next message of a
+// client before releasing its hold, when not configured otherwise.
+const DefaultHeartbeat = 2 * time.Second
+
+// DefaultMaxHold is how long an Operation is held when not limited
+// otherwise.
+const DefaultMaxHold = 10 * time.Second
+
+// eventBuffer is the number of Events buffered for the client, Events are
+// dropped for clients not keeping up.
+const eventBuffer = 16
+
+// Update types sent by clients.
+const (
+	// TypeHold starts holding an Operation or changes the one held.
+	TypeHold = "hold"
+
+	// TypeRelease releases the Operation held.
+	TypeRelease = "release"
+
+	// TypePing keeps the connection alive without changing anything.
+	TypePing = "ping"
+)
+
+// Event types sent to clients.
+const (
+	// TypeHolding tells a hold is transmitted now.
+	TypeHolding = "holding"
+
+	// TypeReleased tells a hold was stopped, by the client or because it
+	// went away.
+	TypeReleased = "released"
+
+	// TypeFinished tells a hold was held for as long as it may be, a new
+	// Update is needed to continue.
+	TypeFinished = "finished"
+
+	// TypeRejected tells a hold was rejected or failed.
+	TypeRejected = "rejected"
+
+	// TypePong answers TypePing.
+	TypePong = "pong"
+
+	// TypeError tells an Update was not understood.
+	TypeError = "error"
+)
+
+// Update is a message of a client. Channel, which may name a device as
+// well, and Operation are required for TypeHold, DurationMs limits how long
+// it is held at most.
+type Update struct {
+	Type       string           `json:"type"`
+	Channel    *device.Target   `json:"channel,omitempty"`
+	Operation  *types.Operation `json:"operation,omitempty"`
+	Intensity  int              `json:"intensity,omitempty"`
+	DurationMs int64            `json:"durationMs,omitempty"`
+}
+
+// Event is a message to a client, about the hold with the given CommandID.
+type Event struct {
+	Type      string `json:"type"`
+	CommandID string `json:"commandId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Dispatcher is where holds send their Commands, usually a
+// command.Dispatcher.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, keyID string, cmd command.Command) error
+}
+
+// Controller holds Operations on behalf of a single client. Every hold is a
+// Command of its own, checked against the limits of the key and counted
+// against its rate limits. Holds last until released, replaced by another
+// hold or stopped, at most for the maximum duration of their Operation.
+type Controller struct {
+	ctx        context.Context
+	dispatcher Dispatcher
+	keyID      string
+	maxHold    func(types.Operation) time.Duration
+
+	events chan Event
+
+	mu      sync.Mutex
+	current context.CancelCauseFunc
+	holds   sync.WaitGroup
+	closed  bool
+}
+
+// NewController creates a Controller sending Commands to the given
+// Dispatcher on behalf of the key with the given ID, with the Origin
+// carried by ctx. maxHold returns how long an Operation may be held at most.
+func NewController(ctx context.Context, d Dispatcher, keyID string, maxHold func(types.Operation) time.Duration) *Controller {
+	return &Controller{
+		ctx:        command.WithOrigin(context.Background(), command.OriginFrom(ctx)),
+		dispatcher: d,
+		keyID:      keyID,
+		maxHold:    maxHold,
+		events:     make(chan Event, eventBuffer),
+	}
+}
+
+// Events returns the channel Events for the client are sent on, closed by
+// Close.
+func (c *Controller) Events() <-chan Event {
+	return c.events
+}
+
+// Handle handles the given Update, returning ErrInvalidUpdate if it is not
+// understood, which is sent as Event as well. The outcome of holds is sent
+// as Events.
+func (c *Controller) Handle(u Update) error {
+	err := c.handle(u)
+	if err != nil && !errors.Is(err, ErrDisconnected) {
+		c.Error(err)
+	}
+
+	return err
+}
+
+// Error tells the client about the given error.
+func (c *Controller) Error(err error) {
+	c.send(Event{Type: TypeError, Error: err.Error()})
+}
+
+func (c *Controller) handle(u Update) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+
+	if closed {
+		return ErrDisconnected
+	}
+
+	switch u.Type {
+	case TypeHold:
+		cmd, err := u.command(c.maxHold)
+		if err != nil {
+			return err
+		}
+
+		return c.hold(cmd)
+	case TypeRelease:
+		c.Stop(ErrReleased)
+		return nil
+	case TypePing:
+		c.send(Event{Type: TypePong})
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidUpdate, u.Type)
+	}
+}
+
+func (u Update) command(maxHold func(types.Operation) time.Duration) (command.Command, error) {
+	switch {
+	case u.Channel == nil || u.Operation == nil:
+		return command.Command{}, fmt.Errorf("%w: channel and operation are required", ErrInvalidUpdate)
+	case u.Intensity < 0 || u.Intensity > 100:
+		return command.Command{}, fmt.Errorf("%w: intensity out of range: %d", ErrInvalidUpdate, u.Intensity)
+	case u.DurationMs < 0:
+		return command.Command{}, fmt.Errorf("%w: durationMs must not be negative", ErrInvalidUpdate)
+	}
+
+	duration := maxHold(*u.Operation)
+	if requested := time.Duration(u.DurationMs) * time.Millisecond; requested > 0 && requested < duration {
+		duration = requested
+	}
+
+	id, err := newID()
+	if err != nil {
+		return command.Command{}, err
+	}
+
+	return command.Command{
+		ID:         id,
+		Device:     u.Channel.Device,
+		Channel:    u.Channel.Channel,
+		Operation:  *u.Operation,
+		Intensity:  types.Intensity(u.Intensity),
+		Repetition: driver.Repetition{Duration: duration},
+	}, nil
+}
+
+// hold replaces the current hold with one sending the given Command.
+func (c *Controller) hold(cmd command.Command) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrDisconnected
+	}
+
+	if c.current != nil {
+		c.current(ErrReplaced)
+	}
+
+	ctx, cancel := context.WithCancelCause(c.ctx)
+	c.current = cancel
+	c.holds.Add(1)
+
+	go func() {
+		defer c.holds.Done()
+		defer cancel(nil)
+
+		started := transmit.WithStarted(ctx, func() {
+			c.send(Event{Type: TypeHolding, CommandID: cmd.ID})
+		})
+
+		err := c.dispatcher.Dispatch(started, c.keyID, cmd)
+		switch {
+		case err == nil:
+			c.send(Event{Type: TypeFinished, CommandID: cmd.ID})
+		case errors.Is(err, ErrReleased), errors.Is(err, ErrReplaced), errors.Is(err, ErrHeartbeat), errors.Is(err, ErrDisconnected):
+			c.send(Event{Type: TypeReleased, CommandID: cmd.ID, Error: err.Error()})
+		default:
+			c.send(Event{Type: TypeRejected, CommandID: cmd.ID, Error: err.Error()})
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the current hold, if any, with the given cause.
+func (c *Controller) Stop(cause error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current != nil {
+		c.current(cause)
+		c.current = nil
+	}
+}
+
+// Close stops the current hold with the given cause and waits for all holds
+// to finish, closing the Events channel. No Updates are accepted
+// afterwards.
+func (c *Controller) Close(cause error) {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	c.Stop(cause)
+	c.holds.Wait()
+	close(c.events)
+}
+
+// send sends the given Event to the client, dropping it if the client is not
+// keeping up. It must not be called after Close.
+func (c *Controller) send(e Event) {
+	select {
+	case c.events <- e:
+	default:
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,133 @@
+package live_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/live"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// slowDriver takes a millisecond for every frame.
+type slowDriver struct{}
+
+func (slowDriver) Output(m *types.Message) error {
+	time.Sleep(time.Millisecond)
+	return nil
+}
+
+// limitedDispatcher sends Commands on a Scheduler, rejecting those with an
+// intensity above 50.
+type limitedDispatcher struct {
+	scheduler *transmit.Scheduler
+}
+
+func (d limitedDispatcher) Dispatch(ctx context.Context, keyID string, cmd command.Command) error {
+	if cmd.Intensity > 50 {
+		return auth.ErrForbidden
+	}
+
+	return d.scheduler.Submit(ctx, cmd.Job())
+}
+
+var _ = Describe("Controller", func() {
+	var (
+		scheduler  *transmit.Scheduler
+		maxHold    time.Duration
+		controller *live.Controller
+	)
+
+	channel := device.Target{Channel: types.Channel1}
+	vibrate := types.OperationVibrate
+
+	hold := func(intensity int) live.Update {
+		return live.Update{Type: live.TypeHold, Channel: &channel, Operation: &vibrate, Intensity: intensity}
+	}
+
+	BeforeEach(func() {
+		scheduler = transmit.NewScheduler("test", driver.Repeating(slowDriver{}, driver.DefaultRepetition), transmit.Config{})
+		DeferCleanup(scheduler.Close)
+
+		maxHold = 5 * time.Second
+		controller = live.NewController(context.Background(), limitedDispatcher{scheduler}, "alice", func(types.Operation) time.Duration {
+			return maxHold
+		})
+	})
+
+	It("holds until released", func() {
+		Expect(controller.Handle(hold(20))).To(Succeed())
+
+		var holding live.Event
+		Eventually(controller.Events()).Should(Receive(&holding))
+		Expect(holding.Type).To(Equal(live.TypeHolding))
+		Consistently(scheduler.Stats, 20*time.Millisecond).Should(HaveField("Transmitting", BeTrue()))
+
+		Expect(controller.Handle(live.Update{Type: live.TypeRelease})).To(Succeed())
+		Eventually(controller.Events()).Should(Receive(Equal(live.Event{
+			Type:      live.TypeReleased,
+			CommandID: holding.CommandID,
+			Error:     live.ErrReleased.Error(),
+		})))
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeFalse()))
+
+		controller.Close(live.ErrDisconnected)
+	})
+
+	It("replaces holds with newer ones", func() {
+		Expect(controller.Handle(hold(20))).To(Succeed())
+		Eventually(controller.Events()).Should(Receive(HaveField("Type", live.TypeHolding)))
+
+		Expect(controller.Handle(hold(30))).To(Succeed())
+
+		// the first hold may be released after the second one started
+		events := make([]live.Event, 2)
+		Eventually(controller.Events()).Should(Receive(&events[0]))
+		Eventually(controller.Events()).Should(Receive(&events[1]))
+		Expect(events).To(ConsistOf(
+			HaveField("Error", live.ErrReplaced.Error()),
+			HaveField("Type", live.TypeHolding),
+		))
+
+		controller.Close(live.ErrHeartbeat)
+		Eventually(controller.Events()).Should(Receive(HaveField("Error", live.ErrHeartbeat.Error())))
+		Eventually(controller.Events()).Should(BeClosed())
+	})
+
+	It("finishes holds after the maximum duration", func() {
+		maxHold = 20 * time.Millisecond
+
+		Expect(controller.Handle(hold(20))).To(Succeed())
+		Eventually(controller.Events()).Should(Receive(HaveField("Type", live.TypeHolding)))
+		Eventually(controller.Events()).Should(Receive(HaveField("Type", live.TypeFinished)))
+
+		controller.Close(live.ErrDisconnected)
+	})
+
+	It("checks every update", func() {
+		Expect(controller.Handle(hold(80))).To(Succeed())
+		Eventually(controller.Events()).Should(Receive(And(
+			HaveField("Type", live.TypeRejected),
+			HaveField("Error", auth.ErrForbidden.Error()),
+		)))
+
+		controller.Close(live.ErrDisconnected)
+	})
+
+	It("rejects invalid updates", func() {
+		Expect(controller.Handle(live.Update{Type: live.TypeHold})).To(MatchError(live.ErrInvalidUpdate))
+		Eventually(controller.Events()).Should(Receive(HaveField("Type", live.TypeError)))
+
+		Expect(controller.Handle(live.Update{Type: "tickle"})).To(MatchError(live.ErrInvalidUpdate))
+		Expect(controller.Handle(live.Update{Type: live.TypePing})).To(Succeed())
+
+		controller.Close(live.ErrDisconnected)
+		Expect(controller.Handle(hold(20))).To(MatchError(live.ErrDisconnected))
+	})
+})
@@ -0,0 +1,27 @@
+package live
+
+import (
+	"errors"
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var (
+	// ErrReleased is the error of holds released by the client.
+	ErrReleased = errors.New("hold released")
+
+	// ErrReplaced is the error of holds replaced by a newer one.
+	ErrReplaced = errors.New("hold replaced")
+
+	// ErrHeartbeat is the error of holds stopped because the client missed
+	// a heartbeat.
+	ErrHeartbeat = errors.New("heartbeat missed")
+
+	// ErrDisconnected is the error of holds stopped because the client
+	// disconnected.
+	ErrDisconnected = errors.New("client disconnected")
+
+	// ErrInvalidUpdate is returned for Updates not understood.
+	ErrInvalidUpdate = fmt.Errorf("%w: invalid update", types.ErrUnparsable)
+)
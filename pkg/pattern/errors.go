@@ -0,0 +1,16 @@
+package pattern
+
+import "errors"
+
+var (
+	// ErrInvalidProgram is returned when a Program cannot be parsed or
+	// compiled.
+	ErrInvalidProgram = errors.New("invalid pattern program")
+
+	// ErrUnknownPattern is returned when there is no Program with a given
+	// name in the patterns directory.
+	ErrUnknownPattern = errors.New("unknown pattern")
+
+	// ErrUnknownRun is returned when there is no Run with a given ID.
+	ErrUnknownRun = errors.New("unknown run")
+)
@@ -0,0 +1,258 @@
+package pattern
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+)
+
+// finishedRunsKept is the number of finished Runs kept for querying their
+// Status.
+const finishedRunsKept = 64
+
+// extensions are the file extensions of Programs in a patterns directory.
+var extensions = []string{".yaml", ".yml", ".json"}
+
+// Manager loads Programs from a patterns directory and keeps track of their
+// Runs.
+type Manager struct {
+	dir        string
+	dispatcher Dispatcher
+	clock      clock.Clock
+
+	mu   sync.Mutex
+	runs map[string]*Run
+}
+
+// NewManager creates a Manager loading Programs from the given directory and
+// sending their Operations to the given Dispatcher, pausing between them on
+// the given Clock.
+func NewManager(dir string, d Dispatcher, c clock.Clock) *Manager {
+	return &Manager{
+		dir:        dir,
+		dispatcher: d,
+		clock:      c,
+		runs:       make(map[string]*Run),
+	}
+}
+
+// Patterns returns the names of all Programs in the patterns directory.
+func (m *Manager) Patterns() ([]string, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading patterns directory: %w", err)
+	}
+
+	ret := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		for _, ext := range extensions {
+			if name, ok := strings.CutSuffix(entry.Name(), ext); ok {
+				ret = append(ret, name)
+				break
+			}
+		}
+	}
+
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Load reads and parses the Program with the given name from the patterns
+// directory.
+func (m *Manager) Load(name string) (*Program, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPattern, name)
+	}
+
+	for _, ext := range extensions {
+		data, err := os.ReadFile(filepath.Join(m.dir, name+ext))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading pattern %q: %w", name, err)
+		}
+
+		program, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing pattern %q: %w", name, err)
+		}
+
+		return program, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownPattern, name)
+}
+
+// Start loads the Program with the given name and runs it on the given
+// Channel or device in the background, on behalf of the key with the given ID. All
+// Operations of the Program are checked against the limits of the key
+// first, with the highest Intensity and longest duration they may pick.
+func (m *Manager) Start(keyID, name string, target device.Target) (*Run, error) {
+	program, err := m.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	instructions, err := program.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instruction := range instructions {
+		if !instruction.Send {
+			continue
+		}
+
+		err := m.dispatcher.Check(keyID, command.Command{
+			Device:    target.Device,
+			Channel:   target.Channel,
+			Operation: instruction.Operation,
+			Intensity: instruction.Intensity.Max,
+			Repetition: driver.Repetition{
+				Duration: instruction.Duration.Max,
+			},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		return nil, fmt.Errorf("error seeding random numbers: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(command.WithOrigin(context.Background(), command.Origin{
+		Source: "pattern:" + name,
+	}))
+
+	run := &Run{
+		id:      id,
+		keyID:   keyID,
+		pattern: name,
+		target:  target,
+		state:   StateRunning,
+		steps:   len(instructions),
+		started: m.clock.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	m.runs[id] = run
+	m.pruneLocked()
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		rng := mathrand.New(mathrand.NewSource(seed.Int64()))
+		err := Execute(ctx, instructions, keyID, target, m.dispatcher, rng, m.clock, run.progress)
+		run.finish(err, m.clock.Now())
+	}()
+
+	return run, nil
+}
+
+// Run returns the Run with the given ID.
+func (m *Manager) Run(id string) (*Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, ok := m.runs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownRun, id)
+	}
+
+	return run, nil
+}
+
+// Runs returns the Status of all Runs known, running ones and the most
+// recently finished ones, of the key with the given ID, or of all keys if
+// empty, ordered by their start time.
+func (m *Manager) Runs(keyID string) []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]Status, 0, len(m.runs))
+	for _, run := range m.runs {
+		if keyID == "" || run.keyID == keyID {
+			ret = append(ret, run.Status())
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Started.Before(ret[j].Started)
+	})
+
+	return ret
+}
+
+// StopAll stops all Runs.
+func (m *Manager) StopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, run := range m.runs {
+		run.Stop()
+	}
+}
+
+// pruneLocked forgets the oldest finished Runs exceeding finishedRunsKept.
+// m.mu has to be locked.
+func (m *Manager) pruneLocked() {
+	finished := make([]*Run, 0)
+	for _, run := range m.runs {
+		select {
+		case <-run.done:
+			finished = append(finished, run)
+		default:
+		}
+	}
+
+	if len(finished) <= finishedRunsKept {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Status().Finished.Before(*finished[j].Status().Finished)
+	})
+
+	for _, run := range finished[:len(finished)-finishedRunsKept] {
+		delete(m.runs, run.id)
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,91 @@
+package pattern_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/pattern"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// limitedDispatcher only allows intensities up to 50.
+type limitedDispatcher struct {
+	recordingDispatcher
+}
+
+func (d *limitedDispatcher) Check(keyID string, cmd command.Command) error {
+	if cmd.Intensity > 50 {
+		return &auth.PolicyError{Rule: "max-intensity", Reason: "too much"}
+	}
+
+	return nil
+}
+
+var _ = Describe("Manager", func() {
+	var (
+		dir  string
+		fake *clock.Fake
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+		Expect(os.WriteFile(filepath.Join(dir, "gentle.yaml"), []byte(`steps: [{operation: vibrate, intensity: 30}]`), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "rough.yaml"), []byte(`steps: [{operation: beep}, {operation: shock, intensity: {min: 10, max: 80}}]`), 0o644)).To(Succeed())
+	})
+
+	It("runs patterns on behalf of a key", func() {
+		d := &limitedDispatcher{}
+		manager := pattern.NewManager(dir, d, fake)
+
+		run, err := manager.Start("key", "gentle", device.Target{Channel: types.Channel1})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(run.Done()).Should(BeClosed())
+
+		Expect(run.Status().State).To(Equal(pattern.StateDone))
+		Expect(run.Status().KeyID).To(Equal("key"))
+		Expect(run.Status().Started).To(Equal(fake.Now()))
+		Expect(run.Status().Finished).To(HaveValue(Equal(fake.Now())))
+		Expect(intensities(d.jobs)).To(Equal([]types.Intensity{30}))
+	})
+
+	It("lists the runs of a single key", func() {
+		manager := pattern.NewManager(dir, &recordingDispatcher{}, fake)
+
+		for _, keyID := range []string{"alice", "bob"} {
+			run, err := manager.Start(keyID, "gentle", device.Target{Channel: types.Channel1})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(run.Done()).Should(BeClosed())
+		}
+
+		Expect(manager.Runs("")).To(HaveLen(2))
+		Expect(manager.Runs("bob")).To(ConsistOf(HaveField("KeyID", "bob")))
+	})
+
+	It("checks all operations before starting", func() {
+		d := &limitedDispatcher{}
+		manager := pattern.NewManager(dir, d, fake)
+
+		_, err := manager.Start("key", "rough", device.Target{Channel: types.Channel1})
+		Expect(err).To(MatchError(auth.ErrForbidden))
+		Expect(manager.Runs("")).To(BeEmpty())
+
+		Consistently(func() int {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return len(d.jobs)
+		}).Should(BeZero())
+	})
+
+	It("does not know patterns outside its directory", func() {
+		_, err := pattern.NewManager(dir, &recordingDispatcher{}, fake).Start("key", "../gentle", device.Target{Channel: types.Channel1})
+		Expect(err).To(MatchError(pattern.ErrUnknownPattern))
+	})
+})
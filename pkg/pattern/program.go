@@ -0,0 +1,311 @@
+package pattern
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// MaxInstructions is the maximum number of instructions a Program may
+// compile to, after expanding all repeat blocks and ramps.
+const MaxInstructions = 10000
+
+// Program is a declarative description of a sequence of operations, loaded
+// from YAML or JSON. It is not bound to a channel, that is given when
+// running it.
+//
+// Example:
+//
+//	description: warm-up and a surprise
+//	steps:
+//	  - operation: beep
+//	    pause: 1s
+//	  - repeat: 3
+//	    steps:
+//	      - operation: vibrate
+//	        ramp: {from: 10, to: 60, steps: 5, curve: exponential}
+//	        duration: 300ms
+//	        pause: 200ms
+//	  - pause: {min: 2s, max: 10s}
+//	  - operation: shock
+//	    intensity: {min: 5, max: 15}
+type Program struct {
+	Description string `yaml:"description" json:"description,omitempty"`
+	Steps       []Step `yaml:"steps" json:"steps"`
+}
+
+// Step is a single entry of a Program. A Step either sends an Operation
+// (optionally followed by a pause), only pauses, or repeats its nested Steps.
+type Step struct {
+	// Operation to send, one of the names understood by types.Operation.
+	Operation string `yaml:"operation,omitempty" json:"operation,omitempty"`
+
+	// Intensity to send the Operation with.
+	Intensity IntensityRange `yaml:"intensity,omitempty" json:"intensity,omitempty"`
+
+	// Ramp replaces Intensity, sending the Operation Ramp.Steps times with
+	// the intensity following the given curve.
+	Ramp *Ramp `yaml:"ramp,omitempty" json:"ramp,omitempty"`
+
+	// Duration to hold the Operation for, the default repetition of the
+	// driver is used if not given.
+	Duration DurationRange `yaml:"duration,omitempty" json:"duration,omitempty"`
+
+	// Pause to wait after the Operation, or on its own.
+	Pause DurationRange `yaml:"pause,omitempty" json:"pause,omitempty"`
+
+	// Repeat makes this Step a block, running its Steps Repeat times.
+	Repeat int    `yaml:"repeat,omitempty" json:"repeat,omitempty"`
+	Steps  []Step `yaml:"steps,omitempty" json:"steps,omitempty"`
+}
+
+// Ramp describes a series of intensities from From to To.
+type Ramp struct {
+	From  types.Intensity `yaml:"from" json:"from"`
+	To    types.Intensity `yaml:"to" json:"to"`
+	Steps int             `yaml:"steps" json:"steps"`
+
+	// Curve is either "linear" (the default) or "exponential".
+	Curve string `yaml:"curve,omitempty" json:"curve,omitempty"`
+}
+
+// IntensityRange is an intensity chosen randomly between Min and Max every
+// time it is used. In YAML and JSON it is either a single number or a
+// mapping with min and max.
+type IntensityRange struct {
+	Min types.Intensity `yaml:"min" json:"min"`
+	Max types.Intensity `yaml:"max" json:"max"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *IntensityRange) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var i types.Intensity
+		if err := i.Set(node.Value); err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+
+		r.Min, r.Max = i, i
+		return nil
+	}
+
+	type plain IntensityRange
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+
+	if r.Min > 100 || r.Max > 100 || r.Min > r.Max {
+		return fmt.Errorf("line %d: %w: invalid intensity range", node.Line, ErrInvalidProgram)
+	}
+
+	return nil
+}
+
+// DurationRange is a duration chosen randomly between Min and Max every time
+// it is used. In YAML and JSON it is either a single duration string like
+// "500ms" or a mapping with min and max.
+type DurationRange struct {
+	Min time.Duration `yaml:"min" json:"min"`
+	Max time.Duration `yaml:"max" json:"max"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (r *DurationRange) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		d, err := time.ParseDuration(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+
+		r.Min, r.Max = d, d
+		return nil
+	}
+
+	var plain struct {
+		Min string `yaml:"min"`
+		Max string `yaml:"max"`
+	}
+
+	if err := node.Decode(&plain); err != nil {
+		return err
+	}
+
+	var err error
+	if r.Min, err = time.ParseDuration(plain.Min); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+
+	if r.Max, err = time.ParseDuration(plain.Max); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+
+	if r.Min < 0 || r.Min > r.Max {
+		return fmt.Errorf("line %d: %w: invalid duration range", node.Line, ErrInvalidProgram)
+	}
+
+	return nil
+}
+
+// Parse parses the given YAML or JSON data into a Program and checks it for
+// errors.
+func Parse(data []byte) (*Program, error) {
+	ret := &Program{}
+	if err := yaml.Unmarshal(data, ret); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProgram, err)
+	}
+
+	if _, err := ret.Compile(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Instruction is a single action of a compiled Program: sending an Operation
+// (if Send is set) and pausing afterwards.
+type Instruction struct {
+	Send      bool
+	Operation types.Operation
+	Intensity IntensityRange
+	Duration  DurationRange
+	Pause     DurationRange
+}
+
+// Compile flattens the Program into a list of Instructions, expanding all
+// repeat blocks and ramps.
+func (p *Program) Compile() ([]Instruction, error) {
+	ret := make([]Instruction, 0)
+	if err := compileSteps(p.Steps, &ret); err != nil {
+		return nil, err
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("%w: no steps", ErrInvalidProgram)
+	}
+
+	return ret, nil
+}
+
+func compileSteps(steps []Step, out *[]Instruction) error {
+	for i, step := range steps {
+		if err := compileStep(step, out); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+
+		if len(*out) > MaxInstructions {
+			return fmt.Errorf("%w: more than %d instructions", ErrInvalidProgram, MaxInstructions)
+		}
+	}
+
+	return nil
+}
+
+func compileStep(step Step, out *[]Instruction) error {
+	if step.Repeat != 0 || len(step.Steps) != 0 {
+		if step.Operation != "" || step.Ramp != nil || step.Pause.Max != 0 || step.Duration.Max != 0 {
+			return fmt.Errorf("%w: repeat blocks can only contain steps", ErrInvalidProgram)
+		}
+
+		if step.Repeat < 1 {
+			return fmt.Errorf("%w: repeat must be at least 1", ErrInvalidProgram)
+		}
+
+		if len(step.Steps) == 0 {
+			return fmt.Errorf("%w: repeat blocks need steps", ErrInvalidProgram)
+		}
+
+		// every step compiles to at least one instruction, so the body
+		// is compiled once and checked against the limit before it is
+		// repeated, not to spin on huge repeats
+		body := make([]Instruction, 0)
+		if err := compileSteps(step.Steps, &body); err != nil {
+			return err
+		}
+
+		if step.Repeat > (MaxInstructions-len(*out))/len(body) {
+			return fmt.Errorf("%w: more than %d instructions", ErrInvalidProgram, MaxInstructions)
+		}
+
+		for i := 0; i < step.Repeat; i++ {
+			*out = append(*out, body...)
+		}
+
+		return nil
+	}
+
+	if step.Operation == "" {
+		if step.Ramp != nil || step.Duration.Max != 0 {
+			return fmt.Errorf("%w: ramp and duration need an operation", ErrInvalidProgram)
+		}
+
+		if step.Pause.Max == 0 {
+			return fmt.Errorf("%w: empty step", ErrInvalidProgram)
+		}
+
+		*out = append(*out, Instruction{Pause: step.Pause})
+		return nil
+	}
+
+	var op types.Operation
+	if err := op.Set(step.Operation); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProgram, err)
+	}
+
+	instruction := Instruction{
+		Send:      true,
+		Operation: op,
+		Intensity: step.Intensity,
+		Duration:  step.Duration,
+		Pause:     step.Pause,
+	}
+
+	if step.Ramp == nil {
+		*out = append(*out, instruction)
+		return nil
+	}
+
+	intensities, err := step.Ramp.intensities()
+	if err != nil {
+		return err
+	}
+
+	for _, intensity := range intensities {
+		instruction.Intensity = IntensityRange{Min: intensity, Max: intensity}
+		*out = append(*out, instruction)
+	}
+
+	return nil
+}
+
+func (r Ramp) intensities() ([]types.Intensity, error) {
+	if r.Steps < 2 || r.Steps > MaxInstructions {
+		return nil, fmt.Errorf("%w: ramp needs at least 2 steps", ErrInvalidProgram)
+	}
+
+	if r.From > 100 || r.To > 100 {
+		return nil, fmt.Errorf("%w: ramp intensities out of range", ErrInvalidProgram)
+	}
+
+	var curve func(x float64) float64
+
+	switch r.Curve {
+	case "", "linear":
+		curve = func(x float64) float64 { return x }
+	case "exponential":
+		// normalized to go from 0 to 1, starting slow and getting steeper
+		curve = func(x float64) float64 { return (math.Exp(3*x) - 1) / (math.Exp(3) - 1) }
+	default:
+		return nil, fmt.Errorf("%w: unknown ramp curve %q", ErrInvalidProgram, r.Curve)
+	}
+
+	ret := make([]types.Intensity, r.Steps)
+	for i := range ret {
+		x := curve(float64(i) / float64(r.Steps-1))
+		ret[i] = types.Intensity(math.Round(float64(r.From) + x*(float64(r.To)-float64(r.From))))
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,187 @@
+package pattern_test
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/pattern"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// recordingDispatcher records all jobs dispatched to it.
+type recordingDispatcher struct {
+	mu   sync.Mutex
+	jobs []transmit.Job
+}
+
+func (d *recordingDispatcher) Check(keyID string, cmd command.Command) error {
+	return nil
+}
+
+func (d *recordingDispatcher) Dispatch(ctx context.Context, keyID string, cmd command.Command) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.jobs = append(d.jobs, cmd.Job())
+	return nil
+}
+
+func intensities(jobs []transmit.Job) []types.Intensity {
+	ret := make([]types.Intensity, len(jobs))
+	for i, job := range jobs {
+		ret[i] = job.Message.GetIntensity()
+	}
+	return ret
+}
+
+var _ = Describe("Program", func() {
+	It("parses YAML with repeat blocks and ramps", func() {
+		program, err := pattern.Parse([]byte(`
+steps:
+  - operation: beep
+    pause: 1s
+  - repeat: 2
+    steps:
+      - operation: vibrate
+        ramp: {from: 10, to: 50, steps: 5}
+        duration: 300ms
+  - pause: {min: 2s, max: 10s}
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		instructions, err := program.Compile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instructions).To(HaveLen(12))
+
+		Expect(instructions[0]).To(Equal(pattern.Instruction{
+			Send:      true,
+			Operation: types.OperationBeep,
+			Pause:     pattern.DurationRange{Min: time.Second, Max: time.Second},
+		}))
+
+		Expect(instructions[3].Intensity).To(Equal(pattern.IntensityRange{Min: 30, Max: 30}))
+		Expect(instructions[3].Duration).To(Equal(pattern.DurationRange{Min: 300 * time.Millisecond, Max: 300 * time.Millisecond}))
+		Expect(instructions[11]).To(Equal(pattern.Instruction{
+			Pause: pattern.DurationRange{Min: 2 * time.Second, Max: 10 * time.Second},
+		}))
+	})
+
+	It("parses JSON", func() {
+		program, err := pattern.Parse([]byte(`{"steps": [{"operation": "shock", "intensity": {"min": 5, "max": 15}}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(program.Steps[0].Intensity).To(Equal(pattern.IntensityRange{Min: 5, Max: 15}))
+	})
+
+	DescribeTable("rejects invalid programs",
+		func(data string) {
+			_, err := pattern.Parse([]byte(data))
+			Expect(err).To(MatchError(ContainSubstring("invalid pattern program")))
+		},
+		Entry("empty", `steps: []`),
+		Entry("unknown operation", `steps: [{operation: tickle}]`),
+		Entry("intensity range", `steps: [{operation: shock, intensity: {min: 50, max: 10}}]`),
+		Entry("ramp curve", `steps: [{operation: shock, ramp: {from: 1, to: 2, steps: 2, curve: sine}}]`),
+		Entry("repeat with operation", `steps: [{operation: shock, repeat: 2, steps: [{operation: beep}]}]`),
+		Entry("too long", `steps: [{repeat: 1000, steps: [{repeat: 1000, steps: [{operation: beep}]}]}]`),
+		Entry("empty repeat", `steps: [{repeat: 2, steps: []}]`),
+		Entry("nested empty repeats", `steps: [{repeat: 1000000000, steps: [{repeat: 1000000000, steps: []}]}]`),
+		Entry("huge repeat", `steps: [{repeat: 2000000000, steps: [{operation: beep}, {operation: vibrate}]}]`),
+	)
+
+	It("ramps exponentially", func() {
+		program, err := pattern.Parse([]byte(`steps: [{operation: vibrate, ramp: {from: 0, to: 100, steps: 5, curve: exponential}}]`))
+		Expect(err).NotTo(HaveOccurred())
+
+		instructions, err := program.Compile()
+		Expect(err).NotTo(HaveOccurred())
+
+		t := &recordingDispatcher{}
+		err = pattern.Execute(context.Background(), instructions, "key", device.Target{Channel: types.Channel1}, t, rand.New(rand.NewSource(1)), clock.Real, func(int) {})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(intensities(t.jobs)).To(Equal([]types.Intensity{0, 6, 18, 44, 100}))
+	})
+})
+
+var _ = Describe("Execute", func() {
+	It("sends all operations on the given channel and reports progress", func() {
+		program, err := pattern.Parse([]byte(`
+steps:
+  - operation: shock
+    intensity: {min: 5, max: 15}
+  - pause: 10ms
+  - operation: vibrate
+    intensity: 20
+    duration: 1s
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		instructions, err := program.Compile()
+		Expect(err).NotTo(HaveOccurred())
+
+		t := &recordingDispatcher{}
+		progress := []int{}
+		err = pattern.Execute(context.Background(), instructions, "key", device.Target{Channel: types.Channel2}, t, rand.New(rand.NewSource(1)), clock.Real, func(step int) {
+			progress = append(progress, step)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(progress).To(Equal([]int{1, 2, 3}))
+
+		Expect(t.jobs).To(HaveLen(2))
+		for _, job := range t.jobs {
+			ch, _, err := job.Message.GetChannel()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ch).To(Equal(types.Channel2))
+		}
+
+		Expect(t.jobs[0].Message.GetIntensity()).To(And(BeNumerically(">=", 5), BeNumerically("<=", 15)))
+		Expect(t.jobs[0].Priority).To(Equal(transmit.PriorityShock))
+		Expect(t.jobs[1].Repetition.Duration).To(Equal(time.Second))
+	})
+
+	It("pauses on the given clock", func() {
+		program, err := pattern.Parse([]byte(`steps: [{operation: beep, pause: 1m}, {operation: vibrate}]`))
+		Expect(err).NotTo(HaveOccurred())
+
+		instructions, err := program.Compile()
+		Expect(err).NotTo(HaveOccurred())
+
+		fake := clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+		t := &recordingDispatcher{}
+		done := make(chan error, 1)
+		go func() {
+			done <- pattern.Execute(context.Background(), instructions, "key", device.Target{Channel: types.Channel1}, t, rand.New(rand.NewSource(1)), fake, func(int) {})
+		}()
+
+		Eventually(fake.Timers).Should(Equal(1))
+		fake.Advance(59 * time.Second)
+		Consistently(done).ShouldNot(Receive())
+
+		fake.Advance(time.Second)
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(t.jobs).To(HaveLen(2))
+	})
+
+	It("stops when the context is cancelled", func() {
+		program, err := pattern.Parse([]byte(`steps: [{operation: beep, pause: 1m}, {operation: beep}]`))
+		Expect(err).NotTo(HaveOccurred())
+
+		instructions, err := program.Compile()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		t := &recordingDispatcher{}
+		err = pattern.Execute(ctx, instructions, "key", device.Target{Channel: types.Channel1}, t, rand.New(rand.NewSource(1)), clock.NewFake(time.Now()), func(int) {})
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(t.jobs).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,193 @@
+package pattern
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Dispatcher is where Programs send their Operations to, usually a
+// command.Dispatcher, applying the same limits as for live requests.
+type Dispatcher interface {
+	Check(keyID string, cmd command.Command) error
+	Dispatch(ctx context.Context, keyID string, cmd command.Command) error
+}
+
+// State is the state of a Run.
+type State string
+
+const (
+	// StateRunning is the State of a Run still executing its Program.
+	StateRunning State = "running"
+
+	// StateDone is the State of a Run that executed all of its Program.
+	StateDone State = "done"
+
+	// StateStopped is the State of a Run stopped before it was done.
+	StateStopped State = "stopped"
+
+	// StateFailed is the State of a Run aborted because of an error.
+	StateFailed State = "failed"
+)
+
+// Status is a snapshot of the progress of a Run.
+type Status struct {
+	ID       string     `json:"id"`
+	KeyID    string     `json:"keyId"`
+	Pattern  string     `json:"pattern"`
+	Channel  string     `json:"channel"`
+	State    State      `json:"state"`
+	Step     int        `json:"step"`
+	Steps    int        `json:"steps"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Run is a single execution of a Program on a given Channel or device.
+type Run struct {
+	id      string
+	keyID   string
+	pattern string
+	target  device.Target
+
+	mu       sync.Mutex
+	state    State
+	step     int
+	steps    int
+	started  time.Time
+	finished time.Time
+	err      error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ID returns the unique identifier of the Run.
+func (r *Run) ID() string {
+	return r.id
+}
+
+// Status returns the current progress of the Run.
+func (r *Run) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ret := Status{
+		ID:      r.id,
+		KeyID:   r.keyID,
+		Pattern: r.pattern,
+		Channel: r.target.String(),
+		State:   r.state,
+		Step:    r.step,
+		Steps:   r.steps,
+		Started: r.started,
+	}
+
+	if !r.finished.IsZero() {
+		finished := r.finished
+		ret.Finished = &finished
+	}
+
+	if r.err != nil {
+		ret.Error = r.err.Error()
+	}
+
+	return ret
+}
+
+// Stop stops the Run, interrupting the Operation sent right now.
+func (r *Run) Stop() {
+	r.cancel()
+}
+
+// Done returns a channel closed when the Run finished.
+func (r *Run) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Run) progress(step int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.step = step
+}
+
+// finish marks the Run as finished at the given time, with the given error.
+func (r *Run) finish(err error, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.finished = now
+	switch {
+	case err == nil:
+		r.state = StateDone
+	case errors.Is(err, context.Canceled) || errors.Is(err, transmit.ErrStopped):
+		r.state = StateStopped
+	default:
+		r.state = StateFailed
+		r.err = err
+	}
+
+	close(r.done)
+}
+
+// Execute runs the given Instructions on the given Target on behalf of the
+// key with the given ID, using rng for choosing random values, pausing on the
+// given Clock and reporting the number of finished Instructions to progress.
+// It returns early with the cause of ctx when it is done.
+func Execute(ctx context.Context, instructions []Instruction, keyID string, target device.Target, d Dispatcher, rng *rand.Rand, c clock.Clock, progress func(int)) error {
+	for i, instruction := range instructions {
+		if instruction.Send {
+			intensity := instruction.Intensity.Min
+			if spread := int(instruction.Intensity.Max) - int(instruction.Intensity.Min); spread > 0 {
+				intensity += types.Intensity(rng.Intn(spread + 1))
+			}
+
+			err := d.Dispatch(ctx, keyID, command.Command{
+				Device:    target.Device,
+				Channel:   target.Channel,
+				Operation: instruction.Operation,
+				Intensity: intensity,
+				Repetition: driver.Repetition{
+					Duration: instruction.Duration.pick(rng),
+				},
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if pause := instruction.Pause.pick(rng); pause > 0 {
+			timer := c.NewTimer(pause)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return context.Cause(ctx)
+			case <-timer.C():
+			}
+		}
+
+		progress(i + 1)
+	}
+
+	return nil
+}
+
+func (r DurationRange) pick(rng *rand.Rand) time.Duration {
+	if spread := r.Max - r.Min; spread > 0 {
+		return r.Min + time.Duration(rng.Int63n(int64(spread)+1))
+	}
+
+	return r.Min
+}
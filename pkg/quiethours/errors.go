@@ -0,0 +1,32 @@
+package quiethours
+
+import (
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var (
+	// ErrQuietHours is returned for Commands denied by a Window.
+	ErrQuietHours = fmt.Errorf("%w: quiet hours", auth.ErrForbidden)
+
+	// ErrInvalidWindow is returned when loading Windows that make no
+	// sense.
+	ErrInvalidWindow = fmt.Errorf("%w: invalid quiet hours", types.ErrUnparsable)
+)
+
+// WindowError is returned when a Window denies a Command, naming the Window
+// and telling why. It matches ErrQuietHours.
+type WindowError struct {
+	Window string
+	Reason string
+}
+
+func (e *WindowError) Error() string {
+	return fmt.Sprintf("%v: %s: %s", ErrQuietHours, e.Window, e.Reason)
+}
+
+func (e *WindowError) Unwrap() error {
+	return ErrQuietHours
+}
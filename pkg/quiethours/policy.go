@@ -0,0 +1,108 @@
+// Package quiethours implements time windows, like quiet hours at night, in
+// which Commands are denied or sent as vibrations instead.
+package quiethours
+
+import (
+	"fmt"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Policy applies Windows to Commands. A nil Policy applies none.
+type Policy struct {
+	windows []Window
+	clock   clock.Clock
+}
+
+// WindowState is the state of a Window of a Policy.
+type WindowState struct {
+	Window
+
+	// Open tells if the Window is open now, Until when it closes then.
+	Open  bool       `json:"open"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// NewPolicy creates a Policy applying the given Windows, returning
+// ErrInvalidWindow if any of them makes no sense or two share a name.
+func NewPolicy(windows []Window, c clock.Clock) (*Policy, error) {
+	windows = append([]Window{}, windows...)
+	names := make(map[string]bool, len(windows))
+	for i := range windows {
+		if err := windows[i].validate(); err != nil {
+			return nil, err
+		}
+
+		if names[windows[i].Name] {
+			return nil, fmt.Errorf("%w: name %q used twice", ErrInvalidWindow, windows[i].Name)
+		}
+		names[windows[i].Name] = true
+	}
+
+	return &Policy{
+		windows: windows,
+		clock:   c,
+	}, nil
+}
+
+// Apply applies the Windows open now to the given Request, returning it as
+// it has to be sent, as vibration if a Window tells so. If any Window denies
+// it, a WindowError is returned.
+func (p *Policy) Apply(r Request) (Request, error) {
+	if p == nil {
+		return r, nil
+	}
+
+	now := p.clock.Now()
+	ret := r
+	for i := range p.windows {
+		w := &p.windows[i]
+		if !w.matches(r) {
+			continue
+		}
+
+		until, open := w.Until(now)
+		if !open {
+			continue
+		}
+
+		switch w.Action {
+		case ActionDeny:
+			return r, &WindowError{
+				Window: w.Name,
+				Reason: fmt.Sprintf("%v not allowed until %v", r.Operation, until.Format("15:04 MST")),
+			}
+		case ActionVibrate:
+			if ret.Operation != types.OperationVibrate {
+				ret.Operation = types.OperationVibrate
+				if w.Intensity != nil {
+					ret.Intensity = *w.Intensity
+				}
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// State returns the state of all Windows.
+func (p *Policy) State() []WindowState {
+	if p == nil {
+		return []WindowState{}
+	}
+
+	now := p.clock.Now()
+	ret := make([]WindowState, 0, len(p.windows))
+	for _, w := range p.windows {
+		state := WindowState{Window: w}
+		if until, open := w.Until(now); open {
+			state.Open, state.Until = true, &until
+		}
+
+		ret = append(ret, state)
+	}
+
+	return ret
+}
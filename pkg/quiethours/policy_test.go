@@ -0,0 +1,151 @@
+package quiethours_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/quiethours"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Policy", func() {
+	var (
+		berlin *time.Location
+		fake   *clock.Fake
+	)
+
+	BeforeEach(func() {
+		var err error
+		berlin, err = time.LoadLocation("Europe/Berlin")
+		Expect(err).NotTo(HaveOccurred())
+
+		// a Friday
+		fake = clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, berlin))
+	})
+
+	policy := func(config string) *quiethours.Policy {
+		var windows []quiethours.Window
+		Expect(json.Unmarshal([]byte(config), &windows)).To(Succeed())
+
+		ret, err := quiethours.NewPolicy(windows, fake)
+		Expect(err).NotTo(HaveOccurred())
+		return ret
+	}
+
+	beep := quiethours.Request{KeyID: "key", Channel: types.Channel1, Operation: types.OperationBeep}
+
+	It("denies Commands in windows over midnight", func() {
+		p := policy(`[{"name": "night", "start": "22:00", "end": "07:00", "action": "deny", "location": "Europe/Berlin"}]`)
+
+		Expect(p.Apply(beep)).To(Equal(beep))
+
+		fake.Set(time.Date(2024, 3, 1, 23, 0, 0, 0, berlin))
+		_, err := p.Apply(beep)
+		Expect(err).To(MatchError(quiethours.ErrQuietHours))
+		Expect(err).To(MatchError(auth.ErrForbidden))
+		Expect(err).To(MatchError(ContainSubstring("night: beep not allowed until 07:00 CET")))
+
+		fake.Set(time.Date(2024, 3, 2, 6, 59, 0, 0, berlin))
+		_, err = p.Apply(beep)
+		Expect(err).To(MatchError(quiethours.ErrQuietHours))
+
+		fake.Set(time.Date(2024, 3, 2, 7, 0, 0, 0, berlin))
+		Expect(p.Apply(beep)).To(Equal(beep))
+	})
+
+	It("applies windows in their time zone", func() {
+		p := policy(`[{"name": "night", "start": "22:00", "end": "07:00", "action": "deny", "location": "Europe/Berlin"}]`)
+
+		fake.Set(time.Date(2024, 3, 1, 21, 30, 0, 0, time.UTC))
+		_, err := p.Apply(beep)
+		Expect(err).To(MatchError(quiethours.ErrQuietHours))
+	})
+
+	It("sends Commands as vibrations", func() {
+		p := policy(`[{"name": "night", "start": "22:00", "end": "07:00", "action": "vibrate", "intensity": 20, "operations": ["beep", "shock"], "location": "Europe/Berlin"}]`)
+		fake.Set(time.Date(2024, 3, 1, 23, 0, 0, 0, berlin))
+
+		shock := quiethours.Request{KeyID: "key", Operation: types.OperationShock, Intensity: 50}
+		Expect(p.Apply(shock)).To(HaveField("Operation", types.OperationVibrate))
+		Expect(p.Apply(shock)).To(HaveField("Intensity", BeEquivalentTo(20)))
+
+		vibrate := quiethours.Request{KeyID: "key", Operation: types.OperationVibrate, Intensity: 50}
+		Expect(p.Apply(vibrate)).To(Equal(vibrate))
+	})
+
+	It("only starts windows on their weekdays and not on exceptions", func() {
+		p := policy(`[{"name": "weekend", "start": "20:00", "end": "10:00", "action": "deny", "weekdays": ["fri", "saturday"], "except": ["2024-03-02"], "location": "Europe/Berlin"}]`)
+
+		fake.Set(time.Date(2024, 3, 2, 9, 0, 0, 0, berlin))
+		_, err := p.Apply(beep)
+		Expect(err).To(MatchError(quiethours.ErrQuietHours))
+
+		fake.Set(time.Date(2024, 3, 2, 21, 0, 0, 0, berlin))
+		Expect(p.Apply(beep)).To(Equal(beep))
+
+		fake.Set(time.Date(2024, 3, 3, 21, 0, 0, 0, berlin))
+		Expect(p.Apply(beep)).To(Equal(beep))
+
+		fake.Set(time.Date(2024, 3, 8, 21, 0, 0, 0, berlin))
+		_, err = p.Apply(beep)
+		Expect(err).To(MatchError(quiethours.ErrQuietHours))
+	})
+
+	It("only applies windows to the devices, channels and keys given", func() {
+		p := policy(`[
+			{"name": "alex", "start": "00:00", "end": "00:00", "action": "deny", "devices": ["alex"]},
+			{"name": "guests", "start": "00:00", "end": "00:00", "action": "deny", "keys": ["guest"], "channels": ["2"]}
+		]`)
+
+		Expect(p.Apply(beep)).To(Equal(beep))
+
+		_, err := p.Apply(quiethours.Request{Device: "alex", Operation: types.OperationBeep})
+		Expect(err).To(MatchError(ContainSubstring("alex")))
+
+		guest := quiethours.Request{KeyID: "guest", Channel: types.Channel1}
+		Expect(p.Apply(guest)).To(Equal(guest))
+		_, err = p.Apply(quiethours.Request{KeyID: "guest", Channel: types.Channel2})
+		Expect(err).To(MatchError(ContainSubstring("guests")))
+	})
+
+	It("returns the state of its windows", func() {
+		p := policy(`[
+			{"name": "night", "start": "22:00", "end": "07:00", "action": "deny", "location": "Europe/Berlin"},
+			{"name": "lunch", "start": "11:30", "end": "13:00", "action": "vibrate", "location": "Europe/Berlin"}
+		]`)
+
+		state := p.State()
+		Expect(state).To(HaveLen(2))
+		Expect(state[0].Open).To(BeFalse())
+		Expect(state[1].Open).To(BeTrue())
+		Expect(*state[1].Until).To(BeTemporally("==", time.Date(2024, 3, 1, 13, 0, 0, 0, berlin)))
+	})
+
+	It("applies nothing without a Policy", func() {
+		var p *quiethours.Policy
+		Expect(p.Apply(beep)).To(Equal(beep))
+	})
+
+	DescribeTable("rejects invalid windows",
+		func(config string) {
+			var windows []quiethours.Window
+			err := json.Unmarshal([]byte(config), &windows)
+			if err == nil {
+				_, err = quiethours.NewPolicy(windows, fake)
+			}
+
+			Expect(err).To(MatchError(quiethours.ErrInvalidWindow))
+		},
+		Entry("invalid time", `[{"name": "night", "start": "10pm", "end": "07:00", "action": "deny"}]`),
+		Entry("unknown action", `[{"name": "night", "start": "22:00", "end": "07:00", "action": "beep"}]`),
+		Entry("unknown weekday", `[{"name": "night", "start": "22:00", "end": "07:00", "action": "deny", "weekdays": ["caturday"]}]`),
+		Entry("unknown location", `[{"name": "night", "start": "22:00", "end": "07:00", "action": "deny", "location": "Mars/Olympus"}]`),
+		Entry("invalid exception", `[{"name": "night", "start": "22:00", "end": "07:00", "action": "deny", "except": ["31.12."]}]`),
+		Entry("no name", `[{"start": "22:00", "end": "07:00", "action": "deny"}]`),
+		Entry("duplicate name", `[{"name": "night", "start": "22:00", "end": "07:00", "action": "deny"}, {"name": "night", "start": "12:00", "end": "13:00", "action": "deny"}]`),
+	)
+})
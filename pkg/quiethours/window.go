@@ -0,0 +1,234 @@
+package quiethours
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Action is what a Window does to the Commands it applies to.
+type Action string
+
+const (
+	// ActionDeny rejects the Commands.
+	ActionDeny Action = "deny"
+
+	// ActionVibrate sends the Commands as vibrations instead.
+	ActionVibrate Action = "vibrate"
+)
+
+// TimeOfDay is a time of the day, in minutes since midnight. It is written
+// as "15:04".
+type TimeOfDay int
+
+// Set parses the given "15:04" string into the TimeOfDay this method is
+// called on.
+func (t *TimeOfDay) Set(s string) error {
+	parsed, err := time.Parse("15:04", s)
+	if err != nil {
+		return fmt.Errorf("%w: time of day %q is not in 15:04 format", ErrInvalidWindow, s)
+	}
+
+	*t = TimeOfDay(parsed.Hour()*60 + parsed.Minute())
+	return nil
+}
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t/60, t%60)
+}
+
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+	return t.Set(string(text))
+}
+
+// Weekday is a time.Weekday written as its English name or its first three
+// letters, like "monday" or "mon".
+type Weekday time.Weekday
+
+func (w *Weekday) Set(s string) error {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s = strings.ToLower(s); s == name || s == name[:3] {
+			*w = Weekday(d)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: unknown weekday %q", ErrInvalidWindow, s)
+}
+
+func (w Weekday) String() string {
+	return strings.ToLower(time.Weekday(w).String()[:3])
+}
+
+func (w Weekday) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+func (w *Weekday) UnmarshalText(text []byte) error {
+	return w.Set(string(text))
+}
+
+// Window is a time window in which Commands matching it are denied or sent
+// as vibrations, like quiet hours at night. It starts at Start and ends at
+// End in its Location, on the next day if End is not after Start, and
+// starts on all Weekdays if none are given, except on the dates in Except.
+// Commands match a Window if they are sent to one of its Devices or
+// Channels, by one of its Keys and with one of its Operations, each of
+// those matching everything if not given.
+type Window struct {
+	Name   string    `json:"name"`
+	Start  TimeOfDay `json:"start"`
+	End    TimeOfDay `json:"end"`
+	Action Action    `json:"action"`
+
+	// Location is the name of the time zone Start and End are in, like
+	// "Europe/Berlin", the local one if not given.
+	Location string `json:"location,omitempty"`
+
+	// Weekdays are the days the Window starts on.
+	Weekdays []Weekday `json:"weekdays,omitempty"`
+
+	// Except are the dates, like "2024-12-31", the Window does not start
+	// on.
+	Except []string `json:"except,omitempty"`
+
+	Devices    []string          `json:"devices,omitempty"`
+	Channels   []types.Channel   `json:"channels,omitempty"`
+	Keys       []string          `json:"keys,omitempty"`
+	Operations []types.Operation `json:"operations,omitempty"`
+
+	// Intensity is the Intensity of the vibrations sent instead with
+	// ActionVibrate, the one requested if not given.
+	Intensity *types.Intensity `json:"intensity,omitempty"`
+
+	location *time.Location
+}
+
+// Request is what a Window is checked against: a Command sent by the key
+// with the ID KeyID, to a device, if any, on a Channel.
+type Request struct {
+	KeyID     string
+	Device    string
+	Channel   types.Channel
+	Operation types.Operation
+	Intensity types.Intensity
+}
+
+// validate returns an error if the Window makes no sense and loads its
+// Location.
+func (w *Window) validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("%w: window without name", ErrInvalidWindow)
+	}
+
+	switch w.Action {
+	case ActionDeny, ActionVibrate:
+	default:
+		return fmt.Errorf("%w: %s: unknown action %q", ErrInvalidWindow, w.Name, w.Action)
+	}
+
+	if w.Intensity != nil && *w.Intensity > 100 {
+		return fmt.Errorf("%w: %s: intensity out of range", ErrInvalidWindow, w.Name)
+	}
+
+	location, err := time.LoadLocation(w.Location)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidWindow, w.Name, err)
+	}
+	w.location = location
+
+	for _, date := range w.Except {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return fmt.Errorf("%w: %s: exception %q is not in 2006-01-02 format", ErrInvalidWindow, w.Name, date)
+		}
+	}
+
+	return nil
+}
+
+// matches returns if the Window applies to the given Request, not looking
+// at the time.
+func (w *Window) matches(r Request) bool {
+	return (len(w.Devices) == 0 || contains(w.Devices, r.Device)) &&
+		(len(w.Channels) == 0 || contains(w.Channels, r.Channel)) &&
+		(len(w.Keys) == 0 || contains(w.Keys, r.KeyID)) &&
+		(len(w.Operations) == 0 || contains(w.Operations, r.Operation))
+}
+
+// Until returns the end of the Window if it is open at the given time.
+func (w *Window) Until(now time.Time) (time.Time, bool) {
+	local := now.In(w.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, w.location)
+	minute := TimeOfDay(local.Hour()*60 + local.Minute())
+
+	// the Window may have started today, or yesterday if it ends on the
+	// day after it started
+	start := midnight
+	switch {
+	case w.Start < w.End && (minute < w.Start || minute >= w.End):
+		return time.Time{}, false
+	case w.Start >= w.End && minute < w.End:
+		start = midnight.AddDate(0, 0, -1)
+	case w.Start >= w.End && minute < w.Start:
+		return time.Time{}, false
+	}
+
+	if !w.startsOn(start) {
+		return time.Time{}, false
+	}
+
+	end := start
+	if w.Start >= w.End {
+		end = end.AddDate(0, 0, 1)
+	}
+
+	return time.Date(end.Year(), end.Month(), end.Day(), int(w.End)/60, int(w.End)%60, 0, 0, w.location), true
+}
+
+// startsOn returns if the Window starts on the day of the given time.
+func (w *Window) startsOn(day time.Time) bool {
+	if len(w.Weekdays) > 0 && !contains(w.Weekdays, Weekday(day.Weekday())) {
+		return false
+	}
+
+	return !contains(w.Except, day.Format(time.DateOnly))
+}
+
+// Load loads the Windows configured in the given JSON file, holding a list
+// of Windows. A file not existing configures none.
+func Load(path string) ([]Window, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading quiet hours: %w", err)
+	}
+
+	var ret []Window
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, fmt.Errorf("error parsing quiet hours: %w", err)
+	}
+
+	return ret, nil
+}
+
+func contains[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,26 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRateLimited is returned when a Command exceeds a Rule of a Limiter.
+var ErrRateLimited = errors.New("rate limited")
+
+// LimitError is returned when a Command exceeds a Rule, telling when to try
+// again. It matches ErrRateLimited.
+type LimitError struct {
+	Rule       Rule
+	Bucket     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %v for %s, retry after %v", ErrRateLimited, e.Rule, e.Bucket, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrRateLimited
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Limiter applies Rules to Commands, keeping a token bucket per Rule and
+// API key or device, depending on the Scope of the Rule.
+type Limiter struct {
+	rules Rules
+	clock clock.Clock
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+}
+
+type bucketKey struct {
+	rule   int
+	bucket string
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// BucketState is a snapshot of a token bucket of a Limiter.
+type BucketState struct {
+	Rule   string  `json:"rule"`
+	Bucket string  `json:"bucket"`
+	Tokens float64 `json:"tokens"`
+
+	// RetryAfter is the time until the next token is available, zero if
+	// there is one already.
+	RetryAfter time.Duration `json:"retryAfter"`
+}
+
+// NewLimiter creates a Limiter applying the given Rules. A Limiter without
+// Rules allows everything.
+func NewLimiter(rules Rules, c clock.Clock) *Limiter {
+	return &Limiter{
+		rules:   rules,
+		clock:   c,
+		buckets: make(map[bucketKey]*bucket),
+	}
+}
+
+// Rules returns the Rules applied by the Limiter.
+func (l *Limiter) Rules() Rules {
+	return l.rules
+}
+
+// Allow takes a token for a Command with the given Operation to the given
+// Target sent by the key with the given ID from all buckets it is counted
+// in. If any of them is empty, no token is taken and a LimitError is
+// returned, telling the longest time to wait.
+func (l *Limiter) Allow(keyID string, t device.Target, op types.Operation) error {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ret *LimitError
+	buckets := make([]*bucket, 0, len(l.rules))
+
+	for i, rule := range l.rules {
+		if !rule.applies(op) {
+			continue
+		}
+
+		key := bucketKey{rule: i}
+		switch rule.Scope {
+		case ScopeKey:
+			key.bucket = "key " + keyID
+		case ScopeChannel:
+			key.bucket = "channel " + t.Channel.String()
+			if t.Device != "" {
+				key.bucket = "device " + t.Device
+			}
+		case ScopeGlobal:
+			key.bucket = "all"
+		}
+
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{tokens: float64(rule.Burst), updated: now}
+			l.buckets[key] = b
+		}
+
+		b.refill(rule, now)
+		if wait := b.wait(rule); wait > 0 {
+			if ret == nil || wait > ret.RetryAfter {
+				ret = &LimitError{Rule: rule, Bucket: key.bucket, RetryAfter: wait}
+			}
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	if ret != nil {
+		return ret
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+
+	return nil
+}
+
+// State returns the state of all buckets not full, ordered by Rule and
+// bucket. Full buckets are forgotten, they are the same as new ones.
+func (l *Limiter) State() []BucketState {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ret := make([]BucketState, 0, len(l.buckets))
+	for key, b := range l.buckets {
+		rule := l.rules[key.rule]
+
+		b.refill(rule, now)
+		if b.tokens >= float64(rule.Burst) {
+			delete(l.buckets, key)
+			continue
+		}
+
+		ret = append(ret, BucketState{
+			Rule:       rule.String(),
+			Bucket:     key.bucket,
+			Tokens:     b.tokens,
+			RetryAfter: b.wait(rule),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Rule != ret[j].Rule {
+			return ret[i].Rule < ret[j].Rule
+		}
+
+		return ret[i].Bucket < ret[j].Bucket
+	})
+
+	return ret
+}
+
+func (b *bucket) refill(rule Rule, now time.Time) {
+	b.tokens += float64(now.Sub(b.updated)) / float64(rule.Every)
+	if b.tokens > float64(rule.Burst) {
+		b.tokens = float64(rule.Burst)
+	}
+
+	b.updated = now
+}
+
+// wait returns the time until the bucket has a token.
+func (b *bucket) wait(rule Rule) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) * float64(rule.Every))
+}
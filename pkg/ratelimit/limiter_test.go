@@ -0,0 +1,140 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var (
+	channel1 = device.Target{Channel: types.Channel1}
+	channel2 = device.Target{Channel: types.Channel2}
+)
+
+func rules(s string) ratelimit.Rules {
+	ret := ratelimit.Rules{}
+	Expect(ret.Set(s)).To(Succeed())
+	return ret
+}
+
+func retryAfter(err error) time.Duration {
+	var limitErr *ratelimit.LimitError
+	Expect(errors.As(err, &limitErr)).To(BeTrue())
+	return limitErr.RetryAfter
+}
+
+var _ = Describe("Rules", func() {
+	It("parses and formats rules", func() {
+		r := rules("channel:shock=1/10s,key:*=10/1m0s,global=5/1s")
+		Expect(r).To(HaveLen(3))
+		Expect(r[0].Scope).To(Equal(ratelimit.ScopeChannel))
+		Expect(*r[0].Operation).To(Equal(types.OperationShock))
+		Expect(r[1].Operation).To(BeNil())
+		Expect(r[2].Every).To(Equal(time.Second))
+		Expect(r.String()).To(Equal("channel:shock=1/10s,key:*=10/1m0s,global:*=5/1s"))
+	})
+
+	DescribeTable("rejects invalid rules",
+		func(s string) {
+			_, err := ratelimit.ParseRule(s)
+			Expect(err).To(MatchError(types.ErrUnparsable))
+		},
+		Entry("no limit", "channel:shock"),
+		Entry("unknown scope", "device:shock=1/1s"),
+		Entry("unknown operation", "channel:tickle=1/1s"),
+		Entry("no interval", "channel:shock=1"),
+		Entry("zero burst", "channel:shock=0/1s"),
+		Entry("invalid interval", "channel:shock=1/often"),
+	)
+})
+
+var _ = Describe("Limiter", func() {
+	var fake *clock.Fake
+
+	BeforeEach(func() {
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+	})
+
+	It("allows everything without rules", func() {
+		limiter := ratelimit.NewLimiter(nil, fake)
+		for i := 0; i < 100; i++ {
+			Expect(limiter.Allow("a", channel1, types.OperationShock)).To(Succeed())
+		}
+	})
+
+	It("limits per channel and operation", func() {
+		limiter := ratelimit.NewLimiter(rules("channel:shock=1/10s"), fake)
+
+		Expect(limiter.Allow("a", channel1, types.OperationShock)).To(Succeed())
+		Expect(limiter.Allow("b", channel2, types.OperationShock)).To(Succeed())
+		Expect(limiter.Allow("a", channel1, types.OperationVibrate)).To(Succeed())
+
+		fake.Advance(4 * time.Second)
+		err := limiter.Allow("b", channel1, types.OperationShock)
+		Expect(err).To(MatchError(ratelimit.ErrRateLimited))
+		Expect(retryAfter(err)).To(BeNumerically("~", 6*time.Second, time.Millisecond))
+
+		fake.Advance(6 * time.Second)
+		Expect(limiter.Allow("b", channel1, types.OperationShock)).To(Succeed())
+	})
+
+	It("limits devices sharing a channel separately", func() {
+		limiter := ratelimit.NewLimiter(rules("channel:shock=1/10s"), fake)
+
+		Expect(limiter.Allow("a", device.Target{Device: "alex-collar", Channel: types.Channel1}, types.OperationShock)).To(Succeed())
+		Expect(limiter.Allow("a", device.Target{Device: "sam-collar", Channel: types.Channel1}, types.OperationShock)).To(Succeed())
+		Expect(limiter.Allow("a", device.Target{Device: "alex-collar", Channel: types.Channel1}, types.OperationShock)).To(MatchError(ratelimit.ErrRateLimited))
+	})
+
+	It("allows bursts per key", func() {
+		limiter := ratelimit.NewLimiter(rules("key:*=3/1s"), fake)
+
+		for i := 0; i < 3; i++ {
+			Expect(limiter.Allow("a", channel1, types.OperationBeep)).To(Succeed())
+		}
+
+		Expect(limiter.Allow("a", channel2, types.OperationVibrate)).To(MatchError(ratelimit.ErrRateLimited))
+		Expect(limiter.Allow("b", channel1, types.OperationBeep)).To(Succeed())
+
+		fake.Advance(time.Second)
+		Expect(limiter.Allow("a", channel1, types.OperationBeep)).To(Succeed())
+		Expect(limiter.Allow("a", channel1, types.OperationBeep)).To(MatchError(ratelimit.ErrRateLimited))
+	})
+
+	It("takes no tokens when any bucket is empty", func() {
+		limiter := ratelimit.NewLimiter(rules("global:*=1/1m,key:*=2/1s"), fake)
+
+		Expect(limiter.Allow("a", channel1, types.OperationBeep)).To(Succeed())
+
+		err := limiter.Allow("a", channel1, types.OperationBeep)
+		Expect(err).To(MatchError(ContainSubstring("global:*=1/1m0s")))
+		Expect(retryAfter(err)).To(Equal(time.Minute))
+
+		fake.Advance(time.Minute)
+		Expect(limiter.Allow("a", channel1, types.OperationBeep)).To(Succeed())
+	})
+
+	It("shows the state of buckets not full", func() {
+		limiter := ratelimit.NewLimiter(rules("channel:shock=2/10s,key:*=5/1s"), fake)
+
+		Expect(limiter.Allow("a", channel1, types.OperationShock)).To(Succeed())
+		Expect(limiter.Allow("a", channel1, types.OperationShock)).To(Succeed())
+
+		fake.Advance(5 * time.Second)
+		Expect(limiter.State()).To(Equal([]ratelimit.BucketState{{
+			Rule:       "channel:shock=2/10s",
+			Bucket:     "channel 1",
+			Tokens:     0.5,
+			RetryAfter: 5 * time.Second,
+		}}))
+
+		fake.Advance(15 * time.Second)
+		Expect(limiter.State()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Scope tells what a Rule counts Commands per.
+type Scope string
+
+const (
+	// ScopeKey counts Commands per API key.
+	ScopeKey Scope = "key"
+
+	// ScopeChannel counts Commands per device, or per Channel for those
+	// not naming a device, so devices sharing a Channel on different
+	// remotes have budgets of their own.
+	ScopeChannel Scope = "channel"
+
+	// ScopeGlobal counts all Commands together.
+	ScopeGlobal Scope = "global"
+)
+
+// Rule is a token bucket limit for Commands in a Scope: a bucket holding at
+// most Burst tokens, refilled with one token every Every. Each Command takes
+// one token. Rules with an Operation only count Commands with that
+// Operation, giving every Operation its own budget.
+type Rule struct {
+	Scope     Scope
+	Operation *types.Operation
+	Burst     int
+	Every     time.Duration
+}
+
+// String returns a string representation of the Rule, in the format
+// ParseRule parses.
+func (r Rule) String() string {
+	op := "*"
+	if r.Operation != nil {
+		op = r.Operation.String()
+	}
+
+	return fmt.Sprintf("%s:%s=%d/%v", r.Scope, op, r.Burst, r.Every)
+}
+
+// applies returns if the Rule counts Commands with the given Operation.
+func (r Rule) applies(op types.Operation) bool {
+	return r.Operation == nil || *r.Operation == op
+}
+
+// ParseRule parses a Rule in the format "scope:operation=burst/interval",
+// e.g. "channel:shock=1/10s" for at most one shock every ten seconds per
+// channel or "key:*=10/1m" for ten Commands of any Operation per minute and
+// API key.
+func ParseRule(s string) (Rule, error) {
+	selector, limit, ok := strings.Cut(s, "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("%w: %q is not in scope:operation=burst/interval format", types.ErrUnparsable, s)
+	}
+
+	scope, opString, ok := strings.Cut(selector, ":")
+	if !ok {
+		opString = "*"
+	}
+
+	ret := Rule{Scope: Scope(scope)}
+	switch ret.Scope {
+	case ScopeKey, ScopeChannel, ScopeGlobal:
+	default:
+		return Rule{}, fmt.Errorf("%w: unknown scope %q", types.ErrUnparsable, scope)
+	}
+
+	if opString != "*" {
+		var op types.Operation
+		if err := op.Set(opString); err != nil {
+			return Rule{}, err
+		}
+
+		ret.Operation = &op
+	}
+
+	burstString, everyString, ok := strings.Cut(limit, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("%w: limit %q is not in burst/interval format", types.ErrUnparsable, limit)
+	}
+
+	var err error
+	if ret.Burst, err = strconv.Atoi(burstString); err != nil || ret.Burst < 1 {
+		return Rule{}, fmt.Errorf("%w: burst %q is not a positive number", types.ErrUnparsable, burstString)
+	}
+
+	if ret.Every, err = time.ParseDuration(everyString); err != nil || ret.Every <= 0 {
+		return Rule{}, fmt.Errorf("%w: interval %q is not a positive duration", types.ErrUnparsable, everyString)
+	}
+
+	return ret, nil
+}
+
+// Rules is a list of Rules, usable as flag.Value.
+type Rules []Rule
+
+// String returns a string representation of the Rules, in the format Set
+// parses.
+func (r Rules) String() string {
+	parts := make([]string, len(r))
+	for i, rule := range r {
+		parts[i] = rule.String()
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Set parses a comma separated list of Rules (see ParseRule), adding them to
+// the Rules.
+func (r *Rules) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		rule, err := ParseRule(part)
+		if err != nil {
+			return err
+		}
+
+		*r = append(*r, rule)
+	}
+
+	return nil
+}
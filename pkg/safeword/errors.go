@@ -0,0 +1,39 @@
+package safeword
+
+import (
+	"errors"
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+)
+
+var (
+	// ErrSafeword is returned for Commands rejected because of a safeword
+	// set by the wearer.
+	ErrSafeword = errors.New("safeword active")
+
+	// ErrInvalidState is returned when setting a State that makes no sense,
+	// like an unknown Mode.
+	ErrInvalidState = errors.New("invalid safeword state")
+)
+
+// RejectedError is returned for Commands rejected because of the State of
+// their Target. It matches ErrSafeword.
+type RejectedError struct {
+	Target device.Target
+	State  State
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	kind := "channel"
+	if e.Target.Device != "" {
+		kind = "device"
+	}
+
+	return fmt.Sprintf("%v on %s %v (%s since %v): %s", ErrSafeword, kind, e.Target, e.State.Mode, e.State.Since.Format("15:04:05"), e.Reason)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return ErrSafeword
+}
@@ -0,0 +1,225 @@
+package safeword
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Mode is what a safeword does to the Commands on its Target.
+type Mode string
+
+const (
+	// ModePause rejects all Commands.
+	ModePause Mode = "pause"
+
+	// ModeNoShock rejects shocks, allowing everything else.
+	ModeNoShock Mode = "no-shock"
+
+	// ModeLimit rejects Commands with an Intensity above the MaxIntensity
+	// of the State.
+	ModeLimit Mode = "limit"
+)
+
+// State is the safeword set for a Target.
+type State struct {
+	Mode         Mode            `json:"mode"`
+	MaxIntensity types.Intensity `json:"maxIntensity,omitempty"`
+
+	// Since is when the State was set, KeyID is the wearer key setting it.
+	Since time.Time `json:"since"`
+	KeyID string    `json:"keyId"`
+}
+
+// check returns a RejectedError if the State does not allow sending the given
+// Operation with the given Intensity.
+func (s State) check(t device.Target, op types.Operation, intensity types.Intensity) error {
+	reason := ""
+
+	switch {
+	case s.Mode == ModePause:
+		reason = "all operations paused"
+	case s.Mode == ModeNoShock && op == types.OperationShock:
+		reason = "shocks paused"
+	case s.Mode == ModeLimit && intensity > s.MaxIntensity:
+		reason = fmt.Sprintf("intensity %v requested, maximum is %v", intensity, s.MaxIntensity)
+	default:
+		return nil
+	}
+
+	return &RejectedError{Target: t, State: s, Reason: reason}
+}
+
+// Lock keeps the safewords set by the wearer per Target, overriding what any
+// key may do otherwise: per device, so wearers of devices sharing a Channel
+// on different remotes do not share a safeword, and per Channel for what is
+// sent without naming a device. Safewords are persisted to a file, to stay
+// in effect over restarts until they are lifted.
+type Lock struct {
+	path  string
+	clock clock.Clock
+
+	mu     sync.Mutex
+	states map[device.Target]State
+}
+
+// scope returns the Target the safeword of the given one is kept for, the
+// device alone if one is named.
+func scope(t device.Target) device.Target {
+	if t.Device != "" {
+		return device.Target{Device: t.Device}
+	}
+
+	return t
+}
+
+// Open opens the Lock persisted in the given file, creating it when the
+// first safeword is set.
+func Open(path string, c clock.Clock) (*Lock, error) {
+	l := &Lock{
+		path:   path,
+		clock:  c,
+		states: make(map[device.Target]State),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading safewords: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &l.states); err != nil {
+		return nil, fmt.Errorf("error parsing safewords: %w", err)
+	}
+
+	return l, nil
+}
+
+// Set sets the safeword with the given Mode for the given Target, on behalf
+// of the wearer key with the given ID. maxIntensity is only used for
+// ModeLimit.
+func (l *Lock) Set(keyID string, t device.Target, mode Mode, maxIntensity types.Intensity) (State, error) {
+	state := State{
+		Mode:  mode,
+		Since: l.clock.Now(),
+		KeyID: keyID,
+	}
+
+	switch mode {
+	case ModePause, ModeNoShock:
+	case ModeLimit:
+		state.MaxIntensity = maxIntensity
+	default:
+		return State{}, fmt.Errorf("%w: unknown mode %q", ErrInvalidState, mode)
+	}
+
+	t = scope(t)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous, set := l.states[t]
+
+	l.states[t] = state
+	if err := l.saveLocked(); err != nil {
+		if set {
+			l.states[t] = previous
+		} else {
+			delete(l.states, t)
+		}
+
+		return State{}, err
+	}
+
+	return state, nil
+}
+
+// Lift removes the safeword of the given Target, if any.
+func (l *Lock) Lift(t device.Target) error {
+	t = scope(t)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previous, set := l.states[t]
+	if !set {
+		return nil
+	}
+
+	delete(l.states, t)
+	if err := l.saveLocked(); err != nil {
+		l.states[t] = previous
+		return err
+	}
+
+	return nil
+}
+
+// States returns the safewords of all Targets having one.
+func (l *Lock) States() map[device.Target]State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ret := make(map[device.Target]State, len(l.states))
+	for t, state := range l.states {
+		ret[t] = state
+	}
+
+	return ret
+}
+
+// Check returns a RejectedError if the safeword of the given Target does not
+// allow sending the given Operation with the given Intensity. Only the
+// safeword of the device is checked for Targets naming one.
+func (l *Lock) Check(t device.Target, op types.Operation, intensity types.Intensity) error {
+	t = scope(t)
+
+	l.mu.Lock()
+	state, set := l.states[t]
+	l.mu.Unlock()
+
+	if !set {
+		return nil
+	}
+
+	return state.check(t, op, intensity)
+}
+
+// saveLocked writes all safewords to the file, l.mu has to be locked.
+func (l *Lock) saveLocked() error {
+	data, err := json.MarshalIndent(l.states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding safewords: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing safewords: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing safewords: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing safewords: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("error writing safewords: %w", err)
+	}
+
+	return nil
+}
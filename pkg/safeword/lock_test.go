@@ -0,0 +1,129 @@
+package safeword_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/safeword"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var (
+	channel1 = device.Target{Channel: types.Channel1}
+	channel2 = device.Target{Channel: types.Channel2}
+)
+
+var _ = Describe("Lock", func() {
+	var (
+		path string
+		fake *clock.Fake
+		lock *safeword.Lock
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		path = filepath.Join(GinkgoT().TempDir(), "safewords.json")
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		lock, err = safeword.Open(path, fake)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("allows everything without safeword", func() {
+		Expect(lock.Check(channel1, types.OperationShock, 100)).To(Succeed())
+		Expect(lock.States()).To(BeEmpty())
+	})
+
+	It("pauses all operations", func() {
+		_, err := lock.Set("wearer", channel1, safeword.ModePause, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = lock.Check(channel1, types.OperationBeep, 0)
+		Expect(err).To(MatchError(safeword.ErrSafeword))
+		Expect(err).To(MatchError(ContainSubstring("all operations paused")))
+
+		Expect(lock.Check(channel2, types.OperationShock, 100)).To(Succeed())
+	})
+
+	It("pauses shocks only", func() {
+		_, err := lock.Set("wearer", channel2, safeword.ModeNoShock, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(lock.Check(channel2, types.OperationShock, 1)).To(MatchError(ContainSubstring("shocks paused")))
+		Expect(lock.Check(channel2, types.OperationVibrate, 100)).To(Succeed())
+	})
+
+	It("lowers the maximum intensity", func() {
+		state, err := lock.Set("wearer", channel1, safeword.ModeLimit, 20)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Since).To(Equal(fake.Now()))
+
+		Expect(lock.Check(channel1, types.OperationVibrate, 20)).To(Succeed())
+
+		err = lock.Check(channel1, types.OperationVibrate, 21)
+		var rejected *safeword.RejectedError
+		Expect(errors.As(err, &rejected)).To(BeTrue())
+		Expect(rejected.State.Mode).To(Equal(safeword.ModeLimit))
+		Expect(rejected.Target).To(Equal(channel1))
+	})
+
+	It("is lifted", func() {
+		_, err := lock.Set("wearer", channel1, safeword.ModePause, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(lock.Lift(channel1)).To(Succeed())
+		Expect(lock.Check(channel1, types.OperationShock, 100)).To(Succeed())
+		Expect(lock.Lift(channel1)).To(Succeed())
+	})
+
+	It("stays set over restarts", func() {
+		_, err := lock.Set("wearer", channel2, safeword.ModeNoShock, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		reopened, err := safeword.Open(path, fake)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.States()).To(HaveKeyWithValue(channel2, And(
+			HaveField("Mode", safeword.ModeNoShock),
+			HaveField("KeyID", "wearer"),
+		)))
+		Expect(reopened.Check(channel2, types.OperationShock, 1)).To(MatchError(safeword.ErrSafeword))
+	})
+
+	It("keeps safewords per device", func() {
+		alex := device.Target{Device: "alex-collar", Channel: types.Channel1}
+		sam := device.Target{Device: "sam-collar", Channel: types.Channel1}
+
+		_, err := lock.Set("wearer", alex, safeword.ModePause, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(lock.Check(alex, types.OperationBeep, 0)).To(MatchError(ContainSubstring("on device alex-collar")))
+		Expect(lock.Check(device.Target{Device: "alex-collar"}, types.OperationBeep, 0)).To(MatchError(safeword.ErrSafeword))
+		Expect(lock.Check(sam, types.OperationShock, 100)).To(Succeed())
+		Expect(lock.Check(channel1, types.OperationShock, 100)).To(Succeed())
+		Expect(lock.States()).To(HaveKey(device.Target{Device: "alex-collar"}))
+
+		Expect(lock.Lift(sam)).To(Succeed())
+		Expect(lock.Check(alex, types.OperationBeep, 0)).To(MatchError(safeword.ErrSafeword))
+	})
+
+	It("reads safewords stored per Channel", func() {
+		Expect(os.WriteFile(path, []byte(`{"2": {"mode": "pause", "keyId": "wearer"}}`), 0o600)).To(Succeed())
+
+		reopened, err := safeword.Open(path, fake)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.Check(channel2, types.OperationBeep, 0)).To(MatchError(safeword.ErrSafeword))
+	})
+
+	It("rejects unknown modes", func() {
+		_, err := lock.Set("wearer", channel1, "panic", 0)
+		Expect(err).To(MatchError(safeword.ErrInvalidState))
+		Expect(lock.States()).To(BeEmpty())
+	})
+})
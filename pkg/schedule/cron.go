@@ -0,0 +1,195 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression in the usual five field format
+// "minute hour day-of-month month day-of-week". Every field takes "*",
+// single values, ranges ("1-5"), steps ("*/15", "0-30/10") and comma
+// separated lists of those. Months and weekdays also take their English
+// three letter abbreviations ("jan", "mon-fri"). The macros @yearly,
+// @monthly, @weekly, @daily and @hourly are supported as well.
+//
+// As in the original cron, when both day-of-month and day-of-week are
+// restricted, a day matching either of them matches.
+type Cron struct {
+	expression string
+
+	minute, hour, dom, month, dow uint64
+
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField = cronField{min: 0, max: 59}
+	hourField   = cronField{min: 0, max: 23}
+	domField    = cronField{min: 1, max: 31}
+	monthField  = cronField{min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField    = cronField{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses the given cron expression.
+func ParseCron(expression string) (*Cron, error) {
+	spec := strings.TrimSpace(expression)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q: expected 5 fields, got %d", ErrInvalidCron, expression, len(fields))
+	}
+
+	ret := &Cron{
+		expression: expression,
+		domStar:    strings.HasPrefix(fields[2], "*"),
+		dowStar:    strings.HasPrefix(fields[4], "*"),
+	}
+
+	for i, target := range []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&ret.minute, minuteField},
+		{&ret.hour, hourField},
+		{&ret.dom, domField},
+		{&ret.month, monthField},
+		{&ret.dow, dowField},
+	} {
+		bits, err := target.field.parse(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidCron, expression, err)
+		}
+
+		*target.bits = bits
+	}
+
+	// 7 is sunday, too
+	if ret.dow&(1<<7) != 0 {
+		ret.dow |= 1
+	}
+
+	return ret, nil
+}
+
+// String returns the expression the Cron was parsed from.
+func (c *Cron) String() string {
+	return c.expression
+}
+
+// Next returns the first time after t matching the Cron, in the location of
+// t. The zero time is returned if there is none in the next five years.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+func (f cronField) parse(s string) (uint64, error) {
+	ret := uint64(0)
+
+	for _, part := range strings.Split(s, ",") {
+		rangeString, stepString, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepString); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepString)
+			}
+		}
+
+		var low, high int
+		if rangeString == "*" {
+			low, high = f.min, f.max
+		} else {
+			lowString, highString, isRange := strings.Cut(rangeString, "-")
+
+			var err error
+			if low, err = f.value(lowString); err != nil {
+				return 0, err
+			}
+
+			high = low
+			if isRange {
+				if high, err = f.value(highString); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = f.max
+			}
+		}
+
+		if low > high {
+			return 0, fmt.Errorf("invalid range %q", rangeString)
+		}
+
+		for i := low; i <= high; i += step {
+			ret |= 1 << uint(i)
+		}
+	}
+
+	return ret, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+
+	return v, nil
+}
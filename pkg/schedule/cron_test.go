@@ -0,0 +1,49 @@
+package schedule_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/schedule"
+)
+
+var _ = Describe("Cron", func() {
+	// a Monday
+	start := time.Date(2026, time.October, 19, 11, 21, 10, 0, time.UTC)
+
+	DescribeTable("Next",
+		func(expression string, expected time.Time) {
+			cron, err := schedule.ParseCron(expression)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cron.Next(start)).To(Equal(expected))
+		},
+		Entry("every minute", "* * * * *", time.Date(2026, time.October, 19, 11, 22, 0, 0, time.UTC)),
+		Entry("every 15 minutes", "*/15 * * * *", time.Date(2026, time.October, 19, 11, 30, 0, 0, time.UTC)),
+		Entry("weekdays at 07:00", "0 7 * * mon-fri", time.Date(2026, time.October, 20, 7, 0, 0, 0, time.UTC)),
+		Entry("saturdays at 07:00", "0 7 * * sat", time.Date(2026, time.October, 24, 7, 0, 0, 0, time.UTC)),
+		Entry("sunday as 7", "30 8 * * 7", time.Date(2026, time.October, 25, 8, 30, 0, 0, time.UTC)),
+		Entry("list of hours", "0 9,12,18 * * *", time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)),
+		Entry("first of the month", "@monthly", time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)),
+		Entry("day-of-month or day-of-week", "0 0 1 * fri", time.Date(2026, time.October, 23, 0, 0, 0, 0, time.UTC)),
+		Entry("leap day", "0 0 29 feb *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)),
+	)
+
+	DescribeTable("rejects invalid expressions",
+		func(expression string) {
+			_, err := schedule.ParseCron(expression)
+			Expect(err).To(MatchError(schedule.ErrInvalidCron))
+		},
+		Entry("too few fields", "* * * *"),
+		Entry("out of range", "60 * * * *"),
+		Entry("inverted range", "* 10-5 * * *"),
+		Entry("unknown name", "* * * * someday"),
+		Entry("invalid step", "*/0 * * * *"),
+	)
+
+	It("never matches impossible dates", func() {
+		cron, err := schedule.ParseCron("0 0 31 feb *")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cron.Next(start)).To(BeZero())
+	})
+})
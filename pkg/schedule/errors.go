@@ -0,0 +1,15 @@
+package schedule
+
+import "errors"
+
+var (
+	// ErrInvalidCron is returned when a cron expression cannot be parsed.
+	ErrInvalidCron = errors.New("invalid cron expression")
+
+	// ErrInvalidSpec is returned when a Spec does not describe when to run
+	// an Entry.
+	ErrInvalidSpec = errors.New("invalid schedule")
+
+	// ErrUnknownEntry is returned when there is no Entry with a given ID.
+	ErrUnknownEntry = errors.New("unknown schedule entry")
+)
@@ -0,0 +1,376 @@
+package schedule
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+)
+
+// MissedGrace is how late a one-shot Entry may still be run, e.g. after the
+// server was restarted. One-shot Entries missed by longer are dropped.
+const MissedGrace = time.Minute
+
+// Dispatcher is where due Entries send their Commands, usually a
+// command.Dispatcher, applying the same limits as for live requests.
+type Dispatcher interface {
+	Check(keyID string, cmd command.Command) error
+	Dispatch(ctx context.Context, keyID string, cmd command.Command) error
+}
+
+// Spec describes when an Entry is run: either recurring with a Cron
+// expression or once at a given time.
+type Spec struct {
+	Cron string     `json:"cron,omitempty"`
+	At   *time.Time `json:"at,omitempty"`
+}
+
+// Entry is a Command sent on behalf of a key at the times given by its Spec.
+type Entry struct {
+	ID      string          `json:"id"`
+	KeyID   string          `json:"keyId"`
+	Spec    Spec            `json:"spec"`
+	Command command.Command `json:"command"`
+
+	Created   time.Time  `json:"created"`
+	Next      time.Time  `json:"next"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+
+	cron *Cron
+}
+
+// Manager keeps the Entries, persists them to a file and sends their
+// Commands when they are due.
+type Manager struct {
+	path       string
+	dispatcher Dispatcher
+	clock      clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	wake    chan struct{}
+}
+
+// NewManager creates a Manager persisting its Entries to the given file,
+// loading the Entries already in it. Call Run to actually send Commands.
+func NewManager(path string, d Dispatcher, c clock.Clock) (*Manager, error) {
+	m := &Manager{
+		path:       path,
+		dispatcher: d,
+		clock:      c,
+		entries:    make(map[string]*Entry),
+		wake:       make(chan struct{}, 1),
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Add creates a new Entry for the key with the given ID, checking the
+// Command against the limits of the key first. One-shot Entries have to be
+// due in the future.
+func (m *Manager) Add(keyID string, spec Spec, cmd command.Command) (Entry, error) {
+	if err := m.dispatcher.Check(keyID, cmd); err != nil {
+		return Entry{}, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	now := m.clock.Now()
+	entry := &Entry{
+		ID:      id,
+		KeyID:   keyID,
+		Spec:    spec,
+		Command: cmd,
+		Created: now,
+	}
+
+	if err := entry.prepare(now); err != nil {
+		return Entry{}, err
+	}
+
+	if entry.cron == nil && entry.Next.Before(now) {
+		return Entry{}, fmt.Errorf("%w: %v is in the past", ErrInvalidSpec, entry.Next)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[id] = entry
+	if err := m.saveLocked(); err != nil {
+		delete(m.entries, id)
+		return Entry{}, err
+	}
+
+	m.wakeUp()
+	return *entry, nil
+}
+
+// Remove deletes the Entry with the given ID, if it belongs to the key with
+// the given ID.
+func (m *Manager) Remove(keyID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[id]
+	if !ok || entry.KeyID != keyID {
+		return fmt.Errorf("%w: %q", ErrUnknownEntry, id)
+	}
+
+	delete(m.entries, id)
+	if err := m.saveLocked(); err != nil {
+		return err
+	}
+
+	m.wakeUp()
+	return nil
+}
+
+// Entries returns all Entries of the key with the given ID, ordered by the
+// time they are due next.
+func (m *Manager) Entries(keyID string) []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := make([]Entry, 0)
+	for _, entry := range m.entries {
+		if entry.KeyID == keyID {
+			ret = append(ret, *entry)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Next.Before(ret[j].Next)
+	})
+
+	return ret
+}
+
+// Run sends the Commands of all Entries when they are due, until ctx is
+// done.
+func (m *Manager) Run(ctx context.Context) {
+	for {
+		var timer clock.Timer
+		var fire <-chan time.Time
+
+		if next, ok := m.next(); ok {
+			timer = m.clock.NewTimer(next.Sub(m.clock.Now()))
+			fire = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-m.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-fire:
+			m.runDue(ctx)
+		}
+	}
+}
+
+func (m *Manager) next() (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ret := time.Time{}
+	for _, entry := range m.entries {
+		if ret.IsZero() || entry.Next.Before(ret) {
+			ret = entry.Next
+		}
+	}
+
+	return ret, !ret.IsZero()
+}
+
+func (m *Manager) runDue(ctx context.Context) {
+	now := m.clock.Now()
+
+	m.mu.Lock()
+	due := make([]Entry, 0)
+	for id, entry := range m.entries {
+		if entry.Next.After(now) {
+			continue
+		}
+
+		due = append(due, *entry)
+
+		if entry.cron != nil {
+			entry.Next = entry.cron.Next(now)
+		} else {
+			delete(m.entries, id)
+		}
+	}
+
+	if err := m.saveLocked(); err != nil {
+		log.Printf("schedule: %v", err)
+	}
+	m.mu.Unlock()
+
+	for _, entry := range due {
+		go func(entry Entry) {
+			ctx := command.WithOrigin(ctx, command.Origin{Source: "schedule:" + entry.ID})
+			err := m.dispatcher.Dispatch(ctx, entry.KeyID, entry.Command)
+			if err != nil {
+				log.Printf("schedule: error running entry %s: %v", entry.ID, err)
+			}
+
+			m.finished(entry.ID, now, err)
+		}(entry)
+	}
+}
+
+func (m *Manager) finished(id string, at time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[id]
+	if !ok {
+		// one-shot entries are gone already
+		return
+	}
+
+	entry.LastRun = &at
+	entry.LastError = ""
+	if err != nil {
+		entry.LastError = err.Error()
+	}
+
+	if err := m.saveLocked(); err != nil {
+		log.Printf("schedule: %v", err)
+	}
+}
+
+// wakeUp makes Run recalculate when the next Entry is due.
+func (m *Manager) wakeUp() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// prepare parses the Spec of the Entry and calculates when it is due next.
+func (e *Entry) prepare(now time.Time) error {
+	switch {
+	case e.Spec.Cron != "" && e.Spec.At != nil:
+		return fmt.Errorf("%w: either cron or at must be given, not both", ErrInvalidSpec)
+	case e.Spec.Cron != "":
+		cron, err := ParseCron(e.Spec.Cron)
+		if err != nil {
+			return err
+		}
+
+		e.cron = cron
+		e.Next = cron.Next(now)
+		if e.Next.IsZero() {
+			return fmt.Errorf("%w: cron expression never matches", ErrInvalidSpec)
+		}
+	case e.Spec.At != nil:
+		e.Next = *e.Spec.At
+	default:
+		return fmt.Errorf("%w: either cron or at must be given", ErrInvalidSpec)
+	}
+
+	return nil
+}
+
+func (m *Manager) load() error {
+	data, err := os.ReadFile(m.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading schedule: %w", err)
+	}
+
+	entries := make([]*Entry, 0)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("error parsing schedule: %w", err)
+	}
+
+	now := m.clock.Now()
+	for _, entry := range entries {
+		if err := entry.prepare(now); err != nil {
+			return fmt.Errorf("error in schedule entry %s: %w", entry.ID, err)
+		}
+
+		if entry.cron == nil && now.Sub(entry.Next) > MissedGrace {
+			log.Printf("schedule: dropping entry %s missed at %v", entry.ID, entry.Next)
+			continue
+		}
+
+		m.entries[entry.ID] = entry
+	}
+
+	return nil
+}
+
+// saveLocked writes all Entries to the schedule file, m.mu has to be locked.
+func (m *Manager) saveLocked() error {
+	entries := make([]*Entry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding schedule: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing schedule: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing schedule: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing schedule: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), m.path); err != nil {
+		return fmt.Errorf("error writing schedule: %w", err)
+	}
+
+	return nil
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,187 @@
+package schedule_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/schedule"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// recordingDispatcher records all Commands dispatched and only accepts the
+// key "valid".
+type recordingDispatcher struct {
+	mu       sync.Mutex
+	commands []command.Command
+}
+
+func (d *recordingDispatcher) Check(keyID string, cmd command.Command) error {
+	if keyID != "valid" {
+		return auth.ErrUnknownKey
+	}
+
+	return nil
+}
+
+func (d *recordingDispatcher) Dispatch(ctx context.Context, keyID string, cmd command.Command) error {
+	if err := d.Check(keyID, cmd); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.commands = append(d.commands, cmd)
+	return nil
+}
+
+func (d *recordingDispatcher) Commands() []command.Command {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]command.Command(nil), d.commands...)
+}
+
+var _ = Describe("Manager", func() {
+	var (
+		path       string
+		dispatcher *recordingDispatcher
+		fake       *clock.Fake
+		manager    *schedule.Manager
+		cancel     context.CancelFunc
+		stopped    chan struct{}
+	)
+
+	beep := command.Command{
+		Channel:   types.Channel2,
+		Operation: types.OperationBeep,
+	}
+
+	start := func() {
+		var err error
+		manager, err = schedule.NewManager(path, dispatcher, fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		stopped = make(chan struct{})
+		go func() {
+			defer close(stopped)
+			manager.Run(ctx)
+		}()
+	}
+
+	stop := func() {
+		cancel()
+		Eventually(stopped).Should(BeClosed())
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "schedule.json")
+		dispatcher = &recordingDispatcher{}
+		// a Monday
+		fake = clock.NewFake(time.Date(2026, time.October, 19, 11, 21, 10, 0, time.UTC))
+		start()
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	It("runs recurring entries every time they are due", func() {
+		entry, err := manager.Add("valid", schedule.Spec{Cron: "0 7 * * mon-fri"}, beep)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry.Next).To(Equal(time.Date(2026, time.October, 20, 7, 0, 0, 0, time.UTC)))
+
+		Eventually(fake.Timers).Should(Equal(1))
+		fake.Set(entry.Next)
+		Eventually(dispatcher.Commands).Should(Equal([]command.Command{beep}))
+
+		Eventually(func() time.Time {
+			return manager.Entries("valid")[0].Next
+		}).Should(Equal(time.Date(2026, time.October, 21, 7, 0, 0, 0, time.UTC)))
+		Eventually(func() *time.Time {
+			return manager.Entries("valid")[0].LastRun
+		}).ShouldNot(BeNil())
+	})
+
+	It("runs one-shot entries once", func() {
+		at := fake.Now().Add(20 * time.Minute)
+		_, err := manager.Add("valid", schedule.Spec{At: &at}, beep)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(fake.Timers).Should(Equal(1))
+		fake.Advance(19 * time.Minute)
+		Consistently(dispatcher.Commands).Should(BeEmpty())
+
+		fake.Advance(time.Minute)
+		Eventually(dispatcher.Commands).Should(HaveLen(1))
+		Expect(manager.Entries("valid")).To(BeEmpty())
+	})
+
+	It("checks entries against the limits of the key", func() {
+		_, err := manager.Add("invalid", schedule.Spec{Cron: "@hourly"}, beep)
+		Expect(err).To(MatchError(auth.ErrUnknownKey))
+	})
+
+	It("rejects invalid specs", func() {
+		at := fake.Now()
+		_, err := manager.Add("valid", schedule.Spec{Cron: "@hourly", At: &at}, beep)
+		Expect(err).To(MatchError(schedule.ErrInvalidSpec))
+
+		_, err = manager.Add("valid", schedule.Spec{Cron: "every hour"}, beep)
+		Expect(err).To(MatchError(schedule.ErrInvalidCron))
+
+		past := fake.Now().Add(-time.Minute)
+		_, err = manager.Add("valid", schedule.Spec{At: &past}, beep)
+		Expect(err).To(MatchError(schedule.ErrInvalidSpec))
+		Expect(manager.Entries("valid")).To(BeEmpty())
+	})
+
+	It("only lists and removes entries of the given key", func() {
+		entry, err := manager.Add("valid", schedule.Spec{Cron: "@hourly"}, beep)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manager.Entries("other")).To(BeEmpty())
+		Expect(manager.Remove("other", entry.ID)).To(MatchError(schedule.ErrUnknownEntry))
+		Expect(manager.Remove("valid", entry.ID)).To(Succeed())
+		Expect(manager.Entries("valid")).To(BeEmpty())
+	})
+
+	It("persists entries across restarts", func() {
+		recurring, err := manager.Add("valid", schedule.Spec{Cron: "@daily"}, beep)
+		Expect(err).NotTo(HaveOccurred())
+
+		soon := fake.Now().Add(time.Hour)
+		oneShot, err := manager.Add("valid", schedule.Spec{At: &soon}, beep)
+		Expect(err).NotTo(HaveOccurred())
+
+		stop()
+		start()
+
+		Expect(manager.Entries("valid")).To(ConsistOf(
+			HaveField("ID", recurring.ID),
+			HaveField("ID", oneShot.ID),
+		))
+	})
+
+	It("drops one-shot entries missed while not running", func() {
+		at := fake.Now().Add(time.Hour)
+		_, err := manager.Add("valid", schedule.Spec{At: &at}, beep)
+		Expect(err).NotTo(HaveOccurred())
+
+		stop()
+		fake.Advance(2 * time.Hour)
+		start()
+
+		Expect(manager.Entries("valid")).To(BeEmpty())
+		Consistently(dispatcher.Commands).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,90 @@
+// Package api holds what all versions of the HTTP API share.
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/approval"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/calibration"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/job"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/pattern"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/safeword"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/schedule"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/session"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// errorStatus maps errors to the HTTP status codes they are answered with,
+// the first matching one wins.
+var errorStatus = []struct {
+	err    error
+	status int
+}{
+	{auth.ErrUnauthorized, http.StatusUnauthorized},
+	{auth.ErrForbidden, http.StatusForbidden},
+	{transmit.ErrQueueFull, http.StatusTooManyRequests},
+	{ratelimit.ErrRateLimited, http.StatusTooManyRequests},
+	{transmit.ErrDutyCycleExceeded, http.StatusTooManyRequests},
+	{transmit.ErrDurationExceeded, http.StatusBadRequest},
+	{transmit.ErrInvalidJob, http.StatusBadRequest},
+	{transmit.ErrStopped, http.StatusConflict},
+	{transmit.ErrUnknownTransmitter, http.StatusNotFound},
+	{device.ErrInvalidDevice, http.StatusBadRequest},
+	{calibration.ErrUnknownFlow, http.StatusNotFound},
+	{calibration.ErrRunning, http.StatusConflict},
+	{calibration.ErrFinished, http.StatusConflict},
+	{calibration.ErrNotFinished, http.StatusConflict},
+	{calibration.ErrOutOfOrder, http.StatusConflict},
+	{calibration.ErrNoSuggestion, http.StatusConflict},
+	{types.ErrUnparsable, http.StatusBadRequest},
+	{ErrIdempotencyKeyReused, http.StatusUnprocessableEntity},
+	{safeword.ErrSafeword, http.StatusLocked},
+	{safeword.ErrInvalidState, http.StatusBadRequest},
+	{session.ErrUnknownSession, http.StatusNotFound},
+	{session.ErrInvalidSession, http.StatusBadRequest},
+	{approval.ErrUnknownRequest, http.StatusNotFound},
+	{approval.ErrNotPending, http.StatusConflict},
+	{job.ErrUnknownJob, http.StatusNotFound},
+	{job.ErrFinished, http.StatusConflict},
+	{pattern.ErrUnknownPattern, http.StatusNotFound},
+	{pattern.ErrUnknownRun, http.StatusNotFound},
+	{pattern.ErrInvalidProgram, http.StatusUnprocessableEntity},
+	{schedule.ErrUnknownEntry, http.StatusNotFound},
+	{schedule.ErrInvalidCron, http.StatusBadRequest},
+	{schedule.ErrInvalidSpec, http.StatusBadRequest},
+}
+
+// Status returns the HTTP status code the given error is answered with, 500
+// for unknown errors.
+func Status(err error) int {
+	for _, e := range errorStatus {
+		if errors.Is(err, e.err) {
+			return e.status
+		}
+	}
+
+	return http.StatusInternalServerError
+}
+
+// RetryAfter returns how long to wait before retrying a request failed with
+// the given error, for rate limited requests and those exceeding the duty
+// cycle of a transmitter.
+func RetryAfter(err error) (time.Duration, bool) {
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.RetryAfter, true
+	}
+
+	var dutyCycleErr *transmit.DutyCycleError
+	if errors.As(err, &dutyCycleErr) {
+		return dutyCycleErr.RetryAfter, true
+	}
+
+	return 0, false
+}
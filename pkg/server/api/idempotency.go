@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// IdempotencyHeader is the request header carrying the idempotency key.
+const IdempotencyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyWindow is how long responses are kept for replaying by
+// default.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// maxIdempotencyKey is the longest idempotency key accepted.
+const maxIdempotencyKey = 255
+
+// maxIdempotentBody is the largest request body fingerprinted, larger ones
+// are rejected.
+const maxIdempotentBody = 1 << 20
+
+// MaxIdempotentResponses is the most responses kept, the oldest ones are
+// forgotten before the window ends when more are recorded.
+const MaxIdempotentResponses = 10000
+
+var (
+	// ErrIdempotencyKeyReused is returned when an idempotency key is used
+	// again for a different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused for a different request")
+
+	// ErrInvalidIdempotencyKey is returned for idempotency keys not
+	// accepted.
+	ErrInvalidIdempotencyKey = fmt.Errorf("%w: invalid idempotency key", types.ErrUnparsable)
+)
+
+type idempotentResponse struct {
+	scope       [sha256.Size]byte
+	fingerprint [sha256.Size]byte
+	created     time.Time
+	done        chan struct{}
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Idempotency replays the response to POST requests with an
+// Idempotency-Key header when the same request is retried with the same key
+// within a window, instead of handling it again. Keys are scoped to the API
+// key the request is authenticated with, so clients cannot see each others
+// responses, and only responses to authenticated requests are kept. Retries
+// arriving while the first request is still handled wait for it.
+type Idempotency struct {
+	window time.Duration
+	clock  clock.Clock
+
+	mu        sync.Mutex
+	responses map[[sha256.Size]byte]*idempotentResponse
+
+	// order are the responses in the order they were recorded, to forget
+	// them from the oldest. It may still hold responses already forgotten.
+	order []*idempotentResponse
+}
+
+// NewIdempotency creates an Idempotency keeping responses for the given
+// window.
+func NewIdempotency(window time.Duration, c clock.Clock) *Idempotency {
+	return &Idempotency{
+		window:    window,
+		clock:     c,
+		responses: make(map[[sha256.Size]byte]*idempotentResponse),
+	}
+}
+
+// Handler returns next wrapped with replaying of responses, errors are
+// written with writeError. authenticate returns the ID of the API key the
+// request is authenticated with, requests it returns false for are handed to
+// next as they are, to be rejected there. Responses to rate limited requests
+// are not replayed, as they are meant to be retried.
+func (i *Idempotency) Handler(next http.Handler, authenticate func(*http.Request) (string, bool), writeError func(http.ResponseWriter, *http.Request, error)) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(IdempotencyHeader)
+		if req.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		keyID, ok := authenticate(req)
+		if !ok {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			writeError(res, req, fmt.Errorf("%w: longer than %d characters", ErrInvalidIdempotencyKey, maxIdempotencyKey))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxIdempotentBody+1))
+		if err != nil {
+			writeError(res, req, fmt.Errorf("error reading request: %w", err))
+			return
+		} else if len(body) > maxIdempotentBody {
+			writeError(res, req, fmt.Errorf("%w: request body too large", ErrInvalidIdempotencyKey))
+			return
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := sha256.Sum256([]byte(keyID + "\x00" + key))
+		fingerprint := sha256.Sum256([]byte(req.URL.String() + "\x00" + string(body)))
+
+		stored, first := i.lookup(scope, fingerprint)
+		if stored == nil {
+			// too many responses being recorded to keep another one
+			next.ServeHTTP(res, req)
+			return
+		} else if first {
+			i.record(stored, next, res, req)
+			return
+		}
+
+		if stored.fingerprint != fingerprint {
+			writeError(res, req, ErrIdempotencyKeyReused)
+			return
+		}
+
+		select {
+		case <-stored.done:
+		case <-req.Context().Done():
+			return
+		}
+
+		if stored.status == 0 {
+			// not kept, handle the retry as usual
+			i.Handler(next, authenticate, writeError).ServeHTTP(res, req)
+			return
+		}
+
+		for name, values := range stored.header {
+			res.Header()[name] = values
+		}
+		res.Header().Set("Idempotent-Replayed", "true")
+		res.WriteHeader(stored.status)
+		res.Write(stored.body)
+	})
+}
+
+// lookup returns the response stored for the given scope, or a new one being
+// recorded if there is none, telling which one it is. It returns nil if no
+// response can be recorded, all kept ones being still recorded.
+func (i *Idempotency) lookup(scope, fingerprint [sha256.Size]byte) (*idempotentResponse, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.pruneLocked()
+
+	if stored, ok := i.responses[scope]; ok {
+		return stored, false
+	}
+
+	if len(i.responses) >= MaxIdempotentResponses && !i.forgetOldestLocked() {
+		return nil, false
+	}
+
+	ret := &idempotentResponse{
+		scope:       scope,
+		fingerprint: fingerprint,
+		created:     i.clock.Now(),
+		done:        make(chan struct{}),
+	}
+
+	i.responses[scope] = ret
+	i.order = append(i.order, ret)
+	return ret, true
+}
+
+// record handles the request with next, storing the response.
+func (i *Idempotency) record(stored *idempotentResponse, next http.Handler, res http.ResponseWriter, req *http.Request) {
+	recorder := &responseRecorder{ResponseWriter: res}
+
+	defer func() {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		if recorder.status == 0 || recorder.status == http.StatusTooManyRequests {
+			i.forgetLocked(stored)
+		} else {
+			stored.status = recorder.status
+			stored.header = res.Header().Clone()
+			stored.body = recorder.body.Bytes()
+		}
+
+		close(stored.done)
+	}()
+
+	next.ServeHTTP(recorder, req)
+}
+
+// pruneLocked forgets responses older than the window, from the oldest one
+// on, i.mu has to be locked.
+func (i *Idempotency) pruneLocked() {
+	now := i.clock.Now()
+	for len(i.order) > 0 && now.Sub(i.order[0].created) >= i.window {
+		if !i.forgetOldestLocked() {
+			return
+		}
+	}
+}
+
+// forgetOldestLocked forgets the oldest response kept, returning false if it
+// is still recorded. i.mu has to be locked.
+func (i *Idempotency) forgetOldestLocked() bool {
+	for len(i.order) > 0 {
+		oldest := i.order[0]
+		if i.responses[oldest.scope] != oldest {
+			// forgotten already
+			i.order = i.order[1:]
+			continue
+		}
+
+		select {
+		case <-oldest.done:
+		default:
+			return false
+		}
+
+		i.forgetLocked(oldest)
+		i.order = i.order[1:]
+		return true
+	}
+
+	return false
+}
+
+// forgetLocked forgets the given response, i.mu has to be locked.
+func (i *Idempotency) forgetLocked(stored *idempotentResponse) {
+	if i.responses[stored.scope] == stored {
+		delete(i.responses, stored.scope)
+	}
+}
+
+// responseRecorder passes everything written to the wrapped ResponseWriter,
+// keeping a copy.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,114 @@
+package api_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api"
+)
+
+var _ = Describe("Idempotency", func() {
+	var (
+		fake    *clock.Fake
+		handled atomic.Int32
+		status  int
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+		handled.Store(0)
+		status = http.StatusOK
+
+		next := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			n := handled.Add(1)
+			res.WriteHeader(status)
+			fmt.Fprintf(res, "response %d", n)
+		})
+
+		authenticate := func(req *http.Request) (string, bool) {
+			keyID := req.Header.Get("Authorization")
+			return keyID, keyID != ""
+		}
+
+		handler = api.NewIdempotency(time.Hour, fake).Handler(next, authenticate, func(res http.ResponseWriter, req *http.Request, err error) {
+			res.WriteHeader(api.Status(err))
+			res.Write([]byte(err.Error()))
+		})
+	})
+
+	do := func(auth, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1beta1/commands", strings.NewReader(body))
+		req.Header.Set("Authorization", auth)
+		if key != "" {
+			req.Header.Set(api.IdempotencyHeader, key)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	It("replays responses to retried requests", func() {
+		first := do("alice", "retry", "{}")
+		Expect(first.Body.String()).To(Equal("response 1"))
+
+		second := do("alice", "retry", "{}")
+		Expect(second.Code).To(Equal(http.StatusOK))
+		Expect(second.Body.String()).To(Equal("response 1"))
+		Expect(second.Header().Get("Idempotent-Replayed")).To(Equal("true"))
+		Expect(handled.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("handles requests without key or of other clients", func() {
+		do("alice", "", "{}")
+		do("alice", "", "{}")
+		do("alice", "retry", "{}")
+		Expect(do("bob", "retry", "{}").Body.String()).To(Equal("response 4"))
+	})
+
+	It("rejects keys reused for different requests", func() {
+		do("alice", "retry", `{"intensity": 10}`)
+
+		res := do("alice", "retry", `{"intensity": 100}`)
+		Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(handled.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("forgets responses after the window", func() {
+		do("alice", "retry", "{}")
+		fake.Advance(time.Hour)
+
+		Expect(do("alice", "retry", "{}").Body.String()).To(Equal("response 2"))
+	})
+
+	It("does not replay rate limited responses", func() {
+		status = http.StatusTooManyRequests
+		do("alice", "retry", "{}")
+
+		status = http.StatusOK
+		Expect(do("alice", "retry", "{}").Body.String()).To(Equal("response 2"))
+	})
+
+	It("does not replay responses to unauthenticated requests", func() {
+		do("", "retry", "{}")
+		Expect(do("", "retry", "{}").Body.String()).To(Equal("response 2"))
+	})
+
+	It("forgets the oldest responses when keeping too many", func() {
+		for i := 0; i <= api.MaxIdempotentResponses; i++ {
+			do("alice", fmt.Sprintf("retry %d", i), "{}")
+		}
+
+		last := fmt.Sprintf("retry %d", api.MaxIdempotentResponses)
+		Expect(do("alice", last, "{}").Header().Get("Idempotent-Replayed")).To(Equal("true"))
+		Expect(do("alice", "retry 0", "{}").Header().Get("Idempotent-Replayed")).To(BeEmpty())
+	})
+})
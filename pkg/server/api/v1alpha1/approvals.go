@@ -0,0 +1,107 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/approval"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+)
+
+// authenticateApprover is like authenticateAdmin, but requires a key allowed
+// to approve requests: approvers, the wearer and admins.
+func (routes routes) authenticateApprover(res http.ResponseWriter, req *http.Request) (auth.Key, bool) {
+	key, ok := routes.authenticate(res, req, "")
+	if !ok {
+		return auth.Key{}, false
+	}
+
+	if !key.Approver && !key.Wearer && !key.Admin {
+		writeError(res, fmt.Errorf("%w: approver key required", auth.ErrForbidden))
+		return auth.Key{}, false
+	}
+
+	return key, true
+}
+
+func (routes routes) getApprovalsHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := routes.authenticateApprover(res, req); !ok {
+		return
+	}
+
+	writeJSON(res, http.StatusOK, routes.Approvals.Requests())
+}
+
+// getApprovalEventsHandler streams approval.Events as server-sent events,
+// starting with the requests pending right now.
+func (routes routes) getApprovalEventsHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := routes.authenticateApprover(res, req); !ok {
+		return
+	}
+
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		writeError(res, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	events, unsubscribe := routes.Approvals.Subscribe()
+	defer unsubscribe()
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+
+	write := func(event approval.Event) {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data)
+		flusher.Flush()
+	}
+
+	for _, r := range routes.Approvals.Requests() {
+		if r.State == approval.StatePending {
+			write(approval.Event{Type: r.State, Request: r})
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case event := <-events:
+			write(event)
+		}
+	}
+}
+
+func (routes routes) postApprovalHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	k, ok := routes.authenticateApprover(res, req)
+	if !ok {
+		return
+	}
+
+	r, err := routes.Approvals.Approve(string(id), k.ID)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, r)
+}
+
+func (routes routes) deleteApprovalHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	k, ok := routes.authenticateApprover(res, req)
+	if !ok {
+		return
+	}
+
+	r, err := routes.Approvals.Deny(string(id), k.ID)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, r)
+}
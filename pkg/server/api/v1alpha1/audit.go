@@ -0,0 +1,121 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/audit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// auditFilterFromQuery parses the query parameters filtering the audit log:
+// from and until (RFC 3339), type, key, channel (or device), operation,
+// outcome and limit.
+func auditFilterFromQuery(req *http.Request, devices *device.Registry) (filter audit.Filter, err error) {
+	query := req.URL.Query()
+
+	parse := func(name string, f func(string) error) {
+		if value := query.Get(name); value != "" && err == nil {
+			if parseErr := f(value); parseErr != nil {
+				err = fmt.Errorf("%w: %s: %v", types.ErrUnparsable, name, parseErr)
+			}
+		}
+	}
+
+	parse("from", func(v string) (err error) {
+		filter.From, err = time.Parse(time.RFC3339, v)
+		return
+	})
+	parse("until", func(v string) (err error) {
+		filter.Until, err = time.Parse(time.RFC3339, v)
+		return
+	})
+	parse("type", func(v string) error {
+		filter.Type = audit.Type(v)
+		return nil
+	})
+	parse("key", func(v string) error {
+		filter.KeyID = v
+		return nil
+	})
+	parse("channel", func(v string) error {
+		var target device.Target
+		if err := target.Set(v); err != nil {
+			return err
+		}
+
+		target, err := devices.Resolve(target)
+		if err != nil {
+			return err
+		}
+
+		if target.Device != "" {
+			filter.Device = target.Device
+		} else {
+			filter.Channel = &target.Channel
+		}
+
+		return nil
+	})
+	parse("operation", func(v string) error {
+		filter.Operation = new(types.Operation)
+		return filter.Operation.Set(v)
+	})
+	parse("outcome", func(v string) error {
+		filter.Outcome = v
+		return nil
+	})
+	parse("limit", func(v string) (err error) {
+		if filter.Limit, err = strconv.Atoi(v); err == nil && filter.Limit < 0 {
+			err = fmt.Errorf("negative limit %d", filter.Limit)
+		}
+
+		return
+	})
+
+	return
+}
+
+// getAuditHandler answers with the records of the audit log matching the
+// filter given in the query, as JSON array or exported as JSON lines or CSV
+// with the format query parameter. Only admins and the wearer see the
+// records of all keys, everyone else only their own.
+func (routes routes) getAuditHandler(res http.ResponseWriter, req *http.Request) {
+	key, ok := routes.authenticate(res, req, "")
+	if !ok {
+		return
+	}
+
+	filter, err := auditFilterFromQuery(req, routes.Devices)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	if !key.Admin && !key.Wearer {
+		filter.KeyID = key.ID
+	}
+
+	records, err := routes.Audit.Query(filter)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(res, http.StatusOK, records)
+	case "jsonl":
+		res.Header().Set("Content-Type", "application/jsonl")
+		audit.WriteJSONLines(res, records)
+	case "csv":
+		res.Header().Set("Content-Type", "text/csv")
+		res.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		audit.WriteCSV(res, records)
+	default:
+		writeError(res, fmt.Errorf("%w: unknown format %q", types.ErrUnparsable, format))
+	}
+}
@@ -0,0 +1,21 @@
+package v1alpha1
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api"
+)
+
+// writeError writes the given error as plain text response, with the status
+// code from api.Status. Rate limited requests get a Retry-After header.
+func writeError(res http.ResponseWriter, err error) {
+	if retryAfter, ok := api.RetryAfter(err); ok {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		res.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+
+	res.WriteHeader(api.Status(err))
+	res.Write([]byte(err.Error()))
+}
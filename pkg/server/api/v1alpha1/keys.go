@@ -0,0 +1,240 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// keyInfo is an auth.Key as shown to admins, without the hash.
+type keyInfo struct {
+	ID       string      `json:"id"`
+	Label    string      `json:"label"`
+	Admin    bool        `json:"admin,omitempty"`
+	Wearer   bool        `json:"wearer,omitempty"`
+	Approver bool        `json:"approver,omitempty"`
+	Created  time.Time   `json:"created"`
+	Expires  *time.Time  `json:"expires,omitempty"`
+	Revoked  *time.Time  `json:"revoked,omitempty"`
+	Policy   auth.Policy `json:"policy"`
+
+	// Key is the API key itself, only set right after creating it.
+	Key string `json:"key,omitempty"`
+}
+
+func newKeyInfo(key auth.Key) keyInfo {
+	return keyInfo{
+		ID:       key.ID,
+		Label:    key.Label,
+		Admin:    key.Admin,
+		Wearer:   key.Wearer,
+		Approver: key.Approver,
+		Created:  key.Created,
+		Expires:  key.Expires,
+		Revoked:  key.Revoked,
+		Policy:   key.Policy,
+	}
+}
+
+// policyFromQuery parses the query parameters named like the settings in
+// auth.PolicySettings into the given Policy, keeping settings not given.
+func policyFromQuery(req *http.Request, policy auth.Policy) (auth.Policy, error) {
+	query := req.URL.Query()
+	for _, setting := range auth.PolicySettings {
+		if query.Has(setting) {
+			if err := policy.Set(setting, query.Get(setting)); err != nil {
+				return policy, err
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// timeFromQuery parses the at (RFC 3339) or in (duration from now) query
+// parameters, returning nil if neither is given.
+func timeFromQuery(req *http.Request) (*time.Time, error) {
+	query := req.URL.Query()
+
+	if at := query.Get("at"); at != "" {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, fmt.Errorf("%w: at: %v", types.ErrUnparsable, err)
+		}
+
+		return &t, nil
+	}
+
+	if in := query.Get("in"); in != "" {
+		d, err := time.ParseDuration(in)
+		if err != nil {
+			return nil, fmt.Errorf("%w: in: %v", types.ErrUnparsable, err)
+		}
+
+		t := time.Now().Add(d)
+		return &t, nil
+	}
+
+	return nil, nil
+}
+
+// mayIssue returns an error unless the key by may create the given key or
+// give it its Policy. Wearer keys only come from wearers of all their devices,
+// as only the wearer may lift their safewords, other keys only from admins.
+func mayIssue(by, key auth.Key) error {
+	if (key.Admin || key.Approver || !key.Wearer) && !by.Admin {
+		return fmt.Errorf("%w: admin key required", auth.ErrForbidden)
+	}
+
+	if !key.Wearer {
+		return nil
+	}
+
+	if len(key.Policy.Devices) == 0 && !by.WearerOf("") {
+		return fmt.Errorf("%w: wearer key of all devices required", auth.ErrForbidden)
+	}
+
+	for _, dev := range key.Policy.Devices {
+		if !by.WearerOf(dev) {
+			return fmt.Errorf("%w: wearer key of device %s required", auth.ErrForbidden, dev)
+		}
+	}
+
+	return nil
+}
+
+func (routes routes) getKeysHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := routes.authenticateAdmin(res, req); !ok {
+		return
+	}
+
+	keys := routes.Keys.List()
+
+	ret := make([]keyInfo, len(keys))
+	for i, key := range keys {
+		ret[i] = newKeyInfo(key)
+	}
+
+	writeJSON(res, http.StatusOK, ret)
+}
+
+func (routes routes) postKeyHandler(res http.ResponseWriter, req *http.Request, label identifier) {
+	by, ok := routes.authenticate(res, req, "")
+	if !ok {
+		return
+	}
+
+	expires, err := timeFromQuery(req)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	policy, err := policyFromQuery(req, auth.Policy{})
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	key := auth.Key{
+		Label:    string(label),
+		Admin:    req.URL.Query().Get("admin") == "true",
+		Wearer:   req.URL.Query().Get("wearer") == "true",
+		Approver: req.URL.Query().Get("approver") == "true",
+		Policy:   policy,
+		Expires:  expires,
+	}
+	if err := mayIssue(by, key); err != nil {
+		writeError(res, err)
+		return
+	}
+
+	apiKey, key, err := routes.Keys.Create(key)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	ret := newKeyInfo(key)
+	ret.Key = apiKey
+
+	writeJSON(res, http.StatusCreated, ret)
+}
+
+func (routes routes) deleteKeyHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	if _, ok := routes.authenticateAdmin(res, req); !ok {
+		return
+	}
+
+	key, err := routes.Keys.Revoke(string(id))
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, newKeyInfo(key))
+}
+
+func (routes routes) postKeyPolicyHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	by, ok := routes.authenticateAdmin(res, req)
+	if !ok {
+		return
+	}
+
+	key, err := routes.Keys.Get(string(id))
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	policy, err := policyFromQuery(req, key.Policy)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	// giving a wearer key other devices makes it the wearer of those
+	if key.Wearer && req.URL.Query().Has("devices") {
+		key.Policy = policy
+		if err := mayIssue(by, key); err != nil {
+			writeError(res, err)
+			return
+		}
+	}
+
+	key, err = routes.Keys.SetPolicy(string(id), policy)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, newKeyInfo(key))
+}
+
+func (routes routes) postKeyExpireHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	if _, ok := routes.authenticateAdmin(res, req); !ok {
+		return
+	}
+
+	at, err := timeFromQuery(req)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	if at == nil {
+		now := time.Now()
+		at = &now
+	}
+
+	key, err := routes.Keys.Expire(string(id), *at)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, newKeyInfo(key))
+}
@@ -0,0 +1,82 @@
+package v1alpha1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api/v1alpha1"
+)
+
+var _ = Describe("Keys", func() {
+	var (
+		handler http.Handler
+		keys    *auth.Store
+		admin   string
+		wearer  string
+		alex    auth.Key
+	)
+
+	BeforeEach(func() {
+		fake := clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		var err error
+		keys, err = auth.OpenStore(filepath.Join(GinkgoT().TempDir(), "keys.json"), fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		admin, _, err = keys.Create(auth.Key{Label: "admin", Admin: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		wearer, alex, err = keys.Create(auth.Key{
+			Label:  "alex",
+			Wearer: true,
+			Policy: auth.Policy{Devices: []string{"alex-collar"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		handler, err = v1alpha1.Routes(v1alpha1.Backend{Keys: keys})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	post := func(path, key string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	It("lets admins create keys", func() {
+		Expect(post("/v1alpha1/keys/alice?devices=alex-collar", admin)).To(Equal(http.StatusCreated))
+		Expect(post("/v1alpha1/keys/bob?admin=true&approver=true", admin)).To(Equal(http.StatusCreated))
+		Expect(post("/v1alpha1/keys/alice", wearer)).To(Equal(http.StatusForbidden))
+	})
+
+	It("only lets wearers of all its devices create wearer keys", func() {
+		Expect(post("/v1alpha1/keys/alex-phone?wearer=true&devices=alex-collar", wearer)).To(Equal(http.StatusCreated))
+
+		Expect(post("/v1alpha1/keys/sam?wearer=true&devices=sam-collar", admin)).To(Equal(http.StatusForbidden))
+		Expect(post("/v1alpha1/keys/sam?wearer=true&devices=alex-collar,sam-collar", wearer)).To(Equal(http.StatusForbidden))
+		Expect(post("/v1alpha1/keys/everyone?wearer=true", wearer)).To(Equal(http.StatusForbidden))
+		Expect(post("/v1alpha1/keys/alex-admin?wearer=true&admin=true&devices=alex-collar", wearer)).To(Equal(http.StatusForbidden))
+
+		Expect(keys.List()).To(HaveLen(3))
+	})
+
+	It("does not let admins give wearer keys other devices", func() {
+		id := alex.ID
+		Expect(post("/v1alpha1/keys/"+id+"/policy?max-duration=5s", admin)).To(Equal(http.StatusOK))
+		Expect(post("/v1alpha1/keys/"+id+"/policy?devices=sam-collar", admin)).To(Equal(http.StatusForbidden))
+		Expect(post("/v1alpha1/keys/"+id+"/policy?devices=", admin)).To(Equal(http.StatusForbidden))
+
+		key, err := keys.Get(id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.Policy.Devices).To(Equal([]string{"alex-collar"}))
+	})
+})
@@ -0,0 +1,101 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// describe returns the given Target as shown in responses.
+func describe(target device.Target) string {
+	if target.Device != "" {
+		return fmt.Sprintf("device %v (channel %v)", target.Device, target.Channel)
+	}
+
+	return fmt.Sprintf("channel %v", target.Channel)
+}
+
+// repetitionFromQuery parses the repeat, gap and duration query parameters,
+// rejecting values over the limits of driver.Repetition.Validate.
+func repetitionFromQuery(req *http.Request) (driver.Repetition, error) {
+	ret := driver.Repetition{}
+	for _, setting := range []string{"repeat", "gap", "duration"} {
+		if value := req.URL.Query().Get(setting); value != "" {
+			if err := ret.Set(setting + "=" + value); err != nil {
+				return ret, fmt.Errorf("%w: %v", types.ErrUnparsable, err)
+			}
+		}
+	}
+
+	return ret, ret.Validate()
+}
+
+func (routes routes) postMessageHandler(res http.ResponseWriter, req *http.Request, key apikey, target device.Target, operation types.Operation, intensity types.Intensity) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	target, err := routes.Devices.Resolve(target)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	repetition, err := repetitionFromQuery(req)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	err = routes.Dispatcher.Dispatch(withOrigin(req), k.ID, command.Command{
+		Device:     target.Device,
+		Channel:    target.Channel,
+		Operation:  operation,
+		Intensity:  intensity,
+		Repetition: repetition,
+	})
+
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	res.Write([]byte(fmt.Sprintf("Hello %v!\nsent %v with intensity %v on %v\n", k.Label, operation, intensity, describe(target))))
+}
+
+func (routes routes) deleteMessageHandler(res http.ResponseWriter, req *http.Request, key apikey, target device.Target) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	target, err := routes.Devices.Resolve(target)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	channel := target.Channel
+	routes.Transmitters.StopChannel(channel)
+	routes.Events.Publish(event.Event{Type: event.TypeStop, Channel: &channel, Device: target.Device, KeyID: k.ID, KeyLabel: k.Label})
+	routes.Instrumentation.EmergencyStop(&channel)
+	res.Write([]byte(fmt.Sprintf("stopped channel %v\n", channel)))
+}
+
+func (routes routes) postStopHandler(res http.ResponseWriter, req *http.Request, key apikey) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	routes.Transmitters.Stop()
+	routes.Events.Publish(event.Event{Type: event.TypeStop, KeyID: k.ID, KeyLabel: k.Label})
+	routes.Instrumentation.EmergencyStop(nil)
+	res.Write([]byte("stopped\n"))
+}
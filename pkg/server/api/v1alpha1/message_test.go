@@ -0,0 +1,172 @@
+package v1alpha1_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api/v1alpha1"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// nopDriver sends nothing, successfully.
+type nopDriver struct{}
+
+func (nopDriver) Output(m *types.Message) error {
+	return nil
+}
+
+var _ = Describe("Messages", func() {
+	var (
+		handler http.Handler
+		events  *event.Bus
+		apiKey  string
+	)
+
+	BeforeEach(func() {
+		fake := clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		keys, err := auth.OpenStore(filepath.Join(GinkgoT().TempDir(), "keys.json"), fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		apiKey, _, err = keys.Create(auth.Key{
+			Label: "alice",
+			Policy: auth.Policy{
+				MaxIntensity: map[types.Operation]types.Intensity{types.OperationShock: 50},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		devices, err := device.NewRegistry([]device.Device{
+			{Name: "alex-collar", Protocol: device.ProtocolPetrainer, RemoteID: types.DefaultRemoteID, Channel: types.Channel2},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		router, err := transmit.NewRouter(transmit.NewScheduler("test", driver.Repeating(nopDriver{}, driver.DefaultRepetition), transmit.Config{}))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(router.Close)
+
+		rule, err := ratelimit.ParseRule("key:beep=1/1h")
+		Expect(err).NotTo(HaveOccurred())
+
+		events = event.NewBus(16, fake)
+
+		handler, err = v1alpha1.Routes(v1alpha1.Backend{
+			Keys: keys,
+			Dispatcher: command.NewDispatcher(router, command.Config{
+				Keys:    keys,
+				Limiter: ratelimit.NewLimiter(ratelimit.Rules{rule}, fake),
+				Devices: devices,
+			}),
+			Transmitters: router,
+			Events:       events,
+			Devices:      devices,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// send sends a request to the given path, with the given key in the
+	// Authorization header unless it is empty.
+	send := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	body := func(res *httptest.ResponseRecorder) string {
+		ret, err := io.ReadAll(res.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(ret)
+	}
+
+	Describe("authentication", func() {
+		It("takes the key from the Authorization header", func() {
+			res := send(http.MethodPost, "/v1alpha1/message/-/alex-collar/vibrate/40", apiKey)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(body(res)).To(Equal("Hello alice!\nsent vibrate with intensity 40 on device alex-collar (channel 2)\n"))
+		})
+
+		It("takes the key from the path without Authorization header", func() {
+			res := send(http.MethodPost, "/v1alpha1/message/"+apiKey+"/1/vibrate/40", "")
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(body(res)).To(HavePrefix("Hello alice!\n"))
+		})
+
+		It("prefers the Authorization header to the key in the path", func() {
+			res := send(http.MethodPost, "/v1alpha1/message/"+apiKey+"/1/vibrate/40", "unknown.key")
+			Expect(res.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects requests without valid key", func() {
+			Expect(send(http.MethodPost, "/v1alpha1/message/unknown.key/1/vibrate/40", "").Code).To(Equal(http.StatusUnauthorized))
+			Expect(send(http.MethodPost, "/v1alpha1/stop/-", "").Code).To(Equal(http.StatusUnauthorized))
+			Expect(send(http.MethodGet, "/v1alpha1/queue", "").Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("requires a key for the state of the queue", func() {
+			res := send(http.MethodGet, "/v1alpha1/queue", apiKey)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).To(Equal("application/json"))
+		})
+	})
+
+	Describe("sending messages", func() {
+		It("rejects messages not allowed by the policy", func() {
+			res := send(http.MethodPost, "/v1alpha1/message/-/1/shock/80", apiKey)
+			Expect(res.Code).To(Equal(http.StatusForbidden))
+			Expect(body(res)).To(ContainSubstring("max-intensity"))
+		})
+
+		It("tells rate limited clients when to retry", func() {
+			Expect(send(http.MethodPost, "/v1alpha1/message/-/1/beep/0", apiKey).Code).To(Equal(http.StatusOK))
+
+			res := send(http.MethodPost, "/v1alpha1/message/-/1/beep/0", apiKey)
+			Expect(res.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(res.Header().Get("Retry-After")).To(Equal("3600"))
+		})
+
+		DescribeTable("rejects invalid messages",
+			func(path string, status int) {
+				Expect(send(http.MethodPost, path, apiKey).Code).To(Equal(status))
+			},
+			Entry("unknown device", "/v1alpha1/message/-/sam-collar/beep/0", http.StatusBadRequest),
+			Entry("invalid channel", "/v1alpha1/message/-/4/beep/0", http.StatusBadRequest),
+			Entry("unknown operation", "/v1alpha1/message/-/1/tickle/0", http.StatusBadRequest),
+			Entry("intensity too high", "/v1alpha1/message/-/1/vibrate/101", http.StatusBadRequest),
+			Entry("too many frames", "/v1alpha1/message/-/1/beep/0?repeat=101", http.StatusBadRequest),
+			Entry("malformed repetition", "/v1alpha1/message/-/1/beep/0?gap=often", http.StatusBadRequest),
+		)
+
+		It("stops a channel", func() {
+			_, published, unsubscribe := events.Subscribe(0)
+			defer unsubscribe()
+
+			res := send(http.MethodDelete, "/v1alpha1/message/-/alex-collar", apiKey)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(body(res)).To(Equal("stopped channel 2\n"))
+
+			Eventually(published).Should(Receive(And(
+				HaveField("Type", event.TypeStop),
+				HaveField("Channel", HaveValue(Equal(types.Channel2))),
+				HaveField("Device", "alex-collar"),
+			)))
+		})
+	})
+})
@@ -0,0 +1,112 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/pattern"
+)
+
+// runsFor returns the ID of the key whose pattern runs the given key may see
+// and stop, empty for all runs.
+func runsFor(key auth.Key) string {
+	if key.Admin || key.Wearer {
+		return ""
+	}
+
+	return key.ID
+}
+
+// lookupRun returns the pattern run with the given ID if the given key may
+// see it, ErrUnknownRun otherwise.
+func (routes routes) lookupRun(key auth.Key, id identifier) (*pattern.Run, error) {
+	run, err := routes.Patterns.Run(string(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if owner := runsFor(key); owner != "" && run.Status().KeyID != owner {
+		return nil, fmt.Errorf("%w: %q", pattern.ErrUnknownRun, id)
+	}
+
+	return run, nil
+}
+
+func (routes routes) getPatternsHandler(res http.ResponseWriter, req *http.Request, key apikey) {
+	if _, ok := routes.authenticate(res, req, key); !ok {
+		return
+	}
+
+	patterns, err := routes.Patterns.Patterns()
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, patterns)
+}
+
+func (routes routes) postPatternHandler(res http.ResponseWriter, req *http.Request, key apikey, name identifier, target device.Target) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	target, err := routes.Devices.Resolve(target)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	run, err := routes.Patterns.Start(k.ID, string(name), target)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, run.Status())
+}
+
+func (routes routes) getRunsHandler(res http.ResponseWriter, req *http.Request, key apikey) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	writeJSON(res, http.StatusOK, routes.Patterns.Runs(runsFor(k)))
+}
+
+func (routes routes) getRunHandler(res http.ResponseWriter, req *http.Request, key apikey, id identifier) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	run, err := routes.lookupRun(k, id)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, run.Status())
+}
+
+func (routes routes) deleteRunHandler(res http.ResponseWriter, req *http.Request, key apikey, id identifier) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	run, err := routes.lookupRun(k, id)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	run.Stop()
+	<-run.Done()
+
+	writeJSON(res, http.StatusOK, run.Status())
+}
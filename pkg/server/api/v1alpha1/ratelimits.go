@@ -0,0 +1,30 @@
+package v1alpha1
+
+import (
+	"net/http"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+)
+
+// rateLimits is the state of the Limiter as shown to admins.
+type rateLimits struct {
+	Rules   []string                `json:"rules"`
+	Buckets []ratelimit.BucketState `json:"buckets"`
+}
+
+func (routes routes) getRateLimitsHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := routes.authenticateAdmin(res, req); !ok {
+		return
+	}
+
+	ret := rateLimits{
+		Rules:   make([]string, 0),
+		Buckets: routes.Limiter.State(),
+	}
+
+	for _, rule := range routes.Limiter.Rules() {
+		ret.Rules = append(ret.Rules, rule.String())
+	}
+
+	writeJSON(res, http.StatusOK, ret)
+}
@@ -1,12 +1,27 @@
 package v1alpha1
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
-	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/approval"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/audit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/pattern"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/safeword"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/schedule"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api"
 	"praios.lf-net.org/littlefox/gotoshock/pkg/server/typesafe_router"
-	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/session"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
 )
 
 type apikey string
@@ -20,35 +35,162 @@ func (a apikey) String() string {
 	return string(a)
 }
 
+// identifier is a path element naming something, like a pattern or a run.
+type identifier string
+
+func (i *identifier) Set(v string) error {
+	*i = identifier(v)
+	return nil
+}
+
+func (i identifier) String() string {
+	return string(i)
+}
+
+// Backend holds everything the v1alpha1 API works with.
+type Backend struct {
+	Keys         *auth.Store
+	Limiter      *ratelimit.Limiter
+	Safewords    *safeword.Lock
+	Sessions     *session.Manager
+	Approvals    *approval.Manager
+	Audit        *audit.Log
+	Transmitters *transmit.Router
+	Dispatcher   *command.Dispatcher
+	Patterns     *pattern.Manager
+	Schedules    *schedule.Manager
+	Events       *event.Bus
+	Devices      *device.Registry
+
+	// Idempotency replays responses to retried requests, optional.
+	Idempotency *api.Idempotency
+
+	// Instrumentation is told about safewords and emergency stops,
+	// optional.
+	Instrumentation instrument.Instrumentation
+}
+
 type routes struct {
 	typesafe_router.TypeSafeRouter
+	Backend
+}
 
-	driver driver.MessageDriver
+func writeJSON(res http.ResponseWriter, status int, v any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(v)
 }
 
-func (routes routes) postMessageHandler(res http.ResponseWriter, req *http.Request, key apikey, channel types.Channel, operation types.Operation, intensity types.Intensity) {
-	if key == "hellorld!" {
-		res.Write([]byte(fmt.Sprintf("Hello %v!\nsending %v with intensity %v on channel %v\n", key, operation, intensity, channel)))
-
-		msg := types.NewMessage().
-			SetChannel(channel).
-			SetOperation(operation).
-			SetIntensity(intensity).
-			Build()
-
-		for i := 0; i < 4; i++ {
-			if err := routes.driver.Output(msg); err != nil {
-				res.WriteHeader(500)
-				res.Write([]byte(err.Error()))
-			}
+// authenticate returns the Key the request is authenticated with, taken
+// from the Authorization header or, for compatibility with older clients,
+// from the key given in the path. It writes an error response and returns
+// false if the key is not valid.
+func (routes routes) authenticate(res http.ResponseWriter, req *http.Request, key apikey) (auth.Key, bool) {
+	apiKey, ok := auth.FromRequest(req)
+	if !ok {
+		apiKey = string(key)
+	}
+
+	ret, err := routes.Keys.Authenticate(apiKey)
+	if err != nil {
+		writeError(res, err)
+		return auth.Key{}, false
+	}
+
+	return ret, true
+}
+
+// keyPaths are the paths taking the key as their first element, for older
+// clients not sending it in the Authorization header.
+var keyPaths = map[string]bool{"message": true, "stop": true, "patterns": true, "schedules": true}
+
+// keyID returns the ID of the key the request is authenticated with, like
+// authenticate, without answering it, for recording responses to retries.
+func (routes routes) keyID(req *http.Request) (string, bool) {
+	apiKey, ok := auth.FromRequest(req)
+	if !ok {
+		// /v1alpha1/<path>/<key>/...
+		elements := strings.Split(req.URL.Path, "/")
+		if len(elements) < 4 || !keyPaths[elements[2]] {
+			return "", false
 		}
-	} else {
-		res.WriteHeader(401)
+
+		apiKey = elements[3]
+	}
+
+	key, err := routes.Keys.Authenticate(apiKey)
+	if err != nil {
+		return "", false
 	}
+
+	return key.ID, true
 }
 
-func Routes(driver driver.MessageDriver) (http.Handler, error) {
-	ret := routes{driver: driver}
+// authenticateAdmin is like authenticate, but only takes the Authorization
+// header and requires an admin key.
+func (routes routes) authenticateAdmin(res http.ResponseWriter, req *http.Request) (auth.Key, bool) {
+	key, ok := routes.authenticate(res, req, "")
+	if !ok {
+		return auth.Key{}, false
+	}
+
+	if !key.Admin {
+		writeError(res, fmt.Errorf("%w: admin key required", auth.ErrForbidden))
+		return auth.Key{}, false
+	}
+
+	return key, true
+}
+
+// authenticateWearer is like authenticateAdmin, but requires a wearer key.
+func (routes routes) authenticateWearer(res http.ResponseWriter, req *http.Request) (auth.Key, bool) {
+	key, ok := routes.authenticate(res, req, "")
+	if !ok {
+		return auth.Key{}, false
+	}
+
+	if !key.Wearer {
+		writeError(res, fmt.Errorf("%w: wearer key required", auth.ErrForbidden))
+		return auth.Key{}, false
+	}
+
+	return key, true
+}
+
+// withOrigin returns the context of the request, carrying its Origin for the
+// audit log.
+func withOrigin(req *http.Request) context.Context {
+	return command.WithOrigin(req.Context(), command.Origin{
+		RemoteAddr:     req.RemoteAddr,
+		Source:         "api",
+		IdempotencyKey: req.Header.Get(api.IdempotencyHeader),
+	})
+}
+
+// getQueueHandler answers with the state of the queue of the transmitter
+// named in the transmitter query parameter, the default one if not given.
+func (routes routes) getQueueHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := routes.authenticate(res, req, ""); !ok {
+		return
+	}
+
+	scheduler := routes.Transmitters.Default()
+	if name := req.URL.Query().Get("transmitter"); name != "" {
+		var err error
+		if scheduler, err = routes.Transmitters.Scheduler(name); err != nil {
+			writeError(res, err)
+			return
+		}
+	}
+
+	writeJSON(res, http.StatusOK, scheduler.Stats())
+}
+
+// Routes returns the http.Handler serving the v1alpha1 API with the given
+// Backend.
+func Routes(backend Backend) (http.Handler, error) {
+	ret := routes{Backend: backend}
+	ret.Instrumentation = instrument.Or(ret.Instrumentation)
 
 	type route struct {
 		method  string
@@ -57,7 +199,38 @@ func Routes(driver driver.MessageDriver) (http.Handler, error) {
 	}
 
 	routes := map[string]route{
-		"postMessage": {"POST", "/v1alpha1/message/:/:/:/:", ret.postMessageHandler},
+		"postMessage":       {"POST", "/v1alpha1/message/:/:/:/:", ret.postMessageHandler},
+		"deleteMessage":     {"DELETE", "/v1alpha1/message/:/:", ret.deleteMessageHandler},
+		"postStop":          {"POST", "/v1alpha1/stop/:", ret.postStopHandler},
+		"getQueue":          {"GET", "/v1alpha1/queue", ret.getQueueHandler},
+		"getPatterns":       {"GET", "/v1alpha1/patterns/:", ret.getPatternsHandler},
+		"postPattern":       {"POST", "/v1alpha1/patterns/:/:/:", ret.postPatternHandler},
+		"getRuns":           {"GET", "/v1alpha1/runs/:", ret.getRunsHandler},
+		"getRun":            {"GET", "/v1alpha1/runs/:/:", ret.getRunHandler},
+		"deleteRun":         {"DELETE", "/v1alpha1/runs/:/:", ret.deleteRunHandler},
+		"getSchedules":      {"GET", "/v1alpha1/schedules/:", ret.getSchedulesHandler},
+		"postSchedule":      {"POST", "/v1alpha1/schedules/:/:/:/:", ret.postScheduleHandler},
+		"deleteSchedule":    {"DELETE", "/v1alpha1/schedules/:/:", ret.deleteScheduleHandler},
+		"getKeys":           {"GET", "/v1alpha1/keys", ret.getKeysHandler},
+		"postKey":           {"POST", "/v1alpha1/keys/:", ret.postKeyHandler},
+		"deleteKey":         {"DELETE", "/v1alpha1/keys/:", ret.deleteKeyHandler},
+		"postKeyPolicy":     {"POST", "/v1alpha1/keys/:/policy", ret.postKeyPolicyHandler},
+		"postKeyExpire":     {"POST", "/v1alpha1/keys/:/expire", ret.postKeyExpireHandler},
+		"getRateLimits":     {"GET", "/v1alpha1/ratelimits", ret.getRateLimitsHandler},
+		"getSafewords":      {"GET", "/v1alpha1/safeword", ret.getSafewordsHandler},
+		"postSafewords":     {"POST", "/v1alpha1/safeword", ret.postSafewordsHandler},
+		"deleteSafewords":   {"DELETE", "/v1alpha1/safeword", ret.deleteSafewordsHandler},
+		"postSafeword":      {"POST", "/v1alpha1/safeword/:", ret.postSafewordHandler},
+		"deleteSafeword":    {"DELETE", "/v1alpha1/safeword/:", ret.deleteSafewordHandler},
+		"getSessions":       {"GET", "/v1alpha1/sessions", ret.getSessionsHandler},
+		"postSession":       {"POST", "/v1alpha1/sessions", ret.postSessionHandler},
+		"getSession":        {"GET", "/v1alpha1/sessions/:", ret.getSessionHandler},
+		"deleteSession":     {"DELETE", "/v1alpha1/sessions/:", ret.deleteSessionHandler},
+		"getApprovals":      {"GET", "/v1alpha1/approvals", ret.getApprovalsHandler},
+		"getApprovalEvents": {"GET", "/v1alpha1/approvals/events", ret.getApprovalEventsHandler},
+		"postApproval":      {"POST", "/v1alpha1/approvals/:", ret.postApprovalHandler},
+		"deleteApproval":    {"DELETE", "/v1alpha1/approvals/:", ret.deleteApprovalHandler},
+		"getAudit":          {"GET", "/v1alpha1/audit", ret.getAuditHandler},
 	}
 
 	for name, route := range routes {
@@ -66,5 +239,11 @@ func Routes(driver driver.MessageDriver) (http.Handler, error) {
 		}
 	}
 
+	if ret.Idempotency != nil {
+		return ret.Idempotency.Handler(&ret, ret.keyID, func(res http.ResponseWriter, _ *http.Request, err error) {
+			writeError(res, err)
+		}), nil
+	}
+
 	return &ret, nil
 }
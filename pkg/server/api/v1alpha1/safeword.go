@@ -0,0 +1,165 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/safeword"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// channels are all Channels, for setting and lifting safewords on all of
+// them at once.
+var channels = []types.Channel{types.Channel1, types.Channel2}
+
+func (routes routes) getSafewordsHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := routes.authenticate(res, req, ""); !ok {
+		return
+	}
+
+	writeJSON(res, http.StatusOK, routes.Safewords.States())
+}
+
+// wornBy returns the devices the given wearer key wears and, if it wears
+// all of them, the Channels, for setting and lifting all safewords it may.
+func (routes routes) wornBy(k auth.Key) []device.Target {
+	ret := make([]device.Target, 0)
+	if k.WearerOf("") {
+		for _, ch := range channels {
+			ret = append(ret, device.Target{Channel: ch})
+		}
+	}
+
+	for _, d := range routes.Devices.Devices() {
+		if k.WearerOf(d.Name) {
+			ret = append(ret, device.Target{Device: d.Name, Channel: d.Channel})
+		}
+	}
+
+	return ret
+}
+
+// wearerTarget authenticates the wearer key of the given Target, answering
+// with the Target resolved, naming the device instead of an alias.
+func (routes routes) wearerTarget(res http.ResponseWriter, req *http.Request, target device.Target) (auth.Key, device.Target, bool) {
+	k, ok := routes.authenticateWearer(res, req)
+	if !ok {
+		return auth.Key{}, device.Target{}, false
+	}
+
+	target, err := routes.Devices.Resolve(target)
+	if err != nil {
+		writeError(res, err)
+		return auth.Key{}, device.Target{}, false
+	}
+
+	if !k.WearerOf(target.Device) {
+		writeError(res, fmt.Errorf("%w: not the wearer of %v", auth.ErrForbidden, target))
+		return auth.Key{}, device.Target{}, false
+	}
+
+	return k, target, true
+}
+
+// remote returns the remote Commands to the given Target are sent from, the
+// default one for Channels.
+func (routes routes) remote(target device.Target) types.RemoteID {
+	if target.Device == "" {
+		return types.DefaultRemoteID
+	}
+
+	if d, err := routes.Devices.Lookup(target.Device); err == nil {
+		return d.RemoteID
+	}
+
+	return types.DefaultRemoteID
+}
+
+// setSafewords sets the safeword given in the mode (pause by default) and
+// max-intensity query parameters for the given Targets on behalf of the given
+// wearer key, stopping whatever is sent to them right now.
+func (routes routes) setSafewords(res http.ResponseWriter, req *http.Request, k auth.Key, targets ...device.Target) {
+	mode := safeword.Mode(req.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = safeword.ModePause
+	}
+
+	var maxIntensity types.Intensity
+	if value := req.URL.Query().Get("max-intensity"); value != "" {
+		if err := maxIntensity.Set(value); err != nil {
+			writeError(res, fmt.Errorf("%w: max-intensity: %v", types.ErrUnparsable, err))
+			return
+		}
+	}
+
+	for _, target := range targets {
+		state, err := routes.Safewords.Set(k.ID, target, mode, maxIntensity)
+		if err != nil {
+			writeError(res, err)
+			return
+		}
+
+		routes.Transmitters.StopRemote(routes.remote(target), target.Channel)
+
+		ch := target.Channel
+		routes.Events.Publish(event.Event{Type: event.TypeSafewordSet, Channel: &ch, Device: target.Device, KeyID: k.ID, KeyLabel: k.Label, Data: state})
+		routes.Instrumentation.Safeword(target, string(state.Mode))
+	}
+
+	writeJSON(res, http.StatusOK, routes.Safewords.States())
+}
+
+// liftSafewords lifts the safewords of the given Targets on behalf of the
+// given wearer key.
+func (routes routes) liftSafewords(res http.ResponseWriter, req *http.Request, k auth.Key, targets ...device.Target) {
+	states := routes.Safewords.States()
+	for _, target := range targets {
+		if err := routes.Safewords.Lift(target); err != nil {
+			writeError(res, err)
+			return
+		}
+
+		// safewords of devices are kept without their Channel
+		kept := target
+		if target.Device != "" {
+			kept = device.Target{Device: target.Device}
+		}
+
+		if _, set := states[kept]; !set {
+			continue
+		}
+
+		ch := target.Channel
+		routes.Events.Publish(event.Event{Type: event.TypeSafewordLifted, Channel: &ch, Device: target.Device, KeyID: k.ID, KeyLabel: k.Label})
+		routes.Instrumentation.Safeword(target, "")
+	}
+
+	writeJSON(res, http.StatusOK, routes.Safewords.States())
+}
+
+func (routes routes) postSafewordsHandler(res http.ResponseWriter, req *http.Request) {
+	if k, ok := routes.authenticateWearer(res, req); ok {
+		routes.setSafewords(res, req, k, routes.wornBy(k)...)
+	}
+}
+
+func (routes routes) deleteSafewordsHandler(res http.ResponseWriter, req *http.Request) {
+	if k, ok := routes.authenticateWearer(res, req); ok {
+		routes.liftSafewords(res, req, k, routes.wornBy(k)...)
+	}
+}
+
+func (routes routes) postSafewordHandler(res http.ResponseWriter, req *http.Request, target device.Target) {
+	if k, target, ok := routes.wearerTarget(res, req, target); ok {
+		routes.setSafewords(res, req, k, target)
+	}
+}
+
+func (routes routes) deleteSafewordHandler(res http.ResponseWriter, req *http.Request, target device.Target) {
+	if k, target, ok := routes.wearerTarget(res, req, target); ok {
+		routes.liftSafewords(res, req, k, target)
+	}
+}
@@ -0,0 +1,87 @@
+package v1alpha1
+
+import (
+	"net/http"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/schedule"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// specFromQuery parses the cron, at (RFC 3339) and in (duration from now)
+// query parameters into a schedule.Spec.
+func specFromQuery(req *http.Request) (schedule.Spec, error) {
+	at, err := timeFromQuery(req)
+	if err != nil {
+		return schedule.Spec{}, err
+	}
+
+	return schedule.Spec{
+		Cron: req.URL.Query().Get("cron"),
+		At:   at,
+	}, nil
+}
+
+func (routes routes) getSchedulesHandler(res http.ResponseWriter, req *http.Request, key apikey) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	writeJSON(res, http.StatusOK, routes.Schedules.Entries(k.ID))
+}
+
+func (routes routes) postScheduleHandler(res http.ResponseWriter, req *http.Request, key apikey, target device.Target, operation types.Operation, intensity types.Intensity) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	target, err := routes.Devices.Resolve(target)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	spec, err := specFromQuery(req)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	repetition, err := repetitionFromQuery(req)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	entry, err := routes.Schedules.Add(k.ID, spec, command.Command{
+		Device:     target.Device,
+		Channel:    target.Channel,
+		Operation:  operation,
+		Intensity:  intensity,
+		Repetition: repetition,
+	})
+
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, entry)
+}
+
+func (routes routes) deleteScheduleHandler(res http.ResponseWriter, req *http.Request, key apikey, id identifier) {
+	k, ok := routes.authenticate(res, req, key)
+	if !ok {
+		return
+	}
+
+	if err := routes.Schedules.Remove(k.ID, string(id)); err != nil {
+		writeError(res, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
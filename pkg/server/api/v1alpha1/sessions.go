@@ -0,0 +1,144 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/session"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// openedSession is a session.Session right after opening it, with the API
+// keys of its invites, which are not shown again.
+type openedSession struct {
+	session.Session
+	InviteKeys []string `json:"inviteKeys,omitempty"`
+}
+
+// sessionFromQuery parses the query parameters of a new session: start
+// (RFC 3339, now by default), end (RFC 3339) or duration, participants
+// (comma separated key IDs), invites (number of invite keys to create) and
+// the limits max-shocks, max-shock-time and max-intensity.
+func sessionFromQuery(req *http.Request) (start, end time.Time, participants []string, invites int, limits session.Limits, err error) {
+	query := req.URL.Query()
+
+	parse := func(name string, f func(string) error) {
+		if value := query.Get(name); value != "" && err == nil {
+			if parseErr := f(value); parseErr != nil {
+				err = fmt.Errorf("%w: %s: %v", types.ErrUnparsable, name, parseErr)
+			}
+		}
+	}
+
+	start = time.Now()
+	parse("start", func(v string) (err error) {
+		start, err = time.Parse(time.RFC3339, v)
+		return
+	})
+	parse("end", func(v string) (err error) {
+		end, err = time.Parse(time.RFC3339, v)
+		return
+	})
+	parse("duration", func(v string) error {
+		d, err := time.ParseDuration(v)
+		end = start.Add(d)
+		return err
+	})
+	parse("participants", func(v string) error {
+		participants = strings.Split(v, ",")
+		return nil
+	})
+	parse("invites", func(v string) (err error) {
+		invites, err = strconv.Atoi(v)
+		return
+	})
+	parse("max-shocks", func(v string) (err error) {
+		limits.MaxShocks, err = strconv.Atoi(v)
+		return
+	})
+	parse("max-shock-time", func(v string) (err error) {
+		limits.MaxShockTime, err = time.ParseDuration(v)
+		return
+	})
+	parse("max-intensity", limits.MaxIntensity.Set)
+
+	if err == nil && end.IsZero() {
+		err = fmt.Errorf("%w: either end or duration must be given", session.ErrInvalidSession)
+	}
+
+	return
+}
+
+// sessionsFor returns the ID of the key whose sessions the given key may
+// see, empty for all sessions.
+func sessionsFor(key auth.Key) string {
+	if key.Admin || key.Wearer {
+		return ""
+	}
+
+	return key.ID
+}
+
+func (routes routes) getSessionsHandler(res http.ResponseWriter, req *http.Request) {
+	k, ok := routes.authenticate(res, req, "")
+	if !ok {
+		return
+	}
+
+	writeJSON(res, http.StatusOK, routes.Sessions.Sessions(sessionsFor(k)))
+}
+
+func (routes routes) postSessionHandler(res http.ResponseWriter, req *http.Request) {
+	k, ok := routes.authenticateWearer(res, req)
+	if !ok {
+		return
+	}
+
+	start, end, participants, invites, limits, err := sessionFromQuery(req)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	s, inviteKeys, err := routes.Sessions.Open(k, start, end, participants, invites, limits)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, openedSession{Session: s, InviteKeys: inviteKeys})
+}
+
+func (routes routes) getSessionHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	k, ok := routes.authenticate(res, req, "")
+	if !ok {
+		return
+	}
+
+	for _, s := range routes.Sessions.Sessions(sessionsFor(k)) {
+		if s.ID == string(id) {
+			writeJSON(res, http.StatusOK, s)
+			return
+		}
+	}
+
+	writeError(res, fmt.Errorf("%w: %q", session.ErrUnknownSession, id))
+}
+
+func (routes routes) deleteSessionHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	if _, ok := routes.authenticateWearer(res, req); !ok {
+		return
+	}
+
+	s, err := routes.Sessions.Close(string(id), "closed by wearer")
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, s)
+}
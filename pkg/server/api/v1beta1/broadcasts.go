@@ -0,0 +1,135 @@
+package v1beta1
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// broadcastRequest is the body of a request sending a command to several
+// devices together: all in Group, those in Targets, which may name Channels
+// as well, or both. Operation is required.
+type broadcastRequest struct {
+	Group      string           `json:"group,omitempty"`
+	Targets    []device.Target  `json:"targets,omitempty"`
+	Operation  *types.Operation `json:"operation"`
+	Intensity  int              `json:"intensity"`
+	DurationMs int64            `json:"durationMs,omitempty"`
+	Repeat     int              `json:"repeat,omitempty"`
+	GapMs      int64            `json:"gapMs,omitempty"`
+}
+
+// broadcastResult is the result of a broadcast for a single device or
+// Channel, with the problem it was rejected or failed with, if any.
+type broadcastResult struct {
+	CommandID string        `json:"commandId"`
+	Status    string        `json:"status"`
+	Device    string        `json:"device,omitempty"`
+	Channel   types.Channel `json:"channel"`
+	Problem   *problem      `json:"problem,omitempty"`
+}
+
+// readBroadcast reads the Commands of a broadcast from the request body, one
+// for every device of the group and every target, each sent once.
+func (routes routes) readBroadcast(req *http.Request) ([]command.Command, error) {
+	var body broadcastRequest
+	if err := readJSON(req, &body); err != nil {
+		return nil, err
+	}
+
+	targets := body.Targets
+	if body.Group != "" {
+		devices, err := routes.Devices.Group(body.Group)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range devices {
+			targets = append(targets, device.Target{Device: d.Name})
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%w: group or targets are required", types.ErrUnparsable)
+	}
+
+	ret := make([]command.Command, 0, len(targets))
+	seen := make(map[device.Target]bool, len(targets))
+	for _, target := range targets {
+		target, err := routes.Devices.Resolve(target)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		cmd, err := commandRequest{
+			Channel:    &target,
+			Operation:  body.Operation,
+			Intensity:  body.Intensity,
+			DurationMs: body.DurationMs,
+			Repeat:     body.Repeat,
+			GapMs:      body.GapMs,
+		}.Command()
+		if err != nil {
+			return nil, err
+		}
+
+		if cmd.ID, err = newID(); err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, cmd)
+	}
+
+	return ret, nil
+}
+
+// postBroadcastHandler sends the command in the request body to all devices
+// of the group and targets given, answering once all of them are done with
+// the result for each. Each device is checked on its own, so some may be
+// rejected while the others are sent.
+func (routes routes) postBroadcastHandler(res http.ResponseWriter, req *http.Request) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	cmds, err := routes.readBroadcast(req)
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	errs := routes.Dispatcher.Broadcast(withOrigin(req), key.ID, cmds)
+
+	results := make([]broadcastResult, 0, len(cmds))
+	for i, cmd := range cmds {
+		result := broadcastResult{
+			CommandID: cmd.ID,
+			Status:    "transmitted",
+			Device:    cmd.Device,
+			Channel:   cmd.Channel,
+		}
+
+		if errs[i] != nil {
+			p := newProblem(req, errs[i])
+			result.Status, result.Problem = "failed", &p
+		}
+
+		results = append(results, result)
+	}
+
+	writeJSON(res, http.StatusOK, struct {
+		Results []broadcastResult `json:"results"`
+		Key     string            `json:"key"`
+		Sent    time.Time         `json:"sent"`
+	}{results, key.Label, time.Now()})
+}
@@ -0,0 +1,182 @@
+package v1beta1
+
+import (
+	"fmt"
+	"net/http"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/calibration"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// calibrationFlowRequest is the body of a request starting a calibration
+// flow, stepping through the raw intensities from From up to To, Step
+// apart. Operation is required.
+type calibrationFlowRequest struct {
+	Operation *types.Operation `json:"operation"`
+	From      *types.Intensity `json:"from,omitempty"`
+	To        *types.Intensity `json:"to,omitempty"`
+	Step      *types.Intensity `json:"step,omitempty"`
+}
+
+// feedbackRequest is the body of a request telling how the step sent last
+// felt.
+type feedbackRequest struct {
+	Feeling calibration.Feeling `json:"feeling"`
+}
+
+// putCalibrationHandler replaces the calibration of the device with the one
+// in the request body, answering with the device.
+func (routes routes) putCalibrationHandler(res http.ResponseWriter, req *http.Request, name identifier) {
+	if _, ok := routes.authenticateWearerOf(res, req, name); !ok {
+		return
+	}
+
+	var c device.Calibration
+	if err := readJSON(req, &c); err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	routes.setCalibration(res, req, name, &c)
+}
+
+// deleteCalibrationHandler goes back to the configured calibration of the
+// device, answering with the device.
+func (routes routes) deleteCalibrationHandler(res http.ResponseWriter, req *http.Request, name identifier) {
+	if _, ok := routes.authenticateWearerOf(res, req, name); !ok {
+		return
+	}
+
+	routes.setCalibration(res, req, name, nil)
+}
+
+func (routes routes) setCalibration(res http.ResponseWriter, req *http.Request, name identifier, c *device.Calibration) {
+	if err := routes.Devices.SetCalibration(string(name), c); err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	d, err := routes.Devices.Lookup(string(name))
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, d)
+}
+
+// postCalibrationFlowHandler starts a calibration flow for the device,
+// answering with 201 Created and the flow. Steps are sent with the next
+// endpoint, one at a time, the wearer telling how each of them felt with the
+// feedback endpoint.
+func (routes routes) postCalibrationFlowHandler(res http.ResponseWriter, req *http.Request, name identifier) {
+	key, ok := routes.authenticateWearerOf(res, req, name)
+	if !ok {
+		return
+	}
+
+	var body calibrationFlowRequest
+	if err := readJSON(req, &body); err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	if body.Operation == nil {
+		writeError(res, req, fmt.Errorf("%w: operation is required", types.ErrUnparsable))
+		return
+	}
+
+	from, to, step := types.Intensity(5), types.Intensity(100), types.Intensity(5)
+	if body.From != nil {
+		from = *body.From
+	}
+	if body.To != nil {
+		to = *body.To
+	}
+	if body.Step != nil {
+		step = *body.Step
+	}
+
+	steps, err := calibration.Steps(from, to, step)
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	ret, err := routes.Calibrations.Start(key.ID, string(name), *body.Operation, steps)
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	writeJSON(res, http.StatusCreated, ret)
+}
+
+func (routes routes) getCalibrationFlowHandler(res http.ResponseWriter, req *http.Request, name identifier) {
+	if _, ok := routes.authenticateWearerOf(res, req, name); !ok {
+		return
+	}
+
+	routes.writeFlow(res, req)(routes.Calibrations.Get(string(name)))
+}
+
+// deleteCalibrationFlowHandler cancels the calibration flow of the device,
+// stopping the step currently sent.
+func (routes routes) deleteCalibrationFlowHandler(res http.ResponseWriter, req *http.Request, name identifier) {
+	if _, ok := routes.authenticateWearerOf(res, req, name); !ok {
+		return
+	}
+
+	routes.writeFlow(res, req)(routes.Calibrations.Cancel(string(name)))
+}
+
+// postCalibrationNextHandler sends the current step of the calibration flow
+// of the device, answering once it was transmitted.
+func (routes routes) postCalibrationNextHandler(res http.ResponseWriter, req *http.Request, name identifier) {
+	key, ok := routes.authenticateWearerOf(res, req, name)
+	if !ok {
+		return
+	}
+
+	routes.writeFlow(res, req)(routes.Calibrations.Next(withOrigin(req), key.ID, string(name)))
+}
+
+// postCalibrationFeedbackHandler records how the step sent last felt,
+// moving on to the next one.
+func (routes routes) postCalibrationFeedbackHandler(res http.ResponseWriter, req *http.Request, name identifier) {
+	if _, ok := routes.authenticateWearerOf(res, req, name); !ok {
+		return
+	}
+
+	var body feedbackRequest
+	if err := readJSON(req, &body); err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	routes.writeFlow(res, req)(routes.Calibrations.Feedback(string(name), body.Feeling))
+}
+
+// postCalibrationApplyHandler applies the calibration suggested by the
+// finished calibration flow of the device.
+func (routes routes) postCalibrationApplyHandler(res http.ResponseWriter, req *http.Request, name identifier) {
+	if _, ok := routes.authenticateWearerOf(res, req, name); !ok {
+		return
+	}
+
+	routes.writeFlow(res, req)(routes.Calibrations.Apply(string(name)))
+}
+
+// writeFlow returns a function answering with the given calibration flow, or
+// the error.
+func (routes routes) writeFlow(res http.ResponseWriter, req *http.Request) func(calibration.Flow, error) {
+	return func(flow calibration.Flow, err error) {
+		if err != nil {
+			writeError(res, req, err)
+			return
+		}
+
+		writeJSON(res, http.StatusOK, flow)
+	}
+}
@@ -0,0 +1,167 @@
+package v1beta1
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// maxBodySize is the largest request body accepted.
+const maxBodySize = 64 << 10
+
+// commandRequest is the body of a request sending a command. Channel, which
+// may name a device as well, and Operation are required.
+type commandRequest struct {
+	Channel    *device.Target   `json:"channel"`
+	Operation  *types.Operation `json:"operation"`
+	Intensity  int              `json:"intensity"`
+	DurationMs int64            `json:"durationMs,omitempty"`
+	Repeat     int              `json:"repeat,omitempty"`
+	GapMs      int64            `json:"gapMs,omitempty"`
+}
+
+// Command validates the request and returns the Command it describes.
+func (r commandRequest) Command() (command.Command, error) {
+	switch {
+	case r.Channel == nil:
+		return command.Command{}, fmt.Errorf("%w: channel is required", types.ErrUnparsable)
+	case r.Operation == nil:
+		return command.Command{}, fmt.Errorf("%w: operation is required", types.ErrUnparsable)
+	case r.Intensity < 0 || r.Intensity > 100:
+		return command.Command{}, fmt.Errorf("%w: intensity out of range: %d", types.ErrUnparsable, r.Intensity)
+	case r.DurationMs < 0 || r.Repeat < 0 || r.GapMs < 0:
+		return command.Command{}, fmt.Errorf("%w: durationMs, repeat and gapMs must not be negative", types.ErrUnparsable)
+	case r.Repeat > driver.MaxCount:
+		return command.Command{}, fmt.Errorf("%w: repeat out of range: %d, maximum is %d", types.ErrUnparsable, r.Repeat, driver.MaxCount)
+	case r.GapMs > driver.MaxGap.Milliseconds():
+		return command.Command{}, fmt.Errorf("%w: gapMs out of range: %d, maximum is %d", types.ErrUnparsable, r.GapMs, driver.MaxGap.Milliseconds())
+	}
+
+	return command.Command{
+		Device:    r.Channel.Device,
+		Channel:   r.Channel.Channel,
+		Operation: *r.Operation,
+		Intensity: types.Intensity(r.Intensity),
+		Repetition: driver.Repetition{
+			Count:    r.Repeat,
+			Gap:      time.Duration(r.GapMs) * time.Millisecond,
+			Duration: time.Duration(r.DurationMs) * time.Millisecond,
+		},
+	}, nil
+}
+
+// commandResult is the response to a command sent.
+type commandResult struct {
+	ID         string          `json:"id"`
+	Status     string          `json:"status"`
+	Device     string          `json:"device,omitempty"`
+	Channel    types.Channel   `json:"channel"`
+	Operation  types.Operation `json:"operation"`
+	Intensity  types.Intensity `json:"intensity"`
+	DurationMs int64           `json:"durationMs,omitempty"`
+	Key        string          `json:"key"`
+	Sent       time.Time       `json:"sent"`
+}
+
+// readJSON decodes the JSON body of the request into v, rejecting unknown
+// fields and bodies of other content types.
+func readJSON(req *http.Request, v any) error {
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			return fmt.Errorf("%w: content type %q, expected application/json", types.ErrUnparsable, contentType)
+		}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(nil, req.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); errors.Is(err, types.ErrUnparsable) {
+		return fmt.Errorf("error parsing request: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", types.ErrUnparsable, err)
+	}
+
+	return nil
+}
+
+// readCommand reads the Command from the request body, with the Channel of
+// the device it is sent to, if any.
+func (routes routes) readCommand(req *http.Request) (command.Command, error) {
+	var body commandRequest
+	if err := readJSON(req, &body); err != nil {
+		return command.Command{}, err
+	}
+
+	cmd, err := body.Command()
+	if err != nil {
+		return command.Command{}, err
+	}
+
+	target, err := routes.Devices.Resolve(cmd.Target())
+	if err != nil {
+		return command.Command{}, err
+	}
+
+	cmd.Device, cmd.Channel = target.Device, target.Channel
+	return cmd, nil
+}
+
+// postCommandHandler sends the command in the request body, answering once
+// it is transmitted.
+func (routes routes) postCommandHandler(res http.ResponseWriter, req *http.Request) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	cmd, err := routes.readCommand(req)
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	cmd.ID, err = newID()
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	if err := routes.Dispatcher.Dispatch(withOrigin(req), key.ID, cmd); err != nil {
+		p := newProblem(req, err)
+		p.CommandID = cmd.ID
+		writeProblem(res, p)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, commandResult{
+		ID:         cmd.ID,
+		Status:     "transmitted",
+		Device:     cmd.Device,
+		Channel:    cmd.Channel,
+		Operation:  cmd.Operation,
+		Intensity:  cmd.Intensity,
+		DurationMs: cmd.Repetition.Duration.Milliseconds(),
+		Key:        key.Label,
+		Sent:       time.Now(),
+	})
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,196 @@
+package v1beta1_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/ratelimit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api/v1beta1"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// nopDriver sends nothing, successfully.
+type nopDriver struct{}
+
+func (nopDriver) Output(m *types.Message) error {
+	return nil
+}
+
+// problem is the problem details answered for errors.
+type problem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail"`
+	Instance   string `json:"instance"`
+	CommandID  string `json:"commandId"`
+	Rule       string `json:"rule"`
+	RetryAfter int    `json:"retryAfter"`
+}
+
+var _ = Describe("Commands", func() {
+	var (
+		handler http.Handler
+		apiKey  string
+	)
+
+	BeforeEach(func() {
+		fake := clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		keys, err := auth.OpenStore(filepath.Join(GinkgoT().TempDir(), "keys.json"), fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		apiKey, _, err = keys.Create(auth.Key{
+			Label: "alice",
+			Policy: auth.Policy{
+				MaxIntensity: map[types.Operation]types.Intensity{types.OperationShock: 50},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		devices, err := device.NewRegistry([]device.Device{
+			{Name: "alex-collar", Protocol: device.ProtocolPetrainer, RemoteID: types.DefaultRemoteID, Channel: types.Channel2},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		router, err := transmit.NewRouter(transmit.NewScheduler("test", driver.Repeating(nopDriver{}, driver.DefaultRepetition), transmit.Config{}))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(router.Close)
+
+		rule, err := ratelimit.ParseRule("key:beep=1/1h")
+		Expect(err).NotTo(HaveOccurred())
+
+		handler, err = v1beta1.Routes(v1beta1.Backend{
+			Keys: keys,
+			Dispatcher: command.NewDispatcher(router, command.Config{
+				Keys:    keys,
+				Limiter: ratelimit.NewLimiter(ratelimit.Rules{rule}, fake),
+				Devices: devices,
+			}),
+			Transmitters: router,
+			Devices:      devices,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	post := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1beta1/commands", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	// problemOf decodes the problem details of the given response.
+	problemOf := func(res *httptest.ResponseRecorder) problem {
+		Expect(res.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+
+		var ret problem
+		Expect(json.NewDecoder(res.Body).Decode(&ret)).To(Succeed())
+		Expect(ret.Status).To(Equal(res.Code))
+		Expect(ret.Type).To(Equal("about:blank"))
+		Expect(ret.Title).To(Equal(http.StatusText(res.Code)))
+		return ret
+	}
+
+	It("sends commands", func() {
+		res := post("application/json", `{"channel": "alex-collar", "operation": "vibrate", "intensity": 40, "durationMs": 500}`)
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Type")).To(Equal("application/json"))
+
+		var result struct {
+			ID         string          `json:"id"`
+			Status     string          `json:"status"`
+			Device     string          `json:"device"`
+			Channel    types.Channel   `json:"channel"`
+			Operation  types.Operation `json:"operation"`
+			DurationMs int64           `json:"durationMs"`
+			Key        string          `json:"key"`
+		}
+		Expect(json.NewDecoder(res.Body).Decode(&result)).To(Succeed())
+		Expect(result.ID).NotTo(BeEmpty())
+		Expect(result.Status).To(Equal("transmitted"))
+		Expect(result.Device).To(Equal("alex-collar"))
+		Expect(result.Channel).To(Equal(types.Channel2))
+		Expect(result.Operation).To(Equal(types.OperationVibrate))
+		Expect(result.DurationMs).To(BeEquivalentTo(500))
+		Expect(result.Key).To(Equal("alice"))
+	})
+
+	It("accepts bodies without content type", func() {
+		Expect(post("", `{"channel": "1", "operation": "beep"}`).Code).To(Equal(http.StatusOK))
+		Expect(post("application/json; charset=utf-8", `{"channel": "1", "operation": "vibrate"}`).Code).To(Equal(http.StatusOK))
+	})
+
+	It("answers requests without valid key with problem details", func() {
+		apiKey = "unknown.key"
+
+		res := post("application/json", `{"channel": "1", "operation": "beep"}`)
+		Expect(res.Code).To(Equal(http.StatusUnauthorized))
+		Expect(problemOf(res).Instance).To(Equal("/v1beta1/commands"))
+	})
+
+	It("answers unknown paths with problem details", func() {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/v1beta1/nothing", nil))
+		Expect(res.Code).To(Equal(http.StatusNotFound))
+		Expect(problemOf(res).Instance).To(Equal("/v1beta1/nothing"))
+	})
+
+	It("names the policy rule broken and the command rejected", func() {
+		res := post("application/json", `{"channel": "1", "operation": "shock", "intensity": 80}`)
+		Expect(res.Code).To(Equal(http.StatusForbidden))
+
+		p := problemOf(res)
+		Expect(p.Rule).To(Equal("max-intensity"))
+		Expect(p.CommandID).NotTo(BeEmpty())
+	})
+
+	It("tells rate limited clients when to retry", func() {
+		Expect(post("application/json", `{"channel": "1", "operation": "beep"}`).Code).To(Equal(http.StatusOK))
+
+		res := post("application/json", `{"channel": "1", "operation": "beep"}`)
+		Expect(res.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(res.Header().Get("Retry-After")).To(Equal("3600"))
+		Expect(problemOf(res).RetryAfter).To(Equal(3600))
+	})
+
+	DescribeTable("rejects invalid bodies",
+		func(contentType, body, detail string) {
+			res := post(contentType, body)
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+			Expect(problemOf(res).Detail).To(ContainSubstring(detail))
+		},
+		Entry("other content type", "text/plain", `{"channel": "1", "operation": "beep"}`, "content type"),
+		Entry("malformed content type", "application/", `{"channel": "1", "operation": "beep"}`, "content type"),
+		Entry("malformed JSON", "application/json", `{"channel": "1",`, "unexpected EOF"),
+		Entry("unknown field", "application/json", `{"channel": "1", "operation": "beep", "volume": 11}`, "unknown field"),
+		Entry("too large", "application/json", `{"channel": "1", "operation": "beep", "padding": "`+strings.Repeat("x", 64<<10)+`"}`, "too large"),
+		Entry("channel not a string", "application/json", `{"channel": 1, "operation": "beep"}`, "cannot unmarshal"),
+		Entry("unknown device", "application/json", `{"channel": "sam-collar", "operation": "beep"}`, "unknown device"),
+		Entry("unknown operation", "application/json", `{"channel": "1", "operation": "tickle"}`, "error parsing request"),
+		Entry("no channel", "application/json", `{"operation": "beep"}`, "channel is required"),
+		Entry("no operation", "application/json", `{"channel": "1"}`, "operation is required"),
+		Entry("intensity too high", "application/json", `{"channel": "1", "operation": "vibrate", "intensity": 101}`, "intensity out of range"),
+		Entry("negative intensity", "application/json", `{"channel": "1", "operation": "vibrate", "intensity": -1}`, "intensity out of range"),
+		Entry("negative duration", "application/json", `{"channel": "1", "operation": "vibrate", "durationMs": -1}`, "must not be negative"),
+		Entry("too many frames", "application/json", `{"channel": "1", "operation": "beep", "repeat": 101}`, "repeat out of range"),
+		Entry("gap too long", "application/json", `{"channel": "1", "operation": "beep", "gapMs": 1001}`, "gapMs out of range"),
+	)
+})
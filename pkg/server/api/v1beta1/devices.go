@@ -0,0 +1,67 @@
+package v1beta1
+
+import (
+	"net/http"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+)
+
+// mayUse returns if the given key may send to the given Device: all keys
+// not limited to some devices or Channels, others if the Device and its
+// Channel are allowed.
+func mayUse(key auth.Key, d device.Device) bool {
+	allowed := len(key.Policy.Channels) == 0
+	for _, ch := range key.Policy.Channels {
+		allowed = allowed || ch == d.Channel
+	}
+
+	named := len(key.Policy.Devices) == 0
+	for _, name := range key.Policy.Devices {
+		named = named || name == d.Name
+	}
+
+	return allowed && named
+}
+
+// getDevicesHandler answers with the devices the key may send to.
+func (routes routes) getDevicesHandler(res http.ResponseWriter, req *http.Request) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	ret := make([]device.Device, 0)
+	for _, d := range routes.Devices.Devices() {
+		if mayUse(key, d) {
+			ret = append(ret, d)
+		}
+	}
+
+	writeJSON(res, http.StatusOK, ret)
+}
+
+// getGroupsHandler answers with the groups of devices, each with the devices
+// the key may send to, leaving out groups without any of those.
+func (routes routes) getGroupsHandler(res http.ResponseWriter, req *http.Request) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	ret := make([]device.Group, 0)
+	for _, group := range routes.Devices.Groups() {
+		devices := make([]string, 0, len(group.Devices))
+		for _, name := range group.Devices {
+			if d, err := routes.Devices.Lookup(name); err == nil && mayUse(key, d) {
+				devices = append(devices, name)
+			}
+		}
+
+		if len(devices) > 0 {
+			ret = append(ret, device.Group{Name: group.Name, Devices: devices})
+		}
+	}
+
+	writeJSON(res, http.StatusOK, ret)
+}
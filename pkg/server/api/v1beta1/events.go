@@ -0,0 +1,169 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// keepAlive is the interval comments are sent on idle event streams, to
+// keep proxies from closing them. The key of the stream is checked again on
+// the same interval.
+const keepAlive = 15 * time.Second
+
+// visibleEvent returns the given Event as the given key may see it, false if
+// it may not see it at all. Admins and the wearer of all devices see
+// everything, other keys only Events on the devices and Channels their Policy
+// allows and not which other keys caused them. Events on a Channel not naming
+// a device, like stopping the whole Channel, are about all devices on it.
+func (routes routes) visibleEvent(key auth.Key, e event.Event) (event.Event, bool) {
+	if key.Admin || key.WearerOf("") {
+		return e, true
+	}
+
+	if e.Channel != nil && len(key.Policy.Devices) > 0 {
+		allowed := false
+		for _, name := range key.Policy.Devices {
+			if e.Device == "" {
+				dev, err := routes.Devices.Lookup(name)
+				allowed = allowed || (err == nil && dev.Channel == *e.Channel)
+			} else {
+				allowed = allowed || name == e.Device
+			}
+		}
+
+		if !allowed {
+			return e, false
+		}
+	}
+
+	if e.Channel != nil && len(key.Policy.Channels) > 0 {
+		allowed := false
+		for _, ch := range key.Policy.Channels {
+			allowed = allowed || ch == *e.Channel
+		}
+
+		if !allowed {
+			return e, false
+		}
+	}
+
+	if e.KeyID != key.ID {
+		e.KeyID, e.KeyLabel = "", ""
+	}
+
+	return e, true
+}
+
+// getEventsHandler streams Events as server-sent events, optionally only
+// those on the Channel, or of the device, given with the channel query
+// parameter. Clients reconnecting with the Last-Event-ID header, or the
+// lastEventId query parameter, get the Events they missed first, as far as
+// they are kept. The stream is closed once the key is revoked or expires.
+func (routes routes) getEventsHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := auth.FromRequest(req); !ok {
+		if key := req.URL.Query().Get("key"); key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	var channel *types.Channel
+	if value := req.URL.Query().Get("channel"); value != "" {
+		var target device.Target
+		if err := target.Set(value); err != nil {
+			writeError(res, req, fmt.Errorf("error parsing channel: %w", err))
+			return
+		}
+
+		ch, err := routes.Devices.Channel(target)
+		if err != nil {
+			writeError(res, req, err)
+			return
+		}
+
+		channel = &ch
+	}
+
+	lastID := req.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = req.URL.Query().Get("lastEventId")
+	}
+
+	var after uint64
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			writeError(res, req, fmt.Errorf("%w: Last-Event-ID: %v", types.ErrUnparsable, err))
+			return
+		}
+	}
+
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		writeError(res, req, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	missed, events, unsubscribe := routes.Events.Subscribe(after)
+	defer unsubscribe()
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+
+	write := func(e event.Event) {
+		if channel != nil && (e.Channel == nil || *e.Channel != *channel) {
+			return
+		}
+
+		e, ok := routes.visibleEvent(key, e)
+		if !ok {
+			return
+		}
+
+		data, _ := json.Marshal(e)
+		fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	}
+
+	for _, e := range missed {
+		write(e)
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			apiKey, _ := auth.FromRequest(req)
+			current, err := routes.Keys.Authenticate(apiKey)
+			if err != nil {
+				// revoked or expired meanwhile
+				return
+			}
+
+			key = current
+
+			fmt.Fprint(res, ": keep-alive\n\n")
+		case e := <-events:
+			write(e)
+		}
+
+		flusher.Flush()
+	}
+}
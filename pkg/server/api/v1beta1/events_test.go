@@ -0,0 +1,106 @@
+package v1beta1_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api/v1beta1"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Events", func() {
+	var (
+		server *httptest.Server
+		events *event.Bus
+		apiKey string
+	)
+
+	BeforeEach(func() {
+		fake := clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		keys, err := auth.OpenStore(filepath.Join(GinkgoT().TempDir(), "keys.json"), fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		apiKey, _, err = keys.Create(auth.Key{
+			Label:  "alex",
+			Wearer: true,
+			Policy: auth.Policy{Devices: []string{"alex-collar"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var other types.RemoteID
+		Expect(other.Set("10111010010101110")).To(Succeed())
+
+		devices, err := device.NewRegistry([]device.Device{
+			{Name: "alex-collar", Protocol: device.ProtocolPetrainer, RemoteID: types.DefaultRemoteID, Channel: types.Channel2},
+			{Name: "sam-collar", Protocol: device.ProtocolPetrainer, RemoteID: other, Channel: types.Channel2},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		events = event.NewBus(16, fake)
+
+		handler, err := v1beta1.Routes(v1beta1.Backend{
+			Keys:    keys,
+			Events:  events,
+			Devices: devices,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		server = httptest.NewServer(handler)
+		DeferCleanup(server.Close)
+	})
+
+	// stream returns the types of the Events streamed to the key after the
+	// one with the given ID, until one of the given Type arrives.
+	stream := func(after string, until event.Type) []event.Type {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1beta1/events", nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Last-Event-ID", after)
+
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+
+		ret := make([]event.Type, 0)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if t, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+				ret = append(ret, event.Type(t))
+				if event.Type(t) == until {
+					return ret
+				}
+			}
+		}
+
+		Fail("stream ended before " + string(until))
+		return nil
+	}
+
+	It("shows keys limited to devices the events on those and on their channels", func() {
+		ch1, ch2 := types.Channel1, types.Channel2
+
+		events.Publish(event.Event{Type: event.TypeStop})
+		events.Publish(event.Event{Type: event.TypeStop, Channel: &ch2})
+		events.Publish(event.Event{Type: event.TypeDriverError, Channel: &ch1})
+		events.Publish(event.Event{Type: event.TypeSafewordSet, Channel: &ch2, Device: "sam-collar"})
+		events.Publish(event.Event{Type: event.TypeDriverError, Channel: &ch2, Device: "alex-collar"})
+
+		Expect(stream("1", event.TypeDriverError)).To(Equal([]event.Type{event.TypeStop, event.TypeDriverError}))
+	})
+})
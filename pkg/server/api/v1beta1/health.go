@@ -0,0 +1,48 @@
+package v1beta1
+
+import (
+	"net/http"
+	"time"
+)
+
+// transmitterHealth is the health of a single transmitter: the fill level
+// of its queue and its time on air against its duty cycle budget.
+type transmitterHealth struct {
+	Name          string        `json:"name"`
+	Status        string        `json:"status"`
+	QueueDepth    int           `json:"queueDepth"`
+	QueueCapacity int           `json:"queueCapacity"`
+	Airtime       time.Duration `json:"airtime"`
+	AirtimeBudget time.Duration `json:"airtimeBudget,omitempty"`
+	DutyCycle     float64       `json:"dutyCycle"`
+}
+
+// getHealthHandler answers with the health of the server, without requiring
+// a key: "degraded" if any transmitter has its queue full or its duty cycle
+// budget used up, as commands sent there are rejected or held back.
+func (routes routes) getHealthHandler(res http.ResponseWriter, req *http.Request) {
+	status := "ok"
+	transmitters := make([]transmitterHealth, 0)
+	for _, stats := range routes.Transmitters.Stats() {
+		health := transmitterHealth{
+			Name:          stats.Name,
+			Status:        "ok",
+			QueueDepth:    stats.QueueDepth,
+			QueueCapacity: stats.QueueCapacity,
+			Airtime:       stats.Airtime,
+			AirtimeBudget: stats.AirtimeBudget,
+			DutyCycle:     stats.DutyCycle,
+		}
+
+		if stats.QueueDepth >= stats.QueueCapacity || (stats.AirtimeBudget > 0 && stats.Airtime >= stats.AirtimeBudget) {
+			status, health.Status = "degraded", "degraded"
+		}
+
+		transmitters = append(transmitters, health)
+	}
+
+	writeJSON(res, http.StatusOK, struct {
+		Status       string              `json:"status"`
+		Transmitters []transmitterHealth `json:"transmitters"`
+	}{status, transmitters})
+}
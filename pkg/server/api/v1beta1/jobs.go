@@ -0,0 +1,132 @@
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/job"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// maxWait is the longest a request waits for a job to finish.
+const maxWait = time.Minute
+
+// jobsFor returns the ID of the key whose jobs the given key may see, empty
+// for all jobs.
+func jobsFor(key auth.Key) string {
+	if key.Admin {
+		return ""
+	}
+
+	return key.ID
+}
+
+// lookupJob returns the job with the given ID if the given key may see it,
+// ErrUnknownJob otherwise.
+func (routes routes) lookupJob(key auth.Key, id identifier) (job.Job, error) {
+	ret, err := routes.Jobs.Get(string(id))
+	if err != nil {
+		return job.Job{}, err
+	}
+
+	if owner := jobsFor(key); owner != "" && ret.KeyID != owner {
+		return job.Job{}, fmt.Errorf("%w: %q", job.ErrUnknownJob, id)
+	}
+
+	return ret, nil
+}
+
+func (routes routes) getJobsHandler(res http.ResponseWriter, req *http.Request) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	writeJSON(res, http.StatusOK, routes.Jobs.Jobs(jobsFor(key)))
+}
+
+// postJobHandler starts a job sending the command in the request body and
+// answers right away with 202 Accepted, commands not allowed for the key
+// are rejected before.
+func (routes routes) postJobHandler(res http.ResponseWriter, req *http.Request) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	cmd, err := routes.readCommand(req)
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	ret, err := routes.Jobs.Submit(withOrigin(req), key.ID, cmd)
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	res.Header().Set("Location", "/v1beta1/jobs/"+ret.ID)
+	writeJSON(res, http.StatusAccepted, ret)
+}
+
+// getJobHandler answers with the job, waiting up to the duration given with
+// the wait query parameter for it to finish.
+func (routes routes) getJobHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	ret, err := routes.lookupJob(key, id)
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	if wait := req.URL.Query().Get("wait"); wait != "" && !ret.State.Finished() {
+		timeout, err := time.ParseDuration(wait)
+		if err != nil {
+			writeError(res, req, fmt.Errorf("%w: wait: %v", types.ErrUnparsable, err))
+			return
+		}
+
+		if timeout > maxWait {
+			timeout = maxWait
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+
+		if ret, err = routes.Jobs.Wait(ctx, string(id)); err != nil {
+			writeError(res, req, err)
+			return
+		}
+	}
+
+	writeJSON(res, http.StatusOK, ret)
+}
+
+// deleteJobHandler cancels the job and answers with it once finished.
+func (routes routes) deleteJobHandler(res http.ResponseWriter, req *http.Request, id identifier) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	if _, err := routes.lookupJob(key, id); err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	ret, err := routes.Jobs.Cancel(string(id))
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, ret)
+}
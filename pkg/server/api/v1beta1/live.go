@@ -0,0 +1,93 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/live"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// maxHold returns how long the given Operation may be held at most.
+func (routes routes) maxHold(op types.Operation) time.Duration {
+	if d, ok := routes.Transmitters.MaxDuration(op); ok {
+		return d
+	}
+
+	return live.DefaultMaxHold
+}
+
+// getLiveHandler upgrades the request to a WebSocket for live control, see
+// package live. The key is taken from the Authorization header or, for
+// browsers not able to set it, from the key query parameter. Every message
+// of the client has to arrive within the heartbeat interval after the
+// previous one, or the hold is released.
+func (routes routes) getLiveHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := auth.FromRequest(req); !ok {
+		if key := req.URL.Query().Get("key"); key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return
+	}
+
+	heartbeat := routes.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = live.DefaultHeartbeat
+	}
+
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		controller := live.NewController(withOrigin(req), routes.Dispatcher, key.ID, routes.maxHold)
+
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+
+			for event := range controller.Events() {
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					ws.Close()
+				}
+			}
+		}()
+
+		controller.Close(routes.receiveUpdates(ws, controller, heartbeat))
+		<-written
+	}}.ServeHTTP(res, req)
+}
+
+// receiveUpdates hands all Updates received on the WebSocket to the
+// Controller until the client goes away, returning why.
+func (routes routes) receiveUpdates(ws *websocket.Conn, controller *live.Controller, heartbeat time.Duration) error {
+	for {
+		if err := ws.SetReadDeadline(time.Now().Add(heartbeat)); err != nil {
+			return fmt.Errorf("%w: %v", live.ErrDisconnected, err)
+		}
+
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return live.ErrHeartbeat
+			}
+
+			return live.ErrDisconnected
+		}
+
+		var update live.Update
+		if err := json.Unmarshal(data, &update); err != nil {
+			controller.Error(fmt.Errorf("%w: %v", live.ErrInvalidUpdate, err))
+			continue
+		}
+
+		controller.Handle(update)
+	}
+}
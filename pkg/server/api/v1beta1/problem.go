@@ -0,0 +1,74 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api"
+)
+
+// problem is an RFC 7807 problem details object, with the extension members
+// this API uses.
+type problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// CommandID is the ID of the command the problem occurred with.
+	CommandID string `json:"commandId,omitempty"`
+
+	// Rule is the policy rule a forbidden command broke.
+	Rule string `json:"rule,omitempty"`
+
+	// RetryAfter is the number of seconds to wait before retrying a rate
+	// limited command.
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+// newProblem returns the problem describing the given error, with the status
+// code from api.Status.
+func newProblem(req *http.Request, err error) problem {
+	status := api.Status(err)
+
+	ret := problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   err.Error(),
+		Instance: req.URL.Path,
+	}
+
+	var policyErr *auth.PolicyError
+	if errors.As(err, &policyErr) {
+		ret.Rule = policyErr.Rule
+	}
+
+	if retryAfter, ok := api.RetryAfter(err); ok {
+		ret.RetryAfter = int(math.Ceil(retryAfter.Seconds()))
+	}
+
+	return ret
+}
+
+// writeProblem writes the given problem as application/problem+json, with a
+// Retry-After header for rate limited requests.
+func writeProblem(res http.ResponseWriter, p problem) {
+	if p.RetryAfter > 0 {
+		res.Header().Set("Retry-After", strconv.Itoa(p.RetryAfter))
+	}
+
+	res.Header().Set("Content-Type", "application/problem+json")
+	res.WriteHeader(p.Status)
+	json.NewEncoder(res).Encode(p)
+}
+
+// writeError writes the problem describing the given error.
+func writeError(res http.ResponseWriter, req *http.Request, err error) {
+	writeProblem(res, newProblem(req, err))
+}
@@ -0,0 +1,13 @@
+package v1beta1
+
+import "net/http"
+
+// getQuietHoursHandler answers with the quiet hours, telling which of them
+// are open now and until when.
+func (routes routes) getQuietHoursHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := routes.authenticate(res, req); !ok {
+		return
+	}
+
+	writeJSON(res, http.StatusOK, routes.QuietHours.State())
+}
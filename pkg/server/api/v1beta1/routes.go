@@ -0,0 +1,199 @@
+// Package v1beta1 implements the JSON API: requests and responses are JSON
+// documents and errors are RFC 7807 problem details.
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/calibration"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/command"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/device"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/event"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/job"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/quiethours"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/typesafe_router"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+)
+
+// Backend holds everything the v1beta1 API works with.
+type Backend struct {
+	Keys         *auth.Store
+	Dispatcher   *command.Dispatcher
+	Jobs         *job.Manager
+	Transmitters *transmit.Router
+	Events       *event.Bus
+	Devices      *device.Registry
+	Calibrations *calibration.Manager
+	QuietHours   *quiethours.Policy
+
+	// Heartbeat is how long live control waits for the next message of a
+	// client before releasing its hold, live.DefaultHeartbeat if 0.
+	Heartbeat time.Duration
+
+	// Idempotency replays responses to retried requests, optional.
+	Idempotency *api.Idempotency
+}
+
+type routes struct {
+	typesafe_router.TypeSafeRouter
+	Backend
+}
+
+func writeJSON(res http.ResponseWriter, status int, v any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(v)
+}
+
+// authenticate returns the Key the request is authenticated with, taken
+// from the Authorization header. It writes a problem response and returns
+// false if the key is not valid.
+func (routes routes) authenticate(res http.ResponseWriter, req *http.Request) (auth.Key, bool) {
+	apiKey, _ := auth.FromRequest(req)
+
+	ret, err := routes.Keys.Authenticate(apiKey)
+	if err != nil {
+		writeError(res, req, err)
+		return auth.Key{}, false
+	}
+
+	return ret, true
+}
+
+// keyID returns the ID of the key the request is authenticated with, like
+// authenticate, without answering it, for recording responses to retries.
+func (routes routes) keyID(req *http.Request) (string, bool) {
+	apiKey, _ := auth.FromRequest(req)
+
+	key, err := routes.Keys.Authenticate(apiKey)
+	if err != nil {
+		return "", false
+	}
+
+	return key.ID, true
+}
+
+// authenticateWearer is like authenticate, but requires a wearer key.
+func (routes routes) authenticateWearer(res http.ResponseWriter, req *http.Request) (auth.Key, bool) {
+	key, ok := routes.authenticate(res, req)
+	if !ok {
+		return auth.Key{}, false
+	}
+
+	if !key.Wearer {
+		writeError(res, req, fmt.Errorf("%w: wearer key required", auth.ErrForbidden))
+		return auth.Key{}, false
+	}
+
+	return key, true
+}
+
+// authenticateWearerOf is like authenticateWearer, but requires the wearer
+// key of the named device.
+func (routes routes) authenticateWearerOf(res http.ResponseWriter, req *http.Request, name identifier) (auth.Key, bool) {
+	key, ok := routes.authenticateWearer(res, req)
+	if !ok {
+		return auth.Key{}, false
+	}
+
+	d, err := routes.Devices.Lookup(string(name))
+	if err != nil {
+		writeError(res, req, err)
+		return auth.Key{}, false
+	}
+
+	if !key.WearerOf(d.Name) {
+		writeError(res, req, fmt.Errorf("%w: not the wearer of %s", auth.ErrForbidden, d.Name))
+		return auth.Key{}, false
+	}
+
+	return key, true
+}
+
+// identifier is a path element naming something, like a job.
+type identifier string
+
+func (i *identifier) Set(v string) error {
+	*i = identifier(v)
+	return nil
+}
+
+func (i identifier) String() string {
+	return string(i)
+}
+
+// withOrigin returns the context of the request, carrying its Origin for the
+// audit log.
+func withOrigin(req *http.Request) context.Context {
+	return command.WithOrigin(req.Context(), command.Origin{
+		RemoteAddr:     req.RemoteAddr,
+		Source:         "api",
+		IdempotencyKey: req.Header.Get(api.IdempotencyHeader),
+	})
+}
+
+// notFound answers requests not matching any route with a problem.
+func notFound(res http.ResponseWriter, req *http.Request) {
+	writeProblem(res, problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(http.StatusNotFound),
+		Status:   http.StatusNotFound,
+		Instance: req.URL.Path,
+	})
+}
+
+// Routes returns the http.Handler serving the v1beta1 API with the given
+// Backend.
+func Routes(backend Backend) (http.Handler, error) {
+	ret := routes{Backend: backend}
+	ret.NotFound = http.HandlerFunc(notFound)
+
+	type route struct {
+		method  string
+		path    string
+		handler any
+	}
+
+	routes := map[string]route{
+		"postCommand":     {"POST", "/v1beta1/commands", ret.postCommandHandler},
+		"getJobs":         {"GET", "/v1beta1/jobs", ret.getJobsHandler},
+		"postJob":         {"POST", "/v1beta1/jobs", ret.postJobHandler},
+		"getJob":          {"GET", "/v1beta1/jobs/:", ret.getJobHandler},
+		"deleteJob":       {"DELETE", "/v1beta1/jobs/:", ret.deleteJobHandler},
+		"getLive":         {"GET", "/v1beta1/live", ret.getLiveHandler},
+		"getEvents":       {"GET", "/v1beta1/events", ret.getEventsHandler},
+		"getDevices":      {"GET", "/v1beta1/devices", ret.getDevicesHandler},
+		"getGroups":       {"GET", "/v1beta1/groups", ret.getGroupsHandler},
+		"postBroadcast":   {"POST", "/v1beta1/broadcasts", ret.postBroadcastHandler},
+		"getTransmitters": {"GET", "/v1beta1/transmitters", ret.getTransmittersHandler},
+		"getQuietHours":   {"GET", "/v1beta1/quiet-hours", ret.getQuietHoursHandler},
+		"getHealth":       {"GET", "/v1beta1/health", ret.getHealthHandler},
+
+		"putCalibration":         {"PUT", "/v1beta1/devices/:/calibration", ret.putCalibrationHandler},
+		"deleteCalibration":      {"DELETE", "/v1beta1/devices/:/calibration", ret.deleteCalibrationHandler},
+		"postCalibrationFlow":    {"POST", "/v1beta1/devices/:/calibration/flow", ret.postCalibrationFlowHandler},
+		"getCalibrationFlow":     {"GET", "/v1beta1/devices/:/calibration/flow", ret.getCalibrationFlowHandler},
+		"deleteCalibrationFlow":  {"DELETE", "/v1beta1/devices/:/calibration/flow", ret.deleteCalibrationFlowHandler},
+		"postCalibrationNext":    {"POST", "/v1beta1/devices/:/calibration/flow/next", ret.postCalibrationNextHandler},
+		"postCalibrationFeeling": {"POST", "/v1beta1/devices/:/calibration/flow/feedback", ret.postCalibrationFeedbackHandler},
+		"postCalibrationApply":   {"POST", "/v1beta1/devices/:/calibration/flow/apply", ret.postCalibrationApplyHandler},
+	}
+
+	for name, route := range routes {
+		if err := ret.AddRoute(route.method, route.path, route.handler); err != nil {
+			return nil, fmt.Errorf("error adding route %q: %w", name, err)
+		}
+	}
+
+	if ret.Idempotency != nil {
+		return ret.Idempotency.Handler(&ret, ret.keyID, writeError), nil
+	}
+
+	return &ret, nil
+}
@@ -0,0 +1,13 @@
+package v1beta1
+
+import "net/http"
+
+// getTransmittersHandler answers with the state of the queues of all
+// transmitters, the default one first.
+func (routes routes) getTransmittersHandler(res http.ResponseWriter, req *http.Request) {
+	if _, ok := routes.authenticate(res, req); !ok {
+		return
+	}
+
+	writeJSON(res, http.StatusOK, routes.Transmitters.Stats())
+}
@@ -18,6 +18,10 @@ var placeHolderRegex = regexp.MustCompile("/:")
 
 type TypeSafeRouter struct {
 	handlers map[string]map[*regexp.Regexp]http.HandlerFunc
+
+	// NotFound serves requests not matching any route, http.NotFoundHandler
+	// if nil.
+	NotFound http.Handler
 }
 
 // AddRoute takes a path with placeholders ('/:') to mark path elements going
@@ -44,14 +48,18 @@ func (tr *TypeSafeRouter) AddRoute(method, path string, handler any) error {
 	}
 
 	pathRegexString := strings.Builder{}
+	pathRegexString.WriteRune('^')
 
 	lastPosition := []int{0, 0}
 	for _, placeHolderPosition := range placeHolderPositions {
-		pathRegexString.WriteString(path[lastPosition[1]:placeHolderPosition[0]])
+		pathRegexString.WriteString(regexp.QuoteMeta(path[lastPosition[1]:placeHolderPosition[0]]))
 		pathRegexString.WriteString(`/([^/]+)`)
 		lastPosition = placeHolderPosition
 	}
 
+	pathRegexString.WriteString(regexp.QuoteMeta(path[lastPosition[1]:]))
+	pathRegexString.WriteRune('$')
+
 	pathRegex, err := regexp.Compile(pathRegexString.String())
 	if err != nil {
 		return fmt.Errorf("error compiling path regex: %w", err)
@@ -106,5 +114,10 @@ func (tr TypeSafeRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	if tr.NotFound != nil {
+		tr.NotFound.ServeHTTP(res, req)
+		return
+	}
+
 	http.NotFoundHandler().ServeHTTP(res, req)
 }
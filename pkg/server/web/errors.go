@@ -0,0 +1,16 @@
+package web
+
+import (
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+)
+
+var (
+	// ErrNotLoggedIn is returned for requests without a valid login.
+	ErrNotLoggedIn = fmt.Errorf("%w: not logged in", auth.ErrUnauthorized)
+
+	// ErrInvalidCSRFToken is returned for requests authenticated by a login
+	// not carrying its CSRF token.
+	ErrInvalidCSRFToken = fmt.Errorf("%w: missing or invalid CSRF token", auth.ErrForbidden)
+)
@@ -0,0 +1,371 @@
+// Package web implements the control panel served to browsers. It is built
+// into the binary and uses the HTTP APIs, authenticated with a login made
+// with an API key instead of the Authorization header.
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/api"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/typesafe_router"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// DefaultLoginLifetime is how long a login lasts by default.
+const DefaultLoginLifetime = 12 * time.Hour
+
+// CookieName is the name of the cookie carrying the login.
+const CookieName = "gotoshock_login"
+
+// CSRFHeader is the request header carrying the CSRF token of the login.
+const CSRFHeader = "X-CSRF-Token"
+
+// maxLoginBody is the largest login request accepted.
+const maxLoginBody = 4 << 10
+
+//go:embed static
+var static embed.FS
+
+// channels are all Channels, shown to keys not limited to some.
+var channels = []types.Channel{types.Channel1, types.Channel2}
+
+// operations are all Operations, shown to keys not limited to some.
+var operations = []types.Operation{types.OperationBeep, types.OperationVibrate, types.OperationShock}
+
+type login struct {
+	apiKey    string
+	csrfToken string
+	expires   time.Time
+}
+
+// Panel serves the control panel and keeps the logins made with it.
+type Panel struct {
+	keys     *auth.Store
+	lifetime time.Duration
+	clock    clock.Clock
+
+	mu     sync.Mutex
+	logins map[string]*login
+}
+
+// NewPanel creates a Panel checking logins against the given Store, each
+// lasting for the given lifetime.
+func NewPanel(keys *auth.Store, lifetime time.Duration, c clock.Clock) *Panel {
+	return &Panel{
+		keys:     keys,
+		lifetime: lifetime,
+		clock:    c,
+		logins:   make(map[string]*login),
+	}
+}
+
+// operation is an Operation a key may send, with the highest Intensity it
+// may send it with.
+type operation struct {
+	Operation    types.Operation `json:"operation"`
+	MaxIntensity types.Intensity `json:"maxIntensity"`
+}
+
+// loginInfo tells the panel what the key logged in with may do.
+type loginInfo struct {
+	KeyID         string          `json:"keyId"`
+	Label         string          `json:"label"`
+	Admin         bool            `json:"admin,omitempty"`
+	Wearer        bool            `json:"wearer,omitempty"`
+	Approver      bool            `json:"approver,omitempty"`
+	Channels      []types.Channel `json:"channels"`
+	Operations    []operation     `json:"operations"`
+	MaxDurationMs int64           `json:"maxDurationMs,omitempty"`
+	CSRFToken     string          `json:"csrfToken"`
+	Expires       time.Time       `json:"expires"`
+}
+
+func newLoginInfo(key auth.Key, l *login) loginInfo {
+	ret := loginInfo{
+		KeyID:         key.ID,
+		Label:         key.Label,
+		Admin:         key.Admin,
+		Wearer:        key.Wearer,
+		Approver:      key.Approver,
+		Channels:      key.Policy.Channels,
+		Operations:    make([]operation, 0, len(operations)),
+		MaxDurationMs: key.Policy.MaxDuration.Milliseconds(),
+		CSRFToken:     l.csrfToken,
+		Expires:       l.expires,
+	}
+
+	if len(ret.Channels) == 0 {
+		ret.Channels = channels
+	}
+
+	for _, op := range operations {
+		if len(key.Policy.Operations) > 0 && !contains(key.Policy.Operations, op) {
+			continue
+		}
+
+		maxIntensity, limited := key.Policy.MaxIntensity[op]
+		if !limited {
+			maxIntensity = 100
+		}
+
+		ret.Operations = append(ret.Operations, operation{Operation: op, MaxIntensity: maxIntensity})
+	}
+
+	return ret
+}
+
+func contains[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeJSON(res http.ResponseWriter, status int, v any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(v)
+}
+
+func writeError(res http.ResponseWriter, err error) {
+	http.Error(res, err.Error(), api.Status(err))
+}
+
+// Routes returns the http.Handler serving the panel and its login
+// endpoints below /ui/.
+func (p *Panel) Routes() (http.Handler, error) {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		return nil, fmt.Errorf("error opening static files: %w", err)
+	}
+
+	ret := &typesafe_router.TypeSafeRouter{NotFound: http.FileServer(http.FS(files))}
+
+	type route struct {
+		method  string
+		path    string
+		handler any
+	}
+
+	routes := map[string]route{
+		"postLogin":  {"POST", "/ui/login", p.postLoginHandler},
+		"getLogin":   {"GET", "/ui/login", p.getLoginHandler},
+		"postLogout": {"POST", "/ui/logout", p.postLogoutHandler},
+	}
+
+	for name, route := range routes {
+		if err := ret.AddRoute(route.method, route.path, route.handler); err != nil {
+			return nil, fmt.Errorf("error adding route %q: %w", name, err)
+		}
+	}
+
+	return ret, nil
+}
+
+// Handler returns next wrapped with authentication by login: requests
+// without an Authorization header but with the login cookie are passed on
+// with the API key of the login. Requests changing anything, and WebSocket
+// connections, have to carry the CSRF token of the login in the
+// X-CSRF-Token header or the csrf query parameter.
+func (p *Panel) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if _, ok := auth.FromRequest(req); ok {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		l, ok := p.login(req)
+		if !ok {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		if needsCSRFToken(req) && !validCSRFToken(req, l) {
+			writeError(res, ErrInvalidCSRFToken)
+			return
+		}
+
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+l.apiKey)
+		next.ServeHTTP(res, req)
+	})
+}
+
+// needsCSRFToken returns if the request has to carry the CSRF token of its
+// login.
+func needsCSRFToken(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return strings.EqualFold(req.Header.Get("Upgrade"), "websocket")
+	default:
+		return true
+	}
+}
+
+func validCSRFToken(req *http.Request, l login) bool {
+	token := req.Header.Get(CSRFHeader)
+	if token == "" {
+		token = req.URL.Query().Get("csrf")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(l.csrfToken)) == 1
+}
+
+// login returns the login the cookie of the request refers to, if it is
+// still valid.
+func (p *Panel) login(req *http.Request) (login, bool) {
+	cookie, err := req.Cookie(CookieName)
+	if err != nil {
+		return login{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l, ok := p.logins[cookie.Value]
+	if !ok || !p.clock.Now().Before(l.expires) {
+		return login{}, false
+	}
+
+	return *l, true
+}
+
+// postLoginHandler logs in with the API key given in the JSON body as
+// {"key": "..."}, setting the login cookie and answering with what the key
+// may do. Only JSON is accepted, which browsers do not send cross-site
+// without asking first.
+func (p *Panel) postLoginHandler(res http.ResponseWriter, req *http.Request) {
+	if mediaType, _, _ := strings.Cut(req.Header.Get("Content-Type"), ";"); strings.TrimSpace(mediaType) != "application/json" {
+		writeError(res, fmt.Errorf("%w: content type must be application/json", types.ErrUnparsable))
+		return
+	}
+
+	var body struct {
+		Key string `json:"key"`
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(res, req.Body, maxLoginBody)).Decode(&body); err != nil {
+		writeError(res, fmt.Errorf("%w: %v", types.ErrUnparsable, err))
+		return
+	}
+
+	key, err := p.keys.Authenticate(strings.TrimSpace(body.Key))
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	id, err := newToken()
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	csrfToken, err := newToken()
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	now := p.clock.Now()
+	l := &login{
+		apiKey:    strings.TrimSpace(body.Key),
+		csrfToken: csrfToken,
+		expires:   now.Add(p.lifetime),
+	}
+
+	p.mu.Lock()
+	for id, other := range p.logins {
+		if !now.Before(other.expires) {
+			delete(p.logins, id)
+		}
+	}
+	p.logins[id] = l
+	p.mu.Unlock()
+
+	http.SetCookie(res, &http.Cookie{
+		Name:     CookieName,
+		Value:    id,
+		Path:     "/",
+		Expires:  l.expires,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	writeJSON(res, http.StatusOK, newLoginInfo(key, l))
+}
+
+// getLoginHandler answers with what the key logged in with may do, including
+// the CSRF token of the login.
+func (p *Panel) getLoginHandler(res http.ResponseWriter, req *http.Request) {
+	l, ok := p.login(req)
+	if !ok {
+		writeError(res, ErrNotLoggedIn)
+		return
+	}
+
+	key, err := p.keys.Authenticate(l.apiKey)
+	if err != nil {
+		writeError(res, err)
+		return
+	}
+
+	writeJSON(res, http.StatusOK, newLoginInfo(key, &l))
+}
+
+// postLogoutHandler ends the login of the request, which has to carry its
+// CSRF token.
+func (p *Panel) postLogoutHandler(res http.ResponseWriter, req *http.Request) {
+	l, ok := p.login(req)
+	if !ok {
+		writeError(res, ErrNotLoggedIn)
+		return
+	}
+
+	if !validCSRFToken(req, l) {
+		writeError(res, ErrInvalidCSRFToken)
+		return
+	}
+
+	cookie, _ := req.Cookie(CookieName)
+
+	p.mu.Lock()
+	delete(p.logins, cookie.Value)
+	p.mu.Unlock()
+
+	http.SetCookie(res, &http.Cookie{
+		Name:     CookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func newToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	return hex.EncodeToString(token), nil
+}
@@ -0,0 +1,175 @@
+package web_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/server/web"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Panel", func() {
+	var (
+		fake    *clock.Fake
+		apiKey  string
+		handler http.Handler
+
+		// authorization is the Authorization header of the last request
+		// passed on to the API
+		authorization string
+	)
+
+	BeforeEach(func() {
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		keys, err := auth.OpenStore(filepath.Join(GinkgoT().TempDir(), "keys.json"), fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		var policy auth.Policy
+		Expect(policy.Set("channels", "2")).To(Succeed())
+		Expect(policy.Set("max-intensity", "shock=30")).To(Succeed())
+
+		apiKey, _, err = keys.Create(auth.Key{Label: "alice", Policy: policy})
+		Expect(err).NotTo(HaveOccurred())
+
+		panel := web.NewPanel(keys, time.Hour, fake)
+		routes, err := panel.Routes()
+		Expect(err).NotTo(HaveOccurred())
+
+		authorization = ""
+		mux := http.NewServeMux()
+		mux.Handle("/", routes)
+		mux.HandleFunc("/v1beta1/", func(res http.ResponseWriter, req *http.Request) {
+			authorization = req.Header.Get("Authorization")
+		})
+
+		handler = panel.Handler(mux)
+	})
+
+	do := func(method, path, body string, cookie *http.Cookie, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	type loginInfo struct {
+		Label      string          `json:"label"`
+		Channels   []types.Channel `json:"channels"`
+		Operations []struct {
+			Operation    types.Operation `json:"operation"`
+			MaxIntensity types.Intensity `json:"maxIntensity"`
+		} `json:"operations"`
+		CSRFToken string `json:"csrfToken"`
+	}
+
+	logIn := func() (*http.Cookie, loginInfo) {
+		res := do(http.MethodPost, "/ui/login", `{"key": "`+apiKey+`"}`, nil)
+		Expect(res.Code).To(Equal(http.StatusOK))
+
+		cookies := res.Result().Cookies()
+		Expect(cookies).To(HaveLen(1))
+		Expect(cookies[0].Name).To(Equal(web.CookieName))
+		Expect(cookies[0].HttpOnly).To(BeTrue())
+		Expect(cookies[0].SameSite).To(Equal(http.SameSiteStrictMode))
+
+		var info loginInfo
+		Expect(json.Unmarshal(res.Body.Bytes(), &info)).To(Succeed())
+		return cookies[0], info
+	}
+
+	It("serves the panel", func() {
+		res := do(http.MethodGet, "/", "", nil)
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring("<title>GoToShock</title>"))
+
+		res = do(http.MethodGet, "/app.js", "", nil)
+		Expect(res.Code).To(Equal(http.StatusOK))
+	})
+
+	It("logs in with API keys", func() {
+		Expect(do(http.MethodPost, "/ui/login", `{"key": "nope.nope"}`, nil).Code).To(Equal(http.StatusUnauthorized))
+
+		cookie, info := logIn()
+		Expect(info.Label).To(Equal("alice"))
+		Expect(info.Channels).To(Equal([]types.Channel{types.Channel2}))
+		Expect(info.Operations).To(ContainElement(And(
+			HaveField("Operation", types.OperationShock),
+			HaveField("MaxIntensity", BeEquivalentTo(30)),
+		)))
+		Expect(info.CSRFToken).NotTo(BeEmpty())
+
+		res := do(http.MethodGet, "/ui/login", "", cookie)
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring(info.CSRFToken))
+
+		Expect(do(http.MethodGet, "/ui/login", "", nil).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("only accepts logins as JSON", func() {
+		req := httptest.NewRequest(http.MethodPost, "/ui/login", strings.NewReader("key="+apiKey))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		Expect(res.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("authenticates API requests with the login", func() {
+		cookie, info := logIn()
+
+		Expect(do(http.MethodGet, "/v1beta1/events", "", cookie).Code).To(Equal(http.StatusOK))
+		Expect(authorization).To(Equal("Bearer " + apiKey))
+
+		authorization = ""
+		Expect(do(http.MethodPost, "/v1beta1/commands", "{}", cookie).Code).To(Equal(http.StatusForbidden))
+		Expect(do(http.MethodPost, "/v1beta1/commands", "{}", cookie, web.CSRFHeader, "wrong").Code).To(Equal(http.StatusForbidden))
+		Expect(do(http.MethodGet, "/v1beta1/live", "", cookie, "Upgrade", "websocket").Code).To(Equal(http.StatusForbidden))
+		Expect(authorization).To(BeEmpty())
+
+		Expect(do(http.MethodPost, "/v1beta1/commands", "{}", cookie, web.CSRFHeader, info.CSRFToken).Code).To(Equal(http.StatusOK))
+		Expect(authorization).To(Equal("Bearer " + apiKey))
+
+		Expect(do(http.MethodGet, "/v1beta1/live?csrf="+info.CSRFToken, "", cookie, "Upgrade", "websocket").Code).To(Equal(http.StatusOK))
+	})
+
+	It("leaves requests with an Authorization header alone", func() {
+		cookie, _ := logIn()
+
+		Expect(do(http.MethodPost, "/v1beta1/commands", "{}", cookie, "Authorization", "Bearer other").Code).To(Equal(http.StatusOK))
+		Expect(authorization).To(Equal("Bearer other"))
+	})
+
+	It("ends logins on logout and after their lifetime", func() {
+		cookie, info := logIn()
+
+		Expect(do(http.MethodPost, "/ui/logout", "", cookie).Code).To(Equal(http.StatusForbidden))
+		Expect(do(http.MethodPost, "/ui/logout", "", cookie, web.CSRFHeader, info.CSRFToken).Code).To(Equal(http.StatusNoContent))
+		Expect(do(http.MethodGet, "/ui/login", "", cookie).Code).To(Equal(http.StatusUnauthorized))
+
+		cookie, _ = logIn()
+		fake.Advance(time.Hour)
+		Expect(do(http.MethodGet, "/ui/login", "", cookie).Code).To(Equal(http.StatusUnauthorized))
+
+		Expect(do(http.MethodGet, "/v1beta1/events", "", cookie).Code).To(Equal(http.StatusOK))
+		Expect(authorization).To(BeEmpty())
+	})
+})
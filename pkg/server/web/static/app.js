@@ -0,0 +1,275 @@
+"use strict";
+
+// eventTypes are the types of events shown as activity.
+const eventTypes = [
+	"command.accepted", "command.rejected", "command.transmitted", "command.failed",
+	"driver.error", "safeword.set", "safeword.lifted", "stop",
+];
+
+// maxActivity is the number of events shown as activity.
+const maxActivity = 50;
+
+let login = null;
+let events = null;
+
+const $ = (id) => document.getElementById(id);
+
+function show(message, error) {
+	$("message").textContent = message;
+	$("message").className = error ? "error" : "";
+}
+
+// request sends a request to the API, with the CSRF token of the login,
+// returning the parsed response or throwing an error with the detail of the
+// problem.
+async function request(method, url, body) {
+	const headers = {};
+	if (login) {
+		headers["X-CSRF-Token"] = login.csrfToken;
+	}
+	if (body !== undefined) {
+		headers["Content-Type"] = "application/json";
+	}
+
+	const res = await fetch(url, {
+		method: method,
+		headers: headers,
+		body: body === undefined ? undefined : JSON.stringify(body),
+		credentials: "same-origin",
+	});
+
+	const text = await res.text();
+	const json = (res.headers.get("Content-Type") || "").includes("json") && text !== "";
+
+	if (!res.ok) {
+		let message = text.trim() || res.statusText;
+		if (json) {
+			const problem = JSON.parse(text);
+			message = problem.detail || problem.title || message;
+		}
+
+		const err = new Error(message);
+		err.status = res.status;
+		throw err;
+	}
+
+	return json ? JSON.parse(text) : text;
+}
+
+async function run(f) {
+	try {
+		await f();
+	} catch (err) {
+		if (err.status === 401) {
+			loggedOut();
+		}
+		show(err.message, true);
+	}
+}
+
+function loggedIn(info) {
+	login = info;
+
+	$("login").hidden = true;
+	$("panel").hidden = false;
+	$("whoami").hidden = false;
+	$("label").textContent = info.label + (info.wearer ? " (wearer)" : "") + (info.admin ? " (admin)" : "");
+	$("safeword").hidden = !info.wearer;
+
+	renderChannels().then(refreshSafewords);
+	subscribe();
+}
+
+function loggedOut() {
+	login = null;
+	if (events) {
+		events.close();
+		events = null;
+	}
+
+	$("login").hidden = false;
+	$("panel").hidden = true;
+	$("whoami").hidden = true;
+}
+
+// renderChannels shows a card per channel and per device the key may send
+// to.
+async function renderChannels() {
+	const container = $("channels");
+	container.replaceChildren();
+
+	for (const channel of login.channels) {
+		container.append(card("Channel " + channel, channel, channel, {}));
+	}
+
+	await run(async () => {
+		for (const device of await request("GET", "/v1beta1/devices")) {
+			container.append(card(device.name, device.name, device.channel, device.maxIntensity || {}));
+		}
+	});
+}
+
+// card builds the card sending commands to target, a channel or the name of
+// a device listening on channel, with the intensities limited to those of
+// the key and limits.
+function card(title, target, channel, limits) {
+	const card = $("channel").content.firstElementChild.cloneNode(true);
+	card.dataset.channel = channel;
+	card.dataset.target = target;
+	card.querySelector("h3").textContent = title;
+
+	const duration = card.querySelector(".duration input");
+	if (login.maxDurationMs) {
+		duration.max = login.maxDurationMs;
+		duration.value = Math.min(duration.value, login.maxDurationMs);
+	}
+
+	for (const op of login.operations) {
+		const row = $("operation").content.firstElementChild.cloneNode(true);
+		const slider = row.querySelector("input");
+		const output = row.querySelector("output");
+		const button = row.querySelector("button");
+
+		button.textContent = op.operation;
+		button.className = op.operation;
+
+		if (op.operation === "beep") {
+			slider.hidden = true;
+			output.hidden = true;
+		} else {
+			slider.max = Math.min(op.maxIntensity, limits[op.operation] ?? 100);
+			slider.addEventListener("input", () => output.textContent = slider.value);
+		}
+
+		button.addEventListener("click", () => run(async () => {
+			const command = {channel: target, operation: op.operation};
+			if (op.operation !== "beep") {
+				command.intensity = Number(slider.value);
+				command.durationMs = Number(duration.value);
+			}
+
+			const result = await request("POST", "/v1beta1/commands", command);
+			show("sent " + result.operation + " to " + (result.device || "channel " + result.channel));
+		}));
+
+		card.querySelector(".operations").append(row);
+	}
+
+	return card;
+}
+
+async function refreshSafewords() {
+	await run(async () => {
+		const states = await request("GET", "/v1alpha1/safeword");
+
+		for (const card of document.querySelectorAll(".channel")) {
+			// safewords are kept per device, or per channel for cards
+			// sending on a channel
+			const state = states[card.dataset.target];
+			let text = "";
+			if (state) {
+				text = "Safeword: " + state.mode + (state.maxIntensity ? " " + state.maxIntensity : "") +
+					" since " + new Date(state.since).toLocaleTimeString();
+			}
+
+			card.querySelector(".state").textContent = text;
+			card.classList.toggle("safeword", !!state);
+		}
+	});
+}
+
+function subscribe() {
+	if (events) {
+		events.close();
+	}
+
+	events = new EventSource("/v1beta1/events");
+	for (const type of eventTypes) {
+		events.addEventListener(type, (message) => {
+			const event = JSON.parse(message.data);
+			addActivity(event);
+
+			if (type.startsWith("safeword.")) {
+				refreshSafewords();
+			}
+		});
+	}
+}
+
+function addActivity(event) {
+	const parts = [new Date(event.time).toLocaleTimeString(), event.type];
+	if (event.device || (event.data && event.data.device)) {
+		parts.push(event.device || event.data.device);
+	} else if (event.channel) {
+		parts.push("channel " + event.channel);
+	}
+	if (event.data && event.data.operation) {
+		parts.push(event.data.operation + (event.data.intensity ? " " + event.data.intensity : ""));
+	}
+	if (event.keyLabel) {
+		parts.push("by " + event.keyLabel);
+	}
+	if (event.error) {
+		parts.push("(" + event.error + ")");
+	}
+
+	const item = document.createElement("li");
+	item.textContent = parts.join(" ");
+	item.className = event.type.replace(".", "-");
+
+	const list = $("activity");
+	list.prepend(item);
+	while (list.children.length > maxActivity) {
+		list.lastChild.remove();
+	}
+}
+
+$("login").addEventListener("submit", (e) => {
+	e.preventDefault();
+
+	run(async () => {
+		loggedIn(await request("POST", "/ui/login", {key: $("key").value}));
+		$("key").value = "";
+		show("");
+	});
+});
+
+$("logout").addEventListener("click", () => run(async () => {
+	await request("POST", "/ui/logout");
+	loggedOut();
+	show("logged out");
+}));
+
+$("stop").addEventListener("click", () => run(async () => {
+	await request("POST", "/v1alpha1/stop/-");
+	show("stopped everything");
+}));
+
+$("safeword-mode").addEventListener("change", () => {
+	$("safeword-max").hidden = $("safeword-mode").value !== "limit";
+});
+
+$("safeword-set").addEventListener("click", () => run(async () => {
+	const query = new URLSearchParams({mode: $("safeword-mode").value});
+	if (query.get("mode") === "limit") {
+		query.set("max-intensity", $("safeword-max").value);
+	}
+
+	await request("POST", "/v1alpha1/safeword?" + query);
+	await refreshSafewords();
+	show("safeword set");
+}));
+
+$("safeword-lift").addEventListener("click", () => run(async () => {
+	await request("DELETE", "/v1alpha1/safeword");
+	await refreshSafewords();
+	show("safeword lifted");
+}));
+
+fetch("/ui/login", {credentials: "same-origin"}).then(async (res) => {
+	if (res.ok) {
+		loggedIn(await res.json());
+	} else {
+		loggedOut();
+	}
+}, loggedOut);
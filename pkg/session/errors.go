@@ -0,0 +1,25 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+)
+
+var (
+	// ErrNoSession is returned for Commands of keys not in an active
+	// Session, when Sessions are required.
+	ErrNoSession = fmt.Errorf("%w: no active session", auth.ErrForbidden)
+
+	// ErrSessionLimit is returned for Commands exceeding the Limits of
+	// their Session.
+	ErrSessionLimit = fmt.Errorf("%w: session limit", auth.ErrForbidden)
+
+	// ErrUnknownSession is returned when a Session is not known.
+	ErrUnknownSession = errors.New("unknown session")
+
+	// ErrInvalidSession is returned when opening a Session that makes no
+	// sense, like one ending before it starts.
+	ErrInvalidSession = errors.New("invalid session")
+)
@@ -0,0 +1,416 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Manager keeps the Sessions, persists them to a file and checks Commands
+// against them.
+type Manager struct {
+	path     string
+	keys     *auth.Store
+	clock    clock.Clock
+	required bool
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewManager creates a Manager persisting its Sessions to the given file,
+// loading the Sessions already in it. Invite keys are created in the given
+// Store. If required is set, only keys in an active Session may send
+// Commands, otherwise keys not participating in any Session are not limited
+// by Sessions. Participants may only send Commands in an active Session, even
+// after all their Sessions closed.
+func NewManager(path string, keys *auth.Store, c clock.Clock, required bool) (*Manager, error) {
+	m := &Manager{
+		path:     path,
+		keys:     keys,
+		clock:    c,
+		required: required,
+		sessions: make(map[string]*Session),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading sessions: %w", err)
+	}
+
+	sessions := make([]*Session, 0)
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("error parsing sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		m.sessions[session.ID] = session
+	}
+
+	return m, nil
+}
+
+// Open opens a Session for the given wearer key, from start until end, with
+// the given participants (key IDs) and Limits. For invites greater than zero,
+// that many keys valid only during the Session are created and added as
+// participants, returning the API keys to hand out. Wearer keys limited to
+// some devices open Sessions for those only: invites are limited to them
+// and participants have to be limited to them as well.
+func (m *Manager) Open(wearer auth.Key, start, end time.Time, participants []string, invites int, limits Limits) (Session, []string, error) {
+	if !end.After(start) {
+		return Session{}, nil, fmt.Errorf("%w: ends before it starts", ErrInvalidSession)
+	}
+
+	if !end.After(m.clock.Now()) {
+		return Session{}, nil, fmt.Errorf("%w: ends in the past", ErrInvalidSession)
+	}
+
+	if len(participants) == 0 && invites <= 0 {
+		return Session{}, nil, fmt.Errorf("%w: no participants", ErrInvalidSession)
+	}
+
+	devices := append([]string(nil), wearer.Policy.Devices...)
+	for _, participant := range participants {
+		key, err := m.keys.Lookup(participant)
+		if err != nil {
+			return Session{}, nil, fmt.Errorf("%w: participant: %v", ErrInvalidSession, err)
+		}
+
+		if len(devices) > 0 && !wears(devices, key.Policy.Devices) {
+			return Session{}, nil, fmt.Errorf("%w: participant %s may send to devices not worn by %s", ErrInvalidSession, participant, wearer.ID)
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Session{}, nil, err
+	}
+
+	session := &Session{
+		ID:           id,
+		KeyID:        wearer.ID,
+		Start:        start,
+		End:          end,
+		Participants: append([]string(nil), participants...),
+		Devices:      devices,
+		Limits:       limits,
+	}
+
+	apiKeys := make([]string, 0, invites)
+	for i := 0; i < invites; i++ {
+		apiKey, key, err := m.keys.Create(auth.Key{
+			Label:   fmt.Sprintf("session %s invite %d", id, i+1),
+			Expires: &end,
+			Policy:  auth.Policy{ValidFrom: &start, Devices: devices},
+		})
+		if err != nil {
+			m.revokeInvites(session)
+			return Session{}, nil, err
+		}
+
+		apiKeys = append(apiKeys, apiKey)
+		session.Invites = append(session.Invites, key.ID)
+		session.Participants = append(session.Participants, key.ID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[id] = session
+	if err := m.saveLocked(); err != nil {
+		delete(m.sessions, id)
+		m.revokeInvites(session)
+		return Session{}, nil, err
+	}
+
+	return *session, apiKeys, nil
+}
+
+// wears returns if all the given allowed devices are among the worn ones,
+// none allowed meaning all of them.
+func wears(worn, allowed []string) bool {
+	if len(allowed) == 0 {
+		return false
+	}
+
+	for _, name := range allowed {
+		found := false
+		for _, w := range worn {
+			found = found || w == name
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Close closes the Session with the given ID, if it is not closed already.
+func (m *Manager) Close(id, reason string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return Session{}, fmt.Errorf("%w: %q", ErrUnknownSession, id)
+	}
+
+	if session.Closed == nil {
+		m.closeLocked(session, m.clock.Now(), reason)
+		if err := m.saveLocked(); err != nil {
+			return Session{}, err
+		}
+	}
+
+	return *session, nil
+}
+
+// Get returns the Session with the given ID.
+func (m *Manager) Get(id string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closeDoneLocked()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return Session{}, fmt.Errorf("%w: %q", ErrUnknownSession, id)
+	}
+
+	return *session, nil
+}
+
+// Sessions returns all Sessions the key with the given ID opened or
+// participates in, or all Sessions for an empty ID, ordered by their start
+// time.
+func (m *Manager) Sessions(keyID string) []Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closeDoneLocked()
+
+	ret := make([]Session, 0)
+	for _, session := range m.sessions {
+		if keyID == "" || session.KeyID == keyID || session.participant(keyID) {
+			ret = append(ret, *session)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Start.Before(ret[j].Start)
+	})
+
+	return ret
+}
+
+// Check returns the error Use would return, without using anything of the
+// budget of the Session.
+func (m *Manager) Check(keyID, dev string, op types.Operation, intensity types.Intensity, duration time.Duration) error {
+	return m.apply(keyID, dev, op, intensity, duration, false)
+}
+
+// Use checks the given Operation with the given Intensity, held for the given
+// duration, sent by the key with the given ID to the device with the given
+// name (empty if none is named) against the active Session the key is in
+// and takes it from the budget of the Session. The Session is closed when
+// its budget is used up.
+func (m *Manager) Use(keyID, dev string, op types.Operation, intensity types.Intensity, duration time.Duration) error {
+	return m.apply(keyID, dev, op, intensity, duration, true)
+}
+
+func (m *Manager) apply(keyID, dev string, op types.Operation, intensity types.Intensity, duration time.Duration, use bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closeDoneLocked()
+
+	session := m.activeLocked(keyID)
+	if session == nil {
+		if m.required {
+			return ErrNoSession
+		}
+
+		// keys invited to a Session stay bound to Sessions, using up the
+		// budget must not lift all limits
+		if bound := m.boundLocked(keyID); bound != nil {
+			return fmt.Errorf("%w: key participates in session %s, which is %s", ErrNoSession, bound.ID, bound.state(m.clock.Now()))
+		}
+
+		return nil
+	}
+
+	if !session.allows(dev) {
+		if dev == "" {
+			return fmt.Errorf("%w devices of session %s: %v not allowed without naming a device", ErrSessionLimit, session.ID, op)
+		}
+
+		return fmt.Errorf("%w devices of session %s: device %s not allowed", ErrSessionLimit, session.ID, dev)
+	}
+
+	limits := session.Limits
+	if limits.MaxIntensity > 0 && intensity > limits.MaxIntensity {
+		return fmt.Errorf("%w max-intensity of session %s: %v with intensity %v requested, maximum is %v", ErrSessionLimit, session.ID, op, intensity, limits.MaxIntensity)
+	}
+
+	if op != types.OperationShock {
+		return nil
+	}
+
+	if limits.MaxShocks > 0 && session.Used.Shocks+1 > limits.MaxShocks {
+		return fmt.Errorf("%w max-shocks of session %s: all %d shocks used", ErrSessionLimit, session.ID, limits.MaxShocks)
+	}
+
+	t := shockTime(duration)
+	if limits.MaxShockTime > 0 && session.Used.ShockTime+t > limits.MaxShockTime {
+		return fmt.Errorf("%w max-shock-time of session %s: %v requested, %v of %v left", ErrSessionLimit, session.ID, t, limits.MaxShockTime-session.Used.ShockTime, limits.MaxShockTime)
+	}
+
+	if !use {
+		return nil
+	}
+
+	session.Used.Shocks++
+	session.Used.ShockTime += t
+
+	if session.usedUp() {
+		m.closeLocked(session, m.clock.Now(), "budget used up")
+	}
+
+	if err := m.saveLocked(); err != nil {
+		log.Printf("session: %v", err)
+	}
+
+	return nil
+}
+
+// activeLocked returns the first active Session the key with the given ID
+// participates in, nil if there is none. m.mu has to be locked.
+func (m *Manager) activeLocked(keyID string) *Session {
+	now := m.clock.Now()
+
+	var ret *Session
+	for _, session := range m.sessions {
+		if session.Active(now) && session.participant(keyID) && (ret == nil || session.Start.Before(ret.Start)) {
+			ret = session
+		}
+	}
+
+	return ret
+}
+
+// boundLocked returns a Session the key with the given ID participates in,
+// active or not, nil if there is none. m.mu has to be locked.
+func (m *Manager) boundLocked(keyID string) *Session {
+	for _, session := range m.sessions {
+		if session.participant(keyID) {
+			return session
+		}
+	}
+
+	return nil
+}
+
+// closeDoneLocked closes all Sessions past their end. m.mu has to be locked.
+func (m *Manager) closeDoneLocked() {
+	now := m.clock.Now()
+
+	changed := false
+	for _, session := range m.sessions {
+		if session.Closed == nil && !now.Before(session.End) {
+			m.closeLocked(session, session.End, "expired")
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := m.saveLocked(); err != nil {
+			log.Printf("session: %v", err)
+		}
+	}
+}
+
+// closeLocked closes the given Session, expiring its invite keys. m.mu has to
+// be locked.
+func (m *Manager) closeLocked(session *Session, at time.Time, reason string) {
+	session.Closed = &at
+	session.CloseReason = reason
+
+	for _, id := range session.Invites {
+		if _, err := m.keys.Expire(id, at); err != nil {
+			log.Printf("session: error expiring invite key %s: %v", id, err)
+		}
+	}
+}
+
+// revokeInvites revokes the invite keys of a Session failed to open.
+func (m *Manager) revokeInvites(session *Session) {
+	for _, id := range session.Invites {
+		if _, err := m.keys.Revoke(id); err != nil {
+			log.Printf("session: error revoking invite key %s: %v", id, err)
+		}
+	}
+}
+
+// saveLocked writes all Sessions to the sessions file, m.mu has to be locked.
+func (m *Manager) saveLocked() error {
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding sessions: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing sessions: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing sessions: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing sessions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), m.path); err != nil {
+		return fmt.Errorf("error writing sessions: %w", err)
+	}
+
+	return nil
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,195 @@
+package session_test
+
+import (
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/auth"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/session"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("Manager", func() {
+	var (
+		dir     string
+		fake    *clock.Fake
+		keys    *auth.Store
+		alice   auth.Key
+		bob     auth.Key
+		manager *session.Manager
+	)
+
+	wearer := auth.Key{ID: "wearer", Wearer: true}
+
+	newManager := func(required bool) *session.Manager {
+		m, err := session.NewManager(filepath.Join(dir, "sessions.json"), keys, fake, required)
+		Expect(err).NotTo(HaveOccurred())
+		return m
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		dir = GinkgoT().TempDir()
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+
+		keys, err = auth.OpenStore(filepath.Join(dir, "keys.json"), fake)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, alice, err = keys.Create(auth.Key{Label: "alice"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, bob, err = keys.Create(auth.Key{Label: "bob"})
+		Expect(err).NotTo(HaveOccurred())
+
+		manager = newManager(true)
+	})
+
+	It("only accepts commands inside an active session when required", func() {
+		Expect(manager.Check(alice.ID, "", types.OperationBeep, 0, 0)).To(MatchError(session.ErrNoSession))
+		Expect(newManager(false).Check(alice.ID, "", types.OperationBeep, 0, 0)).To(Succeed())
+
+		_, _, err := manager.Open(wearer, fake.Now().Add(time.Hour), fake.Now().Add(2*time.Hour), []string{alice.ID}, 0, session.Limits{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manager.Check(alice.ID, "", types.OperationBeep, 0, 0)).To(MatchError(session.ErrNoSession))
+
+		fake.Advance(time.Hour)
+		Expect(manager.Check(alice.ID, "", types.OperationBeep, 0, 0)).To(Succeed())
+		Expect(manager.Check(bob.ID, "", types.OperationBeep, 0, 0)).To(MatchError(session.ErrNoSession))
+
+		fake.Advance(time.Hour)
+		Expect(manager.Check(alice.ID, "", types.OperationBeep, 0, 0)).To(MatchError(session.ErrNoSession))
+		Expect(manager.Sessions("")).To(ConsistOf(HaveField("CloseReason", "expired")))
+	})
+
+	It("keeps limiting participants after their session closed when not required", func() {
+		manager = newManager(false)
+
+		_, _, err := manager.Open(wearer, fake.Now().Add(time.Hour), fake.Now().Add(2*time.Hour), []string{alice.ID}, 0, session.Limits{MaxShocks: 1})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manager.Check(alice.ID, "", types.OperationBeep, 0, 0)).To(MatchError(ContainSubstring("not started yet")))
+		Expect(manager.Check(bob.ID, "", types.OperationShock, 100, 0)).To(Succeed())
+
+		fake.Advance(time.Hour)
+		Expect(manager.Use(alice.ID, "", types.OperationShock, 10, 0)).To(Succeed())
+
+		err = manager.Use(alice.ID, "", types.OperationShock, 100, 0)
+		Expect(err).To(MatchError(session.ErrNoSession))
+		Expect(err).To(MatchError(ContainSubstring("budget used up")))
+		Expect(manager.Check(bob.ID, "", types.OperationShock, 100, 0)).To(Succeed())
+	})
+
+	It("applies the intensity ceiling", func() {
+		_, _, err := manager.Open(wearer, fake.Now(), fake.Now().Add(time.Hour), []string{alice.ID}, 0, session.Limits{MaxIntensity: 30})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manager.Use(alice.ID, "", types.OperationVibrate, 30, 0)).To(Succeed())
+
+		err = manager.Use(alice.ID, "", types.OperationVibrate, 31, 0)
+		Expect(err).To(MatchError(session.ErrSessionLimit))
+		Expect(err).To(MatchError(auth.ErrForbidden))
+		Expect(err).To(MatchError(ContainSubstring("max-intensity")))
+	})
+
+	It("closes when the shocks are used up", func() {
+		s, _, err := manager.Open(wearer, fake.Now(), fake.Now().Add(time.Hour), []string{alice.ID, bob.ID}, 0, session.Limits{MaxShocks: 2})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manager.Use(alice.ID, "", types.OperationShock, 10, 0)).To(Succeed())
+		Expect(manager.Check(bob.ID, "", types.OperationShock, 10, 0)).To(Succeed())
+		Expect(manager.Use(bob.ID, "", types.OperationShock, 10, 0)).To(Succeed())
+
+		Expect(manager.Use(alice.ID, "", types.OperationVibrate, 10, 0)).To(MatchError(session.ErrNoSession))
+
+		s, err = manager.Get(s.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Used.Shocks).To(Equal(2))
+		Expect(s.CloseReason).To(Equal("budget used up"))
+	})
+
+	It("counts shock-seconds", func() {
+		_, _, err := manager.Open(wearer, fake.Now(), fake.Now().Add(time.Hour), []string{alice.ID}, 0, session.Limits{MaxShockTime: 3 * time.Second})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(manager.Use(alice.ID, "", types.OperationShock, 10, 1500*time.Millisecond)).To(Succeed())
+		Expect(manager.Use(alice.ID, "", types.OperationShock, 10, 0)).To(Succeed())
+
+		err = manager.Use(alice.ID, "", types.OperationShock, 10, time.Second)
+		Expect(err).To(MatchError(ContainSubstring("max-shock-time")))
+
+		Expect(manager.Use(alice.ID, "", types.OperationShock, 10, 500*time.Millisecond)).To(Succeed())
+		Expect(manager.Use(alice.ID, "", types.OperationBeep, 0, 0)).To(MatchError(session.ErrNoSession))
+	})
+
+	It("creates invite keys valid only during the session", func() {
+		s, inviteKeys, err := manager.Open(wearer, fake.Now().Add(time.Minute), fake.Now().Add(time.Hour), nil, 2, session.Limits{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inviteKeys).To(HaveLen(2))
+		Expect(s.Participants).To(Equal(s.Invites))
+
+		invite, err := keys.Authenticate(inviteKeys[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(invite.Policy.Check(fake.Now(), "", types.Channel1, types.OperationBeep, 0, 0)).To(MatchError(auth.ErrForbidden))
+
+		fake.Advance(time.Minute)
+		Expect(manager.Check(invite.ID, "", types.OperationBeep, 0, 0)).To(Succeed())
+
+		_, err = manager.Close(s.ID, "closed by wearer")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = keys.Authenticate(inviteKeys[1])
+		Expect(err).To(MatchError(auth.ErrKeyExpired))
+	})
+
+	It("limits sessions to the devices of the wearer opening them", func() {
+		alexWearer := auth.Key{ID: "alex", Wearer: true, Policy: auth.Policy{Devices: []string{"alex-collar"}}}
+
+		_, carol, err := keys.Create(auth.Key{Label: "carol", Policy: auth.Policy{Devices: []string{"alex-collar"}}})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = manager.Open(alexWearer, fake.Now(), fake.Now().Add(time.Hour), []string{alice.ID}, 0, session.Limits{})
+		Expect(err).To(MatchError(session.ErrInvalidSession))
+
+		s, inviteKeys, err := manager.Open(alexWearer, fake.Now(), fake.Now().Add(time.Hour), []string{carol.ID}, 1, session.Limits{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.Devices).To(Equal([]string{"alex-collar"}))
+
+		invite, err := keys.Authenticate(inviteKeys[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(invite.Policy.Devices).To(Equal([]string{"alex-collar"}))
+		Expect(keys.Authorize(invite.ID, "sam-collar", types.Channel1, types.OperationBeep, 0, 0)).To(MatchError(auth.ErrForbidden))
+
+		for _, id := range []string{carol.ID, invite.ID} {
+			Expect(manager.Check(id, "alex-collar", types.OperationBeep, 0, 0)).To(Succeed())
+			Expect(manager.Check(id, "sam-collar", types.OperationBeep, 0, 0)).To(MatchError(session.ErrSessionLimit))
+			Expect(manager.Use(id, "", types.OperationBeep, 0, 0)).To(MatchError(session.ErrSessionLimit))
+		}
+	})
+
+	It("persists sessions with their usage", func() {
+		_, _, err := manager.Open(wearer, fake.Now(), fake.Now().Add(time.Hour), []string{alice.ID}, 0, session.Limits{MaxShocks: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manager.Use(alice.ID, "", types.OperationShock, 10, 0)).To(Succeed())
+
+		reopened := newManager(true)
+		Expect(reopened.Use(alice.ID, "", types.OperationShock, 10, 0)).To(Succeed())
+		Expect(reopened.Use(alice.ID, "", types.OperationShock, 10, 0)).To(MatchError(session.ErrNoSession))
+	})
+
+	DescribeTable("rejects invalid sessions",
+		func(start, end time.Duration, participants []string, invites int) {
+			now := fake.Now()
+			_, _, err := manager.Open(wearer, now.Add(start), now.Add(end), participants, invites, session.Limits{})
+			Expect(err).To(MatchError(session.ErrInvalidSession))
+		},
+		Entry("ending before start", time.Hour, time.Minute, []string{"x"}, 0),
+		Entry("in the past", -time.Hour, -time.Minute, nil, 1),
+		Entry("without participants", time.Duration(0), time.Hour, nil, 0),
+		Entry("with unknown participants", time.Duration(0), time.Hour, []string{"unknown"}, 0),
+	)
+})
@@ -0,0 +1,114 @@
+package session
+
+import (
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// UnheldShockTime is what a shock not held for a given duration counts
+// against the MaxShockTime of a Session.
+const UnheldShockTime = time.Second
+
+// Limits are the budget of a Session, shared by all its participants. Zero
+// values mean "not limited".
+type Limits struct {
+	MaxShocks    int             `json:"maxShocks,omitempty"`
+	MaxShockTime time.Duration   `json:"maxShockTime,omitempty"`
+	MaxIntensity types.Intensity `json:"maxIntensity,omitempty"`
+}
+
+// Usage is how much of the budget of a Session is used.
+type Usage struct {
+	Shocks    int           `json:"shocks"`
+	ShockTime time.Duration `json:"shockTime"`
+}
+
+// Session is a time window opened by the wearer, in which the invited
+// participants may send Commands within the Limits of the Session.
+type Session struct {
+	ID    string `json:"id"`
+	KeyID string `json:"keyId"`
+
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Participants are the IDs of the keys allowed to send Commands,
+	// including the keys generated as invites.
+	Participants []string `json:"participants"`
+	Invites      []string `json:"invites,omitempty"`
+
+	// Devices are the names of the devices Commands may be sent to in the
+	// Session, those worn by the key opening it. Empty if it wears all of
+	// them.
+	Devices []string `json:"devices,omitempty"`
+
+	Limits Limits `json:"limits"`
+	Used   Usage  `json:"used"`
+
+	Closed      *time.Time `json:"closed,omitempty"`
+	CloseReason string     `json:"closeReason,omitempty"`
+}
+
+// Active returns if the Session accepts Commands at the given time.
+func (s Session) Active(now time.Time) bool {
+	return s.Closed == nil && !now.Before(s.Start) && now.Before(s.End)
+}
+
+// state describes why the Session does not accept Commands at the given
+// time, if it does not.
+func (s Session) state(now time.Time) string {
+	switch {
+	case s.Closed != nil && s.CloseReason != "":
+		return "closed: " + s.CloseReason
+	case s.Closed != nil:
+		return "closed"
+	case now.Before(s.Start):
+		return "not started yet"
+	default:
+		return "active"
+	}
+}
+
+// participant returns if the key with the given ID is invited.
+func (s Session) participant(keyID string) bool {
+	for _, id := range s.Participants {
+		if id == keyID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allows returns if Commands may be sent to the device with the given name
+// in the Session, empty for Commands not naming a device.
+func (s Session) allows(dev string) bool {
+	if len(s.Devices) == 0 {
+		return true
+	}
+
+	for _, name := range s.Devices {
+		if name == dev {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usedUp returns if nothing more can be shocked in the Session.
+func (s Session) usedUp() bool {
+	return (s.Limits.MaxShocks > 0 && s.Used.Shocks >= s.Limits.MaxShocks) ||
+		(s.Limits.MaxShockTime > 0 && s.Used.ShockTime >= s.Limits.MaxShockTime)
+}
+
+// shockTime returns what a shock held for the given duration counts against
+// the MaxShockTime of a Session.
+func shockTime(duration time.Duration) time.Duration {
+	if duration <= 0 {
+		return UnheldShockTime
+	}
+
+	return duration
+}
@@ -0,0 +1,159 @@
+package transmit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDutyCycleWindow is the window on-air time is tracked over when not
+// configured otherwise, the one of the duty cycle limits of the 433 MHz ISM
+// band in the EU.
+const DefaultDutyCycleWindow = time.Hour
+
+// DutyCycle limits the share of time a transmitter is on air, tracked over a
+// sliding Window. Only transmitters with an AirtimeDriver are limited.
+type DutyCycle struct {
+	// Budget is the share of the Window the transmitter may be on air,
+	// like 0.01 for 1 %. 0 does not limit it.
+	Budget float64
+
+	// Window is the sliding window on-air time is tracked over,
+	// DefaultDutyCycleWindow if 0.
+	Window time.Duration
+
+	// MaxDelay is the longest a Job is held back until enough of the
+	// Budget is free again. Jobs needing to wait longer are rejected with
+	// ErrDutyCycleExceeded.
+	MaxDelay time.Duration
+}
+
+// String returns a string representation of the DutyCycle, in the format
+// Set parses.
+func (d DutyCycle) String() string {
+	if d.Budget == 0 {
+		return ""
+	}
+
+	ret := fmt.Sprintf("%s%%/%v", strconv.FormatFloat(d.Budget*100, 'f', -1, 64), d.window())
+	if d.MaxDelay > 0 {
+		ret += fmt.Sprintf(",delay=%v", d.MaxDelay)
+	}
+
+	return ret
+}
+
+// Set parses a DutyCycle in the format "budget/window[,delay=duration]",
+// budget being a percentage like "1%" or a share like "0.01", e.g.
+// "10%/1h,delay=5s".
+func (d *DutyCycle) Set(s string) error {
+	limit, delay, hasDelay := strings.Cut(s, ",")
+	budgetString, windowString, ok := strings.Cut(limit, "/")
+	if !ok {
+		return fmt.Errorf("%w: duty cycle %q is not in budget/window format", ErrInvalidDutyCycle, s)
+	}
+
+	ret := DutyCycle{}
+
+	var err error
+	if percentage, ok := strings.CutSuffix(budgetString, "%"); ok {
+		ret.Budget, err = strconv.ParseFloat(percentage, 64)
+		ret.Budget /= 100
+	} else {
+		ret.Budget, err = strconv.ParseFloat(budgetString, 64)
+	}
+
+	if err != nil || !(ret.Budget > 0 && ret.Budget <= 1) {
+		return fmt.Errorf("%w: budget %q is not above 0 and up to 100%%", ErrInvalidDutyCycle, budgetString)
+	}
+
+	if ret.Window, err = time.ParseDuration(windowString); err != nil || ret.Window <= 0 {
+		return fmt.Errorf("%w: window %q is not a positive duration", ErrInvalidDutyCycle, windowString)
+	}
+
+	if hasDelay {
+		value, ok := strings.CutPrefix(delay, "delay=")
+		if ret.MaxDelay, err = time.ParseDuration(value); !ok || err != nil || ret.MaxDelay < 0 {
+			return fmt.Errorf("%w: %q is not in delay=duration format", ErrInvalidDutyCycle, delay)
+		}
+	}
+
+	*d = ret
+	return nil
+}
+
+func (d DutyCycle) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *DutyCycle) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+func (d DutyCycle) window() time.Duration {
+	if d.Window <= 0 {
+		return DefaultDutyCycleWindow
+	}
+
+	return d.Window
+}
+
+// budget returns the on-air time allowed in the Window, 0 if not limited.
+func (d DutyCycle) budget() time.Duration {
+	return time.Duration(d.Budget * float64(d.window()))
+}
+
+// airtimeLog tracks the on-air time of the transmissions started in a
+// sliding window, each counted at its start.
+type airtimeLog struct {
+	window  time.Duration
+	entries []airtimeEntry
+	used    time.Duration
+}
+
+type airtimeEntry struct {
+	start   time.Time
+	airtime time.Duration
+}
+
+// prune forgets the transmissions started before the window ending at now.
+func (l *airtimeLog) prune(now time.Time) {
+	i := 0
+	for ; i < len(l.entries) && !l.entries[i].start.Add(l.window).After(now); i++ {
+		l.used -= l.entries[i].airtime
+	}
+
+	l.entries = l.entries[i:]
+}
+
+// add records a transmission with the given on-air time started at now.
+func (l *airtimeLog) add(now time.Time, airtime time.Duration) {
+	l.prune(now)
+	l.entries = append(l.entries, airtimeEntry{start: now, airtime: airtime})
+	l.used += airtime
+}
+
+// usedAt returns the on-air time in the window ending at now.
+func (l *airtimeLog) usedAt(now time.Time) time.Duration {
+	l.prune(now)
+	return l.used
+}
+
+// wait returns how long from now to wait until the given on-air time fits
+// into the given budget, which it has to be below of.
+func (l *airtimeLog) wait(now time.Time, airtime, budget time.Duration) time.Duration {
+	excess := l.usedAt(now) + airtime - budget
+	for _, e := range l.entries {
+		if excess <= 0 {
+			break
+		}
+
+		excess -= e.airtime
+		if excess <= 0 {
+			return e.start.Add(l.window).Sub(now)
+		}
+	}
+
+	return 0
+}
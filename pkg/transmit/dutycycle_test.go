@@ -0,0 +1,174 @@
+package transmit_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// airtimeDriver is a countingDriver with every frame on air for 100ms.
+type airtimeDriver struct {
+	countingDriver
+}
+
+func (d *airtimeDriver) OutputRepeated(ctx context.Context, m *types.Message, r driver.Repetition) error {
+	return driver.OutputRepeated(ctx, d, m, r.Or(driver.Repetition{Count: 1}))
+}
+
+func (d *airtimeDriver) OutputInterleaved(ctx context.Context, ms []*types.Message, r driver.Repetition) error {
+	return driver.OutputInterleaved(ctx, d, ms, r.Or(driver.Repetition{Count: 1}))
+}
+
+func (d *airtimeDriver) Length(ms []*types.Message, r driver.Repetition) time.Duration {
+	return driver.Length(func(*types.Message) time.Duration { return 100 * time.Millisecond }, ms, r.Or(driver.Repetition{Count: 1}))
+}
+
+func (d *airtimeDriver) Airtime(ms []*types.Message, r driver.Repetition) time.Duration {
+	return driver.Airtime(func(*types.Message) time.Duration { return 100 * time.Millisecond }, ms, r.Or(driver.Repetition{Count: 1}))
+}
+
+var _ = Describe("DutyCycle", func() {
+	DescribeTable("parses and formats duty cycles",
+		func(s string, expected transmit.DutyCycle, formatted string) {
+			var d transmit.DutyCycle
+			Expect(d.Set(s)).To(Succeed())
+			Expect(d).To(Equal(expected))
+			Expect(d.String()).To(Equal(formatted))
+		},
+		Entry("percentage", "1%/1h", transmit.DutyCycle{Budget: 0.01, Window: time.Hour}, "1%/1h0m0s"),
+		Entry("share", "0.1/10s", transmit.DutyCycle{Budget: 0.1, Window: 10 * time.Second}, "10%/10s"),
+		Entry("delay", "10%/1h,delay=5s", transmit.DutyCycle{Budget: 0.1, Window: time.Hour, MaxDelay: 5 * time.Second}, "10%/1h0m0s,delay=5s"),
+	)
+
+	DescribeTable("rejects invalid duty cycles",
+		func(s string) {
+			var d transmit.DutyCycle
+			Expect(d.Set(s)).To(MatchError(transmit.ErrInvalidDutyCycle))
+		},
+		Entry("no window", "1%"),
+		Entry("zero budget", "0%/1h"),
+		Entry("budget above 100 %", "120%/1h"),
+		Entry("invalid window", "1%/often"),
+		Entry("invalid delay", "1%/1h,wait=5s"),
+	)
+})
+
+var _ = Describe("Scheduler duty cycle", func() {
+	var (
+		drv             *airtimeDriver
+		fake            *clock.Fake
+		instrumentation *recordingInstrumentation
+		scheduler       *transmit.Scheduler
+	)
+
+	start := func(maxDelay time.Duration) {
+		scheduler = transmit.NewScheduler("test", drv, transmit.Config{
+			DutyCycle:       transmit.DutyCycle{Budget: 0.1, Window: 10 * time.Second, MaxDelay: maxDelay},
+			Clock:           fake,
+			Instrumentation: instrumentation,
+		})
+	}
+
+	BeforeEach(func() {
+		drv = &airtimeDriver{}
+		instrumentation = &recordingInstrumentation{}
+		fake = clock.NewFake(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	})
+
+	AfterEach(func() {
+		scheduler.Close()
+	})
+
+	job := func(frames int) transmit.Job {
+		return transmit.Job{
+			Message:    message(types.OperationVibrate),
+			Repetition: driver.Repetition{Count: frames},
+		}
+	}
+
+	It("tracks the time on air", func() {
+		start(0)
+
+		Expect(scheduler.Submit(context.Background(), job(3))).To(Succeed())
+		fake.Advance(time.Second)
+		Expect(scheduler.Submit(context.Background(), transmit.Job{
+			Message:     message(types.OperationVibrate),
+			Interleaved: []*types.Message{message(types.OperationBeep)},
+			Repetition:  driver.Repetition{Count: 2},
+		})).To(Succeed())
+
+		stats := scheduler.Stats()
+		Expect(stats.Airtime).To(Equal(700 * time.Millisecond))
+		Expect(stats.AirtimeBudget).To(Equal(time.Second))
+		Expect(stats.DutyCycle).To(BeNumerically("~", 0.07))
+
+		fake.Advance(9 * time.Second)
+		stats = scheduler.Stats()
+		Expect(stats.Airtime).To(Equal(400 * time.Millisecond))
+		Expect(stats.TotalAirtime).To(Equal(700 * time.Millisecond))
+		Expect(instrumentation.Airtime()).To(Equal(700 * time.Millisecond))
+	})
+
+	It("rejects jobs exceeding the budget", func() {
+		start(0)
+
+		Expect(scheduler.Submit(context.Background(), job(6))).To(Succeed())
+		fake.Advance(2 * time.Second)
+
+		err := scheduler.Submit(context.Background(), job(5))
+		Expect(err).To(MatchError(transmit.ErrDutyCycleExceeded))
+
+		var dutyCycleErr *transmit.DutyCycleError
+		Expect(errors.As(err, &dutyCycleErr)).To(BeTrue())
+		Expect(dutyCycleErr.RetryAfter).To(Equal(8 * time.Second))
+		Expect(scheduler.Stats().Rejected).To(BeEquivalentTo(1))
+
+		Expect(scheduler.Submit(context.Background(), job(4))).To(Succeed())
+
+		fake.Advance(8 * time.Second)
+		Expect(scheduler.Submit(context.Background(), job(5))).To(Succeed())
+		Expect(drv.Sent()).To(Equal(15))
+	})
+
+	It("delays jobs until the budget is free again", func() {
+		start(time.Minute)
+
+		Expect(scheduler.Submit(context.Background(), job(10))).To(Succeed())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- scheduler.Submit(context.Background(), job(1))
+		}()
+
+		Eventually(fake.Timers).Should(Equal(1))
+		Consistently(done).ShouldNot(Receive())
+
+		fake.Advance(10 * time.Second)
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(scheduler.Stats().Delayed).To(BeEquivalentTo(1))
+	})
+
+	It("rejects jobs that can never fit into the budget", func() {
+		start(time.Hour)
+
+		Expect(scheduler.Check(job(11))).To(MatchError(transmit.ErrDurationExceeded))
+		Expect(drv.Sent()).To(BeZero())
+	})
+
+	It("does not limit drivers not knowing their time on air", func() {
+		scheduler = transmit.NewScheduler("test", driver.Repeating(&countingDriver{}, driver.Repetition{Count: 1}), transmit.Config{
+			DutyCycle: transmit.DutyCycle{Budget: 0.01, Window: time.Second},
+			Clock:     fake,
+		})
+
+		Expect(scheduler.Submit(context.Background(), job(100))).To(Succeed())
+		Expect(scheduler.Stats().Airtime).To(BeZero())
+	})
+})
@@ -0,0 +1,67 @@
+package transmit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var (
+	// ErrQueueFull is returned when a job is submitted to a Scheduler with
+	// its queue already at capacity.
+	ErrQueueFull = errors.New("transmit queue full")
+
+	// ErrStopped is returned for jobs discarded by Scheduler.Stop before
+	// they were transmitted completely.
+	ErrStopped = errors.New("transmission stopped")
+
+	// ErrClosed is returned when submitting jobs to a closed Scheduler and
+	// for jobs still queued when a Scheduler is closed.
+	ErrClosed = errors.New("transmit scheduler closed")
+
+	// ErrDurationExceeded is returned when a Job requests a longer duration
+	// than allowed for its Operation or is on air for longer than the whole
+	// DutyCycle budget.
+	ErrDurationExceeded = errors.New("maximum duration exceeded")
+
+	// ErrRejected is matched by the errors of checks set with WithCheck
+	// rejecting a Job when the worker is about to transmit it.
+	ErrRejected = errors.New("rejected before transmitting")
+
+	// ErrInvalidJob is returned when submitting a Job without valid Message.
+	ErrInvalidJob = errors.New("invalid job")
+
+	// ErrUnknownTransmitter is returned for Jobs sent on a transmitter a
+	// Router does not know.
+	ErrUnknownTransmitter = errors.New("unknown transmitter")
+
+	// ErrInvalidTransmitter is returned when creating a Router with
+	// transmitters that make no sense.
+	ErrInvalidTransmitter = errors.New("invalid transmitter")
+
+	// ErrDutyCycleExceeded is returned for Jobs that would keep a
+	// transmitter on air for longer than its DutyCycle allows.
+	ErrDutyCycleExceeded = errors.New("duty cycle exceeded")
+
+	// ErrInvalidDutyCycle is returned when parsing a DutyCycle that makes
+	// no sense.
+	ErrInvalidDutyCycle = fmt.Errorf("%w: invalid duty cycle", types.ErrUnparsable)
+)
+
+// DutyCycleError is returned when a Job would exceed the DutyCycle of a
+// transmitter, telling when to try again. It matches ErrDutyCycleExceeded.
+type DutyCycleError struct {
+	Transmitter string
+	Airtime     time.Duration
+	RetryAfter  time.Duration
+}
+
+func (e *DutyCycleError) Error() string {
+	return fmt.Sprintf("%v: %v on air on %s, retry after %v", ErrDutyCycleExceeded, e.Airtime, e.Transmitter, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *DutyCycleError) Unwrap() error {
+	return ErrDutyCycleExceeded
+}
@@ -0,0 +1,69 @@
+package transmit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// DefaultMaxDurations are the MaxDurations used by a Scheduler when not
+// configured otherwise.
+var DefaultMaxDurations = MaxDurations{
+	types.OperationShock:   2 * time.Second,
+	types.OperationVibrate: 10 * time.Second,
+	types.OperationBeep:    5 * time.Second,
+}
+
+// MaxDurations maps Operations to the longest duration a Job with that
+// Operation may request. Operations not in the map are not limited.
+type MaxDurations map[types.Operation]time.Duration
+
+// Check returns ErrDurationExceeded if the given duration is longer than
+// allowed for the given Operation.
+func (m MaxDurations) Check(op types.Operation, d time.Duration) error {
+	if max, ok := m[op]; ok && d > max {
+		return fmt.Errorf("%w: %v requested for %v, maximum is %v", ErrDurationExceeded, d, op, max)
+	}
+
+	return nil
+}
+
+// String returns a string representation of the MaxDurations, in the same
+// format Set parses.
+func (m MaxDurations) String() string {
+	parts := make([]string, 0, len(m))
+	for op, d := range m {
+		parts = append(parts, fmt.Sprintf("%v=%v", op, d))
+	}
+
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// Set parses a comma separated list of "operation=duration" pairs into the
+// MaxDurations, e.g. "shock=2s,vibrate=10s".
+func (m MaxDurations) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		opString, durationString, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("%w: %q is not in operation=duration format", types.ErrUnparsable, part)
+		}
+
+		var op types.Operation
+		if err := op.Set(opString); err != nil {
+			return err
+		}
+
+		d, err := time.ParseDuration(durationString)
+		if err != nil {
+			return fmt.Errorf("error parsing duration for %v: %w", op, err)
+		}
+
+		m[op] = d
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package transmit
+
+import (
+	"fmt"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Priority defines in which order queued jobs are transmitted. Jobs with a
+// higher Priority are always transmitted before jobs with a lower one, jobs
+// with the same Priority are transmitted in the order they were submitted.
+type Priority uint8
+
+const (
+	// PriorityShock is the priority of shock jobs, the lowest there is.
+	PriorityShock Priority = iota
+
+	// PriorityVibrate is the priority of vibrate jobs.
+	PriorityVibrate
+
+	// PriorityBeep is the priority of beep jobs, the highest there is.
+	// Stopping is not queued at all, see Scheduler.Stop.
+	PriorityBeep
+)
+
+// PriorityFor returns the Priority jobs with the given Operation are queued
+// with.
+func PriorityFor(op types.Operation) Priority {
+	switch op {
+	case types.OperationBeep:
+		return PriorityBeep
+	case types.OperationVibrate:
+		return PriorityVibrate
+	default:
+		return PriorityShock
+	}
+}
+
+// String returns a string representation of the Priority.
+func (p Priority) String() string {
+	switch p {
+	case PriorityShock:
+		return "shock"
+	case PriorityVibrate:
+		return "vibrate"
+	case PriorityBeep:
+		return "beep"
+	default:
+		return fmt.Sprintf("unknown priority (%v)", int(p))
+	}
+}
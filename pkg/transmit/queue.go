@@ -0,0 +1,61 @@
+package transmit
+
+import (
+	"context"
+	"time"
+)
+
+// queuedJob is a Job waiting in a Scheduler queue, together with everything
+// needed to report back to the submitter.
+type queuedJob struct {
+	Job
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	seq       uint64
+	index     int
+	submitted time.Time
+
+	done chan error
+}
+
+// jobQueue implements heap.Interface, ordering jobs by Priority first and by
+// submission order second.
+type jobQueue []*queuedJob
+
+func (q jobQueue) Len() int {
+	return len(q)
+}
+
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].Priority != q[j].Priority {
+		return q[i].Priority > q[j].Priority
+	}
+
+	return q[i].seq < q[j].seq
+}
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x any) {
+	job := x.(*queuedJob)
+	job.index = len(*q)
+	*q = append(*q, job)
+}
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	n := len(old)
+
+	job := old[n-1]
+	old[n-1] = nil
+	job.index = -1
+
+	*q = old[:n-1]
+	return job
+}
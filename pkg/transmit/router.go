@@ -0,0 +1,220 @@
+package transmit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// Router routes Jobs to the Schedulers of several named transmitters, like
+// transmitters in different rooms or on different frequencies attached to
+// the same host. Jobs are sent on the transmitters named in
+// Job.Transmitters, on the default one if none are named.
+type Router struct {
+	schedulers []*Scheduler
+	byName     map[string]*Scheduler
+}
+
+// NewRouter creates a Router for the given Schedulers, the first one being
+// the default. ErrInvalidTransmitter is returned if there is none or names
+// are empty or used more than once.
+func NewRouter(schedulers ...*Scheduler) (*Router, error) {
+	if len(schedulers) == 0 {
+		return nil, fmt.Errorf("%w: no transmitters", ErrInvalidTransmitter)
+	}
+
+	r := &Router{
+		schedulers: schedulers,
+		byName:     make(map[string]*Scheduler, len(schedulers)),
+	}
+
+	for _, s := range schedulers {
+		if s.Name() == "" {
+			return nil, fmt.Errorf("%w: empty name", ErrInvalidTransmitter)
+		}
+
+		if _, ok := r.byName[s.Name()]; ok {
+			return nil, fmt.Errorf("%w: name %q used twice", ErrInvalidTransmitter, s.Name())
+		}
+
+		r.byName[s.Name()] = s
+	}
+
+	return r, nil
+}
+
+// Default returns the Scheduler of the default transmitter.
+func (r *Router) Default() *Scheduler {
+	return r.schedulers[0]
+}
+
+// Scheduler returns the Scheduler of the transmitter with the given name,
+// ErrUnknownTransmitter if there is none.
+func (r *Router) Scheduler(name string) (*Scheduler, error) {
+	s, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTransmitter, name)
+	}
+
+	return s, nil
+}
+
+// route returns the Schedulers of the transmitters the given Job is sent on.
+func (r *Router) route(job Job) ([]*Scheduler, error) {
+	if len(job.Transmitters) == 0 {
+		return []*Scheduler{r.Default()}, nil
+	}
+
+	ret := make([]*Scheduler, 0, len(job.Transmitters))
+	for _, name := range job.Transmitters {
+		s, err := r.Scheduler(name)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// MaxDuration returns the longest a Job with the given Operation may be
+// held for on every transmitter, false if not limited on any.
+func (r *Router) MaxDuration(op types.Operation) (time.Duration, bool) {
+	var (
+		ret     time.Duration
+		limited bool
+	)
+
+	for _, s := range r.schedulers {
+		if d, ok := s.MaxDuration(op); ok && (!limited || d < ret) {
+			ret, limited = d, true
+		}
+	}
+
+	return ret, limited
+}
+
+// Length returns how long the given Job takes to transmit on the slowest of
+// its transmitters, see Scheduler.Length. Unknown transmitters are ignored,
+// Check tells about them.
+func (r *Router) Length(job Job) time.Duration {
+	names := job.Transmitters
+	if len(names) == 0 {
+		names = []string{r.Default().Name()}
+	}
+
+	var ret time.Duration
+	for _, name := range names {
+		if s, ok := r.byName[name]; ok && s.Length(job) > ret {
+			ret = s.Length(job)
+		}
+	}
+
+	return ret
+}
+
+// Check returns the error Submit would return for the given Job without
+// queueing it, if it is not valid for any of its transmitters.
+func (r *Router) Check(job Job) error {
+	schedulers, err := r.route(job)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range schedulers {
+		if err := s.Check(job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Submit submits the given Job to the Schedulers of all its transmitters at
+// once and waits until they are done with it, see Scheduler.Submit. Sending
+// on several transmitters is for redundancy, so the Job succeeds if it was
+// transmitted by any of them, the error of the first transmitter is returned
+// if none did. Hooks set with WithStarted are called only once, checks set
+// with WithCheck by every transmitter starting the Job.
+func (r *Router) Submit(ctx context.Context, job Job) error {
+	schedulers, err := r.route(job)
+	if err != nil {
+		return err
+	}
+
+	if len(schedulers) == 1 {
+		return schedulers[0].Submit(ctx, job)
+	}
+
+	if started, ok := ctx.Value(startedKey{}).(func()); ok {
+		var once sync.Once
+		ctx = WithStarted(ctx, func() { once.Do(started) })
+	}
+
+	errs := make([]error, len(schedulers))
+
+	var wg sync.WaitGroup
+	for i, s := range schedulers {
+		i, s := i, s
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.Submit(ctx, job)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+
+	return errs[0]
+}
+
+// Stop stops all transmitters, see Scheduler.Stop.
+func (r *Router) Stop() {
+	for _, s := range r.schedulers {
+		s.Stop()
+	}
+}
+
+// StopChannel stops all jobs sending on the given Channel, on every
+// transmitter.
+func (r *Router) StopChannel(ch types.Channel) {
+	for _, s := range r.schedulers {
+		s.StopChannel(ch)
+	}
+}
+
+// StopRemote stops all jobs sent from the given remote on the given Channel,
+// on every transmitter.
+func (r *Router) StopRemote(remote types.RemoteID, ch types.Channel) {
+	for _, s := range r.schedulers {
+		s.StopRemote(remote, ch)
+	}
+}
+
+// Stats returns a snapshot of the state of every transmitter, the default one
+// first.
+func (r *Router) Stats() []Stats {
+	ret := make([]Stats, 0, len(r.schedulers))
+	for _, s := range r.schedulers {
+		ret = append(ret, s.Stats())
+	}
+
+	return ret
+}
+
+// Close closes the Schedulers of all transmitters.
+func (r *Router) Close() {
+	for _, s := range r.schedulers {
+		s.Close()
+	}
+}
@@ -0,0 +1,144 @@
+package transmit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// countingDriver counts the Messages it sent, failing with err if set.
+type countingDriver struct {
+	mu   sync.Mutex
+	sent int
+	err  error
+}
+
+func (d *countingDriver) Output(m *types.Message) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil {
+		return d.err
+	}
+
+	d.sent++
+	return nil
+}
+
+func (d *countingDriver) Sent() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.sent
+}
+
+var _ = Describe("Router", func() {
+	var (
+		livingRoom, bedroom *countingDriver
+		router              *transmit.Router
+	)
+
+	BeforeEach(func() {
+		livingRoom, bedroom = &countingDriver{}, &countingDriver{}
+
+		var err error
+		router, err = transmit.NewRouter(
+			transmit.NewScheduler("living-room", driver.Repeating(livingRoom, driver.Repetition{Count: 1}), transmit.Config{}),
+			transmit.NewScheduler("bedroom", driver.Repeating(bedroom, driver.Repetition{Count: 1}), transmit.Config{
+				MaxDurations: transmit.MaxDurations{types.OperationShock: time.Second},
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		router.Close()
+	})
+
+	job := func(transmitters ...string) transmit.Job {
+		return transmit.Job{
+			Message:      message(types.OperationBeep),
+			Transmitters: transmitters,
+		}
+	}
+
+	It("sends jobs without transmitters on the default one", func() {
+		Expect(router.Default().Name()).To(Equal("living-room"))
+		Expect(router.Submit(context.Background(), job())).To(Succeed())
+
+		Expect(livingRoom.Sent()).To(Equal(1))
+		Expect(bedroom.Sent()).To(Equal(0))
+	})
+
+	It("sends jobs on the transmitters named", func() {
+		Expect(router.Submit(context.Background(), job("bedroom"))).To(Succeed())
+
+		Expect(livingRoom.Sent()).To(Equal(0))
+		Expect(bedroom.Sent()).To(Equal(1))
+	})
+
+	It("sends jobs on all transmitters named for redundancy", func() {
+		bedroom.err = errors.New("broken")
+
+		var started atomic.Int32
+		ctx := transmit.WithStarted(context.Background(), func() { started.Add(1) })
+
+		Expect(router.Submit(ctx, job("living-room", "bedroom"))).To(Succeed())
+		Expect(livingRoom.Sent()).To(Equal(1))
+		Expect(started.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("returns the error of the first transmitter if none succeeded", func() {
+		livingRoom.err = errors.New("living room broken")
+		bedroom.err = errors.New("bedroom broken")
+
+		Expect(router.Submit(context.Background(), job("bedroom", "living-room"))).To(MatchError("bedroom broken"))
+	})
+
+	It("rejects jobs for unknown transmitters", func() {
+		Expect(router.Check(job("attic"))).To(MatchError(transmit.ErrUnknownTransmitter))
+		Expect(router.Submit(context.Background(), job("bedroom", "attic"))).To(MatchError(transmit.ErrUnknownTransmitter))
+		Expect(bedroom.Sent()).To(Equal(0))
+	})
+
+	It("checks jobs against the limits of all their transmitters", func() {
+		shock := transmit.Job{
+			Message:    message(types.OperationShock),
+			Repetition: driver.Repetition{Duration: 1500 * time.Millisecond},
+		}
+		Expect(router.Check(shock)).To(Succeed())
+
+		shock.Transmitters = []string{"living-room", "bedroom"}
+		Expect(router.Check(shock)).To(MatchError(transmit.ErrDurationExceeded))
+
+		max, limited := router.MaxDuration(types.OperationShock)
+		Expect(limited).To(BeTrue())
+		Expect(max).To(Equal(time.Second))
+	})
+
+	It("returns the stats of all transmitters", func() {
+		Expect(router.Stats()).To(HaveExactElements(
+			HaveField("Name", "living-room"),
+			HaveField("Name", "bedroom"),
+		))
+	})
+
+	It("rejects transmitters with the same name", func() {
+		s := transmit.NewScheduler("x", driver.Repeating(&countingDriver{}, driver.DefaultRepetition), transmit.Config{})
+		defer s.Close()
+
+		_, err := transmit.NewRouter(s, s)
+		Expect(err).To(MatchError(transmit.ErrInvalidTransmitter))
+
+		_, err = transmit.NewRouter()
+		Expect(err).To(MatchError(transmit.ErrInvalidTransmitter))
+	})
+})
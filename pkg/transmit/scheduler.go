@@ -0,0 +1,556 @@
+package transmit
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// DefaultQueueCapacity is the number of jobs a Scheduler queues when not
+// configured otherwise.
+const DefaultQueueCapacity = 16
+
+// Config holds the settings of a Scheduler.
+type Config struct {
+	// QueueCapacity is the number of jobs queued before rejecting new ones,
+	// DefaultQueueCapacity if <= 0.
+	QueueCapacity int
+
+	// MaxDurations limits the Repetition.Duration of jobs per Operation,
+	// DefaultMaxDurations if nil.
+	MaxDurations MaxDurations
+
+	// DutyCycle limits how long the transmitter is on air, if its driver
+	// is an AirtimeDriver.
+	DutyCycle DutyCycle
+
+	// Clock is the Clock on-air time and the time Jobs wait and take are
+	// tracked with, clock.Real if nil.
+	Clock clock.Clock
+
+	// DriverError, if set, is called by the worker with every Job the
+	// MessageDriver failed to transmit and its error, not for Jobs stopped
+	// or cancelled.
+	DriverError func(job Job, err error)
+
+	// Instrumentation is told how long Jobs wait and take and how long they
+	// are on air, instrument.Nop if nil.
+	Instrumentation instrument.Instrumentation
+}
+
+// Job is a single transmission handed to a Scheduler: a Message sent as
+// described by Repetition without any other Message in between. Zero values
+// in Repetition are filled with the defaults of the MessageDriver.
+//
+// To hold an operation for some time, like keeping a button on the remote
+// pressed, set Repetition.Duration. Cancelling the context given to
+// Scheduler.Submit releases it early.
+type Job struct {
+	Message    *types.Message
+	Priority   Priority
+	Repetition driver.Repetition
+
+	// Interleaved are further Messages sent together with Message, a frame
+	// of each in turn, like for all devices of a group sharing a
+	// transmitter. They are sent with the Priority and Repetition of the
+	// Job.
+	Interleaved []*types.Message
+
+	// Transmitters are the names of the transmitters a Router sends the
+	// Job on, the default one if empty. Ignored by Scheduler.
+	Transmitters []string
+}
+
+type startedKey struct{}
+
+// WithStarted returns a copy of ctx making Submit call f when the worker
+// starts transmitting the Job submitted with it, to tell queued Jobs from
+// those on air.
+func WithStarted(ctx context.Context, f func()) context.Context {
+	return context.WithValue(ctx, startedKey{}, f)
+}
+
+type checkKey struct{}
+
+// WithCheck returns a copy of ctx making the worker call f right before it
+// starts transmitting the Job submitted with it, after it waited in the
+// queue, failing it with ErrRejected and the error returned if that is not
+// nil. For checks of things that may change while the Job is queued, like
+// safewords.
+func WithCheck(ctx context.Context, f func() error) context.Context {
+	return context.WithValue(ctx, checkKey{}, f)
+}
+
+// Stats is a snapshot of the state of a Scheduler.
+type Stats struct {
+	Name          string        `json:"name"`
+	QueueDepth    int           `json:"queueDepth"`
+	QueueCapacity int           `json:"queueCapacity"`
+	Transmitting  bool          `json:"transmitting"`
+	Transmitted   uint64        `json:"transmitted"`
+	Failed        uint64        `json:"failed"`
+	Rejected      uint64        `json:"rejected"`
+	LastWait      time.Duration `json:"lastWait"`
+	AverageWait   time.Duration `json:"averageWait"`
+	MaxWait       time.Duration `json:"maxWait"`
+
+	// Airtime is the time on air in the current DutyCycle window,
+	// AirtimeBudget the time allowed, 0 if not limited. DutyCycle is the
+	// share of the window on air, TotalAirtime the time on air since the
+	// Scheduler was created. All of them are 0 for drivers not being an
+	// AirtimeDriver. Delayed counts the Jobs held back for the DutyCycle.
+	Airtime       time.Duration `json:"airtime"`
+	AirtimeBudget time.Duration `json:"airtimeBudget,omitempty"`
+	DutyCycle     float64       `json:"dutyCycle"`
+	TotalAirtime  time.Duration `json:"totalAirtime"`
+	Delayed       uint64        `json:"delayed"`
+}
+
+// Scheduler serializes all transmissions for a single physical transmitter.
+// Jobs are queued by Priority and handed to the MessageDriver by a single
+// worker, so frames of concurrent requests never interleave on air.
+type Scheduler struct {
+	name         string
+	driver       driver.RepeatingMessageDriver
+	capacity     int
+	maxDurations MaxDurations
+	dutyCycle    DutyCycle
+	clock        clock.Clock
+	driverError  func(Job, error)
+	instrument   instrument.Instrumentation
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   jobQueue
+	current *queuedJob
+	seq     uint64
+	closed  bool
+
+	transmitted uint64
+	failed      uint64
+	rejected    uint64
+	lastWait    time.Duration
+	totalWait   time.Duration
+	maxWait     time.Duration
+
+	airtime      airtimeLog
+	totalAirtime time.Duration
+	delayed      uint64
+
+	stopped chan struct{}
+}
+
+// NewScheduler creates a Scheduler for the given MessageDriver and starts its
+// worker.
+func NewScheduler(name string, d driver.RepeatingMessageDriver, config Config) *Scheduler {
+	if config.QueueCapacity <= 0 {
+		config.QueueCapacity = DefaultQueueCapacity
+	}
+
+	if config.MaxDurations == nil {
+		config.MaxDurations = DefaultMaxDurations
+	}
+
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+
+	s := &Scheduler{
+		name:         name,
+		driver:       d,
+		capacity:     config.QueueCapacity,
+		maxDurations: config.MaxDurations,
+		dutyCycle:    config.DutyCycle,
+		clock:        config.Clock,
+		driverError:  config.DriverError,
+		instrument:   instrument.Or(config.Instrumentation),
+		airtime:      airtimeLog{window: config.DutyCycle.window()},
+		stopped:      make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	go s.work()
+
+	return s
+}
+
+// Name returns the name of the transmitter this Scheduler is serving.
+func (s *Scheduler) Name() string {
+	return s.name
+}
+
+// MaxDuration returns the longest a Job with the given Operation may be
+// held for, false if not limited.
+func (s *Scheduler) MaxDuration(op types.Operation) (time.Duration, bool) {
+	d, ok := s.maxDurations[op]
+	return d, ok
+}
+
+// Submit queues the given Job and waits until it is transmitted, returning
+// the error of the MessageDriver, if any. ErrQueueFull is returned right away
+// if the queue is at capacity and ErrDurationExceeded if the Job takes
+// longer than allowed for its Operation, see Length. Jobs exceeding the DutyCycle are
+// held back until enough of its budget is free again, up to its MaxDelay,
+// and rejected with a DutyCycleError otherwise. When ctx is done before the
+// Job was transmitted, it is removed from the queue or interrupted between
+// frames and the context error is returned.
+func (s *Scheduler) Submit(ctx context.Context, job Job) error {
+	if err := s.Check(job); err != nil {
+		return err
+	}
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	queued := &queuedJob{
+		Job:       job,
+		ctx:       jobCtx,
+		cancel:    cancel,
+		submitted: s.clock.Now(),
+		done:      make(chan error, 1),
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+
+	if len(s.queue) >= s.capacity {
+		s.rejected++
+		s.mu.Unlock()
+		return ErrQueueFull
+	}
+
+	if wait := s.airtimeWaitLocked(job); wait > s.dutyCycle.MaxDelay {
+		s.rejected++
+		s.mu.Unlock()
+		return s.dutyCycleError(job, wait)
+	}
+
+	s.seq++
+	queued.seq = s.seq
+	heap.Push(&s.queue, queued)
+	s.cond.Signal()
+	s.mu.Unlock()
+
+	select {
+	case err := <-queued.done:
+		return err
+	case <-jobCtx.Done():
+	}
+
+	s.mu.Lock()
+	if queued.index >= 0 {
+		heap.Remove(&s.queue, queued.index)
+		s.mu.Unlock()
+		return context.Cause(jobCtx)
+	}
+	s.mu.Unlock()
+
+	// already picked up by the worker, which checks the context between
+	// frames and reports back
+	return <-queued.done
+}
+
+// Check returns the error Submit would return for the given Job without
+// queueing it, if it is not valid for this Scheduler.
+func (s *Scheduler) Check(job Job) error {
+	if job.Message == nil {
+		return ErrInvalidJob
+	}
+
+	for _, m := range job.Interleaved {
+		if m == nil {
+			return ErrInvalidJob
+		}
+	}
+
+	op, _, err := job.Message.GetOperation()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+
+	if err := job.Repetition.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+
+	if err := s.maxDurations.Check(op, s.Length(job)); err != nil {
+		return err
+	}
+
+	if budget := s.dutyCycle.budget(); budget > 0 && s.jobAirtime(job) > budget {
+		return fmt.Errorf("%w: %v on air requested, %s may only be on air for %v per %v", ErrDurationExceeded, s.jobAirtime(job), s.name, budget, s.dutyCycle.window())
+	}
+
+	return nil
+}
+
+// Length returns how long the given Job takes to transmit, with the
+// Repetition filled with the defaults of the MessageDriver, however it is
+// held: for its Duration or for a number of frames.
+func (s *Scheduler) Length(job Job) time.Duration {
+	return s.driver.Length(append([]*types.Message{job.Message}, job.Interleaved...), job.Repetition)
+}
+
+// jobAirtime returns how long the given Job is on air, 0 if the driver is
+// no AirtimeDriver.
+func (s *Scheduler) jobAirtime(job Job) time.Duration {
+	d, ok := s.driver.(driver.AirtimeDriver)
+	if !ok {
+		return 0
+	}
+
+	return d.Airtime(append([]*types.Message{job.Message}, job.Interleaved...), job.Repetition)
+}
+
+// airtimeWaitLocked returns how long the given Job has to wait for enough of
+// the DutyCycle budget to be free, s.mu has to be locked.
+func (s *Scheduler) airtimeWaitLocked(job Job) time.Duration {
+	budget := s.dutyCycle.budget()
+	if budget <= 0 {
+		return 0
+	}
+
+	return s.airtime.wait(s.clock.Now(), s.jobAirtime(job), budget)
+}
+
+func (s *Scheduler) dutyCycleError(job Job, wait time.Duration) error {
+	return &DutyCycleError{
+		Transmitter: s.name,
+		Airtime:     s.jobAirtime(job),
+		RetryAfter:  wait,
+	}
+}
+
+// awaitAirtime waits until the given Job fits into the DutyCycle and records
+// its on-air time, returning a DutyCycleError if it has to wait longer than
+// MaxDelay or the cause of its context if that is done before.
+func (s *Scheduler) awaitAirtime(job *queuedJob) error {
+	for delayed := false; ; delayed = true {
+		if job.ctx.Err() != nil {
+			return context.Cause(job.ctx)
+		}
+
+		s.mu.Lock()
+		wait := s.airtimeWaitLocked(job.Job)
+		if wait == 0 {
+			airtime := s.jobAirtime(job.Job)
+			s.airtime.add(s.clock.Now(), airtime)
+			s.totalAirtime += airtime
+			if delayed {
+				s.delayed++
+			}
+			s.mu.Unlock()
+
+			if airtime > 0 {
+				s.instrument.OnAir(s.name, airtime)
+			}
+
+			return nil
+		}
+		s.mu.Unlock()
+
+		if wait > s.dutyCycle.MaxDelay {
+			return s.dutyCycleError(job.Job, wait)
+		}
+
+		timer := s.clock.NewTimer(wait)
+		select {
+		case <-job.ctx.Done():
+			timer.Stop()
+			return context.Cause(job.ctx)
+		case <-timer.C():
+		}
+	}
+}
+
+// Stop discards all queued jobs and interrupts the one currently being
+// transmitted after its current frame. Submitters of those jobs get
+// ErrStopped.
+func (s *Scheduler) Stop() {
+	s.stop(func(*queuedJob) bool { return true })
+}
+
+// StopChannel is like Stop, but only for jobs sending on the given Channel.
+// Jobs with Interleaved Messages are stopped as a whole if any of their
+// Messages is sent on it.
+func (s *Scheduler) StopChannel(ch types.Channel) {
+	s.stop(sending(func(m *types.Message) bool {
+		jobChannel, _, _ := m.GetChannel()
+		return jobChannel == ch
+	}))
+}
+
+// StopRemote is like StopChannel, but only for jobs sent from the given
+// remote, reaching the devices paired with it only.
+func (s *Scheduler) StopRemote(remote types.RemoteID, ch types.Channel) {
+	s.stop(sending(func(m *types.Message) bool {
+		jobChannel, _, _ := m.GetChannel()
+		return jobChannel == ch && m.GetRemoteID() == remote
+	}))
+}
+
+// sending returns a function matching jobs with any Message matched by the
+// given function.
+func sending(match func(*types.Message) bool) func(*queuedJob) bool {
+	return func(job *queuedJob) bool {
+		for _, m := range append([]*types.Message{job.Message}, job.Interleaved...) {
+			if match(m) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func (s *Scheduler) stop(match func(*queuedJob) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.queue {
+		if match(job) {
+			job.cancel(ErrStopped)
+		}
+	}
+
+	if s.current != nil && match(s.current) {
+		s.current.cancel(ErrStopped)
+	}
+}
+
+// Close stops the worker after the job currently transmitted, failing all
+// jobs still queued with ErrClosed.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+
+	s.closed = true
+	for _, job := range s.queue {
+		job.cancel(ErrClosed)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	<-s.stopped
+}
+
+// Stats returns a snapshot of the current state of the Scheduler.
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := Stats{
+		Name:          s.name,
+		QueueDepth:    len(s.queue),
+		QueueCapacity: s.capacity,
+		Transmitting:  s.current != nil,
+		Transmitted:   s.transmitted,
+		Failed:        s.failed,
+		Rejected:      s.rejected,
+		LastWait:      s.lastWait,
+		MaxWait:       s.maxWait,
+	}
+
+	if handled := s.transmitted + s.failed; handled > 0 {
+		ret.AverageWait = s.totalWait / time.Duration(handled)
+	}
+
+	ret.Airtime = s.airtime.usedAt(s.clock.Now())
+	ret.AirtimeBudget = s.dutyCycle.budget()
+	ret.DutyCycle = float64(ret.Airtime) / float64(s.airtime.window)
+	ret.TotalAirtime = s.totalAirtime
+	ret.Delayed = s.delayed
+
+	return ret
+}
+
+func (s *Scheduler) work() {
+	defer close(s.stopped)
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+
+		job := heap.Pop(&s.queue).(*queuedJob)
+		s.current = job
+
+		wait := s.clock.Now().Sub(job.submitted)
+		s.lastWait = wait
+		s.totalWait += wait
+		if wait > s.maxWait {
+			s.maxWait = wait
+		}
+		s.mu.Unlock()
+
+		s.instrument.QueueWait(s.name, wait)
+
+		err := s.awaitAirtime(job)
+		if check, ok := job.ctx.Value(checkKey{}).(func() error); ok && err == nil {
+			if checkErr := check(); checkErr != nil {
+				err = fmt.Errorf("%w: %w", ErrRejected, checkErr)
+			}
+		}
+
+		if err == nil {
+			if started, ok := job.ctx.Value(startedKey{}).(func()); ok {
+				started()
+			}
+
+			err = s.transmit(job)
+		}
+
+		s.mu.Lock()
+		s.current = nil
+		switch {
+		case errors.Is(err, ErrDutyCycleExceeded) || errors.Is(err, ErrRejected):
+			s.rejected++
+		case err != nil:
+			s.failed++
+		default:
+			s.transmitted++
+		}
+		s.mu.Unlock()
+
+		if err == nil {
+			s.instrument.TransmitLatency(s.name, s.clock.Now().Sub(job.submitted))
+		}
+
+		if err != nil && job.ctx.Err() == nil && !errors.Is(err, ErrDutyCycleExceeded) && !errors.Is(err, ErrRejected) && s.driverError != nil {
+			s.driverError(job.Job, err)
+		}
+
+		job.done <- err
+	}
+}
+
+func (s *Scheduler) transmit(job *queuedJob) error {
+	if job.ctx.Err() != nil {
+		return context.Cause(job.ctx)
+	}
+
+	if len(job.Interleaved) > 0 {
+		return s.driver.OutputInterleaved(job.ctx, append([]*types.Message{job.Message}, job.Interleaved...), job.Repetition)
+	}
+
+	return s.driver.OutputRepeated(job.ctx, job.Message, job.Repetition)
+}
@@ -0,0 +1,425 @@
+package transmit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/clock"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/driver"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/instrument"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/transmit"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+// recordingDriver records all operations it was asked to send and blocks on
+// every Output call until something is received on release.
+type recordingDriver struct {
+	mu      sync.Mutex
+	sent    []types.Operation
+	release chan struct{}
+	err     error
+}
+
+func (d *recordingDriver) Output(m *types.Message) error {
+	<-d.release
+
+	op, _, _ := m.GetOperation()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sent = append(d.sent, op)
+	return d.err
+}
+
+func (d *recordingDriver) Sent() []types.Operation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]types.Operation(nil), d.sent...)
+}
+
+// recordingInstrumentation records the durations reported by a Scheduler.
+type recordingInstrumentation struct {
+	instrument.Nop
+
+	mu        sync.Mutex
+	waits     []time.Duration
+	latencies []time.Duration
+	airtime   time.Duration
+}
+
+func (i *recordingInstrumentation) QueueWait(transmitter string, wait time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.waits = append(i.waits, wait)
+}
+
+func (i *recordingInstrumentation) TransmitLatency(transmitter string, latency time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.latencies = append(i.latencies, latency)
+}
+
+func (i *recordingInstrumentation) OnAir(transmitter string, airtime time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.airtime += airtime
+}
+
+func (i *recordingInstrumentation) Latencies() []time.Duration {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]time.Duration(nil), i.latencies...)
+}
+
+func (i *recordingInstrumentation) Waits() []time.Duration {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]time.Duration(nil), i.waits...)
+}
+
+func (i *recordingInstrumentation) Airtime() time.Duration {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.airtime
+}
+
+func message(op types.Operation) *types.Message {
+	return types.NewMessage().
+		SetOperation(op).
+		Build()
+}
+
+var _ = Describe("Scheduler", func() {
+	var (
+		drv             *recordingDriver
+		fake            *clock.Fake
+		driverErrors    chan error
+		instrumentation *recordingInstrumentation
+		scheduler       *transmit.Scheduler
+	)
+
+	BeforeEach(func() {
+		drv = &recordingDriver{release: make(chan struct{})}
+		fake = clock.NewFake(time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+		driverErrors = make(chan error, 1)
+		instrumentation = &recordingInstrumentation{}
+		scheduler = transmit.NewScheduler("test", driver.Repeating(drv, driver.DefaultRepetition), transmit.Config{
+			QueueCapacity: 3,
+			DriverError: func(job transmit.Job, err error) {
+				driverErrors <- err
+			},
+			Instrumentation: instrumentation,
+			Clock:           fake,
+		})
+	})
+
+	AfterEach(func() {
+		close(drv.release)
+		scheduler.Close()
+	})
+
+	submit := func(op types.Operation, repeat int) chan error {
+		ret := make(chan error, 1)
+		go func() {
+			ret <- scheduler.Submit(context.Background(), transmit.Job{
+				Message:  message(op),
+				Priority: transmit.PriorityFor(op),
+				Repetition: driver.Repetition{
+					Count: repeat,
+				},
+			})
+		}()
+		return ret
+	}
+
+	It("transmits all repetitions of a job without interleaving", func() {
+		first := submit(types.OperationShock, 2)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeTrue()))
+
+		second := submit(types.OperationShock, 2)
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+
+		for i := 0; i < 4; i++ {
+			drv.release <- struct{}{}
+		}
+
+		Eventually(first).Should(Receive(BeNil()))
+		Eventually(second).Should(Receive(BeNil()))
+		Expect(scheduler.Stats().Transmitted).To(BeEquivalentTo(2))
+	})
+
+	It("transmits queued jobs by priority", func() {
+		blocker := submit(types.OperationShock, 1)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeTrue()))
+
+		shock := submit(types.OperationShock, 1)
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+		vibrate := submit(types.OperationVibrate, 1)
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 2))
+		beep := submit(types.OperationBeep, 1)
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 3))
+
+		for i := 0; i < 4; i++ {
+			drv.release <- struct{}{}
+		}
+
+		for _, c := range []chan error{blocker, shock, vibrate, beep} {
+			Eventually(c).Should(Receive(BeNil()))
+		}
+
+		Expect(drv.Sent()).To(Equal([]types.Operation{
+			types.OperationShock,
+			types.OperationBeep,
+			types.OperationVibrate,
+			types.OperationShock,
+		}))
+	})
+
+	It("rejects jobs when the queue is full", func() {
+		submit(types.OperationBeep, 1)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeTrue()))
+
+		for i := 0; i < 3; i++ {
+			submit(types.OperationBeep, 1)
+			Eventually(scheduler.Stats).Should(HaveField("QueueDepth", i+1))
+		}
+
+		Eventually(submit(types.OperationBeep, 1)).Should(Receive(MatchError(transmit.ErrQueueFull)))
+		Expect(scheduler.Stats().Rejected).To(BeEquivalentTo(1))
+	})
+
+	It("discards queued jobs on Stop", func() {
+		current := submit(types.OperationVibrate, 3)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeTrue()))
+
+		queued := submit(types.OperationShock, 1)
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+
+		scheduler.Stop()
+		drv.release <- struct{}{}
+
+		Eventually(current).Should(Receive(MatchError(transmit.ErrStopped)))
+		Eventually(queued).Should(Receive(MatchError(transmit.ErrStopped)))
+		Expect(drv.Sent()).To(HaveLen(1))
+	})
+
+	It("rejects jobs held longer than allowed", func() {
+		err := scheduler.Submit(context.Background(), transmit.Job{
+			Message: message(types.OperationShock),
+			Repetition: driver.Repetition{
+				Duration: transmit.DefaultMaxDurations[types.OperationShock] + time.Millisecond,
+			},
+		})
+
+		Expect(err).To(MatchError(transmit.ErrDurationExceeded))
+	})
+
+	It("rejects jobs sending frames for longer than allowed", func() {
+		job := transmit.Job{
+			Message:    message(types.OperationShock),
+			Repetition: driver.Repetition{Count: 60},
+		}
+
+		Expect(scheduler.Length(job)).To(Equal(60 * driver.AssumedFrameTime))
+		Expect(scheduler.Submit(context.Background(), job)).To(MatchError(transmit.ErrDurationExceeded))
+
+		job.Repetition = driver.Repetition{Gap: time.Second}
+		Expect(scheduler.Submit(context.Background(), job)).To(MatchError(transmit.ErrDurationExceeded))
+	})
+
+	It("rejects jobs waiting longer between frames than allowed", func() {
+		err := scheduler.Submit(context.Background(), transmit.Job{
+			Message:    message(types.OperationBeep),
+			Repetition: driver.Repetition{Gap: time.Hour},
+		})
+
+		Expect(err).To(MatchError(transmit.ErrInvalidJob))
+	})
+
+	It("stops jobs only on the given channel with StopChannel", func() {
+		blocker := submit(types.OperationBeep, 1)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeTrue()))
+
+		channel2 := make(chan error, 1)
+		go func() {
+			channel2 <- scheduler.Submit(context.Background(), transmit.Job{
+				Message: types.NewMessage().
+					SetChannel(types.Channel2).
+					Build(),
+			})
+		}()
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+
+		channel1 := submit(types.OperationBeep, 1)
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 2))
+
+		scheduler.StopChannel(types.Channel2)
+		Eventually(channel2).Should(Receive(MatchError(transmit.ErrStopped)))
+
+		drv.release <- struct{}{}
+		drv.release <- struct{}{}
+		Eventually(blocker).Should(Receive(BeNil()))
+		Eventually(channel1).Should(Receive(BeNil()))
+	})
+
+	It("stops jobs only from the given remote with StopRemote", func() {
+		blocker := submit(types.OperationBeep, 3)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeTrue()))
+
+		other := make(chan error, 1)
+		go func() {
+			other <- scheduler.Submit(context.Background(), transmit.Job{
+				Message: types.NewMessage().
+					SetChannel(types.Channel1).
+					Build().
+					SetRemoteID(0b11111111111111111),
+				Repetition: driver.Repetition{Count: 1},
+			})
+		}()
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+
+		defaultRemote := submit(types.OperationBeep, 1)
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 2))
+
+		scheduler.StopRemote(types.DefaultRemoteID, types.Channel1)
+		Eventually(defaultRemote).Should(Receive(MatchError(transmit.ErrStopped)))
+
+		drv.release <- struct{}{}
+		Eventually(blocker).Should(Receive(MatchError(transmit.ErrStopped)))
+
+		drv.release <- struct{}{}
+		Eventually(other).Should(Receive(BeNil()))
+	})
+
+	It("transmits interleaved messages in turn", func() {
+		job := make(chan error, 1)
+		go func() {
+			job <- scheduler.Submit(context.Background(), transmit.Job{
+				Message:     message(types.OperationBeep),
+				Interleaved: []*types.Message{message(types.OperationVibrate)},
+				Repetition:  driver.Repetition{Count: 2},
+			})
+		}()
+
+		for i := 0; i < 4; i++ {
+			drv.release <- struct{}{}
+		}
+
+		Eventually(job).Should(Receive(BeNil()))
+		Expect(drv.Sent()).To(Equal([]types.Operation{
+			types.OperationBeep,
+			types.OperationVibrate,
+			types.OperationBeep,
+			types.OperationVibrate,
+		}))
+	})
+
+	It("tells when it starts transmitting a job", func() {
+		blocker := submit(types.OperationBeep, 1)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeTrue()))
+
+		started := make(chan struct{})
+		ctx := transmit.WithStarted(context.Background(), func() { close(started) })
+
+		job := make(chan error, 1)
+		go func() {
+			job <- scheduler.Submit(ctx, transmit.Job{Message: message(types.OperationBeep)})
+		}()
+
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+		Consistently(started).ShouldNot(BeClosed())
+
+		drv.release <- struct{}{}
+		Eventually(blocker).Should(Receive(BeNil()))
+		Eventually(started).Should(BeClosed())
+	})
+
+	It("checks jobs again when starting to transmit them", func() {
+		blocker := submit(types.OperationBeep, 1)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", BeTrue()))
+
+		var (
+			mu       sync.Mutex
+			safeword error
+		)
+		ctx := transmit.WithCheck(context.Background(), func() error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return safeword
+		})
+
+		job := make(chan error, 1)
+		go func() {
+			job <- scheduler.Submit(ctx, transmit.Job{Message: message(types.OperationShock)})
+		}()
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+
+		mu.Lock()
+		safeword = errors.New("red")
+		mu.Unlock()
+
+		drv.release <- struct{}{}
+		Eventually(blocker).Should(Receive(BeNil()))
+		Eventually(job).Should(Receive(SatisfyAll(MatchError(transmit.ErrRejected), MatchError(ContainSubstring("red")))))
+
+		Expect(drv.Sent()).To(Equal([]types.Operation{types.OperationBeep}))
+		Expect(scheduler.Stats().Rejected).To(BeEquivalentTo(1))
+		Expect(driverErrors).NotTo(Receive())
+	})
+
+	It("reports driver errors", func() {
+		drv.err = errors.New("broken")
+
+		job := submit(types.OperationBeep, 1)
+		drv.release <- struct{}{}
+
+		Eventually(job).Should(Receive(MatchError("broken")))
+		Expect(scheduler.Stats().Failed).To(BeEquivalentTo(1))
+		Expect(driverErrors).To(Receive(MatchError("broken")))
+	})
+
+	It("reports how long jobs wait and take", func() {
+		blocker := submit(types.OperationBeep, 1)
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", true))
+
+		queued := submit(types.OperationVibrate, 1)
+		Eventually(scheduler.Stats).Should(HaveField("QueueDepth", 1))
+		fake.Advance(20 * time.Millisecond)
+
+		drv.release <- struct{}{}
+		Eventually(blocker).Should(Receive(BeNil()))
+		Eventually(scheduler.Stats).Should(HaveField("Transmitting", true))
+		fake.Advance(5 * time.Millisecond)
+
+		drv.release <- struct{}{}
+		Eventually(queued).Should(Receive(BeNil()))
+
+		Eventually(instrumentation.Latencies).Should(HaveLen(2))
+		Expect(instrumentation.Waits()).To(Equal([]time.Duration{0, 20 * time.Millisecond}))
+		Expect(instrumentation.Latencies()).To(Equal([]time.Duration{20 * time.Millisecond, 25 * time.Millisecond}))
+	})
+
+	It("does not report the latency of failed jobs", func() {
+		drv.err = errors.New("broken")
+
+		job := submit(types.OperationBeep, 1)
+		drv.release <- struct{}{}
+
+		Eventually(job).Should(Receive(MatchError("broken")))
+		Expect(instrumentation.Waits()).To(HaveLen(1))
+		Expect(instrumentation.Latencies()).To(BeEmpty())
+	})
+})
@@ -42,3 +42,20 @@ func (ch *Channel) Set(s string) error {
 
 	return nil
 }
+
+// MarshalText implements encoding.TextMarshaler, using the same
+// representation as String.
+func (ch Channel) MarshalText() ([]byte, error) {
+	switch ch {
+	case Channel1, Channel2:
+		return []byte(ch.String()), nil
+	default:
+		return nil, ErrUnknownChannel
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting the same
+// values as Set.
+func (ch *Channel) UnmarshalText(text []byte) error {
+	return ch.Set(string(text))
+}
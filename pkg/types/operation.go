@@ -47,3 +47,20 @@ func (op *Operation) Set(s string) error {
 
 	return nil
 }
+
+// MarshalText implements encoding.TextMarshaler, using the same
+// representation as String.
+func (op Operation) MarshalText() ([]byte, error) {
+	switch op {
+	case OperationShock, OperationVibrate, OperationBeep:
+		return []byte(op.String()), nil
+	default:
+		return nil, ErrUnknownOperation
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting the same
+// values as Set.
+func (op *Operation) UnmarshalText(text []byte) error {
+	return op.Set(string(text))
+}
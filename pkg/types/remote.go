@@ -0,0 +1,89 @@
+package types
+
+import "fmt"
+
+// RemoteID identifies the remote a Message is sent from, shockers only act
+// on Messages from the remote they are paired with. It is the part of the
+// Message not fully understood yet, see the documentation of Message.
+type RemoteID uint32
+
+// remoteIDBits is the length of a RemoteID in a Message.
+const remoteIDBits = len(messageUnknown)
+
+// DefaultRemoteID is the RemoteID set by Message.Build.
+var DefaultRemoteID = func() RemoteID {
+	var ret RemoteID
+	if err := ret.Set(messageUnknown); err != nil {
+		panic(err)
+	}
+
+	return ret
+}()
+
+// String returns the RemoteID as string of bits, as sent in the Message.
+func (id RemoteID) String() string {
+	ret := make([]bool, remoteIDBits)
+	for i := range ret {
+		ret[i] = (id >> (remoteIDBits - 1 - i) & 1) == 1
+	}
+
+	return bitstring(ret)
+}
+
+// Set parses the given string of bits into the RemoteID this method is
+// called on, returning an error if it cannot be parsed.
+func (id *RemoteID) Set(s string) error {
+	if len(s) != remoteIDBits {
+		return fmt.Errorf("%w: remote ID must be %d bits, got %d", ErrUnparsable, remoteIDBits, len(s))
+	}
+
+	var ret RemoteID
+	for _, c := range s {
+		switch c {
+		case '0':
+			ret <<= 1
+		case '1':
+			ret = ret<<1 | 1
+		default:
+			return fmt.Errorf("%w: remote ID must only contain 0 and 1", ErrUnparsable)
+		}
+	}
+
+	*id = ret
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, using the same
+// representation as String.
+func (id RemoteID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting the same
+// values as Set.
+func (id *RemoteID) UnmarshalText(text []byte) error {
+	return id.Set(string(text))
+}
+
+// SetRemoteID sets the RemoteID the Message is sent from, returning the
+// Message so you can use this as a Builder-pattern method. As Build sets the
+// DefaultRemoteID, it has to be called after Build.
+func (m *Message) SetRemoteID(id RemoteID) *Message {
+	for i := 0; i < remoteIDBits; i++ {
+		m[9+i] = (id >> (remoteIDBits - 1 - i) & 1) == 1
+	}
+
+	return m
+}
+
+// GetRemoteID extracts the RemoteID from the Message.
+func (m Message) GetRemoteID() RemoteID {
+	var ret RemoteID
+	for i := 0; i < remoteIDBits; i++ {
+		if m[9+i] {
+			ret |= 1 << (remoteIDBits - 1 - i)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,41 @@
+package types_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"praios.lf-net.org/littlefox/gotoshock/pkg/types"
+)
+
+var _ = Describe("RemoteID", func() {
+	It("is set by Build by default", func() {
+		msg := types.NewMessage().Build()
+
+		Expect(types.DefaultRemoteID.String()).To(Equal("00101110001010110"))
+		Expect(msg.GetRemoteID()).To(Equal(types.DefaultRemoteID))
+	})
+
+	It("parses strings of bits", func() {
+		var id types.RemoteID
+		Expect(id.Set("10111010010101110")).To(Succeed())
+		Expect(id.String()).To(Equal("10111010010101110"))
+
+		Expect(id.Set("1011101001010111")).To(MatchError(types.ErrUnparsable))
+		Expect(id.Set("1011101001010111x")).To(MatchError(types.ErrUnparsable))
+	})
+
+	It("is set on Messages", func() {
+		var id types.RemoteID
+		Expect(id.Set("10111010010101110")).To(Succeed())
+
+		msg := types.NewMessage().
+			SetChannel(types.Channel2).
+			SetOperation(types.OperationVibrate).
+			SetIntensity(40).
+			Build().
+			SetRemoteID(id)
+
+		Expect(msg.GetRemoteID()).To(Equal(id))
+		Expect(msg.String()).To(Equal("01" + "1110" + "010" + "10111010010101110" + "0101000" + "101" + "1000" + "00"))
+		Expect(msg.GetIntensity()).To(BeEquivalentTo(40))
+	})
+})